@@ -0,0 +1,313 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+var (
+	ErrInvalidAddress    = errors.New("invalid address")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrUnsupportedChain  = errors.New("unsupported chain")
+
+	// Cosmos address errors also wrap ErrInvalidAddress.
+	ErrAddressPrefix = errors.New("address prefix not allowed")
+	ErrAddressLength = errors.New("unexpected address length")
+)
+
+// AddressCodec derives a chain's public key from a raw private key and
+// encodes, or validates, addresses in the chain's native format.
+type AddressCodec interface {
+	PublicKey(privateKey []byte) ([]byte, error)
+	EncodeAddress(publicKey []byte) (string, error)
+	ValidateAddress(address string) error
+}
+
+// GetAddressCodec returns the codec of chain in the default registry.
+func GetAddressCodec(chain string) (AddressCodec, error) {
+	config, err := DefaultChainRegistry().Get(chain)
+	if err != nil {
+		return nil, err
+	}
+	return config.Codec(), nil
+}
+
+// parsePrivateKeyHex accepts a hex private key with or without a 0x prefix.
+func parsePrivateKeyHex(privateKey string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(privateKey), "0x"))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	return key, nil
+}
+
+// secp256k1PublicKey returns the compressed public key for a 32-byte scalar.
+func secp256k1PublicKey(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != 32 || !validSecp256k1Scalar(privateKey) {
+		return nil, ErrInvalidPrivateKey
+	}
+	return secp256k1.PrivKeyFromBytes(privateKey).PubKey().SerializeCompressed(), nil
+}
+
+// BitcoinCodec encodes P2PKH addresses, P2WPKH when Segwit is set or
+// P2SH-wrapped P2WPKH when NestedSegwit is set, for Bitcoin and its forks.
+// Validation accepts P2PKH, P2SH and P2WPKH.
+type BitcoinCodec struct {
+	PubKeyHashVersion byte
+	ScriptHashVersion byte
+	SegwitHRP         string
+	Segwit            bool
+	NestedSegwit      bool
+}
+
+func (c *BitcoinCodec) PublicKey(privateKey []byte) ([]byte, error) {
+	return secp256k1PublicKey(privateKey)
+}
+
+func (c *BitcoinCodec) EncodeAddress(publicKey []byte) (string, error) {
+	if _, err := secp256k1.ParsePubKey(publicKey); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	if c.Segwit {
+		if c.SegwitHRP == "" {
+			return "", fmt.Errorf("%w: segwit not supported", ErrInvalidAddress)
+		}
+		program, err := convertBits(hash160(publicKey), 8, 5, true)
+		if err != nil {
+			return "", err
+		}
+		return bech32Encode(c.SegwitHRP, append([]byte{0}, program...)), nil
+	}
+	if c.NestedSegwit {
+		redeemScript := append([]byte{0x00, 0x14}, hash160(publicKey)...)
+		return base58CheckEncode([]byte{c.ScriptHashVersion}, hash160(redeemScript)), nil
+	}
+	return base58CheckEncode([]byte{c.PubKeyHashVersion}, hash160(publicKey)), nil
+}
+
+func (c *BitcoinCodec) ValidateAddress(address string) error {
+	if c.SegwitHRP != "" && strings.HasPrefix(strings.ToLower(address), c.SegwitHRP+"1") {
+		hrp, data, err := bech32Decode(address)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+		}
+		if hrp != c.SegwitHRP || len(data) == 0 || data[0] != 0 {
+			return fmt.Errorf("%w: unsupported witness program", ErrInvalidAddress)
+		}
+		program, err := convertBits(data[1:], 5, 8, false)
+		if err != nil || (len(program) != 20 && len(program) != 32) {
+			return fmt.Errorf("%w: invalid witness program length", ErrInvalidAddress)
+		}
+		return nil
+	}
+
+	payload, err := base58CheckDecode(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if len(payload) != 21 || (payload[0] != c.PubKeyHashVersion && payload[0] != c.ScriptHashVersion) {
+		return fmt.Errorf("%w: unexpected version or length", ErrInvalidAddress)
+	}
+	return nil
+}
+
+// ScriptPubKey returns the output script that pays to address: P2PKH, P2SH,
+// P2WPKH or P2WSH.
+func (c *BitcoinCodec) ScriptPubKey(address string) ([]byte, error) {
+	if err := c.ValidateAddress(address); err != nil {
+		return nil, err
+	}
+
+	if c.SegwitHRP != "" && strings.HasPrefix(strings.ToLower(address), c.SegwitHRP+"1") {
+		_, data, _ := bech32Decode(address)
+		program, _ := convertBits(data[1:], 5, 8, false)
+		return append([]byte{0x00, byte(len(program))}, program...), nil
+	}
+
+	payload, _ := base58CheckDecode(address)
+	if payload[0] == c.ScriptHashVersion {
+		return append(append([]byte{0xa9, 0x14}, payload[1:]...), 0x87), nil
+	}
+	return append(append([]byte{0x76, 0xa9, 0x14}, payload[1:]...), 0x88, 0xac), nil
+}
+
+// EVMCodec encodes EIP-55 checksummed Ethereum addresses.
+type EVMCodec struct{}
+
+func (c *EVMCodec) PublicKey(privateKey []byte) ([]byte, error) {
+	return secp256k1PublicKey(privateKey)
+}
+
+func (c *EVMCodec) EncodeAddress(publicKey []byte) (string, error) {
+	pub, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	return eip55Checksum(hex.EncodeToString(keccak256(pub.SerializeUncompressed()[1:])[12:])), nil
+}
+
+// ValidateAddress accepts all-lowercase or all-uppercase hex, and verifies
+// the EIP-55 checksum of mixed-case addresses.
+func (c *EVMCodec) ValidateAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
+		return fmt.Errorf("%w: expected 0x followed by 40 hex characters", ErrInvalidAddress)
+	}
+
+	body := address[2:]
+	if _, err := hex.DecodeString(body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if body == strings.ToLower(body) || body == strings.ToUpper(body) {
+		return nil
+	}
+	if eip55Checksum(strings.ToLower(body)) != address {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, ErrInvalidChecksum)
+	}
+	return nil
+}
+
+// eip55Checksum applies mixed-case checksumming to a lowercase hex address.
+func eip55Checksum(lowerHex string) string {
+	hash := hex.EncodeToString(keccak256([]byte(lowerHex)))
+
+	out := []byte(lowerHex)
+	for i, ch := range out {
+		if ch >= 'a' && ch <= 'f' && hash[i] >= '8' {
+			out[i] = ch - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+// SolanaCodec encodes ed25519 public keys as base58 addresses.
+type SolanaCodec struct{}
+
+// PublicKey accepts either a 32-byte ed25519 seed or a 64-byte keypair.
+func (c *SolanaCodec) PublicKey(privateKey []byte) ([]byte, error) {
+	switch len(privateKey) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(privateKey).Public().(ed25519.PublicKey), nil
+	case ed25519.PrivateKeySize:
+		pub := ed25519.NewKeyFromSeed(privateKey[:ed25519.SeedSize]).Public().(ed25519.PublicKey)
+		if string(pub) != string(privateKey[ed25519.SeedSize:]) {
+			return nil, fmt.Errorf("%w: keypair public half does not match seed", ErrInvalidPrivateKey)
+		}
+		return pub, nil
+	default:
+		return nil, ErrInvalidPrivateKey
+	}
+}
+
+func (c *SolanaCodec) EncodeAddress(publicKey []byte) (string, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("%w: ed25519 public key must be 32 bytes", ErrInvalidAddress)
+	}
+	return base58Encode(publicKey), nil
+}
+
+func (c *SolanaCodec) ValidateAddress(address string) error {
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if len(decoded) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: expected 32 bytes, got %d", ErrInvalidAddress, len(decoded))
+	}
+	return nil
+}
+
+// Bech32Codec encodes Cosmos SDK account addresses under HRP.
+type Bech32Codec struct {
+	HRP string
+}
+
+func (c *Bech32Codec) PublicKey(privateKey []byte) ([]byte, error) {
+	return secp256k1PublicKey(privateKey)
+}
+
+func (c *Bech32Codec) EncodeAddress(publicKey []byte) (string, error) {
+	if _, err := secp256k1.ParsePubKey(publicKey); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	data, err := convertBits(hash160(publicKey), 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	return bech32Encode(c.HRP, data), nil
+}
+
+func (c *Bech32Codec) ValidateAddress(address string) error {
+	parsed, err := ParseCosmosAddress(address, c.HRP)
+	if err != nil {
+		return err
+	}
+	if parsed.Bech32m {
+		return fmt.Errorf("%w %q: Cosmos addresses take a bech32 checksum, not bech32m", ErrInvalidAddress, address)
+	}
+	if parsed.IsContract() {
+		return fmt.Errorf("%w %q: %w: expected a 20-byte account, got a 32-byte contract address", ErrInvalidAddress, address, ErrAddressLength)
+	}
+	return nil
+}
+
+// Cosmos SDK addresses are 20 bytes for accounts, which hash a public key,
+// and 32 bytes for contracts and other derived accounts, such as XION's
+// smart contract accounts.
+const (
+	cosmosAccountAddressLength  = 20
+	cosmosContractAddressLength = 32
+)
+
+// CosmosAddress is a decoded Cosmos SDK address.
+type CosmosAddress struct {
+	HRP     string
+	Bytes   []byte
+	Bech32m bool // encoded with a BIP-350 checksum rather than BIP-173
+}
+
+// IsContract reports whether the address is a 32-byte contract address
+// rather than a 20-byte account.
+func (a CosmosAddress) IsContract() bool {
+	return len(a.Bytes) == cosmosContractAddressLength
+}
+
+func (a CosmosAddress) String() string {
+	data, _ := convertBits(a.Bytes, 8, 5, true)
+	if a.Bech32m {
+		return bech32EncodeVariant(a.HRP, data, bech32M)
+	}
+	return bech32EncodeVariant(a.HRP, data, bech32Classic)
+}
+
+// ParseCosmosAddress decodes a bech32 or bech32m address, checking its
+// checksum, that its prefix is one of hrps and that it is an account or a
+// contract address. Every error wraps ErrInvalidAddress and says what is
+// wrong.
+func ParseCosmosAddress(address string, hrps ...string) (CosmosAddress, error) {
+	hrp, data, variant, err := bech32DecodeVariant(address)
+	if err != nil {
+		return CosmosAddress{}, fmt.Errorf("%w %q: %w", ErrInvalidAddress, address, err)
+	}
+	allowed := false
+	for _, candidate := range hrps {
+		allowed = allowed || hrp == candidate
+	}
+	if !allowed {
+		return CosmosAddress{}, fmt.Errorf("%w %q: %w: %q, expected %s", ErrInvalidAddress, address, ErrAddressPrefix, hrp, strings.Join(hrps, " or "))
+	}
+	payload, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return CosmosAddress{}, fmt.Errorf("%w %q: %v", ErrInvalidAddress, address, err)
+	}
+	if len(payload) != cosmosAccountAddressLength && len(payload) != cosmosContractAddressLength {
+		return CosmosAddress{}, fmt.Errorf("%w %q: %w: %d bytes, expected %d for an account or %d for a contract",
+			ErrInvalidAddress, address, ErrAddressLength, len(payload), cosmosAccountAddressLength, cosmosContractAddressLength)
+	}
+	return CosmosAddress{HRP: hrp, Bytes: payload, Bech32m: variant == bech32M}, nil
+}
@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddressCodecs(t *testing.T) {
+	// Private key 1 maps to the secp256k1 generator point.
+	generatorKey := make([]byte, 32)
+	generatorKey[31] = 1
+
+	t.Run("BitcoinP2PKH", func(t *testing.T) {
+		codec := mustAddressCodec(t, "BTC")
+		pub, err := codec.PublicKey(generatorKey)
+		require.NoError(t, err)
+
+		address, err := codec.EncodeAddress(pub)
+		require.NoError(t, err)
+		assert.Equal(t, "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH", address)
+		assert.NoError(t, codec.ValidateAddress(address))
+		assert.NoError(t, codec.ValidateAddress("3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy"))
+		assert.ErrorIs(t, codec.ValidateAddress("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMJ"), ErrInvalidAddress)
+	})
+
+	t.Run("BitcoinP2WPKH", func(t *testing.T) {
+		codec := &BitcoinCodec{PubKeyHashVersion: 0x00, ScriptHashVersion: 0x05, SegwitHRP: "bc", Segwit: true}
+		pub, err := codec.PublicKey(generatorKey)
+		require.NoError(t, err)
+
+		address, err := codec.EncodeAddress(pub)
+		require.NoError(t, err)
+		assert.Equal(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", address)
+		assert.NoError(t, mustAddressCodec(t, "BTC").ValidateAddress("BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"))
+		assert.ErrorIs(t, mustAddressCodec(t, "BTC").ValidateAddress("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5"), ErrInvalidAddress)
+	})
+
+	t.Run("EIP55", func(t *testing.T) {
+		codec := mustAddressCodec(t, "ETH")
+		for _, address := range []string{
+			"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed",
+			"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359",
+			"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB",
+			"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb",
+		} {
+			assert.NoError(t, codec.ValidateAddress(address))
+		}
+
+		assert.NoError(t, codec.ValidateAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"))
+		assert.ErrorIs(t, codec.ValidateAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD"), ErrInvalidAddress)
+		assert.ErrorIs(t, codec.ValidateAddress("0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeA"), ErrInvalidAddress)
+	})
+
+	t.Run("Solana", func(t *testing.T) {
+		codec := mustAddressCodec(t, "SOL")
+
+		assert.NoError(t, codec.ValidateAddress("11111111111111111111111111111111"))
+		assert.NoError(t, codec.ValidateAddress("HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk"))
+		assert.ErrorIs(t, codec.ValidateAddress("HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpq0"), ErrInvalidAddress)
+		assert.ErrorIs(t, codec.ValidateAddress("3yZe7d"), ErrInvalidAddress)
+	})
+
+	t.Run("Bech32", func(t *testing.T) {
+		for _, s := range []string{
+			"A12UEL5L",
+			"a12uel5l",
+			"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+			"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		} {
+			_, _, err := bech32Decode(s)
+			assert.NoError(t, err, s)
+		}
+
+		for _, s := range []string{"1nwldj5", "pzry9x0s0muk", "A1G7SGD8", "a12UEL5L", "x1b4n0q5v"} {
+			_, _, err := bech32Decode(s)
+			assert.ErrorIs(t, err, ErrInvalidBech32, s)
+		}
+	})
+
+	t.Run("Bech32m", func(t *testing.T) {
+		for _, s := range []string{
+			"A1LQFN3A",
+			"a1lqfn3a",
+			"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx",
+			"split1checkupstagehandshakeupstreamerranterredcaperredlc445v",
+		} {
+			_, _, variant, err := bech32DecodeVariant(s)
+			assert.NoError(t, err, s)
+			assert.Equal(t, bech32M, variant, s)
+
+			_, _, err = bech32Decode(s)
+			assert.ErrorIs(t, err, ErrInvalidBech32, "bech32 rejects %s", s)
+		}
+
+		_, _, variant, err := bech32DecodeVariant("a12uel5l")
+		require.NoError(t, err)
+		assert.Equal(t, bech32Classic, variant)
+
+		for _, s := range []string{"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6", "M1VUXWEZ", "a1lqfn3A"} {
+			_, _, _, err := bech32DecodeVariant(s)
+			assert.ErrorIs(t, err, ErrInvalidBech32, s)
+		}
+	})
+
+	t.Run("CosmosAddresses", func(t *testing.T) {
+		account, err := ParseCosmosAddress("xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush", "xion")
+		require.NoError(t, err)
+		assert.Equal(t, "xion", account.HRP)
+		assert.Len(t, account.Bytes, 20)
+		assert.False(t, account.IsContract())
+		assert.Equal(t, "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush", account.String())
+
+		contract, err := ParseCosmosAddress("xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5z5tpwxqergd3c8g7rusq62ld7y", "xion")
+		require.NoError(t, err)
+		assert.True(t, contract.IsContract())
+		assert.Equal(t, "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5z5tpwxqergd3c8g7rusq62ld7y", contract.String())
+
+		modern, err := ParseCosmosAddress("xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5ghxs44", "xion")
+		require.NoError(t, err)
+		assert.True(t, modern.Bech32m)
+		assert.Equal(t, account.Bytes, modern.Bytes)
+		assert.Equal(t, "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5ghxs44", modern.String())
+
+		_, err = ParseCosmosAddress("cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnrk363e", "xion", "osmo")
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+		assert.ErrorIs(t, err, ErrAddressPrefix)
+		assert.Contains(t, err.Error(), "expected xion or osmo")
+
+		_, err = ParseCosmosAddress("xion1qypqxpq9qcrsszg2pvxq6rs0zq6q6l0k", "xion")
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+		assert.ErrorIs(t, err, ErrAddressLength)
+
+		_, err = ParseCosmosAddress("xion1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5", "xion")
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+		assert.ErrorIs(t, err, ErrInvalidBech32)
+
+		xion := mustAddressCodec(t, "XION")
+		assert.ErrorIs(t, xion.ValidateAddress(contract.String()), ErrAddressLength, "wallet keys only make accounts")
+		assert.ErrorIs(t, xion.ValidateAddress(modern.String()), ErrInvalidAddress)
+	})
+
+	t.Run("CosmosHRPs", func(t *testing.T) {
+		nrn := mustAddressCodec(t, "NRN")
+		xion := mustAddressCodec(t, "XION")
+		pub, err := nrn.PublicKey(generatorKey)
+		require.NoError(t, err)
+
+		knirvAddress, err := nrn.EncodeAddress(pub)
+		require.NoError(t, err)
+		xionAddress, err := xion.EncodeAddress(pub)
+		require.NoError(t, err)
+
+		assert.NoError(t, nrn.ValidateAddress(knirvAddress))
+		assert.NoError(t, xion.ValidateAddress(xionAddress))
+		assert.ErrorIs(t, nrn.ValidateAddress(xionAddress), ErrInvalidAddress)
+		assert.ErrorIs(t, xion.ValidateAddress("xion1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5"), ErrInvalidAddress)
+	})
+
+	t.Run("InvalidPrivateKey", func(t *testing.T) {
+		_, err := mustAddressCodec(t, "ETH").PublicKey(make([]byte, 32))
+		assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+
+		_, err = mustAddressCodec(t, "SOL").PublicKey(make([]byte, 16))
+		assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+	})
+}
+
+func mustAddressCodec(t *testing.T, chain string) AddressCodec {
+	codec, err := GetAddressCodec(chain)
+	require.NoError(t, err)
+	return codec
+}
@@ -0,0 +1,221 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount is an exact token quantity: an integer count of base units (satoshi,
+// wei, lamports, uxion) and the number of decimals of the display unit.
+// The zero value is zero with no decimals.
+type Amount struct {
+	units    *big.Int
+	decimals int
+}
+
+// NewAmount wraps a base-unit count. units is copied.
+func NewAmount(units *big.Int, decimals int) Amount {
+	return Amount{units: new(big.Int).Set(units), decimals: decimals}
+}
+
+// NewAmountFromInt64 is NewAmount for small base-unit counts.
+func NewAmountFromInt64(units int64, decimals int) Amount {
+	return Amount{units: big.NewInt(units), decimals: decimals}
+}
+
+// ParseAmount parses a display-unit decimal such as "1.5" or "-0.000001".
+// Digits beyond the given decimals are rejected rather than rounded.
+func ParseAmount(s string, decimals int) (Amount, error) {
+	if decimals < 0 {
+		return Amount{}, fmt.Errorf("%w: negative decimals", ErrInvalidAmount)
+	}
+
+	str := strings.TrimSpace(s)
+	sign := ""
+	if strings.HasPrefix(str, "-") {
+		sign, str = "-", str[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(str, ".")
+	if (whole == "" && frac == "") || (hasPoint && frac == "") || !isDecimalDigits(whole) || !isDecimalDigits(frac) {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > decimals {
+		return Amount{}, fmt.Errorf("%w: %q has more than %d decimals", ErrInvalidAmount, s, decimals)
+	}
+
+	digits := sign + whole + frac + strings.Repeat("0", decimals-len(frac))
+	units, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return Amount{units: units, decimals: decimals}, nil
+}
+
+// ParseBaseUnits parses an integer count of base units, the form amounts take
+// on the wire in Cosmos SDK and JSON-RPC responses.
+func ParseBaseUnits(s string, decimals int) (Amount, error) {
+	str := strings.TrimSpace(s)
+	if !isDecimalDigits(strings.TrimPrefix(str, "-")) || strings.TrimPrefix(str, "-") == "" {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	units, _ := new(big.Int).SetString(str, 10)
+	return Amount{units: units, decimals: decimals}, nil
+}
+
+func isDecimalDigits(s string) bool {
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) int() *big.Int {
+	if a.units == nil {
+		return new(big.Int)
+	}
+	return a.units
+}
+
+// BaseUnits returns a copy of the base-unit count.
+func (a Amount) BaseUnits() *big.Int {
+	return new(big.Int).Set(a.int())
+}
+
+func (a Amount) Decimals() int {
+	return a.decimals
+}
+
+func (a Amount) Sign() int {
+	return a.int().Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+// String formats the amount in display units without trailing zeros, e.g.
+// 1500000 base units with 6 decimals is "1.5".
+func (a Amount) String() string {
+	units := a.int()
+	digits := new(big.Int).Abs(units).String()
+
+	sign := ""
+	if units.Sign() < 0 {
+		sign = "-"
+	}
+	if a.decimals == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= a.decimals {
+		digits = strings.Repeat("0", a.decimals-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-a.decimals], strings.TrimRight(digits[len(digits)-a.decimals:], "0")
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+// UnitsAt returns the base-unit count at the given decimals, failing rather
+// than truncating when a has more significant decimals than that.
+func (a Amount) UnitsAt(decimals int) (*big.Int, error) {
+	if decimals < 0 {
+		return nil, fmt.Errorf("%w: negative decimals", ErrInvalidAmount)
+	}
+
+	units := a.BaseUnits()
+	if decimals >= a.decimals {
+		return units.Mul(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals-a.decimals)), nil)), nil
+	}
+
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.decimals-decimals)), nil)
+	quotient, remainder := new(big.Int).QuoRem(units, scale, new(big.Int))
+	if remainder.Sign() != 0 {
+		return nil, fmt.Errorf("%w: %s has more than %d decimals", ErrInvalidAmount, a, decimals)
+	}
+	return quotient, nil
+}
+
+// rescale returns both amounts' base units at the larger of their decimals.
+func (a Amount) rescale(b Amount) (*big.Int, *big.Int, int) {
+	x, y := a.BaseUnits(), b.BaseUnits()
+	decimals := a.decimals
+	switch {
+	case b.decimals > a.decimals:
+		x.Mul(x, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(b.decimals-a.decimals)), nil))
+		decimals = b.decimals
+	case a.decimals > b.decimals:
+		y.Mul(y, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(a.decimals-b.decimals)), nil))
+	}
+	return x, y, decimals
+}
+
+// Add returns a+b at the larger of the two precisions.
+func (a Amount) Add(b Amount) Amount {
+	x, y, decimals := a.rescale(b)
+	return Amount{units: x.Add(x, y), decimals: decimals}
+}
+
+// Sub returns a-b at the larger of the two precisions.
+func (a Amount) Sub(b Amount) Amount {
+	x, y, decimals := a.rescale(b)
+	return Amount{units: x.Sub(x, y), decimals: decimals}
+}
+
+// Cmp compares the values of a and b, returning -1, 0 or +1.
+func (a Amount) Cmp(b Amount) int {
+	x, y, _ := a.rescale(b)
+	return x.Cmp(y)
+}
+
+// amountJSON is the wire form of an Amount. The base-unit count is a string,
+// which keeps 18-decimal amounts exact for JavaScript clients, and the
+// decimals travel with it so a decoded amount displays as the encoded one.
+type amountJSON struct {
+	Units    string `json:"units"`
+	Decimals int    `json:"decimals"`
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(amountJSON{Units: a.int().String(), Decimals: a.decimals})
+}
+
+// UnmarshalJSON decodes the wire form above. A bare base-unit count, as a
+// JSON string or number, is also accepted and keeps the receiver's decimals.
+// null leaves the amount unchanged, as encoding/json does for other types.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var raw amountJSON
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+		}
+		if raw.Decimals < 0 {
+			return fmt.Errorf("%w: negative decimals", ErrInvalidAmount)
+		}
+		parsed, err := ParseBaseUnits(raw.Units, raw.Decimals)
+		if err != nil {
+			return err
+		}
+		*a = parsed
+		return nil
+	}
+	parsed, err := ParseBaseUnits(strings.Trim(string(data), `"`), a.decimals)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
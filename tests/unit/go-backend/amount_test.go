@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmount(t *testing.T) {
+	t.Run("ParseAndFormat", func(t *testing.T) {
+		tests := []struct {
+			input     string
+			decimals  int
+			baseUnits string
+			formatted string
+		}{
+			{"1.5", 8, "150000000", "1.5"},
+			{"0.000000000000000001", 18, "1", "0.000000000000000001"},
+			{"123456789.123456789012345678", 18, "123456789123456789012345678", "123456789.123456789012345678"},
+			{"0.25", 6, "250000", "0.25"},
+			{".5", 6, "500000", "0.5"},
+			{"42", 0, "42", "42"},
+			{"10.000", 6, "10000000", "10"},
+			{"-0.000001", 6, "-1", "-0.000001"},
+			{"0", 9, "0", "0"},
+		}
+
+		for _, tt := range tests {
+			amount, err := ParseAmount(tt.input, tt.decimals)
+			require.NoError(t, err, tt.input)
+			assert.Equal(t, tt.baseUnits, amount.BaseUnits().String(), tt.input)
+			assert.Equal(t, tt.formatted, amount.String(), tt.input)
+		}
+	})
+
+	t.Run("RejectsInvalid", func(t *testing.T) {
+		for _, input := range []string{"", "-", ".", "1.", "1.2.3", "1e18", "0x10", "1,5", "abc"} {
+			_, err := ParseAmount(input, 6)
+			assert.ErrorIs(t, err, ErrInvalidAmount, input)
+		}
+
+		// Excess precision is an error, never silently rounded
+		_, err := ParseAmount("0.0000001", 6)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+
+		_, err = ParseBaseUnits("1.5", 6)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("Arithmetic", func(t *testing.T) {
+		a, _ := ParseAmount("0.1", 18)
+		b, _ := ParseAmount("0.2", 18)
+		c, _ := ParseAmount("0.3", 18)
+
+		// The classic float64 failure case is exact here
+		assert.Equal(t, 0, a.Add(b).Cmp(c))
+		assert.Equal(t, "0.1", c.Sub(b).String())
+		assert.Equal(t, -1, a.Cmp(b))
+		assert.Equal(t, 1, c.Cmp(a))
+		assert.Equal(t, -1, a.Sub(b).Sign())
+
+		// Mixed precision is rescaled rather than truncated
+		coarse, _ := ParseAmount("1.5", 2)
+		fine, _ := ParseAmount("0.000001", 6)
+		sum := coarse.Add(fine)
+		assert.Equal(t, 6, sum.Decimals())
+		assert.Equal(t, "1.500001", sum.String())
+		assert.Equal(t, 0, coarse.Cmp(NewAmountFromInt64(1500000, 6)))
+
+		// Operands are not mutated
+		assert.Equal(t, "0.1", a.String())
+		units := a.BaseUnits()
+		units.SetInt64(0)
+		assert.Equal(t, "0.1", a.String())
+	})
+
+	t.Run("ZeroValue", func(t *testing.T) {
+		var zero Amount
+		assert.True(t, zero.IsZero())
+		assert.Equal(t, "0", zero.String())
+		assert.Equal(t, "7", zero.Add(NewAmountFromInt64(7, 0)).String())
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		wei, ok := new(big.Int).SetString("1500000000000000000", 10)
+		require.True(t, ok)
+
+		encoded, err := json.Marshal(NewAmount(wei, 18))
+		require.NoError(t, err)
+		assert.Equal(t, `{"units":"1500000000000000000","decimals":18}`, string(encoded))
+
+		var decoded Amount
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, "1.5", decoded.String())
+		assert.Equal(t, 18, decoded.Decimals())
+
+		// A bare base-unit count keeps the receiver's decimals
+		decoded = NewAmountFromInt64(0, 18)
+		require.NoError(t, json.Unmarshal([]byte(`"1500000000000000000"`), &decoded))
+		assert.Equal(t, "1.5", decoded.String())
+		require.NoError(t, json.Unmarshal([]byte(`250`), &decoded))
+		assert.Equal(t, "0.00000000000000025", decoded.String())
+
+		assert.ErrorIs(t, json.Unmarshal([]byte(`"1.5"`), &decoded), ErrInvalidAmount)
+		assert.ErrorIs(t, json.Unmarshal([]byte(`{"units":"1.5","decimals":18}`), &decoded), ErrInvalidAmount)
+		assert.ErrorIs(t, json.Unmarshal([]byte(`{"units":"1","decimals":-1}`), &decoded), ErrInvalidAmount)
+
+		// null is no amount, for optional fields
+		var optional struct {
+			Amount *Amount `json:"amount"`
+			Fee    Amount  `json:"fee"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(`{"amount":null,"fee":null}`), &optional))
+		assert.Nil(t, optional.Amount)
+		assert.True(t, optional.Fee.IsZero())
+		require.NoError(t, json.Unmarshal([]byte(`null`), &decoded))
+		assert.Equal(t, "0.00000000000000025", decoded.String())
+	})
+
+	t.Run("JSONRoundTrip", func(t *testing.T) {
+		// Decoded into zero values, as a client reading them back would
+		roundTrip := func(t *testing.T, v, into interface{}) {
+			encoded, err := json.Marshal(v)
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(encoded, into))
+			assert.Equal(t, v, into)
+		}
+		roundTrip(t, &XionTransactionResult{TxHash: "ABC", Success: true, Amount: NewAmountFromInt64(1500000, 6)}, &XionTransactionResult{})
+		roundTrip(t, &SkillReceipt{TxHash: "ABC", SkillID: "code-review", Cost: NewAmountFromInt64(2000000, 6), CreatedAt: time.Unix(1700000000, 0).UTC()}, &SkillReceipt{})
+		roundTrip(t, &FaucetDrip{Address: "xion1abc", Amount: NewAmountFromInt64(1000000, 6), CreatedAt: time.Unix(1700000000, 0).UTC()}, &FaucetDrip{})
+		supply, ok := new(big.Int).SetString("21000000000000000000000000", 10)
+		require.True(t, ok)
+		roundTrip(t, &CW20TokenInfo{Name: "Token", Symbol: "TKN", Decimals: 18, TotalSupply: NewAmount(supply, 18)}, &CW20TokenInfo{})
+
+		var receipt SkillReceipt
+		require.NoError(t, json.Unmarshal([]byte(`{"cost":{"units":"2500000","decimals":6}}`), &receipt))
+		assert.Equal(t, "2.5", receipt.Cost.String())
+	})
+}
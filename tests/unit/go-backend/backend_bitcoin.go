@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+const bitcoinDecimals = 8
+
+// EsploraBackend reads Bitcoin-family chains through an Esplora REST API
+// such as blockstream.info or a self-hosted electrs.
+type EsploraBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewEsploraBackend(baseURL string) *EsploraBackend {
+	return &EsploraBackend{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultBackendTimeout},
+	}
+}
+
+type esploraTxoStats struct {
+	FundedTxoSum int64 `json:"funded_txo_sum"`
+	SpentTxoSum  int64 `json:"spent_txo_sum"`
+}
+
+// GetBalance includes unconfirmed mempool activity, matching what wallets
+// display as the spendable balance.
+func (b *EsploraBackend) GetBalance(address string) (Amount, error) {
+	var stats struct {
+		ChainStats   esploraTxoStats `json:"chain_stats"`
+		MempoolStats esploraTxoStats `json:"mempool_stats"`
+	}
+	if err := b.get("/address/"+address, &stats); err != nil {
+		return Amount{}, err
+	}
+
+	sats := stats.ChainStats.FundedTxoSum - stats.ChainStats.SpentTxoSum +
+		stats.MempoolStats.FundedTxoSum - stats.MempoolStats.SpentTxoSum
+	return NewAmountFromInt64(sats, bitcoinDecimals), nil
+}
+
+func (b *EsploraBackend) GetNonce(address string) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+func (b *EsploraBackend) BroadcastTx(rawTx []byte) (string, error) {
+	resp, err := b.client.Post(b.baseURL+"/tx", "text/plain", strings.NewReader(hex.EncodeToString(rawTx)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("broadcast rejected: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (b *EsploraBackend) GetTx(txHash string) (*ChainTx, error) {
+	var status struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int64 `json:"block_height"`
+	}
+	if err := b.get("/tx/"+txHash+"/status", &status); err != nil {
+		return nil, err
+	}
+	return &ChainTx{
+		Hash:        txHash,
+		BlockHeight: status.BlockHeight,
+		Confirmed:   status.Confirmed,
+		Success:     status.Confirmed,
+	}, nil
+}
+
+func (b *EsploraBackend) get(path string, result interface{}) error {
+	resp, err := b.client.Get(b.baseURL + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/tx/"):
+		return ErrTxNotFound
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("GET %s: unexpected status %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// BitcoinCoreBackend talks to a bitcoind (or litecoind, dashd) JSON-RPC
+// server. Balances come from scantxoutset, so no wallet needs to be loaded.
+type BitcoinCoreBackend struct {
+	rpc *jsonRPCClient
+}
+
+func NewBitcoinCoreBackend(endpoint, username, password string) *BitcoinCoreBackend {
+	rpc := newJSONRPCClient(endpoint)
+	rpc.username, rpc.password = username, password
+	return &BitcoinCoreBackend{rpc: rpc}
+}
+
+// bitcoinCoreTxNotFound is RPC_INVALID_ADDRESS_OR_KEY, which getrawtransaction
+// returns for unknown transactions.
+const bitcoinCoreTxNotFound = -5
+
+func (b *BitcoinCoreBackend) GetBalance(address string) (Amount, error) {
+	var result struct {
+		Success     bool        `json:"success"`
+		TotalAmount json.Number `json:"total_amount"`
+	}
+	params := []interface{}{"start", []string{"addr(" + address + ")"}}
+	if err := b.rpc.Call("scantxoutset", params, &result); err != nil {
+		return Amount{}, err
+	}
+	if !result.Success {
+		return Amount{}, errors.New("scantxoutset did not complete")
+	}
+	return parseBitcoinCoreAmount(result.TotalAmount)
+}
+
+func (b *BitcoinCoreBackend) GetNonce(address string) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+func (b *BitcoinCoreBackend) BroadcastTx(rawTx []byte) (string, error) {
+	var txid string
+	if err := b.rpc.Call("sendrawtransaction", []interface{}{hex.EncodeToString(rawTx)}, &txid); err != nil {
+		return "", err
+	}
+	return txid, nil
+}
+
+func (b *BitcoinCoreBackend) GetTx(txHash string) (*ChainTx, error) {
+	var tx struct {
+		BlockHash     string `json:"blockhash"`
+		Confirmations int64  `json:"confirmations"`
+	}
+	err := b.rpc.Call("getrawtransaction", []interface{}{txHash, true}, &tx)
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && rpcErr.Code == bitcoinCoreTxNotFound {
+		return nil, ErrTxNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tx.BlockHash == "" {
+		return &ChainTx{Hash: txHash}, nil
+	}
+
+	var header struct {
+		Height int64 `json:"height"`
+	}
+	if err := b.rpc.Call("getblockheader", []interface{}{tx.BlockHash}, &header); err != nil {
+		return nil, err
+	}
+	return &ChainTx{
+		Hash:        txHash,
+		BlockHeight: header.Height,
+		Confirmed:   tx.Confirmations > 0,
+		Success:     tx.Confirmations > 0,
+	}, nil
+}
+
+// parseBitcoinCoreAmount converts a BTC-denominated JSON number to satoshis
+// without going through float64.
+func parseBitcoinCoreAmount(n json.Number) (Amount, error) {
+	value, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %q", ErrInvalidAmount, n)
+	}
+	value.Mul(value, new(big.Rat).SetInt64(100_000_000))
+	if !value.IsInt() {
+		return Amount{}, fmt.Errorf("%w: %q has more than %d decimals", ErrInvalidAmount, n, bitcoinDecimals)
+	}
+	return NewAmount(value.Num(), bitcoinDecimals), nil
+}
@@ -0,0 +1,492 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CosmosBackend talks to a Cosmos SDK chain (XION, the KNIRV network)
+// through its CometBFT JSON-RPC endpoint. Queries go through abci_query with
+// protobuf-encoded gRPC requests.
+type CosmosBackend struct {
+	rpc      *jsonRPCClient
+	denom    string
+	decimals int
+}
+
+// NewCosmosBackend reports balances of denom, whose display unit has the
+// given decimals (6 for uxion).
+func NewCosmosBackend(endpoint string, denom string, decimals int) *CosmosBackend {
+	return &CosmosBackend{rpc: newJSONRPCClient(endpoint), denom: denom, decimals: decimals}
+}
+
+const baseAccountTypeURL = "/cosmos.auth.v1beta1.BaseAccount"
+
+// accountBaseDepth is, for each account type GetAccount decodes, how many
+// levels of field 1 its account number and sequence sit under. XION's
+// abstract (smart contract) accounts share BaseAccount's layout; module
+// accounts embed a BaseAccount, and vesting accounts a BaseVestingAccount
+// that embeds one in turn.
+var accountBaseDepth = map[string]int{
+	baseAccountTypeURL:                                 0,
+	"/abstractaccount.v1.AbstractAccount":              0,
+	"/cosmos.auth.v1beta1.ModuleAccount":               1,
+	"/cosmos.vesting.v1beta1.ContinuousVestingAccount": 2,
+	"/cosmos.vesting.v1beta1.DelayedVestingAccount":    2,
+	"/cosmos.vesting.v1beta1.PeriodicVestingAccount":   2,
+	"/cosmos.vesting.v1beta1.PermanentLockedAccount":   2,
+}
+
+func (b *CosmosBackend) GetBalance(address string) (Amount, error) {
+	return b.GetDenomBalance(address, b.denom, b.decimals)
+}
+
+// GetDenomBalance asks the bank module for address's balance of any denom,
+// native or IBC, whose display unit has the given decimals. Denoms the
+// account has never held report zero.
+func (b *CosmosBackend) GetDenomBalance(address, denom string, decimals int) (Amount, error) {
+	var req []byte
+	req = protoAppendString(req, 1, address)
+	req = protoAppendString(req, 2, denom)
+
+	resp, err := b.abciQuery("/cosmos.bank.v1beta1.Query/Balance", req)
+	if err != nil {
+		return Amount{}, err
+	}
+
+	// QueryBalanceResponse{balance: Coin{denom, amount}}
+	amount := "0"
+	fields, err := protoFields(resp)
+	if err != nil {
+		return Amount{}, err
+	}
+	for _, field := range fields {
+		if field.Num != 1 {
+			continue
+		}
+		coin, err := protoFields(field.Bytes)
+		if err != nil {
+			return Amount{}, err
+		}
+		for _, coinField := range coin {
+			if coinField.Num == 2 {
+				amount = string(coinField.Bytes)
+			}
+		}
+	}
+	return ParseBaseUnits(amount, decimals)
+}
+
+func (b *CosmosBackend) GetNonce(address string) (uint64, error) {
+	_, sequence, err := b.GetAccount(address)
+	return sequence, err
+}
+
+// GetAccount returns the account number and sequence that sign docs commit
+// to. Accounts that have never received funds do not exist on chain yet and
+// report zeros.
+func (b *CosmosBackend) GetAccount(address string) (accountNumber uint64, sequence uint64, err error) {
+	resp, err := b.abciQuery("/cosmos.auth.v1beta1.Query/Account", protoAppendString(nil, 1, address))
+	if errors.Is(err, errABCINotFound) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// QueryAccountResponse{account: Any{type_url, value}}
+	fields, err := protoFields(resp)
+	if err != nil || len(fields) == 0 {
+		return 0, 0, ErrMalformedProto
+	}
+	anyFields, err := protoFields(fields[0].Bytes)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var typeURL string
+	var value []byte
+	for _, field := range anyFields {
+		switch field.Num {
+		case 1:
+			typeURL = string(field.Bytes)
+		case 2:
+			value = field.Bytes
+		}
+	}
+	depth, ok := accountBaseDepth[typeURL]
+	if !ok {
+		return 0, 0, fmt.Errorf("unsupported account type %q", typeURL)
+	}
+
+	accountFields, err := protoFields(value)
+	if err != nil {
+		return 0, 0, err
+	}
+	for ; depth > 0; depth-- {
+		var base []byte
+		for _, field := range accountFields {
+			if field.Num == 1 {
+				base = field.Bytes
+			}
+		}
+		if base == nil {
+			return 0, 0, fmt.Errorf("%w: %s without a base account", ErrMalformedProto, typeURL)
+		}
+		if accountFields, err = protoFields(base); err != nil {
+			return 0, 0, err
+		}
+	}
+	for _, field := range accountFields {
+		switch field.Num {
+		case 3:
+			accountNumber = field.Varint
+		case 4:
+			sequence = field.Varint
+		}
+	}
+	return accountNumber, sequence, nil
+}
+
+// CosmosTxResult is the outcome of CheckTx, as returned by a broadcast, or
+// of DeliverTx once the transaction is in a block.
+type CosmosTxResult struct {
+	Hash      string
+	Height    int64
+	Code      uint32
+	Codespace string
+	Log       string
+	GasWanted int64
+	GasUsed   int64
+
+	// Tx is the TxRaw as included, set by GetTxResult.
+	Tx []byte
+}
+
+// Err returns an *ABCIError for a non-zero result code.
+func (r *CosmosTxResult) Err() error {
+	if r.Code == 0 {
+		return nil
+	}
+	return &ABCIError{Codespace: r.Codespace, Code: r.Code, Log: r.Log}
+}
+
+// ABCIError is a transaction rejected by the application. Codes are only
+// unique within their codespace.
+type ABCIError struct {
+	Codespace string
+	Code      uint32
+	Log       string
+}
+
+// sdkErrorReasons names the codes of the Cosmos SDK root codespace that a
+// wallet user can act on.
+var sdkErrorReasons = map[uint32]string{
+	2:  "tx parse error",
+	3:  "invalid sequence",
+	4:  "unauthorized",
+	5:  "insufficient funds",
+	7:  "invalid address",
+	8:  "invalid pubkey",
+	10: "invalid coins",
+	11: "out of gas",
+	12: "memo too large",
+	13: "insufficient fee",
+	19: "tx already in mempool",
+	20: "mempool is full",
+	21: "tx too large",
+	24: "signer mismatch",
+	28: "invalid chain-id",
+	30: "tx timeout height",
+	32: "incorrect account sequence",
+	41: "invalid gas limit",
+}
+
+// Reason describes the code, falling back to codespace/code for codes of
+// modules the wallet does not know.
+func (e *ABCIError) Reason() string {
+	if reason, ok := sdkErrorReasons[e.Code]; ok && e.Codespace == "sdk" {
+		return reason
+	}
+	return fmt.Sprintf("%s/%d", e.Codespace, e.Code)
+}
+
+func (e *ABCIError) Error() string {
+	if e.Log == "" {
+		return e.Reason()
+	}
+	return e.Reason() + ": " + e.Log
+}
+
+// BroadcastTx waits for CheckTx only; use GetTx to follow inclusion.
+func (b *CosmosBackend) BroadcastTx(rawTx []byte) (string, error) {
+	result, err := b.BroadcastTxSync(rawTx)
+	if err != nil {
+		return "", err
+	}
+	if err := result.Err(); err != nil {
+		return "", fmt.Errorf("transaction rejected: %w", err)
+	}
+	return result.Hash, nil
+}
+
+// BroadcastTxSync submits rawTx and returns the CheckTx result, including
+// rejections, which carry a non-zero code rather than an error.
+func (b *CosmosBackend) BroadcastTxSync(rawTx []byte) (*CosmosTxResult, error) {
+	var result struct {
+		Code      uint32 `json:"code"`
+		Log       string `json:"log"`
+		Codespace string `json:"codespace"`
+		Hash      string `json:"hash"`
+	}
+	params := map[string]string{"tx": base64.StdEncoding.EncodeToString(rawTx)}
+	if err := b.rpc.Call("broadcast_tx_sync", params, &result); err != nil {
+		return nil, err
+	}
+	return &CosmosTxResult{Hash: result.Hash, Code: result.Code, Codespace: result.Codespace, Log: result.Log}, nil
+}
+
+func (b *CosmosBackend) GetTx(txHash string) (*ChainTx, error) {
+	result, err := b.GetTxResult(txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &ChainTx{
+		Hash:        result.Hash,
+		BlockHeight: result.Height,
+		Confirmed:   true,
+		Success:     result.Code == 0,
+	}
+	if !tx.Success {
+		tx.Error = result.Log
+	}
+	return tx, nil
+}
+
+// cometTx is a transaction as the tx and tx_search RPC methods return it.
+type cometTx struct {
+	Hash     string `json:"hash"`
+	Height   int64  `json:"height,string"`
+	Tx       []byte `json:"tx"`
+	TxResult struct {
+		Code      uint32 `json:"code"`
+		Codespace string `json:"codespace"`
+		Log       string `json:"log"`
+		GasWanted int64  `json:"gas_wanted,string"`
+		GasUsed   int64  `json:"gas_used,string"`
+	} `json:"tx_result"`
+}
+
+func (tx *cometTx) result(hash string) *CosmosTxResult {
+	return &CosmosTxResult{
+		Hash:      strings.ToUpper(hash),
+		Height:    tx.Height,
+		Code:      tx.TxResult.Code,
+		Codespace: tx.TxResult.Codespace,
+		Log:       tx.TxResult.Log,
+		GasWanted: tx.TxResult.GasWanted,
+		GasUsed:   tx.TxResult.GasUsed,
+		Tx:        tx.Tx,
+	}
+}
+
+// GetTxResult returns the DeliverTx result of an included transaction, or
+// ErrTxNotFound while it is still pending.
+func (b *CosmosBackend) GetTxResult(txHash string) (*CosmosTxResult, error) {
+	hash, err := hex.DecodeString(txHash)
+	if err != nil {
+		return nil, fmt.Errorf("malformed transaction hash %q", txHash)
+	}
+
+	var result cometTx
+	params := map[string]interface{}{"hash": base64.StdEncoding.EncodeToString(hash), "prove": false}
+	err = b.rpc.Call("tx", params, &result)
+
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) && strings.Contains(string(rpcErr.Data), "not found") {
+		return nil, ErrTxNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.result(txHash), nil
+}
+
+// TxSearch returns one page, counted from 1, of the included transactions
+// whose events match query, oldest first, and the number of matches across
+// all pages. query uses CometBFT's syntax, e.g.
+// "transfer.recipient='xion1...' AND tx.height>100".
+func (b *CosmosBackend) TxSearch(query string, page, perPage int) ([]*CosmosTxResult, int, error) {
+	var result struct {
+		Txs        []cometTx `json:"txs"`
+		TotalCount int       `json:"total_count,string"`
+	}
+	params := map[string]interface{}{
+		"query":    query,
+		"prove":    false,
+		"page":     strconv.Itoa(page),
+		"per_page": strconv.Itoa(perPage),
+		"order_by": "asc",
+	}
+	if err := b.rpc.Call("tx_search", params, &result); err != nil {
+		return nil, 0, err
+	}
+	txs := make([]*CosmosTxResult, len(result.Txs))
+	for i := range result.Txs {
+		txs[i] = result.Txs[i].result(result.Txs[i].Hash)
+	}
+	return txs, result.TotalCount, nil
+}
+
+// LatestHeight returns the height of the node's latest block.
+func (b *CosmosBackend) LatestHeight() (int64, error) {
+	var result struct {
+		SyncInfo struct {
+			LatestBlockHeight int64 `json:"latest_block_height,string"`
+		} `json:"sync_info"`
+	}
+	if err := b.rpc.Call("status", map[string]interface{}{}, &result); err != nil {
+		return 0, err
+	}
+	return result.SyncInfo.LatestBlockHeight, nil
+}
+
+// BlockTime returns the header time of the block at height.
+func (b *CosmosBackend) BlockTime(height int64) (time.Time, error) {
+	var result struct {
+		Block struct {
+			Header struct {
+				Time time.Time `json:"time"`
+			} `json:"header"`
+		} `json:"block"`
+	}
+	params := map[string]interface{}{"height": strconv.FormatInt(height, 10)}
+	if err := b.rpc.Call("block", params, &result); err != nil {
+		return time.Time{}, err
+	}
+	return result.Block.Header.Time, nil
+}
+
+// Simulate runs txBytes against the latest state without committing it and
+// returns the gas it consumed.
+func (b *CosmosBackend) Simulate(txBytes []byte) (gasUsed uint64, err error) {
+	resp, err := b.abciQuery("/cosmos.tx.v1beta1.Service/Simulate", protoAppendBytes(nil, 2, txBytes))
+	if err != nil {
+		return 0, err
+	}
+
+	// SimulateResponse{gas_info: GasInfo{gas_wanted, gas_used}, result}
+	fields, err := protoFields(resp)
+	if err != nil {
+		return 0, err
+	}
+	for _, field := range fields {
+		if field.Num != 1 {
+			continue
+		}
+		gasInfo, err := protoFields(field.Bytes)
+		if err != nil {
+			return 0, err
+		}
+		for _, gasField := range gasInfo {
+			if gasField.Num == 2 {
+				gasUsed = gasField.Varint
+			}
+		}
+	}
+	if gasUsed == 0 {
+		return 0, fmt.Errorf("%w: simulation reported no gas used", ErrMalformedProto)
+	}
+	return gasUsed, nil
+}
+
+// GetFeeAllowance returns the x/feegrant allowance granter gives grantee, or
+// ErrAllowanceNotFound.
+func (b *CosmosBackend) GetFeeAllowance(granter, grantee string) (*FeeGrant, error) {
+	req := protoAppendString(nil, 1, granter)
+	req = protoAppendString(req, 2, grantee)
+	resp, err := b.abciQuery("/cosmos.feegrant.v1beta1.Query/Allowance", req)
+	if errors.Is(err, errABCINotFound) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrAllowanceNotFound, granter, grantee)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// QueryAllowanceResponse{allowance: Grant}
+	fields, err := protoFields(resp)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		if field.Num == 1 {
+			return decodeFeeGrant(field.Bytes)
+		}
+	}
+	return nil, fmt.Errorf("%w: %s to %s", ErrAllowanceNotFound, granter, grantee)
+}
+
+// QuerySmartContract runs a CosmWasm smart query, JSON-encoding query and
+// decoding the contract's JSON answer into out.
+func (b *CosmosBackend) QuerySmartContract(contract string, query interface{}, out interface{}) error {
+	queryData, err := json.Marshal(query)
+	if err != nil {
+		return err
+	}
+	req := protoAppendString(nil, 1, contract)
+	req = protoAppendBytes(req, 2, queryData)
+	resp, err := b.abciQuery("/cosmwasm.wasm.v1.Query/SmartContractState", req)
+	if err != nil {
+		return err
+	}
+
+	// QuerySmartContractStateResponse{data}
+	fields, err := protoFields(resp)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if field.Num == 1 {
+			return json.Unmarshal(field.Bytes, out)
+		}
+	}
+	return fmt.Errorf("%w: empty smart query response", ErrMalformedProto)
+}
+
+var errABCINotFound = errors.New("abci query: not found")
+
+// abciQuery runs a gRPC query through CometBFT and returns the raw protobuf
+// response.
+func (b *CosmosBackend) abciQuery(path string, data []byte) ([]byte, error) {
+	var result struct {
+		Response struct {
+			Code      uint32 `json:"code"`
+			Codespace string `json:"codespace"`
+			Log       string `json:"log"`
+			Value     []byte `json:"value"`
+		} `json:"response"`
+	}
+	params := map[string]interface{}{"path": path, "data": hex.EncodeToString(data), "prove": false}
+	if err := b.rpc.Call("abci_query", params, &result); err != nil {
+		return nil, err
+	}
+
+	if result.Response.Code != 0 {
+		if strings.Contains(result.Response.Log, "not found") {
+			return nil, fmt.Errorf("%w: %s", errABCINotFound, result.Response.Log)
+		}
+		return nil, fmt.Errorf("abci query %s: %w", path, &ABCIError{
+			Codespace: result.Response.Codespace,
+			Code:      result.Response.Code,
+			Log:       result.Response.Log,
+		})
+	}
+	return result.Response.Value, nil
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// EthereumBackend talks to any EVM node over the standard eth_* JSON-RPC
+// methods.
+type EthereumBackend struct {
+	rpc *jsonRPCClient
+}
+
+func NewEthereumBackend(endpoint string) *EthereumBackend {
+	return &EthereumBackend{rpc: newJSONRPCClient(endpoint)}
+}
+
+func (b *EthereumBackend) GetBalance(address string) (Amount, error) {
+	var result string
+	if err := b.rpc.Call("eth_getBalance", []interface{}{address, "latest"}, &result); err != nil {
+		return Amount{}, err
+	}
+	wei, err := parseHexQuantity(result)
+	if err != nil {
+		return Amount{}, err
+	}
+	return NewAmount(wei, 18), nil
+}
+
+// GetNonce counts pending transactions so consecutive sends do not reuse a
+// nonce.
+func (b *EthereumBackend) GetNonce(address string) (uint64, error) {
+	var result string
+	if err := b.rpc.Call("eth_getTransactionCount", []interface{}{address, "pending"}, &result); err != nil {
+		return 0, err
+	}
+	nonce, err := parseHexQuantity(result)
+	if err != nil {
+		return 0, err
+	}
+	if !nonce.IsUint64() {
+		return 0, fmt.Errorf("nonce out of range: %s", result)
+	}
+	return nonce.Uint64(), nil
+}
+
+func (b *EthereumBackend) BroadcastTx(rawTx []byte) (string, error) {
+	var hash string
+	if err := b.rpc.Call("eth_sendRawTransaction", []interface{}{"0x" + hex.EncodeToString(rawTx)}, &hash); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (b *EthereumBackend) GetTx(txHash string) (*ChainTx, error) {
+	var tx *struct {
+		BlockNumber *string `json:"blockNumber"`
+	}
+	if err := b.rpc.Call("eth_getTransactionByHash", []interface{}{txHash}, &tx); err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, ErrTxNotFound
+	}
+	if tx.BlockNumber == nil {
+		return &ChainTx{Hash: txHash}, nil
+	}
+
+	var receipt *struct {
+		BlockNumber string `json:"blockNumber"`
+		Status      string `json:"status"`
+	}
+	if err := b.rpc.Call("eth_getTransactionReceipt", []interface{}{txHash}, &receipt); err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return &ChainTx{Hash: txHash}, nil
+	}
+
+	height, err := strconv.ParseInt(strings.TrimPrefix(receipt.BlockNumber, "0x"), 16, 64)
+	if err != nil {
+		return nil, fmt.Errorf("malformed block number %q", receipt.BlockNumber)
+	}
+	result := &ChainTx{
+		Hash:        txHash,
+		BlockHeight: height,
+		Confirmed:   true,
+		Success:     receipt.Status == "0x1",
+	}
+	if !result.Success {
+		result.Error = "execution reverted"
+	}
+	return result, nil
+}
+
+// parseHexQuantity decodes an Ethereum JSON-RPC QUANTITY such as "0x1bc16d674ec80000".
+func parseHexQuantity(s string) (*big.Int, error) {
+	digits, ok := strings.CutPrefix(s, "0x")
+	if !ok || digits == "" {
+		return nil, fmt.Errorf("malformed quantity %q", s)
+	}
+	n, ok := new(big.Int).SetString(digits, 16)
+	if !ok {
+		return nil, fmt.Errorf("malformed quantity %q", s)
+	}
+	return n, nil
+}
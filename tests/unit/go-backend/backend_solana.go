@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+const solanaDecimals = 9
+
+// SolanaBackend talks to a Solana JSON-RPC node.
+type SolanaBackend struct {
+	rpc *jsonRPCClient
+}
+
+func NewSolanaBackend(endpoint string) *SolanaBackend {
+	return &SolanaBackend{rpc: newJSONRPCClient(endpoint)}
+}
+
+func (b *SolanaBackend) GetBalance(address string) (Amount, error) {
+	var result struct {
+		Value uint64 `json:"value"`
+	}
+	params := []interface{}{address, map[string]string{"commitment": "confirmed"}}
+	if err := b.rpc.Call("getBalance", params, &result); err != nil {
+		return Amount{}, err
+	}
+	return NewAmount(new(big.Int).SetUint64(result.Value), solanaDecimals), nil
+}
+
+// GetNonce is not meaningful on Solana, where replay protection comes from
+// the recent blockhash.
+func (b *SolanaBackend) GetNonce(address string) (uint64, error) {
+	return 0, ErrNotSupported
+}
+
+// BroadcastTx returns the transaction's first signature, which Solana uses
+// as its id.
+func (b *SolanaBackend) BroadcastTx(rawTx []byte) (string, error) {
+	var signature string
+	params := []interface{}{
+		base64.StdEncoding.EncodeToString(rawTx),
+		map[string]string{"encoding": "base64"},
+	}
+	if err := b.rpc.Call("sendTransaction", params, &signature); err != nil {
+		return "", err
+	}
+	return signature, nil
+}
+
+func (b *SolanaBackend) GetTx(txHash string) (*ChainTx, error) {
+	var result struct {
+		Value []*struct {
+			Slot               int64           `json:"slot"`
+			ConfirmationStatus string          `json:"confirmationStatus"`
+			Err                json.RawMessage `json:"err"`
+		} `json:"value"`
+	}
+	params := []interface{}{
+		[]string{txHash},
+		map[string]bool{"searchTransactionHistory": true},
+	}
+	if err := b.rpc.Call("getSignatureStatuses", params, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Value) != 1 || result.Value[0] == nil {
+		return nil, ErrTxNotFound
+	}
+
+	status := result.Value[0]
+	tx := &ChainTx{
+		Hash:        txHash,
+		BlockHeight: status.Slot,
+		Confirmed:   status.ConfirmationStatus == "confirmed" || status.ConfirmationStatus == "finalized",
+	}
+	if len(status.Err) > 0 && string(status.Err) != "null" {
+		tx.Error = fmt.Sprintf("transaction failed: %s", status.Err)
+	} else {
+		tx.Success = tx.Confirmed
+	}
+	return tx, nil
+}
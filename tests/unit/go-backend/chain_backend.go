@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrTxNotFound   = errors.New("transaction not found")
+	ErrNotSupported = errors.New("operation not supported by chain backend")
+)
+
+// ChainBackend is the network side of a chain: balance and nonce lookups,
+// broadcasting signed transactions and polling for their inclusion.
+type ChainBackend interface {
+	GetBalance(address string) (Amount, error)
+	// GetNonce returns the next account nonce or sequence number. UTXO
+	// chains return ErrNotSupported.
+	GetNonce(address string) (uint64, error)
+	// BroadcastTx submits a signed, serialized transaction and returns its
+	// hash in the chain's native notation.
+	BroadcastTx(rawTx []byte) (string, error)
+	// GetTx returns ErrTxNotFound for hashes the node has never seen.
+	GetTx(txHash string) (*ChainTx, error)
+}
+
+// ChainTx is the inclusion status of a broadcast transaction.
+type ChainTx struct {
+	Hash        string `json:"hash"`
+	BlockHeight int64  `json:"block_height"`
+	Confirmed   bool   `json:"confirmed"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+}
+
+const defaultBackendTimeout = 30 * time.Second
+
+// RPCError is an error object returned by a JSON-RPC server.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	if len(e.Data) > 0 {
+		return fmt.Sprintf("rpc error %d: %s: %s", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// jsonRPCClient speaks JSON-RPC 2.0 over HTTP POST, which Ethereum, Solana,
+// CometBFT and Bitcoin Core nodes all accept.
+type jsonRPCClient struct {
+	endpoint string
+	client   *http.Client
+	username string
+	password string
+	nextID   atomic.Uint64
+}
+
+func newJSONRPCClient(endpoint string) *jsonRPCClient {
+	return &jsonRPCClient{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: defaultBackendTimeout},
+	}
+}
+
+type jsonRPCRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      uint64      `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type jsonRPCResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// Call invokes method and decodes the result into result, which may be nil.
+func (c *jsonRPCClient) Call(method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(jsonRPCRequest{
+		JSONRPC: "2.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+
+	// Bitcoin Core reports RPC errors with a 500 status and a JSON body
+	var decoded jsonRPCResponse
+	if err := json.Unmarshal(respBody, &decoded); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: unexpected status %s", method, resp.Status)
+		}
+		return fmt.Errorf("%s: malformed response: %w", method, err)
+	}
+	if decoded.Error != nil {
+		return fmt.Errorf("%s: %w", method, decoded.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(decoded.Result, result); err != nil {
+		return fmt.Errorf("%s: malformed result: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticBackend is a ChainBackend test double with a fixed balance.
+type staticBackend struct {
+	balance Amount
+}
+
+func (b *staticBackend) GetBalance(address string) (Amount, error) { return b.balance, nil }
+func (b *staticBackend) GetNonce(address string) (uint64, error)   { return 0, nil }
+func (b *staticBackend) BroadcastTx(rawTx []byte) (string, error)  { return "", ErrNotSupported }
+func (b *staticBackend) GetTx(txHash string) (*ChainTx, error)     { return nil, ErrTxNotFound }
+
+type rpcHandler func(params json.RawMessage) (interface{}, *RPCError)
+
+// newRPCStandIn serves JSON-RPC 2.0 from a method table, standing in for a
+// node.
+func newRPCStandIn(t *testing.T, methods map[string]rpcHandler) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     uint64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		handler, ok := methods[req.Method]
+		if !ok {
+			t.Errorf("unexpected RPC method %s", req.Method)
+			http.Error(w, "unknown method", http.StatusNotFound)
+			return
+		}
+
+		result, rpcErr := handler(req.Params)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  result,
+			"error":   rpcErr,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func decodeParams(t *testing.T, params json.RawMessage, into ...interface{}) {
+	require.NoError(t, json.Unmarshal(params, &into))
+}
+
+func TestChainBackends(t *testing.T) {
+	t.Run("Ethereum", func(t *testing.T) {
+		const txHash = "0x88df016429689c079f3b2f6ad39fa052532c56795b733da78a91ebe6a713944b"
+
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"eth_getBalance": func(params json.RawMessage) (interface{}, *RPCError) {
+				var address, block string
+				decodeParams(t, params, &address, &block)
+				assert.Equal(t, "latest", block)
+				return "0x14d1120d7b160000", nil // 1.5 ether
+			},
+			"eth_getTransactionCount": func(params json.RawMessage) (interface{}, *RPCError) {
+				var address, block string
+				decodeParams(t, params, &address, &block)
+				assert.Equal(t, "pending", block)
+				return "0x2a", nil
+			},
+			"eth_sendRawTransaction": func(params json.RawMessage) (interface{}, *RPCError) {
+				var raw string
+				decodeParams(t, params, &raw)
+				if raw != "0xf86c" {
+					return nil, &RPCError{Code: -32000, Message: "invalid sender"}
+				}
+				return txHash, nil
+			},
+			"eth_getTransactionByHash": func(params json.RawMessage) (interface{}, *RPCError) {
+				var hash string
+				decodeParams(t, params, &hash)
+				if hash != txHash {
+					return nil, nil
+				}
+				return map[string]string{"hash": txHash, "blockNumber": "0x10"}, nil
+			},
+			"eth_getTransactionReceipt": func(params json.RawMessage) (interface{}, *RPCError) {
+				return map[string]string{"blockNumber": "0x10", "status": "0x1"}, nil
+			},
+		})
+		backend := NewEthereumBackend(server.URL)
+
+		balance, err := backend.GetBalance("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+		require.NoError(t, err)
+		assert.Equal(t, "1.5", balance.String())
+		assert.Equal(t, 18, balance.Decimals())
+
+		nonce, err := backend.GetNonce("0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(42), nonce)
+
+		hash, err := backend.BroadcastTx([]byte{0xf8, 0x6c})
+		require.NoError(t, err)
+		assert.Equal(t, txHash, hash)
+
+		_, err = backend.BroadcastTx([]byte{0x00})
+		var rpcErr *RPCError
+		require.True(t, errors.As(err, &rpcErr))
+		assert.Equal(t, -32000, rpcErr.Code)
+
+		tx, err := backend.GetTx(txHash)
+		require.NoError(t, err)
+		assert.Equal(t, int64(16), tx.BlockHeight)
+		assert.True(t, tx.Confirmed)
+		assert.True(t, tx.Success)
+
+		_, err = backend.GetTx("0x00")
+		assert.ErrorIs(t, err, ErrTxNotFound)
+	})
+
+	t.Run("Esplora", func(t *testing.T) {
+		const txid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/address/bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{
+				"chain_stats": {"funded_txo_sum": 250000000, "spent_txo_sum": 100000000},
+				"mempool_stats": {"funded_txo_sum": 1000, "spent_txo_sum": 0}
+			}`)
+		})
+		mux.HandleFunc("/tx", func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "0100", string(body))
+			io.WriteString(w, txid)
+		})
+		mux.HandleFunc("/tx/"+txid+"/status", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, `{"confirmed": true, "block_height": 800000}`)
+		})
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		backend := NewEsploraBackend(server.URL + "/")
+
+		balance, err := backend.GetBalance("bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu")
+		require.NoError(t, err)
+		assert.Equal(t, "1.50001", balance.String())
+
+		_, err = backend.GetNonce("bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu")
+		assert.ErrorIs(t, err, ErrNotSupported)
+
+		hash, err := backend.BroadcastTx([]byte{0x01, 0x00})
+		require.NoError(t, err)
+		assert.Equal(t, txid, hash)
+
+		tx, err := backend.GetTx(txid)
+		require.NoError(t, err)
+		assert.Equal(t, int64(800000), tx.BlockHeight)
+		assert.True(t, tx.Confirmed)
+
+		_, err = backend.GetTx("00")
+		assert.ErrorIs(t, err, ErrTxNotFound)
+	})
+
+	t.Run("BitcoinCore", func(t *testing.T) {
+		const txid = "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"
+
+		rpc := newRPCStandIn(t, map[string]rpcHandler{
+			"scantxoutset": func(params json.RawMessage) (interface{}, *RPCError) {
+				var action string
+				var descriptors []string
+				decodeParams(t, params, &action, &descriptors)
+				assert.Equal(t, "start", action)
+				assert.Equal(t, []string{"addr(1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA)"}, descriptors)
+				return json.RawMessage(`{"success": true, "total_amount": 0.12345678}`), nil
+			},
+			"getrawtransaction": func(params json.RawMessage) (interface{}, *RPCError) {
+				var hash string
+				var verbose bool
+				decodeParams(t, params, &hash, &verbose)
+				if hash != txid {
+					return nil, &RPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+				}
+				return map[string]interface{}{"blockhash": "00000000000000000002", "confirmations": 6}, nil
+			},
+			"getblockheader": func(params json.RawMessage) (interface{}, *RPCError) {
+				return map[string]int64{"height": 800001}, nil
+			},
+		})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "rpcuser" || password != "rpcpass" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			rpc.Config.Handler.ServeHTTP(w, r)
+		}))
+		defer server.Close()
+		backend := NewBitcoinCoreBackend(server.URL, "rpcuser", "rpcpass")
+
+		balance, err := backend.GetBalance("1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")
+		require.NoError(t, err)
+		assert.Equal(t, "12345678", balance.BaseUnits().String())
+
+		tx, err := backend.GetTx(txid)
+		require.NoError(t, err)
+		assert.Equal(t, int64(800001), tx.BlockHeight)
+		assert.True(t, tx.Success)
+
+		_, err = backend.GetTx("00")
+		assert.ErrorIs(t, err, ErrTxNotFound)
+
+		_, err = NewBitcoinCoreBackend(server.URL, "rpcuser", "wrong").GetBalance("1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")
+		assert.Error(t, err)
+	})
+
+	t.Run("Solana", func(t *testing.T) {
+		const signature = "5VERv8NMvzbJMEkV8xnrLkEaWRtSz9CosKDYjCJjBRnbJLgp8uirBgmQpjKhoR4tjF3ZpRzrFmBV6UjKdiSZkQUW"
+
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"getBalance": func(params json.RawMessage) (interface{}, *RPCError) {
+				return map[string]interface{}{"context": map[string]int{"slot": 1}, "value": 1500000000}, nil
+			},
+			"sendTransaction": func(params json.RawMessage) (interface{}, *RPCError) {
+				var encoded string
+				var config map[string]string
+				decodeParams(t, params, &encoded, &config)
+				assert.Equal(t, "base64", config["encoding"])
+				assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("signed")), encoded)
+				return signature, nil
+			},
+			"getSignatureStatuses": func(params json.RawMessage) (interface{}, *RPCError) {
+				var signatures []string
+				decodeParams(t, params, &signatures)
+				switch signatures[0] {
+				case signature:
+					return json.RawMessage(`{"value": [{"slot": 72, "confirmationStatus": "finalized", "err": null}]}`), nil
+				case "failed":
+					return json.RawMessage(`{"value": [{"slot": 73, "confirmationStatus": "confirmed", "err": {"InstructionError": [0, {"Custom": 1}]}}]}`), nil
+				default:
+					return json.RawMessage(`{"value": [null]}`), nil
+				}
+			},
+		})
+		backend := NewSolanaBackend(server.URL)
+
+		balance, err := backend.GetBalance("HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk")
+		require.NoError(t, err)
+		assert.Equal(t, "1.5", balance.String())
+
+		hash, err := backend.BroadcastTx([]byte("signed"))
+		require.NoError(t, err)
+		assert.Equal(t, signature, hash)
+
+		tx, err := backend.GetTx(signature)
+		require.NoError(t, err)
+		assert.Equal(t, int64(72), tx.BlockHeight)
+		assert.True(t, tx.Success)
+
+		tx, err = backend.GetTx("failed")
+		require.NoError(t, err)
+		assert.True(t, tx.Confirmed)
+		assert.False(t, tx.Success)
+		assert.Contains(t, tx.Error, "InstructionError")
+
+		_, err = backend.GetTx("unknown")
+		assert.ErrorIs(t, err, ErrTxNotFound)
+	})
+
+	t.Run("Cosmos", func(t *testing.T) {
+		const address = "xion1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5"
+		const txHash = "D5B6A4C5E3F2A1B0C9D8E7F6A5B4C3D2E1F0A9B8C7D6E5F4A3B2C1D0E9F8A7B6"
+
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"abci_query": func(params json.RawMessage) (interface{}, *RPCError) {
+				var query struct {
+					Path string `json:"path"`
+					Data string `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(params, &query))
+				data, err := hex.DecodeString(query.Data)
+				require.NoError(t, err)
+				fields, err := protoFields(data)
+				require.NoError(t, err)
+
+				if string(fields[0].Bytes) != address {
+					return map[string]interface{}{"response": map[string]interface{}{
+						"code": 22, "log": "account " + string(fields[0].Bytes) + ": key not found",
+					}}, nil
+				}
+
+				var value []byte
+				switch query.Path {
+				case "/cosmos.bank.v1beta1.Query/Balance":
+					assert.Equal(t, "uxion", string(fields[1].Bytes))
+					coin := protoAppendString(nil, 1, "uxion")
+					coin = protoAppendString(coin, 2, "2500000")
+					value = protoAppendBytes(nil, 1, coin)
+				case "/cosmos.auth.v1beta1.Query/Account":
+					account := protoAppendString(nil, 1, address)
+					account = protoAppendUint64(account, 3, 17)
+					account = protoAppendUint64(account, 4, 5)
+					anyAccount := protoAppendString(nil, 1, baseAccountTypeURL)
+					anyAccount = protoAppendBytes(anyAccount, 2, account)
+					value = protoAppendBytes(nil, 1, anyAccount)
+				default:
+					t.Errorf("unexpected query path %s", query.Path)
+				}
+				return map[string]interface{}{"response": map[string]interface{}{"code": 0, "value": value}}, nil
+			},
+			"broadcast_tx_sync": func(params json.RawMessage) (interface{}, *RPCError) {
+				var req map[string]string
+				require.NoError(t, json.Unmarshal(params, &req))
+				if req["tx"] != base64.StdEncoding.EncodeToString([]byte("signed")) {
+					return map[string]interface{}{"code": 5, "codespace": "sdk", "log": "insufficient funds"}, nil
+				}
+				return map[string]interface{}{"code": 0, "hash": txHash}, nil
+			},
+			"tx": func(params json.RawMessage) (interface{}, *RPCError) {
+				var req map[string]interface{}
+				require.NoError(t, json.Unmarshal(params, &req))
+				hash, _ := base64.StdEncoding.DecodeString(req["hash"].(string))
+				if hex.EncodeToString(hash) != "d5b6a4c5e3f2a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6e5f4a3b2c1d0e9f8a7b6" {
+					return nil, &RPCError{Code: -32603, Message: "Internal error", Data: json.RawMessage(`"tx (` + hex.EncodeToString(hash) + `) not found"`)}
+				}
+				return map[string]interface{}{"hash": txHash, "height": "1234", "tx_result": map[string]interface{}{"code": 0}}, nil
+			},
+		})
+		backend := NewCosmosBackend(server.URL, "uxion", 6)
+
+		balance, err := backend.GetBalance(address)
+		require.NoError(t, err)
+		assert.Equal(t, "2.5", balance.String())
+
+		accountNumber, sequence, err := backend.GetAccount(address)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(17), accountNumber)
+		assert.Equal(t, uint64(5), sequence)
+
+		// Accounts unknown to the chain start at sequence zero
+		nonce, err := backend.GetNonce("xion1newaccount")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), nonce)
+
+		hash, err := backend.BroadcastTx([]byte("signed"))
+		require.NoError(t, err)
+		assert.Equal(t, txHash, hash)
+
+		_, err = backend.BroadcastTx([]byte("unfunded"))
+		assert.ErrorContains(t, err, "insufficient funds")
+
+		tx, err := backend.GetTx(txHash)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1234), tx.BlockHeight)
+		assert.True(t, tx.Success)
+
+		_, err = backend.GetTx("00")
+		assert.ErrorIs(t, err, ErrTxNotFound)
+	})
+
+	t.Run("CosmosAccountTypes", func(t *testing.T) {
+		// Each address holds an account of one type, number 17 at sequence 5
+		base := protoAppendString(nil, 1, "xion1account")
+		base = protoAppendUint64(base, 3, 17)
+		base = protoAppendUint64(base, 4, 5)
+		baseVesting := protoAppendBytes(nil, 1, base)
+		baseVesting = protoAppendBytes(baseVesting, 2, protoAppendString(protoAppendString(nil, 1, "uxion"), 2, "1000"))
+		accounts := map[string]struct {
+			typeURL string
+			value   []byte
+		}{
+			"abstract":   {"/abstractaccount.v1.AbstractAccount", base},
+			"module":     {"/cosmos.auth.v1beta1.ModuleAccount", protoAppendString(protoAppendBytes(nil, 1, base), 2, "fee_collector")},
+			"continuous": {"/cosmos.vesting.v1beta1.ContinuousVestingAccount", protoAppendUint64(protoAppendBytes(nil, 1, baseVesting), 2, 1700000000)},
+			"delayed":    {"/cosmos.vesting.v1beta1.DelayedVestingAccount", protoAppendBytes(nil, 1, baseVesting)},
+			"periodic":   {"/cosmos.vesting.v1beta1.PeriodicVestingAccount", protoAppendUint64(protoAppendBytes(nil, 1, baseVesting), 2, 1700000000)},
+			"locked":     {"/cosmos.vesting.v1beta1.PermanentLockedAccount", protoAppendBytes(nil, 1, baseVesting)},
+			"hollow":     {"/cosmos.vesting.v1beta1.DelayedVestingAccount", protoAppendUint64(nil, 2, 1)},
+			"unknown":    {"/cosmos.auth.v1beta1.Unknown", base},
+		}
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"abci_query": func(params json.RawMessage) (interface{}, *RPCError) {
+				var query struct {
+					Data string `json:"data"`
+				}
+				require.NoError(t, json.Unmarshal(params, &query))
+				data, err := hex.DecodeString(query.Data)
+				require.NoError(t, err)
+				fields, err := protoFields(data)
+				require.NoError(t, err)
+				account := accounts[string(fields[0].Bytes)]
+				anyAccount := protoAppendString(nil, 1, account.typeURL)
+				anyAccount = protoAppendBytes(anyAccount, 2, account.value)
+				return map[string]interface{}{"response": map[string]interface{}{"code": 0, "value": protoAppendBytes(nil, 1, anyAccount)}}, nil
+			},
+		})
+		backend := NewCosmosBackend(server.URL, "uxion", 6)
+
+		for _, address := range []string{"abstract", "module", "continuous", "delayed", "periodic", "locked"} {
+			accountNumber, sequence, err := backend.GetAccount(address)
+			require.NoError(t, err, address)
+			assert.Equal(t, uint64(17), accountNumber, address)
+			assert.Equal(t, uint64(5), sequence, address)
+		}
+
+		_, _, err := backend.GetAccount("hollow")
+		assert.ErrorIs(t, err, ErrMalformedProto)
+		_, _, err = backend.GetAccount("unknown")
+		assert.ErrorContains(t, err, "unsupported account type")
+	})
+
+	t.Run("ServiceRouting", func(t *testing.T) {
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"eth_getBalance": func(params json.RawMessage) (interface{}, *RPCError) {
+				return "0x1", nil
+			},
+		})
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+		service.RegisterBackend("ETH", NewEthereumBackend(server.URL))
+
+		balance, err := service.GetWalletBalance("0x9858EfFD232B4033E47d90003D41EC34EcaEda94", "ETH")
+		require.NoError(t, err)
+		assert.Equal(t, "0.000000000000000001", balance.String())
+
+		_, err = service.GetWalletBalance("HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk", "SOL")
+		assert.ErrorContains(t, err, "balance retrieval not implemented")
+	})
+}
@@ -0,0 +1,316 @@
+package tests
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed chains.yaml
+var defaultChainsYAML []byte
+
+var ErrInvalidChainConfig = errors.New("invalid chain config")
+
+// ChainConfig describes one chain: how its keys are derived, how addresses
+// look and where its nodes are.
+type ChainConfig struct {
+	Symbol         string        `yaml:"symbol"`
+	Name           string        `yaml:"name"`
+	Network        string        `yaml:"network"`
+	Decimals       int           `yaml:"decimals"`
+	CoinType       uint32        `yaml:"coin_type"`
+	Curve          Curve         `yaml:"curve"`
+	DerivationPath string        `yaml:"derivation_path"`
+	Address        AddressConfig `yaml:"address"`
+	Backend        string        `yaml:"backend"`
+	RPCEndpoints   []string      `yaml:"rpc_endpoints"`
+	Denom          string        `yaml:"denom"`
+
+	codec AddressCodec
+}
+
+// AddressConfig selects and parameterizes an AddressCodec.
+type AddressConfig struct {
+	Codec             string `yaml:"codec"`
+	PubKeyHashVersion uint8  `yaml:"pubkey_hash_version"`
+	ScriptHashVersion uint8  `yaml:"script_hash_version"`
+	SegwitHRP         string `yaml:"segwit_hrp"`
+	HRP               string `yaml:"hrp"`
+
+	// ScriptType is what bitcoin receive addresses pay to: p2pkh (the
+	// default), p2sh-p2wpkh or p2wpkh. It also picks the BIP-44, 49 or 84
+	// purpose of the default derivation path.
+	ScriptType string `yaml:"script_type"`
+}
+
+// bip32Purposes are the derivation path purposes of the bitcoin script
+// types.
+var bip32Purposes = map[string]int{
+	"p2pkh":       44,
+	"p2sh-p2wpkh": 49,
+	"p2wpkh":      84,
+}
+
+// Info returns the public description of the chain.
+func (c *ChainConfig) Info() ChainInfo {
+	return ChainInfo{Symbol: c.Symbol, Name: c.Name, Network: c.Network, Decimals: c.Decimals}
+}
+
+func (c *ChainConfig) Codec() AddressCodec {
+	return c.codec
+}
+
+var chainBackendFactories = map[string]func(c *ChainConfig, endpoint string) ChainBackend{
+	"esplora": func(c *ChainConfig, endpoint string) ChainBackend { return NewEsploraBackend(endpoint) },
+	"bitcoin-core": func(c *ChainConfig, endpoint string) ChainBackend {
+		// Credentials, if any, travel in the endpoint URL
+		return NewBitcoinCoreBackend(endpoint, "", "")
+	},
+	"ethereum": func(c *ChainConfig, endpoint string) ChainBackend { return NewEthereumBackend(endpoint) },
+	"solana":   func(c *ChainConfig, endpoint string) ChainBackend { return NewSolanaBackend(endpoint) },
+	"cosmos": func(c *ChainConfig, endpoint string) ChainBackend {
+		return NewCosmosBackend(endpoint, c.Denom, c.Decimals)
+	},
+}
+
+// NewBackend connects to the configured RPC endpoints. It returns nil when
+// the chain has none.
+func (c *ChainConfig) NewBackend() ChainBackend {
+	var backends []ChainBackend
+	for _, endpoint := range c.RPCEndpoints {
+		backends = append(backends, chainBackendFactories[c.Backend](c, endpoint))
+	}
+
+	switch len(backends) {
+	case 0:
+		return nil
+	case 1:
+		return backends[0]
+	default:
+		return &failoverBackend{backends: backends}
+	}
+}
+
+// normalize fills defaults, validates the entry and builds its codec.
+func (c *ChainConfig) normalize() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidChainConfig, c.Symbol, fmt.Sprintf(format, args...))
+	}
+
+	if c.Symbol == "" {
+		return fmt.Errorf("%w: chain without symbol", ErrInvalidChainConfig)
+	}
+	if c.Name == "" || c.Network == "" {
+		return invalid("name and network are required")
+	}
+	if c.Decimals < 0 {
+		return invalid("negative decimals")
+	}
+
+	if c.Curve == "" {
+		c.Curve = CurveSecp256k1
+	}
+	purpose := 44
+	if c.Address.ScriptType != "" {
+		var ok bool
+		if purpose, ok = bip32Purposes[c.Address.ScriptType]; !ok {
+			return invalid("unknown script type %q", c.Address.ScriptType)
+		}
+		if c.Address.Codec != "bitcoin" {
+			return invalid("script type %s needs the bitcoin codec", c.Address.ScriptType)
+		}
+		if c.Address.ScriptType == "p2wpkh" && c.Address.SegwitHRP == "" {
+			return invalid("p2wpkh needs a segwit_hrp")
+		}
+	}
+	if c.DerivationPath == "" {
+		c.DerivationPath = fmt.Sprintf("m/%d'/%d'/0'/0/0", purpose, c.CoinType)
+		if c.Curve == CurveEd25519 {
+			c.DerivationPath = fmt.Sprintf("m/44'/%d'/0'/0'", c.CoinType)
+		}
+	}
+	if _, err := ParseDerivationPath(c.DerivationPath); err != nil {
+		return invalid("%v", err)
+	}
+
+	defaultBackend := ""
+	switch c.Address.Codec {
+	case "bitcoin":
+		c.codec = &BitcoinCodec{
+			PubKeyHashVersion: c.Address.PubKeyHashVersion,
+			ScriptHashVersion: c.Address.ScriptHashVersion,
+			SegwitHRP:         c.Address.SegwitHRP,
+			Segwit:            c.Address.ScriptType == "p2wpkh",
+			NestedSegwit:      c.Address.ScriptType == "p2sh-p2wpkh",
+		}
+		defaultBackend = "esplora"
+	case "evm":
+		c.codec = &EVMCodec{}
+		defaultBackend = "ethereum"
+	case "solana":
+		c.codec = &SolanaCodec{}
+		defaultBackend = "solana"
+	case "bech32":
+		if c.Address.HRP == "" {
+			return invalid("bech32 codec needs an hrp")
+		}
+		c.codec = &Bech32Codec{HRP: c.Address.HRP}
+		defaultBackend = "cosmos"
+	default:
+		return invalid("unknown address codec %q", c.Address.Codec)
+	}
+
+	if (c.Curve == CurveEd25519) != (c.Address.Codec == "solana") {
+		return invalid("curve %s does not match address codec %s", c.Curve, c.Address.Codec)
+	}
+
+	if c.Backend == "" {
+		c.Backend = defaultBackend
+	}
+	if _, ok := chainBackendFactories[c.Backend]; !ok {
+		return invalid("unknown backend %q", c.Backend)
+	}
+	if c.Backend == "cosmos" && len(c.RPCEndpoints) > 0 && c.Denom == "" {
+		return invalid("cosmos backend needs a denom")
+	}
+	for _, endpoint := range c.RPCEndpoints {
+		if u, err := url.Parse(endpoint); err != nil || u.Host == "" {
+			return invalid("malformed rpc endpoint %q", endpoint)
+		}
+	}
+	return nil
+}
+
+// ChainRegistry is the set of chains a service supports, in configuration
+// order.
+type ChainRegistry struct {
+	chains    []*ChainConfig
+	bySymbol  map[string]*ChainConfig
+	byNetwork map[string]*ChainConfig
+}
+
+// NewChainRegistry validates chains and indexes them by symbol and network.
+func NewChainRegistry(chains []ChainConfig) (*ChainRegistry, error) {
+	registry := &ChainRegistry{
+		bySymbol:  make(map[string]*ChainConfig),
+		byNetwork: make(map[string]*ChainConfig),
+	}
+
+	for i := range chains {
+		chain := chains[i]
+		if err := chain.normalize(); err != nil {
+			return nil, err
+		}
+		if _, exists := registry.bySymbol[chain.Symbol]; exists {
+			return nil, fmt.Errorf("%w: duplicate symbol %s", ErrInvalidChainConfig, chain.Symbol)
+		}
+		if _, exists := registry.byNetwork[chain.Network]; exists {
+			return nil, fmt.Errorf("%w: duplicate network %s", ErrInvalidChainConfig, chain.Network)
+		}
+
+		registry.chains = append(registry.chains, &chain)
+		registry.bySymbol[chain.Symbol] = &chain
+		registry.byNetwork[chain.Network] = &chain
+	}
+	return registry, nil
+}
+
+// ParseChainRegistry reads a registry document. YAML is a superset of JSON,
+// so both formats are accepted.
+func ParseChainRegistry(data []byte) (*ChainRegistry, error) {
+	var doc struct {
+		Chains []ChainConfig `yaml:"chains"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidChainConfig, err)
+	}
+	return NewChainRegistry(doc.Chains)
+}
+
+// LoadChainRegistry reads a YAML or JSON registry file.
+func LoadChainRegistry(path string) (*ChainRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseChainRegistry(data)
+}
+
+var defaultChainRegistry = mustParseChainRegistry(defaultChainsYAML)
+
+func mustParseChainRegistry(data []byte) *ChainRegistry {
+	registry, err := ParseChainRegistry(data)
+	if err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// DefaultChainRegistry returns the built-in chains from chains.yaml.
+func DefaultChainRegistry() *ChainRegistry {
+	return defaultChainRegistry
+}
+
+// Get returns the chain registered under symbol.
+func (r *ChainRegistry) Get(symbol string) (*ChainConfig, error) {
+	chain, ok := r.bySymbol[symbol]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedChain, symbol)
+	}
+	return chain, nil
+}
+
+// ByNetwork returns the chain whose network name, as stored on wallets, is
+// network.
+func (r *ChainRegistry) ByNetwork(network string) (*ChainConfig, error) {
+	chain, ok := r.byNetwork[network]
+	if !ok {
+		return nil, fmt.Errorf("%w: network %s", ErrUnsupportedChain, network)
+	}
+	return chain, nil
+}
+
+func (r *ChainRegistry) Chains() []*ChainConfig {
+	return r.chains
+}
+
+// failoverBackend tries each endpoint in order, moving on only when a node
+// is unreachable. Errors reported by a node are returned as-is.
+type failoverBackend struct {
+	backends []ChainBackend
+}
+
+func failover[T any](backends []ChainBackend, call func(ChainBackend) (T, error)) (T, error) {
+	var (
+		result T
+		err    error
+	)
+	for _, backend := range backends {
+		result, err = call(backend)
+		var urlErr *url.Error
+		if !errors.As(err, &urlErr) {
+			return result, err
+		}
+	}
+	return result, err
+}
+
+func (b *failoverBackend) GetBalance(address string) (Amount, error) {
+	return failover(b.backends, func(backend ChainBackend) (Amount, error) { return backend.GetBalance(address) })
+}
+
+func (b *failoverBackend) GetNonce(address string) (uint64, error) {
+	return failover(b.backends, func(backend ChainBackend) (uint64, error) { return backend.GetNonce(address) })
+}
+
+func (b *failoverBackend) BroadcastTx(rawTx []byte) (string, error) {
+	return failover(b.backends, func(backend ChainBackend) (string, error) { return backend.BroadcastTx(rawTx) })
+}
+
+func (b *failoverBackend) GetTx(txHash string) (*ChainTx, error) {
+	return failover(b.backends, func(backend ChainBackend) (*ChainTx, error) { return backend.GetTx(txHash) })
+}
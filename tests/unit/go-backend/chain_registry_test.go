@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainRegistry(t *testing.T) {
+	testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	t.Run("DefaultRegistry", func(t *testing.T) {
+		registry := DefaultChainRegistry()
+
+		var symbols []string
+		for _, chain := range registry.Chains() {
+			symbols = append(symbols, chain.Symbol)
+		}
+		assert.Equal(t, []string{"BTC", "ETH", "LTC", "DASH", "SOL", "NRN", "XION"}, symbols)
+
+		sol, err := registry.Get("SOL")
+		require.NoError(t, err)
+		assert.Equal(t, CurveEd25519, sol.Curve)
+		assert.Equal(t, "m/44'/501'/0'/0'", sol.DerivationPath)
+
+		eth, err := registry.ByNetwork("ethereum")
+		require.NoError(t, err)
+		assert.Equal(t, "m/44'/60'/0'/0/0", eth.DerivationPath)
+		assert.Nil(t, eth.NewBackend())
+
+		_, err = registry.Get("DOGE")
+		assert.ErrorIs(t, err, ErrUnsupportedChain)
+	})
+
+	t.Run("ConfigOnlyChains", func(t *testing.T) {
+		config := map[string]interface{}{
+			"chains": []map[string]interface{}{
+				{
+					"symbol": "MATIC", "name": "Polygon", "network": "polygon", "decimals": 18,
+					"coin_type": 60, "address": map[string]string{"codec": "evm"},
+				},
+				{
+					"symbol": "ATOM", "name": "Cosmos Hub", "network": "cosmoshub", "decimals": 6,
+					"coin_type": 118, "address": map[string]string{"codec": "bech32", "hrp": "cosmos"},
+				},
+			},
+		}
+		data, err := json.Marshal(config)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "chains.json")
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		registry, err := LoadChainRegistry(path)
+		require.NoError(t, err)
+		service := NewMultichainWalletServiceWithRegistry(NewMemoryWalletRepository(), registry)
+
+		assert.Equal(t, []ChainInfo{
+			{Symbol: "MATIC", Name: "Polygon", Network: "polygon", Decimals: 18},
+			{Symbol: "ATOM", Name: "Cosmos Hub", Network: "cosmoshub", Decimals: 6},
+		}, service.GetSupportedChains())
+
+		polygon, err := service.GenerateWalletForChain(testMnemonic, "MATIC")
+		require.NoError(t, err)
+		assert.Equal(t, "0x9858EfFD232B4033E47d90003D41EC34EcaEda94", polygon.Address)
+
+		hub, err := service.GenerateWalletForChain(testMnemonic, "ATOM")
+		require.NoError(t, err)
+		assert.Equal(t, "cosmos19rl4cm2hmr8afy4kldpxz3fka4jguq0auqdal4", hub.Address)
+
+		_, err = service.GenerateWalletForChain(testMnemonic, "BTC")
+		assert.ErrorIs(t, err, ErrUnsupportedChain)
+		assert.Equal(t, "polygon", service.getNetworkName("MATIC"))
+	})
+
+	t.Run("EndpointsCreateBackends", func(t *testing.T) {
+		server := newRPCStandIn(t, map[string]rpcHandler{
+			"eth_getBalance": func(params json.RawMessage) (interface{}, *RPCError) {
+				return "0xde0b6b3a7640000", nil // 1 ether
+			},
+		})
+
+		// The first node is down, so the second one answers
+		down := httptest.NewServer(nil)
+		down.Close()
+
+		registry, err := ParseChainRegistry([]byte(`
+chains:
+  - symbol: BASE
+    name: Base
+    network: base
+    decimals: 18
+    coin_type: 60
+    address: {codec: evm}
+    rpc_endpoints:
+      - ` + down.URL + `
+      - ` + server.URL + `
+`))
+		require.NoError(t, err)
+		service := NewMultichainWalletServiceWithRegistry(NewMemoryWalletRepository(), registry)
+
+		balance, err := service.GetWalletBalance("0x9858EfFD232B4033E47d90003D41EC34EcaEda94", "BASE")
+		require.NoError(t, err)
+		assert.Equal(t, "1", balance.String())
+	})
+
+	t.Run("ScriptTypes", func(t *testing.T) {
+		registry, err := ParseChainRegistry([]byte(`
+chains:
+  - {symbol: BTC, name: Bitcoin, network: bitcoin, coin_type: 0,
+     address: {codec: bitcoin, pubkey_hash_version: 0x00, script_hash_version: 0x05, segwit_hrp: bc, script_type: p2pkh}}
+  - {symbol: BTC-NESTED, name: Bitcoin, network: bitcoin-nested, coin_type: 0,
+     address: {codec: bitcoin, pubkey_hash_version: 0x00, script_hash_version: 0x05, segwit_hrp: bc, script_type: p2sh-p2wpkh}}
+  - {symbol: BTC-SEGWIT, name: Bitcoin, network: bitcoin-segwit, coin_type: 0,
+     address: {codec: bitcoin, pubkey_hash_version: 0x00, script_hash_version: 0x05, segwit_hrp: bc, script_type: p2wpkh}}
+`))
+		require.NoError(t, err)
+		service := NewMultichainWalletServiceWithRegistry(NewMemoryWalletRepository(), registry)
+
+		// The first receive addresses of BIP-44, 49 and 84
+		for symbol, want := range map[string]struct{ path, address string }{
+			"BTC":        {"m/44'/0'/0'/0/0", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+			"BTC-NESTED": {"m/49'/0'/0'/0/0", "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+			"BTC-SEGWIT": {"m/84'/0'/0'/0/0", "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		} {
+			chain, err := registry.Get(symbol)
+			require.NoError(t, err)
+			assert.Equal(t, want.path, chain.DerivationPath, symbol)
+			wallet, err := service.GenerateWalletForChain(testMnemonic, symbol)
+			require.NoError(t, err)
+			assert.Equal(t, want.address, wallet.Address, symbol)
+		}
+	})
+
+	t.Run("InvalidConfigs", func(t *testing.T) {
+		tests := map[string]string{
+			"MissingSymbol":    `chains: [{name: X, network: x, address: {codec: evm}}]`,
+			"UnknownCodec":     `chains: [{symbol: X, name: X, network: x, address: {codec: ripple}}]`,
+			"CurveMismatch":    `chains: [{symbol: X, name: X, network: x, curve: ed25519, address: {codec: evm}}]`,
+			"Bech32WithoutHRP": `chains: [{symbol: X, name: X, network: x, address: {codec: bech32}}]`,
+			"UnknownScript":    `chains: [{symbol: X, name: X, network: x, address: {codec: bitcoin, segwit_hrp: x, script_type: p2tr}}]`,
+			"ScriptNotBitcoin": `chains: [{symbol: X, name: X, network: x, address: {codec: evm, script_type: p2wpkh}}]`,
+			"SegwitWithoutHRP": `chains: [{symbol: X, name: X, network: x, address: {codec: bitcoin, script_type: p2wpkh}}]`,
+			"BadPath":          `chains: [{symbol: X, name: X, network: x, derivation_path: "44/60", address: {codec: evm}}]`,
+			"UnknownBackend":   `chains: [{symbol: X, name: X, network: x, backend: electrum, address: {codec: bitcoin}}]`,
+			"CosmosNoDenom":    `chains: [{symbol: X, name: X, network: x, rpc_endpoints: ["http://localhost:26657"], address: {codec: bech32, hrp: x}}]`,
+			"BadEndpoint":      `chains: [{symbol: X, name: X, network: x, rpc_endpoints: ["localhost"], address: {codec: evm}}]`,
+			"DuplicateSymbol": `chains: [{symbol: X, name: X, network: x, address: {codec: evm}},
+				{symbol: X, name: Y, network: y, address: {codec: evm}}]`,
+			"Malformed": `chains: {`,
+		}
+
+		for name, config := range tests {
+			t.Run(name, func(t *testing.T) {
+				_, err := ParseChainRegistry([]byte(config))
+				assert.ErrorIs(t, err, ErrInvalidChainConfig)
+			})
+		}
+	})
+}
@@ -0,0 +1,365 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// x/feegrant lets a granter pay the fees of another account's transactions
+// up to an allowance; x/authz lets a grantee execute messages on behalf of
+// the granter. Together they are how the wallet sponsors gas for meta
+// accounts.
+
+const (
+	basicAllowanceTypeURL      = "/cosmos.feegrant.v1beta1.BasicAllowance"
+	periodicAllowanceTypeURL   = "/cosmos.feegrant.v1beta1.PeriodicAllowance"
+	allowedMsgAllowanceTypeURL = "/cosmos.feegrant.v1beta1.AllowedMsgAllowance"
+	msgGrantAllowanceTypeURL   = "/cosmos.feegrant.v1beta1.MsgGrantAllowance"
+	msgRevokeAllowanceTypeURL  = "/cosmos.feegrant.v1beta1.MsgRevokeAllowance"
+
+	genericAuthorizationTypeURL = "/cosmos.authz.v1beta1.GenericAuthorization"
+	msgGrantTypeURL             = "/cosmos.authz.v1beta1.MsgGrant"
+	msgExecTypeURL              = "/cosmos.authz.v1beta1.MsgExec"
+	msgRevokeTypeURL            = "/cosmos.authz.v1beta1.MsgRevoke"
+)
+
+var ErrAllowanceNotFound = errors.New("fee allowance not found")
+
+// FeeAllowance is one of the x/feegrant allowance types.
+type FeeAllowance interface {
+	TypeURL() string
+	marshal() []byte
+}
+
+// BasicAllowance covers fees up to SpendLimit until Expiration. An empty
+// SpendLimit is unlimited and a zero Expiration never expires.
+type BasicAllowance struct {
+	SpendLimit []CosmosCoin
+	Expiration time.Time
+}
+
+func (BasicAllowance) TypeURL() string { return basicAllowanceTypeURL }
+
+func (a BasicAllowance) marshal() []byte {
+	var b []byte
+	for _, coin := range a.SpendLimit {
+		b = protoAppendBytes(b, 1, coin.marshal())
+	}
+	if !a.Expiration.IsZero() {
+		b = protoAppendMessage(b, 2, marshalTimestamp(a.Expiration))
+	}
+	return b
+}
+
+// PeriodicAllowance additionally caps spending per Period. The chain resets
+// PeriodCanSpend to PeriodSpendLimit at PeriodReset; a zero PeriodReset is
+// set to the grant's block time plus Period.
+type PeriodicAllowance struct {
+	Basic            BasicAllowance
+	Period           time.Duration
+	PeriodSpendLimit []CosmosCoin
+	PeriodCanSpend   []CosmosCoin
+	PeriodReset      time.Time
+}
+
+func (PeriodicAllowance) TypeURL() string { return periodicAllowanceTypeURL }
+
+func (a PeriodicAllowance) marshal() []byte {
+	b := protoAppendMessage(nil, 1, a.Basic.marshal())
+	b = protoAppendMessage(b, 2, marshalDuration(a.Period))
+	for _, coin := range a.PeriodSpendLimit {
+		b = protoAppendBytes(b, 3, coin.marshal())
+	}
+	for _, coin := range a.PeriodCanSpend {
+		b = protoAppendBytes(b, 4, coin.marshal())
+	}
+	var reset []byte
+	if !a.PeriodReset.IsZero() {
+		reset = marshalTimestamp(a.PeriodReset)
+	}
+	return protoAppendMessage(b, 5, reset)
+}
+
+// AllowedMsgAllowance restricts Allowance to transactions made up only of
+// the listed message types.
+type AllowedMsgAllowance struct {
+	Allowance       FeeAllowance
+	AllowedMessages []string
+}
+
+func (AllowedMsgAllowance) TypeURL() string { return allowedMsgAllowanceTypeURL }
+
+func (a AllowedMsgAllowance) marshal() []byte {
+	b := protoAppendBytes(nil, 1, packAllowance(a.Allowance).marshal())
+	for _, typeURL := range a.AllowedMessages {
+		b = protoAppendString(b, 2, typeURL)
+	}
+	return b
+}
+
+func packAllowance(allowance FeeAllowance) CosmosMsg {
+	return CosmosMsg{TypeURL: allowance.TypeURL(), Value: allowance.marshal()}
+}
+
+// FeeGrant is an allowance as stored on chain. Spend limits reflect what is
+// left, not what was granted.
+type FeeGrant struct {
+	Granter   string
+	Grantee   string
+	Allowance FeeAllowance
+}
+
+// NewMsgGrantAllowance grants allowance from granter to grantee. It replaces
+// nothing: an existing grant must be revoked first.
+func NewMsgGrantAllowance(granter, grantee string, allowance FeeAllowance) CosmosMsg {
+	value := protoAppendString(nil, 1, granter)
+	value = protoAppendString(value, 2, grantee)
+	value = protoAppendBytes(value, 3, packAllowance(allowance).marshal())
+	return CosmosMsg{TypeURL: msgGrantAllowanceTypeURL, Value: value}
+}
+
+func NewMsgRevokeAllowance(granter, grantee string) CosmosMsg {
+	value := protoAppendString(nil, 1, granter)
+	value = protoAppendString(value, 2, grantee)
+	return CosmosMsg{TypeURL: msgRevokeAllowanceTypeURL, Value: value}
+}
+
+// NewMsgGrantAuthorization lets grantee execute messages of msgTypeURL as
+// granter until expiration, or indefinitely if it is zero. The granter signs
+// it.
+func NewMsgGrantAuthorization(granter, grantee, msgTypeURL string, expiration time.Time) CosmosMsg {
+	authorization := CosmosMsg{TypeURL: genericAuthorizationTypeURL, Value: protoAppendString(nil, 1, msgTypeURL)}
+	grant := protoAppendBytes(nil, 1, authorization.marshal())
+	if !expiration.IsZero() {
+		grant = protoAppendMessage(grant, 2, marshalTimestamp(expiration))
+	}
+
+	value := protoAppendString(nil, 1, granter)
+	value = protoAppendString(value, 2, grantee)
+	value = protoAppendMessage(value, 3, grant)
+	return CosmosMsg{TypeURL: msgGrantTypeURL, Value: value}
+}
+
+func NewMsgRevokeAuthorization(granter, grantee, msgTypeURL string) CosmosMsg {
+	value := protoAppendString(nil, 1, granter)
+	value = protoAppendString(value, 2, grantee)
+	value = protoAppendString(value, 3, msgTypeURL)
+	return CosmosMsg{TypeURL: msgRevokeTypeURL, Value: value}
+}
+
+// NewMsgExec has grantee run msgs, each signed for by an account that
+// authorized grantee to send it.
+func NewMsgExec(grantee string, msgs ...CosmosMsg) CosmosMsg {
+	value := protoAppendString(nil, 1, grantee)
+	for _, msg := range msgs {
+		value = protoAppendBytes(value, 2, msg.marshal())
+	}
+	return CosmosMsg{TypeURL: msgExecTypeURL, Value: value}
+}
+
+// decodeMsgExec returns the messages a MsgExec runs.
+func decodeMsgExec(msg CosmosMsg) ([]CosmosMsg, error) {
+	fields, err := protoFields(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []CosmosMsg
+	for _, field := range fields {
+		if field.Num == 2 {
+			inner, err := decodeAny(field.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, inner)
+		}
+	}
+	return msgs, nil
+}
+
+// decodeFeeGrant decodes a feegrant Grant{granter, grantee, allowance}.
+func decodeFeeGrant(b []byte) (*FeeGrant, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return nil, err
+	}
+	grant := &FeeGrant{}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			grant.Granter = string(field.Bytes)
+		case 2:
+			grant.Grantee = string(field.Bytes)
+		case 3:
+			if grant.Allowance, err = decodeAllowanceAny(field.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if grant.Allowance == nil {
+		return nil, fmt.Errorf("%w: grant without an allowance", ErrMalformedProto)
+	}
+	return grant, nil
+}
+
+func decodeAllowanceAny(b []byte) (FeeAllowance, error) {
+	msg, err := decodeAny(b)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := protoFields(msg.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	switch msg.TypeURL {
+	case basicAllowanceTypeURL:
+		return decodeBasicAllowance(fields)
+	case periodicAllowanceTypeURL:
+		var allowance PeriodicAllowance
+		for _, field := range fields {
+			switch field.Num {
+			case 1:
+				basicFields, err := protoFields(field.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				if allowance.Basic, err = decodeBasicAllowance(basicFields); err != nil {
+					return nil, err
+				}
+			case 2:
+				if allowance.Period, err = decodeDuration(field.Bytes); err != nil {
+					return nil, err
+				}
+			case 3, 4:
+				coin, err := decodeCoin(field.Bytes)
+				if err != nil {
+					return nil, err
+				}
+				if field.Num == 3 {
+					allowance.PeriodSpendLimit = append(allowance.PeriodSpendLimit, coin)
+				} else {
+					allowance.PeriodCanSpend = append(allowance.PeriodCanSpend, coin)
+				}
+			case 5:
+				if allowance.PeriodReset, err = decodeTimestamp(field.Bytes); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return allowance, nil
+	case allowedMsgAllowanceTypeURL:
+		var allowance AllowedMsgAllowance
+		for _, field := range fields {
+			switch field.Num {
+			case 1:
+				if allowance.Allowance, err = decodeAllowanceAny(field.Bytes); err != nil {
+					return nil, err
+				}
+			case 2:
+				allowance.AllowedMessages = append(allowance.AllowedMessages, string(field.Bytes))
+			}
+		}
+		return allowance, nil
+	default:
+		return nil, fmt.Errorf("unsupported fee allowance type %q", msg.TypeURL)
+	}
+}
+
+func decodeBasicAllowance(fields []protoField) (BasicAllowance, error) {
+	var allowance BasicAllowance
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			coin, err := decodeCoin(field.Bytes)
+			if err != nil {
+				return BasicAllowance{}, err
+			}
+			allowance.SpendLimit = append(allowance.SpendLimit, coin)
+		case 2:
+			expiration, err := decodeTimestamp(field.Bytes)
+			if err != nil {
+				return BasicAllowance{}, err
+			}
+			allowance.Expiration = expiration
+		}
+	}
+	return allowance, nil
+}
+
+func decodeAny(b []byte) (CosmosMsg, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	var msg CosmosMsg
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			msg.TypeURL = string(field.Bytes)
+		case 2:
+			msg.Value = field.Bytes
+		}
+	}
+	return msg, nil
+}
+
+func decodeCoin(b []byte) (CosmosCoin, error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return CosmosCoin{}, err
+	}
+	var coin CosmosCoin
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			coin.Denom = string(field.Bytes)
+		case 2:
+			coin.Amount = string(field.Bytes)
+		}
+	}
+	return coin, nil
+}
+
+// Timestamps and durations share the {seconds, nanos} layout.
+
+func marshalTimestamp(t time.Time) []byte {
+	b := protoAppendUint64(nil, 1, uint64(t.Unix()))
+	return protoAppendUint64(b, 2, uint64(t.Nanosecond()))
+}
+
+// decodeTimestamp treats the empty message as unset rather than the epoch.
+func decodeTimestamp(b []byte) (time.Time, error) {
+	seconds, nanos, err := decodeSecondsNanos(b)
+	if err != nil || (seconds == 0 && nanos == 0) {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+func marshalDuration(d time.Duration) []byte {
+	b := protoAppendUint64(nil, 1, uint64(d/time.Second))
+	return protoAppendUint64(b, 2, uint64(d%time.Second))
+}
+
+func decodeDuration(b []byte) (time.Duration, error) {
+	seconds, nanos, err := decodeSecondsNanos(b)
+	return time.Duration(seconds)*time.Second + time.Duration(nanos), err
+}
+
+func decodeSecondsNanos(b []byte) (seconds int64, nanos int64, err error) {
+	fields, err := protoFields(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			seconds = int64(field.Varint)
+		case 2:
+			// int32 on the wire, sign-extended to ten bytes when negative
+			nanos = int64(int32(field.Varint))
+		}
+	}
+	return seconds, nanos, nil
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CW20Client queries and builds execute messages for a CW20 token contract,
+// such as the NRN token. Amounts are in the token's display unit.
+type CW20Client struct {
+	backend  *CosmosBackend
+	contract string
+	decimals int
+}
+
+// NewCW20Client targets the token at contract, whose display unit has the
+// given decimals (its token_info decimals).
+func NewCW20Client(backend *CosmosBackend, contract string, decimals int) *CW20Client {
+	return &CW20Client{backend: backend, contract: contract, decimals: decimals}
+}
+
+func (c *CW20Client) Contract() string {
+	return c.contract
+}
+
+type CW20TokenInfo struct {
+	Name        string `json:"name"`
+	Symbol      string `json:"symbol"`
+	Decimals    int    `json:"decimals"`
+	TotalSupply Amount `json:"total_supply"`
+}
+
+type CW20Allowance struct {
+	Allowance Amount         `json:"allowance"`
+	Expires   CW20Expiration `json:"expires"`
+}
+
+// CW20Expiration is when an allowance lapses: at a block height, at a time,
+// or, when both are zero, never.
+type CW20Expiration struct {
+	AtHeight uint64
+	AtTime   time.Time
+}
+
+func (e CW20Expiration) MarshalJSON() ([]byte, error) {
+	switch {
+	case e.AtHeight != 0:
+		return json.Marshal(map[string]uint64{"at_height": e.AtHeight})
+	case !e.AtTime.IsZero():
+		// cosmwasm Timestamps are nanoseconds since the epoch, as a string
+		return json.Marshal(map[string]string{"at_time": strconv.FormatInt(e.AtTime.UnixNano(), 10)})
+	default:
+		return []byte(`{"never":{}}`), nil
+	}
+}
+
+func (e *CW20Expiration) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		AtHeight *uint64         `json:"at_height"`
+		AtTime   *string         `json:"at_time"`
+		Never    json.RawMessage `json:"never"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch {
+	case raw.AtHeight != nil:
+		*e = CW20Expiration{AtHeight: *raw.AtHeight}
+	case raw.AtTime != nil:
+		nanos, err := strconv.ParseInt(*raw.AtTime, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid expiration time %q", *raw.AtTime)
+		}
+		*e = CW20Expiration{AtTime: time.Unix(0, nanos).UTC()}
+	case raw.Never != nil:
+		*e = CW20Expiration{}
+	default:
+		return fmt.Errorf("unknown expiration %s", data)
+	}
+	return nil
+}
+
+func (c *CW20Client) Balance(address string) (Amount, error) {
+	var resp struct {
+		Balance string `json:"balance"`
+	}
+	query := map[string]interface{}{"balance": map[string]string{"address": address}}
+	if err := c.backend.QuerySmartContract(c.contract, query, &resp); err != nil {
+		return Amount{}, err
+	}
+	return ParseBaseUnits(resp.Balance, c.decimals)
+}
+
+func (c *CW20Client) TokenInfo() (*CW20TokenInfo, error) {
+	var resp struct {
+		Name        string `json:"name"`
+		Symbol      string `json:"symbol"`
+		Decimals    int    `json:"decimals"`
+		TotalSupply string `json:"total_supply"`
+	}
+	query := map[string]interface{}{"token_info": struct{}{}}
+	if err := c.backend.QuerySmartContract(c.contract, query, &resp); err != nil {
+		return nil, err
+	}
+	supply, err := ParseBaseUnits(resp.TotalSupply, resp.Decimals)
+	if err != nil {
+		return nil, err
+	}
+	return &CW20TokenInfo{Name: resp.Name, Symbol: resp.Symbol, Decimals: resp.Decimals, TotalSupply: supply}, nil
+}
+
+// Allowance returns how much spender may still move out of owner's balance.
+func (c *CW20Client) Allowance(owner, spender string) (*CW20Allowance, error) {
+	var resp struct {
+		Allowance string         `json:"allowance"`
+		Expires   CW20Expiration `json:"expires"`
+	}
+	query := map[string]interface{}{"allowance": map[string]string{"owner": owner, "spender": spender}}
+	if err := c.backend.QuerySmartContract(c.contract, query, &resp); err != nil {
+		return nil, err
+	}
+	allowance, err := ParseBaseUnits(resp.Allowance, c.decimals)
+	if err != nil {
+		return nil, err
+	}
+	return &CW20Allowance{Allowance: allowance, Expires: resp.Expires}, nil
+}
+
+// AllAccounts pages through holders in address order, starting after
+// startAfter. The contract caps limit, at 30 for cw20-base.
+func (c *CW20Client) AllAccounts(startAfter string, limit uint32) ([]string, error) {
+	var resp struct {
+		Accounts []string `json:"accounts"`
+	}
+	params := map[string]interface{}{}
+	if startAfter != "" {
+		params["start_after"] = startAfter
+	}
+	if limit != 0 {
+		params["limit"] = limit
+	}
+	query := map[string]interface{}{"all_accounts": params}
+	if err := c.backend.QuerySmartContract(c.contract, query, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Accounts, nil
+}
+
+func (c *CW20Client) Transfer(sender, recipient string, amount Amount) (CosmosMsg, error) {
+	units, err := c.units(amount)
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	return c.execute(sender, "transfer", map[string]string{"recipient": recipient, "amount": units})
+}
+
+// Send transfers amount to contract and calls its Receive hook with msg.
+func (c *CW20Client) Send(sender, contract string, amount Amount, msg []byte) (CosmosMsg, error) {
+	units, err := c.units(amount)
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	// Binary fields encode as base64, which []byte does
+	return c.execute(sender, "send", struct {
+		Contract string `json:"contract"`
+		Amount   string `json:"amount"`
+		Msg      []byte `json:"msg"`
+	}{contract, units, msg})
+}
+
+func (c *CW20Client) Burn(sender string, amount Amount) (CosmosMsg, error) {
+	units, err := c.units(amount)
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	return c.execute(sender, "burn", map[string]string{"amount": units})
+}
+
+// IncreaseAllowance lets spender move amount more of sender's balance. A
+// zero expires leaves the current expiration unchanged.
+func (c *CW20Client) IncreaseAllowance(sender, spender string, amount Amount, expires CW20Expiration) (CosmosMsg, error) {
+	units, err := c.units(amount)
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	params := map[string]interface{}{"spender": spender, "amount": units}
+	if expires != (CW20Expiration{}) {
+		params["expires"] = expires
+	}
+	return c.execute(sender, "increase_allowance", params)
+}
+
+func (c *CW20Client) units(amount Amount) (string, error) {
+	if amount.Sign() <= 0 {
+		return "", fmt.Errorf("%w: token amount must be positive", ErrInvalidAmount)
+	}
+	units, err := amount.UnitsAt(c.decimals)
+	if err != nil {
+		return "", err
+	}
+	return units.String(), nil
+}
+
+func (c *CW20Client) execute(sender, action string, params interface{}) (CosmosMsg, error) {
+	msg, err := json.Marshal(map[string]interface{}{action: params})
+	if err != nil {
+		return CosmosMsg{}, err
+	}
+	return NewMsgExecuteContract(sender, c.contract, msg), nil
+}
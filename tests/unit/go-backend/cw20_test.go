@@ -0,0 +1,286 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeJSON returns the contract and execute message of a
+// MsgExecuteContract.
+func executeJSON(t *testing.T, msg CosmosMsg) (contract string, execute string) {
+	t.Helper()
+	require.Equal(t, msgExecuteContractTypeURL, msg.TypeURL)
+	fields, err := protoFields(msg.Value)
+	require.NoError(t, err)
+	for _, field := range fields {
+		switch field.Num {
+		case 2:
+			contract = string(field.Bytes)
+		case 3:
+			execute = string(field.Bytes)
+		}
+	}
+	return contract, execute
+}
+
+func TestCW20Client(t *testing.T) {
+	keyring := NewXionKeyring()
+	sponsorKey := sha256.Sum256([]byte("sponsor"))
+	sponsor, err := keyring.AddKey(sponsorKey[:])
+	require.NoError(t, err)
+	holderKey := sha256.Sum256([]byte("nrn holder"))
+	holder, err := keyring.AddKey(holderKey[:])
+	require.NoError(t, err)
+	recipient := "xion1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnpltc8j"
+	const token = "xion1nrntoken"
+
+	// The token contract's state, answering cw20-base smart queries
+	balances := map[string]string{holder: "7250000", recipient: "10", sponsor: "1"}
+	var broadcasts [][]byte
+	server := newRPCStandIn(t, map[string]rpcHandler{
+		"abci_query": func(params json.RawMessage) (interface{}, *RPCError) {
+			var query struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(params, &query))
+			data, err := hex.DecodeString(query.Data)
+			require.NoError(t, err)
+			request, err := protoFields(data)
+			require.NoError(t, err)
+			respond := func(value []byte) (interface{}, *RPCError) {
+				return map[string]interface{}{"response": map[string]interface{}{"code": 0, "value": value}}, nil
+			}
+
+			switch query.Path {
+			case "/cosmos.auth.v1beta1.Query/Account":
+				account := protoAppendString(nil, 1, string(request[0].Bytes))
+				account = protoAppendUint64(account, 3, 11)
+				anyAccount := protoAppendString(nil, 1, baseAccountTypeURL)
+				anyAccount = protoAppendBytes(anyAccount, 2, account)
+				return respond(protoAppendBytes(nil, 1, anyAccount))
+			case "/cosmos.tx.v1beta1.Service/Simulate":
+				return respond(protoAppendBytes(nil, 1, protoAppendUint64(nil, 2, 150000)))
+			case "/cosmwasm.wasm.v1.Query/SmartContractState":
+			default:
+				t.Errorf("unexpected abci query %s", query.Path)
+				return nil, &RPCError{Code: -32603, Message: "Internal error"}
+			}
+
+			assert.Equal(t, token, string(request[0].Bytes))
+			var msg map[string]struct {
+				Address    string `json:"address"`
+				Owner      string `json:"owner"`
+				Spender    string `json:"spender"`
+				StartAfter string `json:"start_after"`
+				Limit      int    `json:"limit"`
+			}
+			require.NoError(t, json.Unmarshal(request[1].Bytes, &msg))
+
+			var answer interface{}
+			switch {
+			case msg["balance"].Address != "":
+				balance, ok := balances[msg["balance"].Address]
+				if !ok {
+					balance = "0"
+				}
+				answer = map[string]string{"balance": balance}
+			case strings.Contains(string(request[1].Bytes), "token_info"):
+				answer = map[string]interface{}{"name": "Neural Resource Network", "symbol": "NRN", "decimals": 6, "total_supply": "1000000000000000"}
+			case msg["allowance"].Owner == holder && msg["allowance"].Spender == sponsor:
+				answer = map[string]interface{}{"allowance": "2500000", "expires": map[string]uint64{"at_height": 900}}
+			case msg["allowance"].Owner != "":
+				answer = map[string]interface{}{"allowance": "0", "expires": map[string]interface{}{"never": struct{}{}}}
+			case strings.Contains(string(request[1].Bytes), "all_accounts"):
+				var accounts []string
+				for address := range balances {
+					if address > msg["all_accounts"].StartAfter {
+						accounts = append(accounts, address)
+					}
+				}
+				sort.Strings(accounts)
+				if limit := msg["all_accounts"].Limit; limit != 0 && len(accounts) > limit {
+					accounts = accounts[:limit]
+				}
+				answer = map[string]interface{}{"accounts": accounts}
+			default:
+				return map[string]interface{}{"response": map[string]interface{}{
+					"code": 9, "codespace": "wasm", "log": "query wasm contract failed: Error parsing into type cw20_base::msg::QueryMsg: unknown variant",
+				}}, nil
+			}
+			encoded, err := json.Marshal(answer)
+			require.NoError(t, err)
+			return respond(protoAppendBytes(nil, 1, encoded))
+		},
+		"broadcast_tx_sync": func(params json.RawMessage) (interface{}, *RPCError) {
+			var req map[string]string
+			require.NoError(t, json.Unmarshal(params, &req))
+			rawTx, err := base64.StdEncoding.DecodeString(req["tx"])
+			require.NoError(t, err)
+			broadcasts = append(broadcasts, rawTx)
+			hash := sha256.Sum256(rawTx)
+			return map[string]interface{}{"code": 0, "hash": strings.ToUpper(hex.EncodeToString(hash[:]))}, nil
+		},
+		"tx": func(params json.RawMessage) (interface{}, *RPCError) {
+			return map[string]interface{}{"height": "312", "tx_result": map[string]interface{}{"code": 0, "gas_used": "141002"}}, nil
+		},
+	})
+
+	client := NewCW20Client(NewCosmosBackend(server.URL, "uxion", 6), token, 6)
+
+	t.Run("Balance", func(t *testing.T) {
+		balance, err := client.Balance(holder)
+		require.NoError(t, err)
+		assert.Equal(t, "7.25", balance.String())
+
+		balance, err = client.Balance("xion1nobody")
+		require.NoError(t, err)
+		assert.True(t, balance.IsZero())
+	})
+
+	t.Run("TokenInfo", func(t *testing.T) {
+		info, err := client.TokenInfo()
+		require.NoError(t, err)
+		assert.Equal(t, "NRN", info.Symbol)
+		assert.Equal(t, 6, info.Decimals)
+		assert.Equal(t, "1000000000", info.TotalSupply.String())
+	})
+
+	t.Run("Allowance", func(t *testing.T) {
+		allowance, err := client.Allowance(holder, sponsor)
+		require.NoError(t, err)
+		assert.Equal(t, "2.5", allowance.Allowance.String())
+		assert.Equal(t, CW20Expiration{AtHeight: 900}, allowance.Expires)
+
+		allowance, err = client.Allowance(recipient, sponsor)
+		require.NoError(t, err)
+		assert.True(t, allowance.Allowance.IsZero())
+		assert.Equal(t, CW20Expiration{}, allowance.Expires)
+	})
+
+	t.Run("AllAccounts", func(t *testing.T) {
+		all := []string{holder, recipient, sponsor}
+		sort.Strings(all)
+
+		page, err := client.AllAccounts("", 2)
+		require.NoError(t, err)
+		assert.Equal(t, all[:2], page)
+		page, err = client.AllAccounts(page[1], 2)
+		require.NoError(t, err)
+		assert.Equal(t, all[2:], page)
+	})
+
+	t.Run("QueryError", func(t *testing.T) {
+		var out struct{}
+		err := client.backend.QuerySmartContract(token, map[string]interface{}{"minter": struct{}{}}, &out)
+		var abciErr *ABCIError
+		require.ErrorAs(t, err, &abciErr)
+		assert.Equal(t, "wasm", abciErr.Codespace)
+	})
+
+	t.Run("ExecuteMessages", func(t *testing.T) {
+		amount := mustParseAmount(t, "1.5", 6)
+
+		msg, err := client.Transfer(holder, recipient, amount)
+		require.NoError(t, err)
+		contract, execute := executeJSON(t, msg)
+		assert.Equal(t, token, contract)
+		assert.JSONEq(t, `{"transfer":{"recipient":"`+recipient+`","amount":"1500000"}}`, execute)
+
+		msg, err = client.Send(holder, "xion1vault", amount, []byte(`{"stake":{}}`))
+		require.NoError(t, err)
+		_, execute = executeJSON(t, msg)
+		assert.JSONEq(t, `{"send":{"contract":"xion1vault","amount":"1500000","msg":"eyJzdGFrZSI6e319"}}`, execute)
+
+		msg, err = client.Burn(holder, amount)
+		require.NoError(t, err)
+		_, execute = executeJSON(t, msg)
+		assert.JSONEq(t, `{"burn":{"amount":"1500000"}}`, execute)
+
+		msg, err = client.IncreaseAllowance(holder, sponsor, amount, CW20Expiration{AtTime: time.Unix(1900000000, 0)})
+		require.NoError(t, err)
+		_, execute = executeJSON(t, msg)
+		assert.JSONEq(t, `{"increase_allowance":{"spender":"`+sponsor+`","amount":"1500000","expires":{"at_time":"1900000000000000000"}}}`, execute)
+
+		msg, err = client.IncreaseAllowance(holder, sponsor, amount, CW20Expiration{})
+		require.NoError(t, err)
+		_, execute = executeJSON(t, msg)
+		assert.JSONEq(t, `{"increase_allowance":{"spender":"`+sponsor+`","amount":"1500000"}}`, execute)
+
+		_, err = client.Transfer(holder, recipient, NewAmountFromInt64(0, 6))
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+		_, err = client.Burn(holder, mustParseAmount(t, "0.0000001", 7))
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("ExpirationJSON", func(t *testing.T) {
+		for _, expires := range []CW20Expiration{{}, {AtHeight: 12}, {AtTime: time.Unix(1700000000, 5).UTC()}} {
+			encoded, err := json.Marshal(expires)
+			require.NoError(t, err)
+			var decoded CW20Expiration
+			require.NoError(t, json.Unmarshal(encoded, &decoded))
+			assert.Equal(t, expires, decoded)
+		}
+		var decoded CW20Expiration
+		assert.Error(t, json.Unmarshal([]byte(`{"at_epoch":3}`), &decoded))
+	})
+
+	service := NewXionIntegrationService(XionConfig{
+		ChainID:         "xion-testnet-1",
+		RPCEndpoint:     server.URL,
+		GasPrice:        "0.025uxion",
+		NRNTokenAddress: token,
+		GaslessEnabled:  true,
+		FeeGranter:      sponsor,
+		ConfirmTimeout:  time.Second,
+		PollInterval:    time.Millisecond,
+	}, keyring)
+
+	t.Run("ServiceBalance", func(t *testing.T) {
+		balance, err := service.GetBalance(holder, "nrn")
+		require.NoError(t, err)
+		assert.Equal(t, "7250000", balance.BaseUnits().String())
+	})
+
+	t.Run("TransferNRN", func(t *testing.T) {
+		broadcasts = nil
+		result, err := service.TransferNRN(holder, recipient, "1500000")
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, "141002", result.GasUsed)
+		assert.Equal(t, sponsor, result.Sponsor)
+
+		// A sponsored call of the token contract, signed by the holder
+		require.Len(t, broadcasts, 1)
+		raw, err := protoFields(broadcasts[0])
+		require.NoError(t, err)
+		body, err := protoFields(raw[0].Bytes)
+		require.NoError(t, err)
+		msg, err := decodeAny(body[0].Bytes)
+		require.NoError(t, err)
+		contract, execute := executeJSON(t, msg)
+		assert.Equal(t, token, contract)
+		assert.JSONEq(t, `{"transfer":{"recipient":"`+recipient+`","amount":"1500000"}}`, execute)
+		assert.Contains(t, string(raw[1].Bytes), sponsor)
+
+		_, err = service.TransferNRN(holder, recipient, "1.5")
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("NoToken", func(t *testing.T) {
+		untokened := NewXionIntegrationService(XionConfig{ChainID: "xion-testnet-1", RPCEndpoint: server.URL}, keyring)
+		_, err := untokened.GetBalance(holder, "nrn")
+		assert.ErrorIs(t, err, ErrNoNRNToken)
+		_, err = untokened.TransferNRN(holder, recipient, "1")
+		assert.ErrorIs(t, err, ErrNoNRNToken)
+	})
+}
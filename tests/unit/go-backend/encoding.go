@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Encoding helpers shared by the chain address codecs
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	ErrInvalidBase58   = errors.New("invalid base58 string")
+	ErrInvalidChecksum = errors.New("invalid checksum")
+	ErrInvalidBech32   = errors.New("invalid bech32 string")
+)
+
+// sha256d returns SHA-256(SHA-256(data)).
+func sha256d(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// hash160 returns RIPEMD-160(SHA-256(data)), as used by Bitcoin and Cosmos.
+func hash160(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	h := ripemd160.New()
+	h.Write(sum[:])
+	return h.Sum(nil)
+}
+
+// keccak256 returns the legacy Keccak-256 digest used by Ethereum.
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func base58Encode(data []byte) string {
+	num := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for num.Sign() > 0 {
+		num.DivMod(num, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, ErrInvalidBase58
+	}
+
+	num := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		idx := strings.IndexRune(base58Alphabet, r)
+		if idx < 0 {
+			return nil, ErrInvalidBase58
+		}
+		num.Mul(num, radix)
+		num.Add(num, big.NewInt(int64(idx)))
+	}
+
+	decoded := num.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
+
+// base58CheckEncode prefixes payload with version and appends a 4-byte
+// double-SHA-256 checksum.
+func base58CheckEncode(version []byte, payload []byte) string {
+	data := append(append([]byte{}, version...), payload...)
+	return base58Encode(append(data, sha256d(data)[:4]...))
+}
+
+// base58CheckDecode verifies the checksum and returns the version-prefixed
+// payload.
+func base58CheckDecode(s string) ([]byte, error) {
+	data, err := base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 5 {
+		return nil, ErrInvalidBase58
+	}
+
+	body, checksum := data[:len(data)-4], data[len(data)-4:]
+	if string(sha256d(body)[:4]) != string(checksum) {
+		return nil, ErrInvalidChecksum
+	}
+	return body, nil
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// bech32Variant is the constant a checksum's polymod must leave: BIP-173
+// bech32, or BIP-350 bech32m, which fixed bech32's weakness to inserted
+// and deleted q characters before a trailing p.
+type bech32Variant uint32
+
+const (
+	bech32Classic bech32Variant = 1
+	bech32M       bech32Variant = 0x2bc830a3
+)
+
+// bech32Encode encodes 5-bit groups under hrp with a BIP-173 checksum.
+func bech32Encode(hrp string, data []byte) string {
+	return bech32EncodeVariant(hrp, data, bech32Classic)
+}
+
+func bech32EncodeVariant(hrp string, data []byte, variant bech32Variant) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ uint32(variant)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+// convertBits regroups data from fromBits-wide to toBits-wide groups.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc := uint32(0)
+	bits := uint(0)
+	maxv := uint32(1)<<toBits - 1
+
+	var out []byte
+	for _, b := range data {
+		if uint32(b)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data range: %d", b)
+		}
+		acc = acc<<fromBits | uint32(b)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+// bech32Decode splits a BIP-173 string into its HRP and 5-bit data,
+// verifying case, charset and checksum.
+func bech32Decode(s string) (string, []byte, error) {
+	hrp, data, variant, err := bech32DecodeVariant(s)
+	if err != nil {
+		return "", nil, err
+	}
+	if variant != bech32Classic {
+		return "", nil, fmt.Errorf("%w: bech32m checksum where bech32 was expected", ErrInvalidBech32)
+	}
+	return hrp, data, nil
+}
+
+// bech32DecodeVariant is bech32Decode accepting bech32m checksums too, and
+// reporting which one the string has.
+func bech32DecodeVariant(s string) (string, []byte, bech32Variant, error) {
+	if len(s) < 8 || len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("%w: invalid length %d", ErrInvalidBech32, len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, fmt.Errorf("%w: mixed case", ErrInvalidBech32)
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, 0, fmt.Errorf("%w: missing separator", ErrInvalidBech32)
+	}
+
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, fmt.Errorf("%w: invalid hrp character", ErrInvalidBech32)
+		}
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for _, r := range s[sep+1:] {
+		idx := strings.IndexRune(bech32Charset, r)
+		if idx < 0 {
+			return "", nil, 0, fmt.Errorf("%w: invalid character %q", ErrInvalidBech32, r)
+		}
+		data = append(data, byte(idx))
+	}
+
+	variant := bech32Variant(bech32Polymod(append(bech32HRPExpand(hrp), data...)))
+	if variant != bech32Classic && variant != bech32M {
+		return "", nil, 0, fmt.Errorf("%w: %v", ErrInvalidBech32, ErrInvalidChecksum)
+	}
+	return hrp, data[:len(data)-6], variant, nil
+}
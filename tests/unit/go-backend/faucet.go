@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCooldown       = errors.New("faucet cooldown has not elapsed")
+	ErrCapExceeded    = errors.New("faucet cap exceeded")
+	ErrFaucetDisabled = errors.New("faucet is not configured")
+)
+
+// FaucetCooldownError is an ErrCooldown with what the frontend needs to
+// tell the user when to come back.
+type FaucetCooldownError struct {
+	Scope   string // "address" or "ip"
+	RetryAt time.Time
+}
+
+func (e *FaucetCooldownError) Error() string {
+	return fmt.Sprintf("%v for this %s; retry after %s", ErrCooldown, e.Scope, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+func (e *FaucetCooldownError) Unwrap() error { return ErrCooldown }
+
+// FaucetCapError is an ErrCapExceeded naming the cap and what is left of it.
+type FaucetCapError struct {
+	Scope     string // "request", "address" or "daily"
+	Limit     Amount
+	Remaining Amount
+}
+
+func (e *FaucetCapError) Error() string {
+	return fmt.Sprintf("%v: %s limit is %s NRN, %s NRN remaining", ErrCapExceeded, e.Scope, e.Limit, e.Remaining)
+}
+
+func (e *FaucetCapError) Unwrap() error { return ErrCapExceeded }
+
+// FaucetPolicy bounds how much the faucet pays out. Daily caps cover the
+// trailing 24 hours. Zero durations and caps disable their check.
+type FaucetPolicy struct {
+	MaxPerRequest   Amount
+	AddressCooldown time.Duration
+	IPCooldown      time.Duration
+	AddressDailyCap Amount
+	DailyCap        Amount
+}
+
+// DefaultFaucetPolicy suits a public testnet faucet.
+func DefaultFaucetPolicy() FaucetPolicy {
+	decimals := xionDenomDecimals["nrn"]
+	return FaucetPolicy{
+		MaxPerRequest:   NewAmountFromInt64(10_000000, decimals),
+		AddressCooldown: time.Hour,
+		IPCooldown:      10 * time.Minute,
+		AddressDailyCap: NewAmountFromInt64(30_000000, decimals),
+		DailyCap:        NewAmountFromInt64(100_000_000000, decimals),
+	}
+}
+
+// FaucetRequest asks for Amount base units of NRN, or the per-request
+// maximum if it is empty. IP limits apply when ClientIP is set.
+type FaucetRequest struct {
+	Address  string
+	Amount   string
+	ClientIP string
+}
+
+type faucetState struct {
+	mu     sync.Mutex // serializes checks with the reservations they admit
+	policy FaucetPolicy
+	ledger FaucetLedger
+	now    func() time.Time
+}
+
+// ConfigureFaucet replaces the faucet's policy and ledger.
+func (s *XionIntegrationService) ConfigureFaucet(policy FaucetPolicy, ledger FaucetLedger) {
+	s.faucet.mu.Lock()
+	defer s.faucet.mu.Unlock()
+	s.faucet.policy = policy
+	s.faucet.ledger = ledger
+}
+
+// RequestFromFaucet drips amount base units of NRN to address, without
+// per-IP limits; see Drip.
+func (s *XionIntegrationService) RequestFromFaucet(address, amount string) (*XionTransactionResult, error) {
+	return s.Drip(FaucetRequest{Address: address, Amount: amount})
+}
+
+// Drip transfers NRN from the faucet account, whose key the signer holds,
+// once the request clears the policy. Refusals are *FaucetCooldownError or
+// *FaucetCapError.
+func (s *XionIntegrationService) Drip(req FaucetRequest) (*XionTransactionResult, error) {
+	failed := func(err error) (*XionTransactionResult, error) {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	if err := s.ValidateAddress(req.Address); err != nil {
+		return failed(fmt.Errorf("recipient: %w", err))
+	}
+	if s.config.FaucetAddress == "" || s.nrn == nil {
+		return failed(ErrFaucetDisabled)
+	}
+	drip, ledger, err := s.reserveDrip(req)
+	if err != nil {
+		return failed(err)
+	}
+
+	msg, err := s.nrn.Transfer(s.config.FaucetAddress, req.Address, drip.Amount)
+	if err != nil {
+		ledger.Release(drip.ID)
+		return failed(err)
+	}
+	result, err := s.Execute(&XionTransaction{
+		From:            s.config.FaucetAddress,
+		To:              req.Address,
+		Amount:          drip.Amount,
+		Denom:           "nrn",
+		Memo:            "knirv faucet",
+		Type:            XionTxFaucet,
+		ContractAddress: s.nrn.Contract(),
+	}, msg)
+
+	// Drips whose outcome is unknown count against the limits too. A
+	// reservation that cannot be released keeps counting until it ages
+	// out, which errs on the side of paying out less.
+	if result.TxHash != "" && (err == nil || errors.Is(err, ErrTxPending)) {
+		if finalizeErr := ledger.Finalize(drip.ID, result.TxHash); finalizeErr != nil && err == nil {
+			err = fmt.Errorf("drip %s sent but not recorded: %w", result.TxHash, finalizeErr)
+		}
+	} else {
+		ledger.Release(drip.ID)
+	}
+	return result, err
+}
+
+// reserveDrip admits req under the policy and records it in the ledger,
+// without a TxHash, so that later requests count it while it is sent. The
+// faucet's lock is only held for the checks and the reservation, not for
+// the broadcast. It returns the ledger the reservation is in.
+func (s *XionIntegrationService) reserveDrip(req FaucetRequest) (*FaucetDrip, FaucetLedger, error) {
+	clientIP, err := faucetIPKey(req.ClientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.faucet.mu.Lock()
+	defer s.faucet.mu.Unlock()
+	policy := s.faucet.policy
+
+	amount := policy.MaxPerRequest
+	if req.Amount != "" {
+		if amount, err = ParseBaseUnits(req.Amount, xionDenomDecimals["nrn"]); err != nil {
+			return nil, nil, err
+		}
+	}
+	if amount.Sign() <= 0 {
+		return nil, nil, fmt.Errorf("%w: faucet amount must be positive", ErrInvalidAmount)
+	}
+	if policy.MaxPerRequest.Sign() > 0 && amount.Cmp(policy.MaxPerRequest) > 0 {
+		return nil, nil, &FaucetCapError{Scope: "request", Limit: policy.MaxPerRequest, Remaining: policy.MaxPerRequest}
+	}
+
+	now := s.faucet.now()
+	if err := s.checkFaucetLimits(now, req.Address, clientIP, amount); err != nil {
+		return nil, nil, err
+	}
+	drip := &FaucetDrip{Address: req.Address, ClientIP: clientIP, Amount: amount, CreatedAt: now}
+	if err := s.faucet.ledger.Record(drip); err != nil {
+		return nil, nil, fmt.Errorf("failed to reserve faucet drip: %w", err)
+	}
+	return drip, s.faucet.ledger, nil
+}
+
+func (s *XionIntegrationService) checkFaucetLimits(now time.Time, address, clientIP string, amount Amount) error {
+	policy, ledger := s.faucet.policy, s.faucet.ledger
+
+	cooldown := func(scope string, period time.Duration, address, clientIP string) error {
+		if period <= 0 || (address == "" && clientIP == "") {
+			return nil
+		}
+		recent, err := ledger.Drips(now.Add(-period), address, clientIP)
+		if err != nil || len(recent) == 0 {
+			return err
+		}
+		return &FaucetCooldownError{Scope: scope, RetryAt: recent[len(recent)-1].CreatedAt.Add(period)}
+	}
+	if err := cooldown("address", policy.AddressCooldown, address, ""); err != nil {
+		return err
+	}
+	if err := cooldown("ip", policy.IPCooldown, "", clientIP); err != nil {
+		return err
+	}
+
+	dailyCap := func(scope string, limit Amount, address string) error {
+		if limit.Sign() <= 0 {
+			return nil
+		}
+		drips, err := ledger.Drips(now.Add(-24*time.Hour), address, "")
+		if err != nil {
+			return err
+		}
+		spent := NewAmountFromInt64(0, limit.Decimals())
+		for _, drip := range drips {
+			spent = spent.Add(drip.Amount)
+		}
+		if spent.Add(amount).Cmp(limit) > 0 {
+			remaining := limit.Sub(spent)
+			if remaining.Sign() < 0 {
+				remaining = NewAmountFromInt64(0, limit.Decimals())
+			}
+			return &FaucetCapError{Scope: scope, Limit: limit, Remaining: remaining}
+		}
+		return nil
+	}
+	if err := dailyCap("address", policy.AddressDailyCap, address); err != nil {
+		return err
+	}
+	return dailyCap("daily", policy.DailyCap, "")
+}
+
+// faucetIPKey is the network a client is rate-limited by: its IPv4
+// address, or its IPv6 /64, since a single host can use a whole /64.
+func faucetIPKey(clientIP string) (string, error) {
+	if clientIP == "" {
+		return "", nil
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid client IP %q", clientIP)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String(), nil
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String(), nil
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FaucetDrip is one payout of the faucet. A drip without a TxHash is
+// reserved: admitted and counting against the limits, but not yet sent.
+type FaucetDrip struct {
+	ID        int64     `json:"id"` // assigned by Record
+	Address   string    `json:"address"`
+	ClientIP  string    `json:"client_ip,omitempty"` // the rate-limited network, see faucetIPKey
+	Amount    Amount    `json:"amount"`
+	TxHash    string    `json:"tx_hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FaucetLedger records faucet payouts so that cooldowns and caps survive
+// restarts.
+type FaucetLedger interface {
+	// Record adds drip and sets its ID.
+	Record(drip *FaucetDrip) error
+	// Finalize sets the TxHash of a reserved drip once it is sent.
+	Finalize(id int64, txHash string) error
+	// Release removes a reserved drip that was never sent. Drips that have
+	// a TxHash are left alone.
+	Release(id int64) error
+	// Drips returns the drips made after since, oldest first, to address
+	// and from clientIP where those are non-empty.
+	Drips(since time.Time, address, clientIP string) ([]*FaucetDrip, error)
+}
+
+// MemoryFaucetLedger is an in-memory FaucetLedger for unit tests.
+type MemoryFaucetLedger struct {
+	mu     sync.RWMutex
+	drips  []*FaucetDrip
+	nextID int64
+}
+
+func NewMemoryFaucetLedger() *MemoryFaucetLedger {
+	return &MemoryFaucetLedger{}
+}
+
+func (l *MemoryFaucetLedger) Record(drip *FaucetDrip) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.nextID++
+	drip.ID = l.nextID
+	copied := *drip
+	l.drips = append(l.drips, &copied)
+	return nil
+}
+
+func (l *MemoryFaucetLedger) Finalize(id int64, txHash string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, drip := range l.drips {
+		if drip.ID == id {
+			drip.TxHash = txHash
+			return nil
+		}
+	}
+	return fmt.Errorf("no faucet drip %d", id)
+}
+
+func (l *MemoryFaucetLedger) Release(id int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.drips = slices.DeleteFunc(l.drips, func(drip *FaucetDrip) bool { return drip.ID == id && drip.TxHash == "" })
+	return nil
+}
+
+func (l *MemoryFaucetLedger) Drips(since time.Time, address, clientIP string) ([]*FaucetDrip, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var out []*FaucetDrip
+	for _, drip := range l.drips {
+		if !drip.CreatedAt.After(since) ||
+			(address != "" && drip.Address != address) ||
+			(clientIP != "" && drip.ClientIP != clientIP) {
+			continue
+		}
+		copied := *drip
+		out = append(out, &copied)
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// faucetMigrations are versioned like walletMigrations, in their own table.
+var faucetMigrations = []string{
+	`CREATE TABLE faucet_drips (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		address    TEXT NOT NULL,
+		client_ip  TEXT NOT NULL DEFAULT '',
+		amount     TEXT NOT NULL,
+		tx_hash    TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX idx_faucet_drips_address ON faucet_drips (address, created_at)`,
+	`CREATE INDEX idx_faucet_drips_client_ip ON faucet_drips (client_ip, created_at)`,
+	`CREATE INDEX idx_faucet_drips_created_at ON faucet_drips (created_at)`,
+}
+
+// SQLiteFaucetLedger keeps the drip ledger in SQLite. It can share a
+// database file with SQLiteWalletRepository.
+type SQLiteFaucetLedger struct {
+	db *sql.DB
+}
+
+func NewSQLiteFaucetLedger(path string) (*SQLiteFaucetLedger, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open faucet ledger: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`PRAGMA busy_timeout = 5000`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure faucet ledger: %w", err)
+	}
+	if err := migrateSQLite(db, "faucet_schema_migrations", faucetMigrations); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteFaucetLedger{db: db}, nil
+}
+
+func (l *SQLiteFaucetLedger) Close() error {
+	return l.db.Close()
+}
+
+func (l *SQLiteFaucetLedger) Record(drip *FaucetDrip) error {
+	result, err := l.db.Exec(`INSERT INTO faucet_drips (address, client_ip, amount, tx_hash, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		drip.Address, drip.ClientIP, drip.Amount.BaseUnits().String(), drip.TxHash, drip.CreatedAt.UnixNano())
+	if err != nil {
+		return err
+	}
+	drip.ID, err = result.LastInsertId()
+	return err
+}
+
+func (l *SQLiteFaucetLedger) Finalize(id int64, txHash string) error {
+	result, err := l.db.Exec(`UPDATE faucet_drips SET tx_hash = ? WHERE id = ?`, txHash, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("no faucet drip %d", id)
+	}
+	return nil
+}
+
+func (l *SQLiteFaucetLedger) Release(id int64) error {
+	_, err := l.db.Exec(`DELETE FROM faucet_drips WHERE id = ? AND tx_hash = ''`, id)
+	return err
+}
+
+func (l *SQLiteFaucetLedger) Drips(since time.Time, address, clientIP string) ([]*FaucetDrip, error) {
+	query := `SELECT id, address, client_ip, amount, tx_hash, created_at FROM faucet_drips WHERE created_at > ?`
+	args := []interface{}{since.UnixNano()}
+	if address != "" {
+		query += ` AND address = ?`
+		args = append(args, address)
+	}
+	if clientIP != "" {
+		query += ` AND client_ip = ?`
+		args = append(args, clientIP)
+	}
+	rows, err := l.db.Query(query+` ORDER BY created_at, id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drips []*FaucetDrip
+	for rows.Next() {
+		var drip FaucetDrip
+		var amount string
+		var createdAt int64
+		if err := rows.Scan(&drip.ID, &drip.Address, &drip.ClientIP, &amount, &drip.TxHash, &createdAt); err != nil {
+			return nil, err
+		}
+		if drip.Amount, err = ParseBaseUnits(amount, xionDenomDecimals["nrn"]); err != nil {
+			return nil, fmt.Errorf("corrupt faucet ledger amount %q: %w", amount, err)
+		}
+		drip.CreatedAt = time.Unix(0, createdAt)
+		drips = append(drips, &drip)
+	}
+	return drips, rows.Err()
+}
@@ -0,0 +1,351 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaucetLedger(t *testing.T) {
+	ledgers := map[string]func(t *testing.T) FaucetLedger{
+		"Memory": func(t *testing.T) FaucetLedger {
+			return NewMemoryFaucetLedger()
+		},
+		"SQLite": func(t *testing.T) FaucetLedger {
+			ledger, err := NewSQLiteFaucetLedger(filepath.Join(t.TempDir(), "faucet.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { ledger.Close() })
+			return ledger
+		},
+	}
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	drip := func(address, clientIP string, minutes int) *FaucetDrip {
+		return &FaucetDrip{
+			Address:   address,
+			ClientIP:  clientIP,
+			Amount:    NewAmountFromInt64(1500000, 6),
+			TxHash:    "AB12",
+			CreatedAt: start.Add(time.Duration(minutes) * time.Minute),
+		}
+	}
+
+	for name, newLedger := range ledgers {
+		t.Run(name, func(t *testing.T) {
+			ledger := newLedger(t)
+			require.NoError(t, ledger.Record(drip("xion1a", "203.0.113.7", 0)))
+			require.NoError(t, ledger.Record(drip("xion1b", "203.0.113.7", 10)))
+			require.NoError(t, ledger.Record(drip("xion1a", "198.51.100.1", 20)))
+
+			all, err := ledger.Drips(start.Add(-time.Minute), "", "")
+			require.NoError(t, err)
+			require.Len(t, all, 3)
+			assert.Equal(t, "xion1b", all[1].Address, "oldest first")
+			assert.Equal(t, "1.5", all[0].Amount.String())
+			assert.True(t, all[2].CreatedAt.Equal(start.Add(20*time.Minute)))
+
+			byAddress, err := ledger.Drips(start.Add(-time.Minute), "xion1a", "")
+			require.NoError(t, err)
+			assert.Len(t, byAddress, 2)
+
+			byIP, err := ledger.Drips(start, "", "203.0.113.7")
+			require.NoError(t, err)
+			require.Len(t, byIP, 1, "drips at since are over")
+			assert.Equal(t, "xion1b", byIP[0].Address)
+
+			both, err := ledger.Drips(start.Add(-time.Minute), "xion1a", "203.0.113.7")
+			require.NoError(t, err)
+			assert.Len(t, both, 1)
+
+			// Reservations count until they are released; sent drips stay
+			reserved := drip("xion1c", "", 30)
+			reserved.TxHash = ""
+			require.NoError(t, ledger.Record(reserved))
+			sent := drip("xion1c", "", 31)
+			sent.TxHash = ""
+			require.NoError(t, ledger.Record(sent))
+			assert.NotEqual(t, reserved.ID, sent.ID)
+			require.NoError(t, ledger.Finalize(sent.ID, "CD34"))
+			assert.Error(t, ledger.Finalize(sent.ID+100, "CD34"))
+
+			byC, err := ledger.Drips(start, "xion1c", "")
+			require.NoError(t, err)
+			require.Len(t, byC, 2)
+			assert.Empty(t, byC[0].TxHash)
+			assert.Equal(t, "CD34", byC[1].TxHash)
+
+			require.NoError(t, ledger.Release(reserved.ID))
+			require.NoError(t, ledger.Release(sent.ID))
+			byC, err = ledger.Drips(start, "xion1c", "")
+			require.NoError(t, err)
+			require.Len(t, byC, 1)
+			assert.Equal(t, sent.ID, byC[0].ID)
+		})
+	}
+
+	t.Run("SQLitePersistence", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "faucet.db")
+		ledger, err := NewSQLiteFaucetLedger(path)
+		require.NoError(t, err)
+		require.NoError(t, ledger.Record(drip("xion1a", "", 0)))
+		require.NoError(t, ledger.Close())
+
+		reopened, err := NewSQLiteFaucetLedger(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+		drips, err := reopened.Drips(time.Time{}, "xion1a", "")
+		require.NoError(t, err)
+		assert.Len(t, drips, 1)
+	})
+
+	t.Run("SharedDatabase", func(t *testing.T) {
+		// Wallets and drips can live in one file, each with its own migrations
+		path := filepath.Join(t.TempDir(), "knirv.db")
+		repo, err := NewSQLiteWalletRepository(path)
+		require.NoError(t, err)
+		defer repo.Close()
+		ledger, err := NewSQLiteFaucetLedger(path)
+		require.NoError(t, err)
+		defer ledger.Close()
+
+		version, err := repo.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, len(walletMigrations), version)
+		require.NoError(t, ledger.Record(drip("xion1a", "", 0)))
+	})
+}
+
+func TestFaucetIPKey(t *testing.T) {
+	for clientIP, want := range map[string]string{
+		"":                        "",
+		"203.0.113.7":             "203.0.113.7",
+		"::ffff:203.0.113.7":      "203.0.113.7",
+		"2001:db8:1:2:3:4:5:6":    "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1234": "2001:db8:1:2::/64",
+	} {
+		key, err := faucetIPKey(clientIP)
+		require.NoError(t, err, clientIP)
+		assert.Equal(t, want, key, clientIP)
+	}
+	_, err := faucetIPKey("localhost")
+	assert.Error(t, err)
+}
+
+func TestFaucet(t *testing.T) {
+	keyring := NewXionKeyring()
+	faucetKey := sha256.Sum256([]byte("faucet"))
+	faucet, err := keyring.AddKey(faucetKey[:])
+	require.NoError(t, err)
+	alice := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+	bob := "xion1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnpltc8j"
+	const token = "xion1nrntoken"
+
+	chain := newXionChainStandIn(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	newService := func(ledger FaucetLedger) *XionIntegrationService {
+		service := NewXionIntegrationService(XionConfig{
+			ChainID:         "xion-testnet-1",
+			RPCEndpoint:     chain.URL,
+			GasPrice:        "0.025uxion",
+			NRNTokenAddress: token,
+			FaucetAddress:   faucet,
+			ConfirmTimeout:  time.Second,
+			PollInterval:    time.Millisecond,
+		}, keyring)
+		service.ConfigureFaucet(FaucetPolicy{
+			MaxPerRequest:   NewAmountFromInt64(2000000, 6),
+			AddressCooldown: time.Hour,
+			IPCooldown:      10 * time.Minute,
+			AddressDailyCap: NewAmountFromInt64(5000000, 6),
+			DailyCap:        NewAmountFromInt64(8000000, 6),
+		}, ledger)
+		service.faucet.now = func() time.Time { return now }
+		return service
+	}
+	ledger, err := NewSQLiteFaucetLedger(filepath.Join(t.TempDir(), "faucet.db"))
+	require.NoError(t, err)
+	defer ledger.Close()
+	service := newService(ledger)
+
+	t.Run("Drip", func(t *testing.T) {
+		result, err := service.Drip(FaucetRequest{Address: alice, Amount: "1500000", ClientIP: "203.0.113.7"})
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+
+		// A CW20 transfer out of the faucet account, which pays its own fees
+		msgs, _, err := decodeTxBody(chain.broadcasts[len(chain.broadcasts)-1])
+		require.NoError(t, err)
+		require.Len(t, msgs, 1)
+		contract, execute := executeJSON(t, msgs[0])
+		assert.Equal(t, token, contract)
+		assert.JSONEq(t, `{"transfer":{"recipient":"`+alice+`","amount":"1500000"}}`, execute)
+		assert.Empty(t, result.Sponsor)
+
+		drips, err := ledger.Drips(time.Time{}, alice, "")
+		require.NoError(t, err)
+		require.Len(t, drips, 1)
+		assert.Equal(t, result.TxHash, drips[0].TxHash)
+		assert.Equal(t, "203.0.113.7", drips[0].ClientIP)
+
+		history, err := service.GetTransactionHistory(alice)
+		require.NoError(t, err)
+		assert.Contains(t, history, result)
+	})
+
+	t.Run("AddressCooldown", func(t *testing.T) {
+		broadcasts := len(chain.broadcasts)
+		result, err := service.Drip(FaucetRequest{Address: alice, Amount: "100", ClientIP: "198.51.100.1"})
+		assert.ErrorIs(t, err, ErrCooldown)
+		assert.False(t, result.Success)
+		assert.NotEmpty(t, result.Error)
+
+		var cooldown *FaucetCooldownError
+		require.True(t, errors.As(err, &cooldown))
+		assert.Equal(t, "address", cooldown.Scope)
+		assert.True(t, now.Add(time.Hour).Equal(cooldown.RetryAt))
+		assert.Len(t, chain.broadcasts, broadcasts)
+	})
+
+	t.Run("IPCooldown", func(t *testing.T) {
+		_, err := service.Drip(FaucetRequest{Address: bob, Amount: "100", ClientIP: "203.0.113.7"})
+		var cooldown *FaucetCooldownError
+		require.True(t, errors.As(err, &cooldown))
+		assert.Equal(t, "ip", cooldown.Scope)
+		assert.True(t, now.Add(10*time.Minute).Equal(cooldown.RetryAt))
+
+		// Once the IP cooldown is over, bob is served
+		now = cooldown.RetryAt
+		_, err = service.Drip(FaucetRequest{Address: bob, Amount: "100", ClientIP: "203.0.113.7"})
+		require.NoError(t, err)
+	})
+
+	t.Run("IPv6Network", func(t *testing.T) {
+		carol := "cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnrk363e"
+		_, err := service.Drip(FaucetRequest{Address: carol, ClientIP: "2001:db8::1"})
+		assert.Error(t, err, "only xion addresses are served")
+
+		now = now.Add(50 * time.Minute)
+		_, err = service.Drip(FaucetRequest{Address: alice, Amount: "100", ClientIP: "2001:db8::1"})
+		require.NoError(t, err)
+		frank := newTestXionAddress(t, 0x46)
+		_, err = service.Drip(FaucetRequest{Address: frank, Amount: "100", ClientIP: "2001:db8::ffff:2"})
+		var cooldown *FaucetCooldownError
+		require.True(t, errors.As(err, &cooldown), "one /64 is one client")
+		assert.Equal(t, "ip", cooldown.Scope)
+	})
+
+	t.Run("MaxPerRequest", func(t *testing.T) {
+		_, err := service.Drip(FaucetRequest{Address: bob, Amount: "2000001"})
+		assert.ErrorIs(t, err, ErrCapExceeded)
+		var capErr *FaucetCapError
+		require.True(t, errors.As(err, &capErr))
+		assert.Equal(t, "request", capErr.Scope)
+		assert.Equal(t, "2", capErr.Limit.String())
+
+		_, err = service.Drip(FaucetRequest{Address: bob, Amount: "0"})
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+		_, err = service.Drip(FaucetRequest{Address: bob, Amount: "1.5"})
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("AddressDailyCap", func(t *testing.T) {
+		// alice has had 1.5001 NRN today; two more full drips would make 5.5001
+		now = now.Add(time.Hour)
+		_, err := service.RequestFromFaucet(alice, "")
+		require.NoError(t, err)
+		now = now.Add(time.Hour)
+		_, err = service.RequestFromFaucet(alice, "")
+
+		var capErr *FaucetCapError
+		require.True(t, errors.As(err, &capErr))
+		assert.Equal(t, "address", capErr.Scope)
+		assert.Equal(t, "1.4999", capErr.Remaining.String())
+
+		_, err = service.RequestFromFaucet(alice, "1499900")
+		require.NoError(t, err)
+
+		// The window rolls: a day after the first drip, it no longer counts
+		now = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+		_, err = service.RequestFromFaucet(alice, "1500000")
+		require.NoError(t, err)
+	})
+
+	t.Run("DailyCap", func(t *testing.T) {
+		// With this drip to bob, 6.9999 NRN went out in the last 24 hours
+		now = now.Add(time.Hour)
+		_, err := service.RequestFromFaucet(bob, "")
+		require.NoError(t, err)
+
+		dave := newTestXionAddress(t, 0x44)
+		_, err = service.RequestFromFaucet(dave, "")
+		var capErr *FaucetCapError
+		require.True(t, errors.As(err, &capErr))
+		assert.Equal(t, "daily", capErr.Scope)
+		assert.Equal(t, "1.0001", capErr.Remaining.String())
+	})
+
+	t.Run("LedgerSurvivesRestart", func(t *testing.T) {
+		restarted := newService(ledger)
+		_, err := restarted.RequestFromFaucet(bob, "100")
+		assert.ErrorIs(t, err, ErrCooldown)
+	})
+
+	t.Run("ReservedWhileSending", func(t *testing.T) {
+		grace := newTestXionAddress(t, 0x47)
+		var locked, reserved bool
+		chain.deliver = func([]byte) *ABCIError {
+			// Following the broadcast into its block
+			if service.faucet.mu.TryLock() {
+				service.faucet.mu.Unlock()
+			} else {
+				locked = true
+			}
+			drips, err := ledger.Drips(time.Time{}, grace, "")
+			reserved = err == nil && len(drips) == 1 && drips[0].TxHash == ""
+			return nil
+		}
+		defer func() { chain.deliver = nil }()
+
+		result, err := service.RequestFromFaucet(grace, "100")
+		require.NoError(t, err)
+		assert.False(t, locked, "the faucet is not locked while a drip is sent")
+		assert.True(t, reserved, "the drip is reserved while it is sent")
+		drips, err := ledger.Drips(time.Time{}, grace, "")
+		require.NoError(t, err)
+		require.Len(t, drips, 1)
+		assert.Equal(t, result.TxHash, drips[0].TxHash)
+	})
+
+	t.Run("FailedDrip", func(t *testing.T) {
+		chain.deliver = func([]byte) *ABCIError {
+			return &ABCIError{Codespace: "wasm", Code: 5, Log: "Cannot Sub with 0 and 100"}
+		}
+		defer func() { chain.deliver = nil }()
+		eve := newTestXionAddress(t, 0x45)
+
+		_, err := service.RequestFromFaucet(eve, "100")
+		assert.Error(t, err)
+		drips, err := ledger.Drips(time.Time{}, eve, "")
+		require.NoError(t, err)
+		assert.Empty(t, drips, "failed drips pay nothing and do not count")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		disabled := NewXionIntegrationService(XionConfig{RPCEndpoint: chain.URL, NRNTokenAddress: token}, keyring)
+		_, err := disabled.RequestFromFaucet(alice, "100")
+		assert.ErrorIs(t, err, ErrFaucetDisabled)
+	})
+}
+
+// newTestXionAddress is a valid xion address whose 20 bytes are all b.
+func newTestXionAddress(t *testing.T, b byte) string {
+	data, err := convertBits(bytes.Repeat([]byte{b}, 20), 8, 5, true)
+	require.NoError(t, err)
+	return bech32Encode("xion", data)
+}
@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// BIP-39 seed derivation and BIP-32 / SLIP-0010 hierarchical key derivation
+
+const hardenedOffset uint32 = 0x80000000
+
+// Curve selects the key derivation scheme for a chain.
+type Curve string
+
+const (
+	CurveSecp256k1 Curve = "secp256k1"
+	CurveEd25519   Curve = "ed25519"
+)
+
+var (
+	ErrInvalidDerivationPath = errors.New("invalid derivation path")
+	ErrInvalidChildKey       = errors.New("derived key is invalid")
+	ErrHardenedFromPublic    = errors.New("cannot derive hardened child from public key")
+	ErrInvalidExtendedKey    = errors.New("invalid extended key")
+)
+
+// ExtendedKey is a node in a BIP-32 (secp256k1) or SLIP-0010 (ed25519) tree.
+// Public-only (neutered) secp256k1 nodes leave Key nil and set PubKey.
+type ExtendedKey struct {
+	Curve     Curve
+	Key       []byte
+	PubKey    []byte
+	ChainCode []byte
+	Depth     uint8
+	ChildNum  uint32
+	ParentFP  []byte
+}
+
+// MnemonicToSeed stretches a BIP-39 mnemonic and optional passphrase into a
+// 64-byte seed.
+func MnemonicToSeed(mnemonic, passphrase string) []byte {
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), 2048, 64, sha512.New)
+}
+
+// NewMasterKey derives the root node of the tree for the given curve.
+func NewMasterKey(seed []byte, curve Curve) (*ExtendedKey, error) {
+	var hmacKey string
+	switch curve {
+	case CurveSecp256k1:
+		hmacKey = "Bitcoin seed"
+	case CurveEd25519:
+		hmacKey = "ed25519 seed"
+	default:
+		return nil, fmt.Errorf("unsupported curve: %s", curve)
+	}
+
+	mac := hmac.New(sha512.New, []byte(hmacKey))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key := &ExtendedKey{
+		Curve:     curve,
+		Key:       sum[:32],
+		ChainCode: sum[32:],
+		ParentFP:  []byte{0, 0, 0, 0},
+	}
+	if curve == CurveSecp256k1 && !validSecp256k1Scalar(key.Key) {
+		return nil, ErrInvalidChildKey
+	}
+	return key, nil
+}
+
+// Child derives child index i. Indices at or above 2^31 are hardened;
+// ed25519 only supports hardened derivation.
+func (k *ExtendedKey) Child(i uint32) (*ExtendedKey, error) {
+	hardened := i >= hardenedOffset
+
+	data := make([]byte, 0, 37)
+	switch {
+	case hardened && !k.IsPrivate():
+		return nil, ErrHardenedFromPublic
+	case hardened:
+		data = append(data, 0x00)
+		data = append(data, k.Key...)
+	case k.Curve == CurveEd25519:
+		return nil, fmt.Errorf("%w: ed25519 requires hardened indices", ErrInvalidDerivationPath)
+	default:
+		data = append(data, k.PublicKey()...)
+	}
+	data = binary.BigEndian.AppendUint32(data, i)
+
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+	il, ir := sum[:32], sum[32:]
+
+	child := &ExtendedKey{
+		Curve:     k.Curve,
+		ChainCode: ir,
+		Depth:     k.Depth + 1,
+		ChildNum:  i,
+		ParentFP:  k.Fingerprint(),
+	}
+
+	if k.Curve == CurveEd25519 {
+		child.Key = il
+		return child, nil
+	}
+
+	if !validSecp256k1Scalar(il) {
+		return nil, ErrInvalidChildKey
+	}
+
+	if !k.IsPrivate() {
+		childPub, err := addTweakToPublicKey(k.PubKey, il)
+		if err != nil {
+			return nil, err
+		}
+		child.PubKey = childPub
+		return child, nil
+	}
+
+	var tweak, parent secp256k1.ModNScalar
+	tweak.SetByteSlice(il)
+	parent.SetByteSlice(k.Key)
+	tweak.Add(&parent)
+	if tweak.IsZero() {
+		return nil, ErrInvalidChildKey
+	}
+	childKey := tweak.Bytes()
+	child.Key = childKey[:]
+	return child, nil
+}
+
+// Derive walks a path such as m/44'/60'/0'/0/0 from this node.
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indices, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	node := k
+	for _, i := range indices {
+		if node, err = node.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// IsPrivate reports whether the node holds a private key.
+func (k *ExtendedKey) IsPrivate() bool {
+	return k.Key != nil
+}
+
+// Neuter returns the public-only counterpart of a secp256k1 node.
+func (k *ExtendedKey) Neuter() *ExtendedKey {
+	return &ExtendedKey{
+		Curve:     k.Curve,
+		PubKey:    k.PublicKey(),
+		ChainCode: k.ChainCode,
+		Depth:     k.Depth,
+		ChildNum:  k.ChildNum,
+		ParentFP:  k.ParentFP,
+	}
+}
+
+// PublicKey returns the compressed secp256k1 point or the raw ed25519 key.
+func (k *ExtendedKey) PublicKey() []byte {
+	if !k.IsPrivate() {
+		return k.PubKey
+	}
+	if k.Curve == CurveEd25519 {
+		return ed25519.NewKeyFromSeed(k.Key).Public().(ed25519.PublicKey)
+	}
+	return secp256k1.PrivKeyFromBytes(k.Key).PubKey().SerializeCompressed()
+}
+
+// Fingerprint is the first four bytes of HASH160 of the public key.
+func (k *ExtendedKey) Fingerprint() []byte {
+	return hash160(k.PublicKey())[:4]
+}
+
+var (
+	xprvVersion = []byte{0x04, 0x88, 0xad, 0xe4}
+	xpubVersion = []byte{0x04, 0x88, 0xb2, 0x1e}
+)
+
+// String serializes a secp256k1 node as a Base58Check xprv, or as an xpub
+// for public-only nodes.
+func (k *ExtendedKey) String() string {
+	if !k.IsPrivate() {
+		return k.PublicString()
+	}
+	return k.serialize(xprvVersion, append([]byte{0x00}, k.Key...))
+}
+
+// PublicString serializes a secp256k1 node as a Base58Check xpub.
+func (k *ExtendedKey) PublicString() string {
+	return k.serialize(xpubVersion, k.PublicKey())
+}
+
+// ParseExtendedPublicKey decodes a Base58Check extended public key and
+// returns it with its 4-byte version, which callers map to an address type.
+func ParseExtendedPublicKey(s string) (*ExtendedKey, []byte, error) {
+	payload, err := base58CheckDecode(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+	if len(payload) != 78 {
+		return nil, nil, fmt.Errorf("%w: expected 78 bytes, got %d", ErrInvalidExtendedKey, len(payload))
+	}
+
+	pubKey := payload[45:78]
+	if _, err := secp256k1.ParsePubKey(pubKey); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+
+	return &ExtendedKey{
+		Curve:     CurveSecp256k1,
+		PubKey:    pubKey,
+		ChainCode: payload[13:45],
+		Depth:     payload[4],
+		ParentFP:  payload[5:9],
+		ChildNum:  binary.BigEndian.Uint32(payload[9:13]),
+	}, payload[:4], nil
+}
+
+func (k *ExtendedKey) serialize(version []byte, keyData []byte) string {
+	payload := make([]byte, 0, 74)
+	payload = append(payload, k.Depth)
+	payload = append(payload, k.ParentFP...)
+	payload = binary.BigEndian.AppendUint32(payload, k.ChildNum)
+	payload = append(payload, k.ChainCode...)
+	payload = append(payload, keyData...)
+	return base58CheckEncode(version, payload)
+}
+
+// ParseDerivationPath converts m/44'/0'/0'/0/0 into child indices. Both '
+// and h mark hardened components.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDerivationPath, path)
+	}
+
+	indices := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || uint32(n) >= hardenedOffset {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidDerivationPath, path)
+		}
+
+		index := uint32(n)
+		if hardened {
+			index += hardenedOffset
+		}
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+func validSecp256k1Scalar(b []byte) bool {
+	var s secp256k1.ModNScalar
+	overflow := s.SetByteSlice(b)
+	return !overflow && !s.IsZero()
+}
+
+// addTweakToPublicKey returns tweak*G + publicKey, the public half of BIP-32
+// child derivation.
+func addTweakToPublicKey(publicKey []byte, tweak []byte) ([]byte, error) {
+	parent, err := secp256k1.ParsePubKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidExtendedKey, err)
+	}
+
+	var scalar secp256k1.ModNScalar
+	scalar.SetByteSlice(tweak)
+
+	var tweakPoint, parentPoint, sum secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&scalar, &tweakPoint)
+	parent.AsJacobian(&parentPoint)
+	secp256k1.AddNonConst(&tweakPoint, &parentPoint, &sum)
+	if (sum.X.IsZero() && sum.Y.IsZero()) || sum.Z.IsZero() {
+		return nil, ErrInvalidChildKey
+	}
+
+	sum.ToAffine()
+	return secp256k1.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed(), nil
+}
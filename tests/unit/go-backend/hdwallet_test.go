@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHDKeyDerivation(t *testing.T) {
+	testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	t.Run("BIP39Seed", func(t *testing.T) {
+		seed := MnemonicToSeed(testMnemonic, "TREZOR")
+
+		assert.Equal(t,
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+			hex.EncodeToString(seed))
+	})
+
+	t.Run("BIP32TestVector1", func(t *testing.T) {
+		seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+		master, err := NewMasterKey(seed, CurveSecp256k1)
+		require.NoError(t, err)
+
+		assert.Equal(t, "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi", master.String())
+		assert.Equal(t, "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8", master.PublicString())
+
+		child, err := master.Derive("m/0'")
+		require.NoError(t, err)
+		assert.Equal(t, "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7", child.String())
+
+		leaf, err := master.Derive("m/0'/1/2'/2/1000000000")
+		require.NoError(t, err)
+		assert.Equal(t, "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76", leaf.String())
+	})
+
+	t.Run("SLIP10Ed25519TestVector1", func(t *testing.T) {
+		seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+		master, err := NewMasterKey(seed, CurveEd25519)
+		require.NoError(t, err)
+
+		assert.Equal(t, "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7", hex.EncodeToString(master.Key))
+		assert.Equal(t, "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb", hex.EncodeToString(master.ChainCode))
+
+		leaf, err := master.Derive("m/0'/1'/2'/2'/1000000000'")
+		require.NoError(t, err)
+		assert.Equal(t, "8f94d394a8e8fd6b1bc2f3f49f5c47e385281d5c17e65324b0f62483e37e8793", hex.EncodeToString(leaf.Key))
+
+		_, err = master.Derive("m/0")
+		assert.ErrorIs(t, err, ErrInvalidDerivationPath)
+	})
+
+	t.Run("ChainAddressVectors", func(t *testing.T) {
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+
+		testCases := []struct {
+			chain    string
+			expected string
+		}{
+			{"BTC", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+			{"ETH", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94"},
+			{"SOL", "HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.chain, func(t *testing.T) {
+				wallet, err := service.GenerateWalletForChain(testMnemonic, tc.chain)
+
+				require.NoError(t, err)
+				assert.Equal(t, tc.expected, wallet.Address)
+			})
+		}
+
+		t.Run("CosmosPath", func(t *testing.T) {
+			master, err := NewMasterKey(MnemonicToSeed(testMnemonic, ""), CurveSecp256k1)
+			require.NoError(t, err)
+			account, err := master.Derive("m/44'/118'/0'/0/0")
+			require.NoError(t, err)
+
+			data, err := convertBits(hash160(account.PublicKey()), 8, 5, true)
+			require.NoError(t, err)
+			assert.Equal(t, "cosmos19rl4cm2hmr8afy4kldpxz3fka4jguq0auqdal4", bech32Encode("cosmos", data))
+		})
+	})
+
+	t.Run("InvalidPaths", func(t *testing.T) {
+		for _, path := range []string{"", "44'/0'", "m/x", "m/2147483648"} {
+			_, err := ParseDerivationPath(path)
+			assert.ErrorIs(t, err, ErrInvalidDerivationPath, path)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// At-rest encryption for Wallet.EncryptedPrivateKey
+//
+// A sealed key is base64(version || salt || nonce || ciphertext). The version
+// byte pins the KDF parameters and cipher, so blobs written today stay
+// readable after the defaults change. The header is authenticated as AEAD
+// additional data.
+
+const (
+	keyBlobV1 byte = 0x01 // Argon2id (t=3, m=64 MiB, p=4) + AES-256-GCM
+
+	keySaltSize = 16
+)
+
+type keyBlobParams struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+var keyBlobVersions = map[byte]keyBlobParams{
+	keyBlobV1: {time: 3, memory: 64 * 1024, threads: 4},
+}
+
+var (
+	ErrEmptyPassphrase       = errors.New("passphrase is required")
+	ErrUnsupportedKeyVersion = errors.New("unsupported encrypted key version")
+	ErrMalformedEncryptedKey = errors.New("malformed encrypted key")
+	ErrPrivateKeyDecryption  = errors.New("failed to decrypt private key: wrong passphrase or corrupted data")
+)
+
+// EncryptPrivateKey seals privateKey under a key derived from passphrase with
+// a fresh random salt and nonce.
+func EncryptPrivateKey(privateKey, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", ErrEmptyPassphrase
+	}
+
+	salt := make([]byte, keySaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	aead, err := newKeyBlobAEAD(keyBlobV1, passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := append([]byte{keyBlobV1}, salt...)
+	blob := append(append(header, nonce...), aead.Seal(nil, nonce, []byte(privateKey), header)...)
+	return base64.StdEncoding.EncodeToString(blob), nil
+}
+
+// DecryptPrivateKey opens a blob produced by EncryptPrivateKey.
+func DecryptPrivateKey(encrypted, passphrase string) (string, error) {
+	plaintext, err := openPrivateKey(encrypted, passphrase)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// openPrivateKey is DecryptPrivateKey without the string conversion, so
+// callers can wipe the plaintext once they are done with it.
+func openPrivateKey(encrypted, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(blob) < 1+keySaltSize {
+		return nil, ErrMalformedEncryptedKey
+	}
+
+	version := blob[0]
+	if _, ok := keyBlobVersions[version]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedKeyVersion, version)
+	}
+
+	header := blob[:1+keySaltSize]
+	aead, err := newKeyBlobAEAD(version, passphrase, header[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	rest := blob[len(header):]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrMalformedEncryptedKey
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, ErrPrivateKeyDecryption
+	}
+	return plaintext, nil
+}
+
+// wipeBytes overwrites secret material that is no longer needed.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func newKeyBlobAEAD(version byte, passphrase string, salt []byte) (cipher.AEAD, error) {
+	params := keyBlobVersions[version]
+	key := argon2.IDKey([]byte(passphrase), salt, params.time, params.memory, params.threads, 32)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
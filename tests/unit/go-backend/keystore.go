@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keystore V3 (Web3 Secret Storage) and Solana id.json key files
+
+const (
+	keystoreVersion = 3
+
+	// StandardScryptN and StandardScryptP match the geth defaults so exported
+	// files open in MetaMask and geth without surprises.
+	StandardScryptN = 1 << 18
+	StandardScryptP = 1
+
+	// Imported files choose their own KDF costs, so they are capped: above
+	// these a crafted file could exhaust memory or CPU before the MAC check.
+	maxKeystoreScryptN      = 1 << 20
+	maxKeystoreScryptRP     = 1 << 30 // r·p must stay below this
+	maxKeystoreScryptMemory = 1 << 30 // 128·r·n bytes
+	maxKeystorePBKDF2Rounds = 10_000_000
+	keystoreDKLen           = 32
+)
+
+var (
+	ErrUnsupportedKeystore = errors.New("unsupported keystore format")
+	ErrKeystoreMAC         = errors.New("keystore MAC mismatch: wrong password or corrupted file")
+	ErrKeystoreAddress     = errors.New("keystore address does not match its private key")
+)
+
+type keystoreV3 struct {
+	Version int            `json:"version"`
+	ID      string         `json:"id"`
+	Address string         `json:"address,omitempty"`
+	Crypto  keystoreCrypto `json:"crypto"`
+}
+
+type keystoreCrypto struct {
+	Cipher       string                 `json:"cipher"`
+	CipherText   string                 `json:"ciphertext"`
+	CipherParams keystoreCipherParams   `json:"cipherparams"`
+	KDF          string                 `json:"kdf"`
+	KDFParams    map[string]interface{} `json:"kdfparams"`
+	MAC          string                 `json:"mac"`
+}
+
+type keystoreCipherParams struct {
+	IV string `json:"iv"`
+}
+
+// EncryptKeystoreV3 seals a secp256k1 private key as a Keystore V3 document
+// using scrypt with the given cost parameters. address is written without
+// the 0x prefix when set.
+func EncryptKeystoreV3(privateKey []byte, password string, address string, scryptN, scryptP int) ([]byte, error) {
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := scrypt.Key([]byte(password), salt, scryptN, 8, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherText, err := aesCTR(derivedKey[:16], iv, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(keystoreV3{
+		Version: keystoreVersion,
+		ID:      uuid.New().String(),
+		Address: strings.ToLower(strings.TrimPrefix(address, "0x")),
+		Crypto: keystoreCrypto{
+			Cipher:       "aes-128-ctr",
+			CipherText:   hex.EncodeToString(cipherText),
+			CipherParams: keystoreCipherParams{IV: hex.EncodeToString(iv)},
+			KDF:          "scrypt",
+			KDFParams: map[string]interface{}{
+				"n":     scryptN,
+				"r":     8,
+				"p":     scryptP,
+				"dklen": 32,
+				"salt":  hex.EncodeToString(salt),
+			},
+			MAC: hex.EncodeToString(keccak256(derivedKey[16:32], cipherText)),
+		},
+	})
+}
+
+// DecryptKeystoreV3 verifies the MAC and returns the raw private key from a
+// Keystore V3 document using either the scrypt or pbkdf2 KDF.
+func DecryptKeystoreV3(keystoreJSON []byte, password string) ([]byte, error) {
+	var ks keystoreV3
+	if err := json.Unmarshal(keystoreJSON, &ks); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKeystore, err)
+	}
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedKeystore, ks.Version)
+	}
+	if ks.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("%w: cipher %q", ErrUnsupportedKeystore, ks.Crypto.Cipher)
+	}
+
+	derivedKey, err := keystoreDerivedKey(ks.Crypto, password)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ciphertext: %v", ErrUnsupportedKeystore, err)
+	}
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, fmt.Errorf("%w: mac: %v", ErrUnsupportedKeystore, err)
+	}
+	if !hmac.Equal(keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrKeystoreMAC
+	}
+
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("%w: invalid iv", ErrUnsupportedKeystore)
+	}
+
+	privateKey, err := aesCTR(derivedKey[:16], iv, cipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	// The optional address field is an Ethereum address; reject files whose
+	// key does not produce it.
+	if ks.Address != "" {
+		codec := &EVMCodec{}
+		publicKey, err := codec.PublicKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		address, err := codec.EncodeAddress(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(strings.TrimPrefix(address, "0x"), strings.TrimPrefix(ks.Address, "0x")) {
+			return nil, ErrKeystoreAddress
+		}
+	}
+	return privateKey, nil
+}
+
+func keystoreDerivedKey(c keystoreCrypto, password string) ([]byte, error) {
+	params := c.KDFParams
+	salt, err := hex.DecodeString(keystoreParamString(params, "salt"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: salt: %v", ErrUnsupportedKeystore, err)
+	}
+
+	dkLen := keystoreParamInt(params, "dklen")
+	if dkLen != keystoreDKLen {
+		return nil, fmt.Errorf("%w: dklen %d", ErrUnsupportedKeystore, dkLen)
+	}
+
+	switch c.KDF {
+	case "scrypt":
+		n, r, p := keystoreParamInt(params, "n"), keystoreParamInt(params, "r"), keystoreParamInt(params, "p")
+		if n < 2 || n > maxKeystoreScryptN || r < 1 || p < 1 || r*p >= maxKeystoreScryptRP || 128*r*n > maxKeystoreScryptMemory {
+			return nil, fmt.Errorf("%w: scrypt n=%d r=%d p=%d", ErrUnsupportedKeystore, n, r, p)
+		}
+		return scrypt.Key([]byte(password), salt, n, r, p, dkLen)
+	case "pbkdf2":
+		if prf := keystoreParamString(params, "prf"); prf != "hmac-sha256" {
+			return nil, fmt.Errorf("%w: prf %q", ErrUnsupportedKeystore, prf)
+		}
+		rounds := keystoreParamInt(params, "c")
+		if rounds < 1 || rounds > maxKeystorePBKDF2Rounds {
+			return nil, fmt.Errorf("%w: pbkdf2 c=%d", ErrUnsupportedKeystore, rounds)
+		}
+		return pbkdf2.Key([]byte(password), salt, rounds, dkLen, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("%w: kdf %q", ErrUnsupportedKeystore, c.KDF)
+	}
+}
+
+// keystoreParamInt reads a whole-number KDF parameter, returning -1 for
+// anything else, including values too large to be a sane cost.
+func keystoreParamInt(params map[string]interface{}, name string) int {
+	v, ok := params[name].(float64)
+	if !ok || v != math.Trunc(v) || v < 0 || v > 1<<40 {
+		return -1
+	}
+	return int(v)
+}
+
+func keystoreParamString(params map[string]interface{}, name string) string {
+	v, _ := params[name].(string)
+	return v
+}
+
+func aesCTR(key, iv, in []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+
+// DecodeSolanaKeypair parses a Solana CLI id.json file: a JSON array of the
+// 64 keypair bytes (seed followed by public key).
+func DecodeSolanaKeypair(keypairJSON []byte) ([]byte, error) {
+	var values []int
+	if err := json.Unmarshal(keypairJSON, &values); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedKeystore, err)
+	}
+	if len(values) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrUnsupportedKeystore, ed25519.PrivateKeySize, len(values))
+	}
+
+	keypair := make([]byte, len(values))
+	for i, v := range values {
+		if v < 0 || v > 255 {
+			return nil, fmt.Errorf("%w: byte %d out of range", ErrUnsupportedKeystore, i)
+		}
+		keypair[i] = byte(v)
+	}
+
+	seed := keypair[:ed25519.SeedSize]
+	if !bytes.Equal(ed25519.NewKeyFromSeed(seed)[ed25519.SeedSize:], keypair[ed25519.SeedSize:]) {
+		return nil, fmt.Errorf("%w: public key does not match seed", ErrInvalidPrivateKey)
+	}
+	return keypair, nil
+}
+
+// EncodeSolanaKeypair writes a 32-byte seed or 64-byte keypair in the
+// Solana CLI id.json format.
+func EncodeSolanaKeypair(privateKey []byte) ([]byte, error) {
+	var keypair ed25519.PrivateKey
+	switch len(privateKey) {
+	case ed25519.SeedSize:
+		keypair = ed25519.NewKeyFromSeed(privateKey)
+	case ed25519.PrivateKeySize:
+		keypair = privateKey
+	default:
+		return nil, ErrInvalidPrivateKey
+	}
+
+	values := make([]int, len(keypair))
+	for i, b := range keypair {
+		values[i] = int(b)
+	}
+	return json.Marshal(values)
+}
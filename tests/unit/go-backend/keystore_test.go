@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors from the Web3 Secret Storage Definition
+const (
+	keystorePBKDF2Vector = `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+			"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+			"kdf": "pbkdf2",
+			"kdfparams": {
+				"c": 262144,
+				"dklen": 32,
+				"prf": "hmac-sha256",
+				"salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"
+			},
+			"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`
+
+	keystoreScryptVector = `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "83dbcc02d8ccb40e466191a123791e0e"},
+			"ciphertext": "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+			"kdf": "scrypt",
+			"kdfparams": {
+				"dklen": 32,
+				"n": 262144,
+				"p": 8,
+				"r": 1,
+				"salt": "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"
+			},
+			"mac": "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`
+
+	keystoreVectorKey = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+)
+
+func TestKeystore(t *testing.T) {
+	t.Run("PBKDF2Vector", func(t *testing.T) {
+		key, err := DecryptKeystoreV3([]byte(keystorePBKDF2Vector), "testpassword")
+
+		require.NoError(t, err)
+		assert.Equal(t, keystoreVectorKey, hex.EncodeToString(key))
+	})
+
+	t.Run("ScryptVector", func(t *testing.T) {
+		key, err := DecryptKeystoreV3([]byte(keystoreScryptVector), "testpassword")
+
+		require.NoError(t, err)
+		assert.Equal(t, keystoreVectorKey, hex.EncodeToString(key))
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		_, err := DecryptKeystoreV3([]byte(keystorePBKDF2Vector), "wrongpassword")
+		assert.ErrorIs(t, err, ErrKeystoreMAC)
+	})
+
+	t.Run("RoundTripWithAddress", func(t *testing.T) {
+		key, _ := hex.DecodeString(keystoreVectorKey)
+		codec := &EVMCodec{}
+		pub, err := codec.PublicKey(key)
+		require.NoError(t, err)
+		address, err := codec.EncodeAddress(pub)
+		require.NoError(t, err)
+
+		// Light scrypt parameters keep the test fast
+		keystoreJSON, err := EncryptKeystoreV3(key, "secret", address, 1<<12, 6)
+		require.NoError(t, err)
+
+		decrypted, err := DecryptKeystoreV3(keystoreJSON, "secret")
+		require.NoError(t, err)
+		assert.Equal(t, key, decrypted)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(keystoreJSON, &doc))
+		doc["address"] = "0000000000000000000000000000000000000000"
+		tampered, _ := json.Marshal(doc)
+		_, err = DecryptKeystoreV3(tampered, "secret")
+		assert.ErrorIs(t, err, ErrKeystoreAddress)
+	})
+
+	t.Run("UnsupportedKDF", func(t *testing.T) {
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(keystorePBKDF2Vector), &doc))
+		doc["crypto"].(map[string]interface{})["kdf"] = "argon2"
+		keystoreJSON, _ := json.Marshal(doc)
+
+		_, err := DecryptKeystoreV3(keystoreJSON, "testpassword")
+		assert.ErrorIs(t, err, ErrUnsupportedKeystore)
+	})
+
+	t.Run("KDFLimits", func(t *testing.T) {
+		withParams := func(t *testing.T, vector string, params map[string]interface{}) []byte {
+			var doc map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(vector), &doc))
+			kdfParams := doc["crypto"].(map[string]interface{})["kdfparams"].(map[string]interface{})
+			for name, value := range params {
+				kdfParams[name] = value
+			}
+			keystoreJSON, err := json.Marshal(doc)
+			require.NoError(t, err)
+			return keystoreJSON
+		}
+
+		for name, tc := range map[string]struct {
+			vector string
+			params map[string]interface{}
+		}{
+			"ScryptN":         {keystoreScryptVector, map[string]interface{}{"n": 1 << 30}},
+			"ScryptRP":        {keystoreScryptVector, map[string]interface{}{"r": 1 << 15, "p": 1 << 15}},
+			"ScryptMemory":    {keystoreScryptVector, map[string]interface{}{"n": 1 << 20, "r": 16, "p": 1}},
+			"ScryptZero":      {keystoreScryptVector, map[string]interface{}{"r": 0}},
+			"PBKDF2Rounds":    {keystorePBKDF2Vector, map[string]interface{}{"c": 1e8}},
+			"PBKDF2Fraction":  {keystorePBKDF2Vector, map[string]interface{}{"c": 1.5}},
+			"DKLen":           {keystorePBKDF2Vector, map[string]interface{}{"dklen": 1 << 30}},
+			"ShortDKLen":      {keystoreScryptVector, map[string]interface{}{"dklen": 16}},
+			"HugeParameter":   {keystoreScryptVector, map[string]interface{}{"n": 1e300}},
+			"MissingRounds":   {keystorePBKDF2Vector, map[string]interface{}{"c": nil}},
+			"NegativeScryptN": {keystoreScryptVector, map[string]interface{}{"n": -2}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				_, err := DecryptKeystoreV3(withParams(t, tc.vector, tc.params), "testpassword")
+				assert.ErrorIs(t, err, ErrUnsupportedKeystore)
+			})
+		}
+	})
+
+	t.Run("SolanaKeypair", func(t *testing.T) {
+		seed := make([]byte, 32)
+		seed[0] = 7
+
+		keypairJSON, err := EncodeSolanaKeypair(seed)
+		require.NoError(t, err)
+
+		keypair, err := DecodeSolanaKeypair(keypairJSON)
+		require.NoError(t, err)
+		assert.Equal(t, seed, keypair[:32])
+
+		var values []int
+		require.NoError(t, json.Unmarshal(keypairJSON, &values))
+		values[63] ^= 1
+		corrupted, _ := json.Marshal(values)
+		_, err = DecodeSolanaKeypair(corrupted)
+		assert.ErrorIs(t, err, ErrInvalidPrivateKey)
+
+		_, err = DecodeSolanaKeypair([]byte(`[1, 2, 3]`))
+		assert.ErrorIs(t, err, ErrUnsupportedKeystore)
+	})
+
+	t.Run("ServiceImportExport", func(t *testing.T) {
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+		userID := uuid.New()
+		passphrase := "correct horse battery staple"
+
+		wallet, err := service.ImportKeystore(userID, "MetaMask", []byte(keystorePBKDF2Vector), "testpassword", "ETH", passphrase)
+		require.NoError(t, err)
+
+		imported, err := service.ImportWallet(uuid.New(), "Raw", keystoreVectorKey, "ETH", passphrase)
+		require.NoError(t, err)
+		assert.Equal(t, imported.Address, wallet.Address)
+		assert.Equal(t, imported.Network, wallet.Network)
+
+		exported, err := service.ExportKeystore(wallet.ID, passphrase, "export password")
+		require.NoError(t, err)
+		key, err := DecryptKeystoreV3(exported, "export password")
+		require.NoError(t, err)
+		assert.Equal(t, keystoreVectorKey, hex.EncodeToString(key))
+
+		seed := make([]byte, 32)
+		seed[31] = 42
+		keypairJSON, err := EncodeSolanaKeypair(seed)
+		require.NoError(t, err)
+
+		solWallet, err := service.ImportKeystore(userID, "Phantom", keypairJSON, "", "SOL", passphrase)
+		require.NoError(t, err)
+		assert.NoError(t, service.ValidateAddress(solWallet.Address, "SOL"))
+
+		exportedKeypair, err := service.ExportKeystore(solWallet.ID, passphrase, "")
+		require.NoError(t, err)
+		assert.JSONEq(t, string(keypairJSON), string(exportedKeypair))
+	})
+}
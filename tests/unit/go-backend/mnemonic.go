@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// BIP-39 mnemonic generation and validation
+
+//go:embed bip39_english.txt
+var bip39EnglishRaw string
+
+var (
+	bip39English      = strings.Fields(bip39EnglishRaw)
+	bip39EnglishIndex = func() map[string]int {
+		index := make(map[string]int, len(bip39English))
+		for i, word := range bip39English {
+			index[word] = i
+		}
+		return index
+	}()
+)
+
+var (
+	ErrInvalidWordCount = errors.New("invalid mnemonic word count")
+	ErrInvalidEntropy   = errors.New("invalid entropy length")
+	ErrUnknownWord      = errors.New("unknown mnemonic word")
+	ErrMnemonicChecksum = errors.New("invalid mnemonic checksum")
+)
+
+// MnemonicError reports why a mnemonic was rejected. Word and Position are
+// set when a specific word is at fault.
+type MnemonicError struct {
+	Word     string
+	Position int
+	Err      error
+}
+
+func (e *MnemonicError) Error() string {
+	if e.Word != "" {
+		return fmt.Sprintf("invalid mnemonic phrase: %v %q at position %d", e.Err, e.Word, e.Position+1)
+	}
+	return fmt.Sprintf("invalid mnemonic phrase: %v", e.Err)
+}
+
+func (e *MnemonicError) Unwrap() error {
+	return e.Err
+}
+
+// validWordCount reports whether n is one of the BIP-39 sizes 12/15/18/21/24.
+func validWordCount(n int) bool {
+	return n >= 12 && n <= 24 && n%3 == 0
+}
+
+// GenerateMnemonic returns a fresh mnemonic of wordCount words backed by
+// crypto/rand entropy.
+func GenerateMnemonic(wordCount int) (string, error) {
+	if !validWordCount(wordCount) {
+		return "", fmt.Errorf("%w: %d", ErrInvalidWordCount, wordCount)
+	}
+
+	entropy := make([]byte, wordCount*4/3)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", fmt.Errorf("failed to read entropy: %w", err)
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes 16-32 bytes of entropy, plus its SHA-256
+// checksum bits, as English words.
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("%w: %d bytes", ErrInvalidEntropy, len(entropy))
+	}
+
+	checksumBits := len(entropy) / 4
+	hash := sha256.Sum256(entropy)
+	data := append(append([]byte{}, entropy...), hash[0])
+
+	wordCount := (len(entropy)*8 + checksumBits) / 11
+	words := make([]string, wordCount)
+	for i := range words {
+		index := 0
+		for bit := i * 11; bit < (i+1)*11; bit++ {
+			index = index<<1 | int(data[bit/8]>>(7-uint(bit%8))&1)
+		}
+		words[i] = bip39English[index]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic back to its entropy, verifying word
+// membership and the checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if !validWordCount(len(words)) {
+		return nil, &MnemonicError{Position: len(words), Err: ErrInvalidWordCount}
+	}
+
+	totalBits := len(words) * 11
+	checksumBits := totalBits / 33
+	data := make([]byte, (totalBits+7)/8)
+	for i, word := range words {
+		index, ok := bip39EnglishIndex[word]
+		if !ok {
+			return nil, &MnemonicError{Word: word, Position: i, Err: ErrUnknownWord}
+		}
+		for b := 0; b < 11; b++ {
+			if index>>(10-uint(b))&1 == 1 {
+				bit := i*11 + b
+				data[bit/8] |= 1 << (7 - uint(bit%8))
+			}
+		}
+	}
+
+	entropy := data[:(totalBits-checksumBits)/8]
+	hash := sha256.Sum256(entropy)
+	mask := byte(0xff << (8 - uint(checksumBits)))
+	if hash[0]&mask != data[len(entropy)]&mask {
+		return nil, &MnemonicError{Err: ErrMnemonicChecksum}
+	}
+	return entropy, nil
+}
+
+// ValidateMnemonic returns a *MnemonicError if the phrase is not a valid
+// English BIP-39 mnemonic.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := MnemonicToEntropy(mnemonic)
+	return err
+}
@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMnemonic(t *testing.T) {
+	t.Run("Wordlist", func(t *testing.T) {
+		assert.Len(t, bip39English, 2048)
+		assert.Equal(t, "abandon", bip39English[0])
+		assert.Equal(t, "zoo", bip39English[2047])
+	})
+
+	t.Run("EntropyVectors", func(t *testing.T) {
+		testCases := []struct {
+			entropy  string
+			mnemonic string
+		}{
+			{"00000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"},
+			{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f", "legal winner thank year wave sausage worth useful legal winner thank yellow"},
+			{"80808080808080808080808080808080", "letter advice cage absurd amount doctor acoustic avoid letter advice cage above"},
+			{"ffffffffffffffffffffffffffffffff", "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong"},
+			{"000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon agent"},
+			{"0000000000000000000000000000000000000000000000000000000000000000", "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art"},
+		}
+
+		for _, tc := range testCases {
+			entropy, _ := hex.DecodeString(tc.entropy)
+
+			mnemonic, err := EntropyToMnemonic(entropy)
+			require.NoError(t, err)
+			assert.Equal(t, tc.mnemonic, mnemonic)
+
+			decoded, err := MnemonicToEntropy(tc.mnemonic)
+			require.NoError(t, err)
+			assert.Equal(t, entropy, decoded)
+		}
+	})
+
+	t.Run("AllWordCounts", func(t *testing.T) {
+		for _, count := range []int{12, 15, 18, 21, 24} {
+			mnemonic, err := GenerateMnemonic(count)
+
+			require.NoError(t, err)
+			assert.Len(t, strings.Fields(mnemonic), count)
+			assert.NoError(t, ValidateMnemonic(mnemonic))
+		}
+
+		for _, count := range []int{0, 11, 13, 27} {
+			_, err := GenerateMnemonic(count)
+			assert.ErrorIs(t, err, ErrInvalidWordCount)
+		}
+	})
+
+	t.Run("BadChecksum", func(t *testing.T) {
+		err := ValidateMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon")
+
+		var mnemonicErr *MnemonicError
+		require.ErrorAs(t, err, &mnemonicErr)
+		assert.ErrorIs(t, err, ErrMnemonicChecksum)
+	})
+
+	t.Run("UnknownWord", func(t *testing.T) {
+		err := ValidateMnemonic("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon bitcoin")
+
+		var mnemonicErr *MnemonicError
+		require.ErrorAs(t, err, &mnemonicErr)
+		assert.ErrorIs(t, err, ErrUnknownWord)
+		assert.Equal(t, "bitcoin", mnemonicErr.Word)
+		assert.Equal(t, 11, mnemonicErr.Position)
+	})
+}
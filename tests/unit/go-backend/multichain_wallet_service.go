@@ -0,0 +1,469 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ChainInfo struct {
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Network  string `json:"network"`
+	Decimals int    `json:"decimals"`
+}
+
+type WalletResult struct {
+	Address        string `json:"address"`
+	PrivateKey     string `json:"private_key"`
+	DerivationPath string `json:"derivation_path,omitempty"`
+}
+
+type Wallet struct {
+	ID                  uuid.UUID `json:"id"`
+	UserID              uuid.UUID `json:"user_id"`
+	Name                string    `json:"name"`
+	Network             string    `json:"network"`
+	Address             string    `json:"address"`
+	EncryptedPrivateKey string    `json:"-"`
+	IsHardware          bool      `json:"is_hardware"`
+	IsWatchOnly         bool      `json:"is_watch_only"`
+	ExtendedPublicKey   string    `json:"extended_public_key,omitempty"`
+	IsActive            bool      `json:"is_active"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// MultichainWalletService derives and imports wallets for every supported chain
+type MultichainWalletService struct {
+	wallets  WalletRepository
+	chains   *ChainRegistry
+	backends map[string]ChainBackend
+}
+
+// NewMultichainWalletService serves the built-in chains from chains.yaml.
+func NewMultichainWalletService(wallets WalletRepository) *MultichainWalletService {
+	return NewMultichainWalletServiceWithRegistry(wallets, DefaultChainRegistry())
+}
+
+// NewMultichainWalletServiceWithRegistry serves the chains in registry and
+// connects a backend for each chain that lists RPC endpoints.
+func NewMultichainWalletServiceWithRegistry(wallets WalletRepository, chains *ChainRegistry) *MultichainWalletService {
+	s := &MultichainWalletService{
+		wallets:  wallets,
+		chains:   chains,
+		backends: make(map[string]ChainBackend),
+	}
+	for _, chain := range chains.Chains() {
+		if backend := chain.NewBackend(); backend != nil {
+			s.backends[chain.Symbol] = backend
+		}
+	}
+	return s
+}
+
+// RegisterBackend routes network operations for chain (a ChainInfo.Symbol)
+// to backend, replacing any previous registration.
+func (s *MultichainWalletService) RegisterBackend(chain string, backend ChainBackend) {
+	s.backends[chain] = backend
+}
+
+func (s *MultichainWalletService) GetSupportedChains() []ChainInfo {
+	var chains []ChainInfo
+	for _, chain := range s.chains.Chains() {
+		chains = append(chains, chain.Info())
+	}
+	return chains
+}
+
+// GenerateMnemonic returns a random BIP-39 mnemonic of 12, 15, 18, 21 or 24
+// words.
+func (s *MultichainWalletService) GenerateMnemonic(wordCount int) (string, error) {
+	return GenerateMnemonic(wordCount)
+}
+
+// GenerateWalletForChain derives the chain's first account from the mnemonic
+// along its BIP-44 path, so the result can be restored in any standard wallet.
+func (s *MultichainWalletService) GenerateWalletForChain(mnemonic string, chain string) (*WalletResult, error) {
+	if strings.TrimSpace(mnemonic) == "" {
+		return nil, errors.New("mnemonic is required")
+	}
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+
+	config, err := s.chains.Get(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	master, err := NewMasterKey(MnemonicToSeed(mnemonic, ""), config.Curve)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+
+	account, err := master.Derive(config.DerivationPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive %s key: %w", chain, err)
+	}
+
+	address, err := config.Codec().EncodeAddress(account.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &WalletResult{
+		Address:        address,
+		PrivateKey:     hex.EncodeToString(account.Key),
+		DerivationPath: config.DerivationPath,
+	}, nil
+}
+
+// CreateMultichainWallet derives one wallet per chain from mnemonic. Each
+// private key is sealed under passphrase before it leaves this method. The
+// mnemonic and every chain are checked before any wallet is stored, so an
+// invalid phrase or an unsupported chain stores nothing.
+func (s *MultichainWalletService) CreateMultichainWallet(userID uuid.UUID, walletName string, mnemonic string, passphrase string, chains []string) ([]*Wallet, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	if strings.TrimSpace(mnemonic) == "" {
+		return nil, errors.New("mnemonic is required")
+	}
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	for _, chain := range chains {
+		if _, err := s.chains.Get(chain); err != nil {
+			return nil, err
+		}
+	}
+
+	var wallets []*Wallet
+
+	for _, chain := range chains {
+		walletResult, err := s.GenerateWalletForChain(mnemonic, chain)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive %s wallet: %w", chain, err)
+		}
+
+		encryptedKey, err := s.encryptPrivateKey(walletResult.PrivateKey, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		wallet := &Wallet{
+			ID:                  uuid.New(),
+			UserID:              userID,
+			Name:                walletName + " (" + chain + ")",
+			Network:             s.getNetworkName(chain),
+			Address:             walletResult.Address,
+			EncryptedPrivateKey: encryptedKey,
+			IsHardware:          false,
+			IsActive:            true,
+			CreatedAt:           time.Now(),
+			UpdatedAt:           time.Now(),
+		}
+
+		if err := s.wallets.Create(wallet); err != nil {
+			return nil, fmt.Errorf("failed to store %s wallet: %w", chain, err)
+		}
+
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, nil
+}
+
+func (s *MultichainWalletService) ImportWallet(userID uuid.UUID, walletName string, privateKey string, chain string, passphrase string) (*Wallet, error) {
+	codec, err := s.addressCodec(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := parsePrivateKeyHex(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := s.generateAddressForChain(codec, key)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := s.encryptPrivateKey(hex.EncodeToString(key), passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet := &Wallet{
+		ID:                  uuid.New(),
+		UserID:              userID,
+		Name:                walletName + " (" + chain + ")",
+		Network:             s.getNetworkName(chain),
+		Address:             address,
+		EncryptedPrivateKey: encryptedKey,
+		IsHardware:          false,
+		IsActive:            true,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+
+	if err := s.wallets.Create(wallet); err != nil {
+		return nil, fmt.Errorf("failed to store wallet: %w", err)
+	}
+
+	return wallet, nil
+}
+
+// ImportKeystore imports a Keystore V3 file (MetaMask, geth) or, for Solana
+// chains, a Solana CLI id.json keypair. keystorePassword opens the file;
+// passphrase seals the key at rest exactly as ImportWallet does.
+func (s *MultichainWalletService) ImportKeystore(userID uuid.UUID, walletName string, keystoreJSON []byte, keystorePassword string, chain string, passphrase string) (*Wallet, error) {
+	codec, err := s.addressCodec(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey []byte
+	if _, isSolana := codec.(*SolanaCodec); isSolana {
+		var keypair []byte
+		if keypair, err = DecodeSolanaKeypair(keystoreJSON); err == nil {
+			privateKey = keypair[:ed25519.SeedSize]
+		}
+	} else {
+		privateKey, err = DecryptKeystoreV3(keystoreJSON, keystorePassword)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.ImportWallet(userID, walletName, hex.EncodeToString(privateKey), chain, passphrase)
+}
+
+// ExportKeystore writes a stored wallet's key as a Solana id.json keypair for
+// Solana wallets and as a scrypt Keystore V3 document otherwise.
+func (s *MultichainWalletService) ExportKeystore(walletID uuid.UUID, passphrase string, keystorePassword string) ([]byte, error) {
+	wallet, err := s.wallets.Get(walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeyHex, err := s.DecryptPrivateKey(wallet, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parsePrivateKeyHex(privateKeyHex)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.chains.ByNetwork(wallet.Network)
+	if err != nil {
+		return nil, err
+	}
+	if _, isSolana := config.Codec().(*SolanaCodec); isSolana {
+		return EncodeSolanaKeypair(privateKey)
+	}
+
+	if keystorePassword == "" {
+		return nil, errors.New("keystore password is required")
+	}
+
+	var address string
+	if _, isEVM := config.Codec().(*EVMCodec); isEVM {
+		address = wallet.Address
+	}
+	return EncryptKeystoreV3(privateKey, keystorePassword, address, StandardScryptN, StandardScryptP)
+}
+
+// ImportWatchOnly stores a wallet without a private key. addressOrXpub is
+// either a plain address for chain or, for Bitcoin-family chains, an
+// xpub/ypub/zpub account key whose first receive address becomes the wallet
+// address.
+func (s *MultichainWalletService) ImportWatchOnly(userID uuid.UUID, walletName string, chain string, addressOrXpub string) (*Wallet, error) {
+	codec, err := s.addressCodec(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	addressOrXpub = strings.TrimSpace(addressOrXpub)
+	address := addressOrXpub
+	var xpub string
+
+	if isExtendedPublicKey(addressOrXpub) {
+		account, xpubCodec, err := parseWatchOnlyXpub(codec, addressOrXpub)
+		if err != nil {
+			return nil, err
+		}
+
+		addresses, err := ScanExtendedPublicKey(account, xpubCodec, 1, nil)
+		if err != nil {
+			return nil, err
+		}
+		address, xpub = addresses.Receive[0], addressOrXpub
+	} else if err := codec.ValidateAddress(address); err != nil {
+		return nil, err
+	}
+
+	wallet := &Wallet{
+		ID:                uuid.New(),
+		UserID:            userID,
+		Name:              walletName + " (" + chain + ")",
+		Network:           s.getNetworkName(chain),
+		Address:           address,
+		ExtendedPublicKey: xpub,
+		IsHardware:        false,
+		IsWatchOnly:       true,
+		IsActive:          true,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+
+	if err := s.wallets.Create(wallet); err != nil {
+		return nil, fmt.Errorf("failed to store wallet: %w", err)
+	}
+
+	return wallet, nil
+}
+
+// ScanWatchOnlyAddresses derives receive and change addresses of an xpub
+// watch-only wallet, in the address format of the wallet's network,
+// stopping each branch after gapLimit consecutive addresses for which used
+// returns false. A nil used treats every address as unused.
+func (s *MultichainWalletService) ScanWatchOnlyAddresses(walletID uuid.UUID, gapLimit int, used func(address string) bool) (*WatchOnlyAddresses, error) {
+	wallet, err := s.wallets.Get(walletID)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.ExtendedPublicKey == "" {
+		return nil, fmt.Errorf("wallet %s has no extended public key", wallet.ID)
+	}
+
+	chain, err := s.chains.ByNetwork(wallet.Network)
+	if err != nil {
+		return nil, err
+	}
+	account, xpubCodec, err := parseWatchOnlyXpub(chain.Codec(), wallet.ExtendedPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return ScanExtendedPublicKey(account, xpubCodec, gapLimit, used)
+}
+
+// ListWallets returns every stored wallet of userID.
+func (s *MultichainWalletService) ListWallets(userID uuid.UUID) ([]*Wallet, error) {
+	return s.wallets.ListByUser(userID)
+}
+
+// DeactivateWallet marks a wallet inactive without deleting its record.
+func (s *MultichainWalletService) DeactivateWallet(walletID uuid.UUID) error {
+	return s.wallets.Deactivate(walletID)
+}
+
+// ValidateAddress checks address against the chain's native format.
+func (s *MultichainWalletService) ValidateAddress(address string, chain string) error {
+	codec, err := s.addressCodec(chain)
+	if err != nil {
+		return err
+	}
+	return codec.ValidateAddress(address)
+}
+
+// GetWalletBalance asks the chain's registered backend for the balance of
+// address.
+func (s *MultichainWalletService) GetWalletBalance(address string, chain string) (Amount, error) {
+	backend, ok := s.backends[chain]
+	if !ok {
+		return Amount{}, fmt.Errorf("balance retrieval not implemented for chain: %s", chain)
+	}
+	return backend.GetBalance(address)
+}
+
+// generateAddressForChain derives the public key for a raw private key and
+// encodes it with the chain's codec.
+func (s *MultichainWalletService) generateAddressForChain(codec AddressCodec, privateKey []byte) (string, error) {
+	publicKey, err := codec.PublicKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	return codec.EncodeAddress(publicKey)
+}
+
+func (s *MultichainWalletService) addressCodec(chain string) (AddressCodec, error) {
+	config, err := s.chains.Get(chain)
+	if err != nil {
+		return nil, err
+	}
+	return config.Codec(), nil
+}
+
+func (s *MultichainWalletService) getNetworkName(chain string) string {
+	config, err := s.chains.Get(chain)
+	if err != nil {
+		return "unknown"
+	}
+	return config.Network
+}
+
+func (s *MultichainWalletService) encryptPrivateKey(privateKey string, passphrase string) (string, error) {
+	return EncryptPrivateKey(privateKey, passphrase)
+}
+
+// DecryptPrivateKey returns the hex private key sealed in wallet.
+func (s *MultichainWalletService) DecryptPrivateKey(wallet *Wallet, passphrase string) (string, error) {
+	if wallet.IsWatchOnly {
+		return "", ErrWatchOnly
+	}
+	if wallet.EncryptedPrivateKey == "" {
+		return "", fmt.Errorf("wallet %s has no private key", wallet.ID)
+	}
+	return DecryptPrivateKey(wallet.EncryptedPrivateKey, passphrase)
+}
+
+// RotatePassphrase re-encrypts every stored wallet of userID under
+// newPassphrase. All keys are opened before any is rewritten, and they are
+// written back together, so a wrong old passphrase or a failed write leaves
+// every wallet under the old one.
+func (s *MultichainWalletService) RotatePassphrase(userID uuid.UUID, oldPassphrase string, newPassphrase string) error {
+	if newPassphrase == "" {
+		return ErrEmptyPassphrase
+	}
+
+	wallets, err := s.wallets.ListByUser(userID)
+	if err != nil {
+		return err
+	}
+
+	var resealed []*Wallet
+	now := time.Now()
+	for _, wallet := range wallets {
+		if wallet.EncryptedPrivateKey == "" {
+			continue
+		}
+
+		privateKey, err := s.DecryptPrivateKey(wallet, oldPassphrase)
+		if err != nil {
+			return fmt.Errorf("wallet %s: %w", wallet.ID, err)
+		}
+
+		encryptedKey, err := s.encryptPrivateKey(privateKey, newPassphrase)
+		if err != nil {
+			return err
+		}
+
+		wallet.EncryptedPrivateKey = encryptedKey
+		wallet.UpdatedAt = now
+		resealed = append(resealed, wallet)
+	}
+
+	if err := s.wallets.UpdateAll(resealed); err != nil {
+		return fmt.Errorf("failed to store rotated wallets: %w", err)
+	}
+	return nil
+}
@@ -1,208 +1,35 @@
 package tests
 
 import (
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// Mock structures for testing
-type ChainInfo struct {
-	Symbol   string `json:"symbol"`
-	Name     string `json:"name"`
-	Network  string `json:"network"`
-	Decimals int    `json:"decimals"`
-}
-
-type WalletResult struct {
-	Address    string `json:"address"`
-	PrivateKey string `json:"private_key"`
-}
-
-type Wallet struct {
-	ID                  uuid.UUID `json:"id"`
-	UserID              uuid.UUID `json:"user_id"`
-	Name                string    `json:"name"`
-	Network             string    `json:"network"`
-	Address             string    `json:"address"`
-	EncryptedPrivateKey string    `json:"-"`
-	IsHardware          bool      `json:"is_hardware"`
-	IsActive            bool      `json:"is_active"`
-	CreatedAt           time.Time `json:"created_at"`
-	UpdatedAt           time.Time `json:"updated_at"`
-}
-
-// Mock MultichainWalletService for testing
-type MockMultichainWalletService struct{}
-
-func NewMockMultichainWalletService() *MockMultichainWalletService {
-	return &MockMultichainWalletService{}
-}
-
-func (s *MockMultichainWalletService) GetSupportedChains() []ChainInfo {
-	return []ChainInfo{
-		{Symbol: "BTC", Name: "Bitcoin", Network: "bitcoin", Decimals: 8},
-		{Symbol: "ETH", Name: "Ethereum", Network: "ethereum", Decimals: 18},
-		{Symbol: "SOL", Name: "Solana", Network: "solana", Decimals: 9},
-		{Symbol: "NRN", Name: "KNIRV Network", Network: "knirv-network", Decimals: 6},
-	}
-}
-
-func (s *MockMultichainWalletService) GenerateMnemonic(wordCount int) (string, error) {
-	if wordCount != 12 && wordCount != 24 {
-		return "", assert.AnError
-	}
-
-	words := []string{"abandon", "ability", "able", "about", "above", "absent", "absorb", "abstract", "absurd", "abuse", "access", "accident"}
-	if wordCount == 24 {
-		words = append(words, "account", "accuse", "achieve", "acid", "acoustic", "acquire", "across", "act", "action", "actor", "actress", "actual")
-	}
-
-	return strings.Join(words[:wordCount], " "), nil
-}
-
-func (s *MockMultichainWalletService) GenerateWalletForChain(mnemonic string, chain string) (*WalletResult, error) {
-	if mnemonic == "" {
-		return nil, assert.AnError
-	}
-
-	// Mock address generation based on chain
-	var address string
-	switch chain {
-	case "BTC":
-		address = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
-	case "ETH":
-		address = "0x742d35Cc6634C0532925a3b8D4C9db96C4b4d8b6"
-	case "SOL":
-		address = "DYw8jCTfwHNRJhhmFcbXvVDTqWMEVFBX6ZKUmG5CNSKK"
-	case "NRN":
-		address = "knirv1jg8mtutu9khhfwc4nxmuhcpftf0pajdhfvsqf5"
-	default:
-		address = "unknown_1234567890abcdef1234"
-	}
-
-	return &WalletResult{
-		Address:    address,
-		PrivateKey: "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef",
-	}, nil
-}
-
-func (s *MockMultichainWalletService) CreateMultichainWallet(userID uuid.UUID, walletName string, mnemonic string, chains []string) ([]*Wallet, error) {
-	var wallets []*Wallet
-
-	for _, chain := range chains {
-		walletResult, err := s.GenerateWalletForChain(mnemonic, chain)
-		if err != nil {
-			continue
-		}
-
-		wallet := &Wallet{
-			ID:                  uuid.New(),
-			UserID:              userID,
-			Name:                walletName + " (" + chain + ")",
-			Network:             s.getNetworkName(chain),
-			Address:             walletResult.Address,
-			EncryptedPrivateKey: s.encryptPrivateKey(walletResult.PrivateKey),
-			IsHardware:          false,
-			IsActive:            true,
-			CreatedAt:           time.Now(),
-			UpdatedAt:           time.Now(),
-		}
-
-		wallets = append(wallets, wallet)
-	}
-
-	return wallets, nil
-}
-
-func (s *MockMultichainWalletService) ImportWallet(userID uuid.UUID, walletName string, privateKey string, chain string) (*Wallet, error) {
-	if privateKey == "" || privateKey == "invalid-key" {
-		return nil, assert.AnError
-	}
-
-	address := s.generateAddressForChain(chain, privateKey)
-
-	return &Wallet{
-		ID:                  uuid.New(),
-		UserID:              userID,
-		Name:                walletName + " (" + chain + ")",
-		Network:             s.getNetworkName(chain),
-		Address:             address,
-		EncryptedPrivateKey: s.encryptPrivateKey(privateKey),
-		IsHardware:          false,
-		IsActive:            true,
-		CreatedAt:           time.Now(),
-		UpdatedAt:           time.Now(),
-	}, nil
-}
-
-func (s *MockMultichainWalletService) GetWalletBalance(address string, chain string) (float64, error) {
-	switch chain {
-	case "BTC", "ETH", "SOL", "NRN":
-		return 1.5, nil // Mock balance
-	default:
-		return 0.0, assert.AnError
-	}
-}
-
-func (s *MockMultichainWalletService) generateAddressForChain(chain string, privateKey string) string {
-	switch chain {
-	case "BTC":
-		return "1" + privateKey[:33]
-	case "ETH":
-		return "0x" + privateKey[:40]
-	case "LTC":
-		return "L" + privateKey[:33]
-	case "DASH":
-		return "X" + privateKey[:33]
-	case "SOL":
-		return privateKey[:44]
-	case "NRN":
-		return "knirv1" + privateKey[:39]
-	default:
-		return "unknown_" + privateKey[:20]
-	}
-}
-
-func (s *MockMultichainWalletService) getNetworkName(chain string) string {
-	switch chain {
-	case "BTC":
-		return "bitcoin"
-	case "ETH":
-		return "ethereum"
-	case "LTC":
-		return "litecoin"
-	case "DASH":
-		return "dash"
-	case "SOL":
-		return "solana"
-	case "NRN":
-		return "knirv-network"
-	default:
-		return "unknown"
-	}
-}
-
-func (s *MockMultichainWalletService) encryptPrivateKey(privateKey string) string {
-	// Simple mock encryption
-	return "encrypted_" + privateKey
-}
-
 func TestMultichainWalletService(t *testing.T) {
-	service := NewMockMultichainWalletService()
+	service := NewMultichainWalletService(NewMemoryWalletRepository())
+	testPassphrase := "correct horse battery staple"
 
 	t.Run("GetSupportedChains", func(t *testing.T) {
 		chains := service.GetSupportedChains()
 
 		assert.NotEmpty(t, chains)
-		assert.Contains(t, chains, "BTC")
-		assert.Contains(t, chains, "ETH")
-		assert.Contains(t, chains, "SOL")
-		assert.Contains(t, chains, "NRN")
+		var symbols []string
+		for _, chain := range chains {
+			symbols = append(symbols, chain.Symbol)
+		}
+		assert.Contains(t, symbols, "BTC")
+		assert.Contains(t, symbols, "ETH")
+		assert.Contains(t, symbols, "LTC")
+		assert.Contains(t, symbols, "DASH")
+		assert.Contains(t, symbols, "SOL")
+		assert.Contains(t, symbols, "NRN")
 
 		// Verify all chains have required fields
 		for _, chain := range chains {
@@ -295,11 +122,8 @@ func TestMultichainWalletService(t *testing.T) {
 		})
 
 		t.Run("UnsupportedChain", func(t *testing.T) {
-			wallet, err := service.GenerateWalletForChain(testMnemonic, "UNSUPPORTED")
-
-			require.NoError(t, err) // Service should handle gracefully
-			assert.NotEmpty(t, wallet.Address)
-			assert.True(t, strings.HasPrefix(wallet.Address, "unknown_"))
+			_, err := service.GenerateWalletForChain(testMnemonic, "UNSUPPORTED")
+			assert.ErrorIs(t, err, ErrUnsupportedChain)
 		})
 
 		t.Run("ConsistentAddressGeneration", func(t *testing.T) {
@@ -332,7 +156,7 @@ func TestMultichainWalletService(t *testing.T) {
 		testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
 		chains := []string{"BTC", "ETH", "SOL", "NRN"}
 
-		wallets, err := service.CreateMultichainWallet(userID, walletName, testMnemonic, chains)
+		wallets, err := service.CreateMultichainWallet(userID, walletName, testMnemonic, testPassphrase, chains)
 
 		require.NoError(t, err)
 		assert.Len(t, wallets, len(chains))
@@ -356,13 +180,31 @@ func TestMultichainWalletService(t *testing.T) {
 		}
 	})
 
+	t.Run("CreateMultichainWalletRejectsBadInput", func(t *testing.T) {
+		store := NewMemoryWalletRepository()
+		rejecting := NewMultichainWalletService(store)
+		userID := uuid.New()
+		validMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+		_, err := rejecting.CreateMultichainWallet(userID, "Bad", "not a valid mnemonic at all", testPassphrase, []string{"ETH", "BTC"})
+		var mnemonicErr *MnemonicError
+		assert.ErrorAs(t, err, &mnemonicErr)
+
+		_, err = rejecting.CreateMultichainWallet(userID, "Bad", validMnemonic, testPassphrase, []string{"ETH", "UNSUPPORTED"})
+		assert.ErrorIs(t, err, ErrUnsupportedChain)
+
+		stored, err := store.ListByUser(userID)
+		require.NoError(t, err)
+		assert.Empty(t, stored, "nothing is stored when any chain is refused")
+	})
+
 	t.Run("ImportWallet", func(t *testing.T) {
 		userID := uuid.New()
 		walletName := "Imported Wallet"
 		privateKey := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 		chain := "ETH"
 
-		wallet, err := service.ImportWallet(userID, walletName, privateKey, chain)
+		wallet, err := service.ImportWallet(userID, walletName, privateKey, chain, testPassphrase)
 
 		require.NoError(t, err)
 		assert.Equal(t, userID, wallet.UserID)
@@ -377,32 +219,46 @@ func TestMultichainWalletService(t *testing.T) {
 	t.Run("GetWalletBalance", func(t *testing.T) {
 		testAddress := "0x742d35Cc6634C0532925a3b8D4C9db96C4b4d8b6"
 
+		for chain, decimals := range map[string]int{"BTC": 8, "ETH": 18, "SOL": 9, "NRN": 6} {
+			balance, err := ParseAmount("1.5", decimals)
+			require.NoError(t, err)
+			service.RegisterBackend(chain, &staticBackend{balance: balance})
+		}
+
 		t.Run("BitcoinBalance", func(t *testing.T) {
 			balance, err := service.GetWalletBalance(testAddress, "BTC")
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, balance, 0.0)
+			assert.GreaterOrEqual(t, balance.Sign(), 0)
+			assert.Equal(t, 8, balance.Decimals())
+			assert.Equal(t, "150000000", balance.BaseUnits().String())
 		})
 
 		t.Run("EthereumBalance", func(t *testing.T) {
 			balance, err := service.GetWalletBalance(testAddress, "ETH")
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, balance, 0.0)
+			assert.GreaterOrEqual(t, balance.Sign(), 0)
+			assert.Equal(t, 18, balance.Decimals())
+			assert.Equal(t, "1500000000000000000", balance.BaseUnits().String())
 		})
 
 		t.Run("SolanaBalance", func(t *testing.T) {
 			balance, err := service.GetWalletBalance(testAddress, "SOL")
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, balance, 0.0)
+			assert.GreaterOrEqual(t, balance.Sign(), 0)
+			assert.Equal(t, 9, balance.Decimals())
+			assert.Equal(t, "1500000000", balance.BaseUnits().String())
 		})
 
 		t.Run("KNIRVNetworkBalance", func(t *testing.T) {
 			balance, err := service.GetWalletBalance(testAddress, "NRN")
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, balance, 0.0)
+			assert.GreaterOrEqual(t, balance.Sign(), 0)
+			assert.Equal(t, 6, balance.Decimals())
+			assert.Equal(t, "1500000", balance.BaseUnits().String())
 		})
 
 		t.Run("UnsupportedChain", func(t *testing.T) {
@@ -413,42 +269,55 @@ func TestMultichainWalletService(t *testing.T) {
 	})
 
 	t.Run("AddressGeneration", func(t *testing.T) {
-		testPrivateKey := "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+		testPrivateKey := []byte{
+			0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef, 0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef,
+			0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef, 0x12, 0x34, 0x56, 0x78, 0x90, 0xab, 0xcd, 0xef,
+		}
+
+		generate := func(t *testing.T, chain string) string {
+			codec, err := GetAddressCodec(chain)
+			require.NoError(t, err)
+
+			address, err := service.generateAddressForChain(codec, testPrivateKey)
+			require.NoError(t, err)
+			assert.NoError(t, service.ValidateAddress(address, chain))
+			return address
+		}
 
 		t.Run("BitcoinAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("BTC", testPrivateKey)
+			address := generate(t, "BTC")
 			assert.True(t, strings.HasPrefix(address, "1"))
 		})
 
 		t.Run("EthereumAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("ETH", testPrivateKey)
+			address := generate(t, "ETH")
 			assert.True(t, strings.HasPrefix(address, "0x"))
 			assert.Equal(t, 42, len(address))
 		})
 
 		t.Run("LitecoinAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("LTC", testPrivateKey)
+			address := generate(t, "LTC")
 			assert.True(t, strings.HasPrefix(address, "L"))
 		})
 
 		t.Run("DashAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("DASH", testPrivateKey)
+			address := generate(t, "DASH")
 			assert.True(t, strings.HasPrefix(address, "X"))
 		})
 
 		t.Run("SolanaAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("SOL", testPrivateKey)
-			assert.Equal(t, 44, len(address)) // Solana addresses are 44 characters
+			address := generate(t, "SOL")
+			assert.True(t, len(address) == 43 || len(address) == 44) // base58 of a 32-byte key
 		})
 
 		t.Run("KNIRVNetworkAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("NRN", testPrivateKey)
+			address := generate(t, "NRN")
 			assert.True(t, strings.HasPrefix(address, "knirv1"))
 		})
 
 		t.Run("UnknownChainAddressFormat", func(t *testing.T) {
-			address := service.generateAddressForChain("UNKNOWN", testPrivateKey)
-			assert.True(t, strings.HasPrefix(address, "unknown_"))
+			_, err := GetAddressCodec("UNKNOWN")
+			assert.ErrorIs(t, err, ErrUnsupportedChain)
 		})
 	})
 
@@ -477,15 +346,136 @@ func TestMultichainWalletService(t *testing.T) {
 	t.Run("PrivateKeyEncryption", func(t *testing.T) {
 		testPrivateKey := "1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
 
-		encrypted := service.encryptPrivateKey(testPrivateKey)
+		encrypted, err := service.encryptPrivateKey(testPrivateKey, testPassphrase)
+		require.NoError(t, err)
 
-		// Should not be the same as original
-		assert.NotEqual(t, testPrivateKey, encrypted)
+		// Should not contain the original
+		assert.NotContains(t, encrypted, testPrivateKey)
 		assert.NotEmpty(t, encrypted)
 
-		// Should be consistent for same input
-		encrypted2 := service.encryptPrivateKey(testPrivateKey)
-		assert.Equal(t, encrypted, encrypted2)
+		// Fresh salt and nonce for every seal
+		encrypted2, err := service.encryptPrivateKey(testPrivateKey, testPassphrase)
+		require.NoError(t, err)
+		assert.NotEqual(t, encrypted, encrypted2)
+
+		decrypted, err := DecryptPrivateKey(encrypted, testPassphrase)
+		require.NoError(t, err)
+		assert.Equal(t, testPrivateKey, decrypted)
+
+		_, err = DecryptPrivateKey(encrypted, "wrong passphrase")
+		assert.ErrorIs(t, err, ErrPrivateKeyDecryption)
+
+		_, err = service.encryptPrivateKey(testPrivateKey, "")
+		assert.ErrorIs(t, err, ErrEmptyPassphrase)
+	})
+
+	t.Run("TamperedEncryptedKey", func(t *testing.T) {
+		encrypted, err := EncryptPrivateKey("deadbeef", testPassphrase)
+		require.NoError(t, err)
+
+		blob, err := base64.StdEncoding.DecodeString(encrypted)
+		require.NoError(t, err)
+
+		blob[len(blob)-1] ^= 0x01
+		_, err = DecryptPrivateKey(base64.StdEncoding.EncodeToString(blob), testPassphrase)
+		assert.ErrorIs(t, err, ErrPrivateKeyDecryption)
+
+		blob[len(blob)-1] ^= 0x01
+		blob[0] = 0x7f
+		_, err = DecryptPrivateKey(base64.StdEncoding.EncodeToString(blob), testPassphrase)
+		assert.ErrorIs(t, err, ErrUnsupportedKeyVersion)
+	})
+
+	t.Run("RotatePassphrase", func(t *testing.T) {
+		userID := uuid.New()
+		otherUser := uuid.New()
+		testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+		_, err := service.CreateMultichainWallet(userID, "Rotating", testMnemonic, testPassphrase, []string{"BTC", "ETH"})
+		require.NoError(t, err)
+		other, err := service.ImportWallet(otherUser, "Other", "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef", "ETH", testPassphrase)
+		require.NoError(t, err)
+
+		wallets, err := service.ListWallets(userID)
+		require.NoError(t, err)
+		require.Len(t, wallets, 2)
+
+		before, err := service.DecryptPrivateKey(wallets[1], testPassphrase)
+		require.NoError(t, err)
+
+		err = service.RotatePassphrase(userID, "wrong passphrase", "new passphrase")
+		assert.ErrorIs(t, err, ErrPrivateKeyDecryption)
+
+		require.NoError(t, service.RotatePassphrase(userID, testPassphrase, "new passphrase"))
+
+		rotated, err := service.ListWallets(userID)
+		require.NoError(t, err)
+
+		after, err := service.DecryptPrivateKey(rotated[1], "new passphrase")
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+
+		_, err = service.DecryptPrivateKey(rotated[0], testPassphrase)
+		assert.ErrorIs(t, err, ErrPrivateKeyDecryption)
+
+		// Wallets of other users keep their passphrase
+		_, err = service.DecryptPrivateKey(other, testPassphrase)
+		assert.NoError(t, err)
+	})
+
+	t.Run("RotatePassphraseFailsWhole", func(t *testing.T) {
+		repositories := map[string]func(t *testing.T) WalletRepository{
+			"Memory": func(t *testing.T) WalletRepository { return NewMemoryWalletRepository() },
+			"SQLite": func(t *testing.T) WalletRepository {
+				repo, err := NewSQLiteWalletRepository(filepath.Join(t.TempDir(), "wallets.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { repo.Close() })
+				return repo
+			},
+		}
+		testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+		for name, newRepo := range repositories {
+			for nth := 0; nth < 3; nth++ {
+				t.Run(fmt.Sprintf("%s/%d", name, nth), func(t *testing.T) {
+					repo := &vanishingWalletRepository{WalletRepository: newRepo(t), nth: -1}
+					service := NewMultichainWalletService(repo)
+					userID := uuid.New()
+					_, err := service.CreateMultichainWallet(userID, "Rotating", testMnemonic, testPassphrase, []string{"BTC", "ETH", "SOL"})
+					require.NoError(t, err)
+
+					repo.nth = nth
+					err = service.RotatePassphrase(userID, testPassphrase, "new passphrase")
+					assert.ErrorIs(t, err, ErrWalletNotFound)
+					repo.nth = -1
+
+					// Every wallet left is still under the old passphrase
+					wallets, err := service.ListWallets(userID)
+					require.NoError(t, err)
+					require.Len(t, wallets, 2)
+					for _, wallet := range wallets {
+						_, err := service.DecryptPrivateKey(wallet, testPassphrase)
+						assert.NoError(t, err, wallet.Network)
+					}
+				})
+			}
+		}
+	})
+
+	t.Run("DuplicateImport", func(t *testing.T) {
+		userID := uuid.New()
+		privateKey := "0x1234567890abcdef1234567890abcdef1234567890abcdef1234567890abcdef"
+
+		wallet, err := service.ImportWallet(userID, "First", privateKey, "ETH", testPassphrase)
+		require.NoError(t, err)
+
+		_, err = service.ImportWallet(userID, "Second", privateKey, "ETH", testPassphrase)
+		assert.ErrorIs(t, err, ErrDuplicateWallet)
+
+		require.NoError(t, service.DeactivateWallet(wallet.ID))
+		wallets, err := service.ListWallets(userID)
+		require.NoError(t, err)
+		require.Len(t, wallets, 1)
+		assert.False(t, wallets[0].IsActive)
 	})
 
 	t.Run("ErrorHandling", func(t *testing.T) {
@@ -495,25 +485,38 @@ func TestMultichainWalletService(t *testing.T) {
 		})
 
 		t.Run("InvalidMnemonic", func(t *testing.T) {
-			// This should work in mock but might fail in real implementation
-			wallet, err := service.GenerateWalletForChain("invalid mnemonic phrase", "ETH")
-			if err != nil {
-				assert.Error(t, err)
-			} else {
-				assert.NotNil(t, wallet)
-			}
+			_, err := service.GenerateWalletForChain("invalid mnemonic phrase", "ETH")
+			assert.ErrorIs(t, err, ErrInvalidWordCount)
+
+			var mnemonicErr *MnemonicError
+			assert.ErrorAs(t, err, &mnemonicErr)
 		})
 
 		t.Run("EmptyPrivateKey", func(t *testing.T) {
 			userID := uuid.New()
-			_, err := service.ImportWallet(userID, "Test", "", "ETH")
+			_, err := service.ImportWallet(userID, "Test", "", "ETH", testPassphrase)
 			assert.Error(t, err)
 		})
 
 		t.Run("InvalidPrivateKey", func(t *testing.T) {
 			userID := uuid.New()
-			_, err := service.ImportWallet(userID, "Test", "invalid-key", "ETH")
+			_, err := service.ImportWallet(userID, "Test", "invalid-key", "ETH", testPassphrase)
 			assert.Error(t, err)
 		})
 	})
 }
+
+// vanishingWalletRepository deletes the nth wallet of each listing after
+// returning it, as if another request removed it, so writing it back fails.
+type vanishingWalletRepository struct {
+	WalletRepository
+	nth int
+}
+
+func (r *vanishingWalletRepository) ListByUser(userID uuid.UUID) ([]*Wallet, error) {
+	wallets, err := r.WalletRepository.ListByUser(userID)
+	if err == nil && r.nth >= 0 && r.nth < len(wallets) {
+		err = r.Delete(wallets[r.nth].ID)
+	}
+	return wallets, err
+}
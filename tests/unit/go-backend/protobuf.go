@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Minimal protobuf wire-format encoding for the few Cosmos SDK messages the
+// wallet builds and reads, so the module does not need the full SDK.
+
+var ErrMalformedProto = errors.New("malformed protobuf message")
+
+const (
+	protoWireVarint = 0
+	protoWireBytes  = 2
+)
+
+func protoAppendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+func protoAppendTag(b []byte, field int, wireType int) []byte {
+	return protoAppendVarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// protoAppendBytes appends a length-delimited field. Empty values are the
+// proto3 default and are omitted.
+func protoAppendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protoAppendTag(b, field, protoWireBytes)
+	b = protoAppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// protoAppendMessage appends an embedded message even when it is empty, as
+// gogoproto does for non-nullable fields.
+func protoAppendMessage(b []byte, field int, v []byte) []byte {
+	b = protoAppendTag(b, field, protoWireBytes)
+	b = protoAppendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func protoAppendString(b []byte, field int, s string) []byte {
+	return protoAppendBytes(b, field, []byte(s))
+}
+
+// protoAppendUint64 appends a varint field, omitting zero.
+func protoAppendUint64(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protoAppendTag(b, field, protoWireVarint)
+	return protoAppendVarint(b, v)
+}
+
+// protoField is one decoded field. Varint fields set Varint, length-delimited
+// fields set Bytes.
+type protoField struct {
+	Num    int
+	Varint uint64
+	Bytes  []byte
+}
+
+// protoFields decodes the top-level fields of a message. Fixed32 and fixed64
+// fields are skipped; groups are rejected.
+func protoFields(b []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, ErrMalformedProto
+		}
+		b = b[n:]
+
+		field := protoField{Num: int(tag >> 3)}
+		switch tag & 7 {
+		case protoWireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, ErrMalformedProto
+			}
+			field.Varint, b = v, b[n:]
+		case protoWireBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return nil, ErrMalformedProto
+			}
+			field.Bytes, b = b[n:n+int(length)], b[n+int(length):]
+		case 1: // fixed64
+			if len(b) < 8 {
+				return nil, ErrMalformedProto
+			}
+			b = b[8:]
+			continue
+		case 5: // fixed32
+			if len(b) < 4 {
+				return nil, ErrMalformedProto
+			}
+			b = b[4:]
+			continue
+		default:
+			return nil, fmt.Errorf("%w: unsupported wire type %d", ErrMalformedProto, tag&7)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,351 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownSkill    = errors.New("unknown skill")
+	ErrUnderpaid       = errors.New("payment is below the skill's price")
+	ErrReceiptNotFound = errors.New("skill receipt not found")
+	ErrReceiptMismatch = errors.New("transaction does not prove the skill payment")
+	errNotSkillPayment = errors.New("not a skill payment")
+)
+
+const (
+	skillMemoPrefix    = "knirv:skill:"
+	maxSkillMemoLength = 256 // the SDK's default max_memo_characters
+)
+
+// SkillPrice is what one invocation of a skill costs in NRN.
+type SkillPrice struct {
+	SkillID string `json:"skill_id"`
+	Cost    Amount `json:"cost"`
+}
+
+// SkillPricing is the price list of skills, keyed by skill ID.
+type SkillPricing struct {
+	mu     sync.RWMutex
+	prices map[string]Amount
+}
+
+func NewSkillPricing() *SkillPricing {
+	return &SkillPricing{prices: make(map[string]Amount)}
+}
+
+func (p *SkillPricing) Set(skillID string, cost Amount) error {
+	if skillID == "" || strings.Contains(skillID, ":") {
+		return fmt.Errorf("invalid skill ID %q", skillID)
+	}
+	if cost.Sign() <= 0 {
+		return fmt.Errorf("%w: skill price must be positive", ErrInvalidAmount)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prices[skillID] = cost
+	return nil
+}
+
+func (p *SkillPricing) Price(skillID string) (Amount, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	cost, ok := p.prices[skillID]
+	if !ok {
+		return Amount{}, fmt.Errorf("%w: %s", ErrUnknownSkill, skillID)
+	}
+	return cost, nil
+}
+
+// List returns the price list ordered by skill ID.
+func (p *SkillPricing) List() []SkillPrice {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	prices := make([]SkillPrice, 0, len(p.prices))
+	for skillID, cost := range p.prices {
+		prices = append(prices, SkillPrice{SkillID: skillID, Cost: cost})
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].SkillID < prices[j].SkillID })
+	return prices
+}
+
+// SkillReceipt links a skill invocation to the NRN burn that paid for it.
+type SkillReceipt struct {
+	TxHash       string    `json:"tx_hash"`
+	SkillID      string    `json:"skill_id"`
+	Caller       string    `json:"caller"`
+	Cost         Amount    `json:"cost"`
+	MetadataHash string    `json:"metadata_hash"`
+	BlockHeight  int64     `json:"block_height"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// SkillMetadataHash commits to an invocation's metadata (input, model,
+// maxTokens, ...) as the hex SHA-256 of its JSON encoding, whose map keys
+// are sorted. Nil metadata hashes like an empty object.
+func SkillMetadataHash(metadata map[string]interface{}) (string, error) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("unencodable skill metadata: %w", err)
+	}
+	digest := sha256.Sum256(encoded)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// skillMemo is the memo of a skill burn, which is what ties the burn to the
+// skill on chain: cw20 burn messages carry nothing but the amount.
+func skillMemo(skillID, metadataHash string) string {
+	return skillMemoPrefix + skillID + ":" + metadataHash
+}
+
+func parseSkillMemo(memo string) (skillID, metadataHash string, err error) {
+	rest, ok := strings.CutPrefix(memo, skillMemoPrefix)
+	if !ok {
+		return "", "", errNotSkillPayment
+	}
+	skillID, metadataHash, ok = strings.Cut(rest, ":")
+	if !ok || skillID == "" || len(metadataHash) != 2*sha256.Size {
+		return "", "", errNotSkillPayment
+	}
+	return skillID, metadataHash, nil
+}
+
+// skillReceipts is the service's record of the skill payments it made.
+type skillReceipts struct {
+	mu       sync.RWMutex
+	receipts []*SkillReceipt
+	byHash   map[string]*SkillReceipt
+}
+
+func newSkillReceipts() *skillReceipts {
+	return &skillReceipts{byHash: make(map[string]*SkillReceipt)}
+}
+
+func (r *skillReceipts) add(receipt *SkillReceipt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.receipts = append(r.receipts, receipt)
+	r.byHash[strings.ToUpper(receipt.TxHash)] = receipt
+}
+
+func (r *skillReceipts) get(txHash string) (*SkillReceipt, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	receipt, ok := r.byHash[strings.ToUpper(txHash)]
+	if !ok {
+		return nil, false
+	}
+	copied := *receipt
+	return &copied, true
+}
+
+func (r *skillReceipts) list(caller, skillID string) []*SkillReceipt {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []*SkillReceipt
+	for _, receipt := range r.receipts {
+		if (caller == "" || receipt.Caller == caller) && (skillID == "" || receipt.SkillID == skillID) {
+			copied := *receipt
+			out = append(out, &copied)
+		}
+	}
+	return out
+}
+
+// SkillPricing returns the service's price list.
+func (s *XionIntegrationService) SkillPricing() *SkillPricing {
+	return s.skills
+}
+
+// BurnNRNForSkill pays for one invocation of skillID by burning amount base
+// units of NRN, at least the skill's price, and records a SkillReceipt. The
+// burn's memo names the skill and commits to metadata.
+func (s *XionIntegrationService) BurnNRNForSkill(address, skillID, amount string, metadata map[string]interface{}) (*XionTransactionResult, error) {
+	failed := func(err error) (*XionTransactionResult, error) {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	if skillID == "" || amount == "" {
+		return failed(errors.New("address, skill ID and amount are required"))
+	}
+	if err := s.ValidateAddress(address); err != nil {
+		return failed(fmt.Errorf("caller: %w", err))
+	}
+	if s.nrn == nil {
+		return failed(ErrNoNRNToken)
+	}
+
+	price, err := s.skills.Price(skillID)
+	if err != nil {
+		return failed(err)
+	}
+	paid, err := ParseBaseUnits(amount, xionDenomDecimals["nrn"])
+	if err != nil {
+		return failed(err)
+	}
+	if paid.Cmp(price) < 0 {
+		return failed(fmt.Errorf("%w: %s costs %s NRN, got %s", ErrUnderpaid, skillID, price, paid))
+	}
+	metadataHash, err := SkillMetadataHash(metadata)
+	if err != nil {
+		return failed(err)
+	}
+	memo := skillMemo(skillID, metadataHash)
+	if len(memo) > maxSkillMemoLength {
+		return failed(fmt.Errorf("skill ID %q is too long for the memo", skillID))
+	}
+
+	msg, err := s.nrn.Burn(address, paid)
+	if err != nil {
+		return failed(err)
+	}
+	result, err := s.Execute(&XionTransaction{
+		From:            address,
+		Amount:          paid,
+		Denom:           "nrn",
+		Memo:            memo,
+		Gasless:         s.config.GaslessEnabled,
+		Type:            XionTxSkillBurn,
+		ContractAddress: s.nrn.Contract(),
+		SkillID:         skillID,
+		Metadata:        metadata,
+	}, msg)
+	if err != nil {
+		return result, err
+	}
+
+	s.receipts.add(&SkillReceipt{
+		TxHash:       result.TxHash,
+		SkillID:      skillID,
+		Caller:       address,
+		Cost:         paid,
+		MetadataHash: metadataHash,
+		BlockHeight:  result.BlockHeight,
+		CreatedAt:    time.Now(),
+	})
+	return result, nil
+}
+
+// GetSkillReceipt returns the receipt of a payment this service made.
+func (s *XionIntegrationService) GetSkillReceipt(txHash string) (*SkillReceipt, error) {
+	receipt, ok := s.receipts.get(txHash)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, txHash)
+	}
+	return receipt, nil
+}
+
+// ListSkillReceipts returns the receipts of payments this service made, in
+// order, filtered by caller and skill when they are non-empty.
+func (s *XionIntegrationService) ListSkillReceipts(caller, skillID string) []*SkillReceipt {
+	return s.receipts.list(caller, skillID)
+}
+
+// VerifySkillReceipt rebuilds the receipt of txHash from the chain: it must
+// be a successful burn on the NRN contract whose memo names a priced skill,
+// of at least the skill's current price. Anyone
+// can check an agent's payment this way, comparing MetadataHash against
+// SkillMetadataHash of the invocation. Receipts recorded locally must agree
+// with the chain.
+func (s *XionIntegrationService) VerifySkillReceipt(txHash string) (*SkillReceipt, error) {
+	if s.nrn == nil {
+		return nil, ErrNoNRNToken
+	}
+	result, err := s.backend.GetTxResult(txHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("%w: transaction failed: %v", ErrReceiptMismatch, err)
+	}
+	msgs, memo, err := decodeTxBody(result.Tx)
+	if err != nil {
+		return nil, err
+	}
+
+	skillID, metadataHash, err := parseSkillMemo(memo)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReceiptMismatch, err)
+	}
+	caller, burned, err := s.findBurn(msgs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrReceiptMismatch, err)
+	}
+	price, err := s.skills.Price(skillID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReceiptMismatch, err)
+	}
+	if burned.Cmp(price) < 0 {
+		return nil, fmt.Errorf("%w: burned %s NRN, %s costs %s", ErrReceiptMismatch, burned, skillID, price)
+	}
+	receipt := &SkillReceipt{
+		TxHash:       result.Hash,
+		SkillID:      skillID,
+		Caller:       caller,
+		Cost:         burned,
+		MetadataHash: metadataHash,
+		BlockHeight:  result.Height,
+	}
+
+	if local, ok := s.receipts.get(txHash); ok {
+		if local.SkillID != receipt.SkillID || local.Caller != receipt.Caller ||
+			local.Cost.Cmp(receipt.Cost) != 0 || local.MetadataHash != receipt.MetadataHash {
+			return nil, fmt.Errorf("%w: chain disagrees with the local receipt", ErrReceiptMismatch)
+		}
+		receipt.CreatedAt = local.CreatedAt
+	}
+	return receipt, nil
+}
+
+// findBurn returns the sender and amount of the single NRN burn among msgs,
+// looking inside authz MsgExec for sponsored burns.
+func (s *XionIntegrationService) findBurn(msgs []CosmosMsg) (string, Amount, error) {
+	var caller string
+	var burned Amount
+	found := 0
+	for i := 0; i < len(msgs); i++ {
+		msg := msgs[i]
+		if msg.TypeURL == msgExecTypeURL {
+			inner, err := decodeMsgExec(msg)
+			if err != nil {
+				return "", Amount{}, err
+			}
+			msgs = append(msgs, inner...)
+			continue
+		}
+		if msg.TypeURL != msgExecuteContractTypeURL {
+			continue
+		}
+		sender, contract, execute, err := decodeMsgExecuteContract(msg)
+		if err != nil {
+			return "", Amount{}, err
+		}
+		var burn struct {
+			Burn *struct {
+				Amount string `json:"amount"`
+			} `json:"burn"`
+		}
+		if contract != s.nrn.Contract() || json.Unmarshal(execute, &burn) != nil || burn.Burn == nil {
+			continue
+		}
+		amount, err := ParseBaseUnits(burn.Burn.Amount, xionDenomDecimals["nrn"])
+		if err != nil {
+			return "", Amount{}, err
+		}
+		caller, burned = sender, amount
+		found++
+	}
+	if found != 1 {
+		return "", Amount{}, fmt.Errorf("expected one NRN burn, found %d", found)
+	}
+	return caller, burned, nil
+}
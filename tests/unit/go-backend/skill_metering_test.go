@@ -0,0 +1,219 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkillPricing(t *testing.T) {
+	pricing := NewSkillPricing()
+	require.NoError(t, pricing.Set("code-review", NewAmountFromInt64(2000000, 6)))
+	require.NoError(t, pricing.Set("summarize", NewAmountFromInt64(250000, 6)))
+	require.NoError(t, pricing.Set("code-review", NewAmountFromInt64(1500000, 6)))
+
+	price, err := pricing.Price("code-review")
+	require.NoError(t, err)
+	assert.Equal(t, "1.5", price.String())
+
+	_, err = pricing.Price("translate")
+	assert.ErrorIs(t, err, ErrUnknownSkill)
+
+	list := pricing.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "code-review", list[0].SkillID)
+	assert.Equal(t, "summarize", list[1].SkillID)
+
+	assert.Error(t, pricing.Set("", NewAmountFromInt64(1, 6)))
+	assert.Error(t, pricing.Set("a:b", NewAmountFromInt64(1, 6)), "colons would break the memo")
+	assert.ErrorIs(t, pricing.Set("free", NewAmountFromInt64(0, 6)), ErrInvalidAmount)
+}
+
+func TestSkillMetadataHash(t *testing.T) {
+	hash, err := SkillMetadataHash(map[string]interface{}{"model": "CodeT5", "maxTokens": 100, "input": "test input"})
+	require.NoError(t, err)
+	// SHA-256 of {"input":"test input","maxTokens":100,"model":"CodeT5"}
+	assert.Equal(t, "94435e709e37bd6ef206857b8ebf28b546b5691b581096a5a9a97aecf4023659", hash)
+
+	empty, err := SkillMetadataHash(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a", empty)
+
+	_, err = SkillMetadataHash(map[string]interface{}{"callback": func() {}})
+	assert.Error(t, err)
+}
+
+func TestSkillMetering(t *testing.T) {
+	const token = "xion1nrntoken"
+	keyring := NewXionKeyring()
+	sponsorKey := sha256.Sum256([]byte("sponsor"))
+	sponsor, err := keyring.AddKey(sponsorKey[:])
+	require.NoError(t, err)
+	agentKey := sha256.Sum256([]byte("agent"))
+	agent, err := keyring.AddKey(agentKey[:])
+	require.NoError(t, err)
+	remote := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+
+	chain := newXionChainStandIn(t)
+	newService := func() *XionIntegrationService {
+		service := NewXionIntegrationService(XionConfig{
+			ChainID:         "xion-testnet-1",
+			RPCEndpoint:     chain.URL,
+			GasPrice:        "0.025uxion",
+			NRNTokenAddress: token,
+			GaslessEnabled:  true,
+			FeeGranter:      sponsor,
+			ConfirmTimeout:  time.Second,
+			PollInterval:    time.Millisecond,
+		}, keyring)
+		require.NoError(t, service.SkillPricing().Set("code-review", NewAmountFromInt64(2000000, 6)))
+		require.NoError(t, service.SkillPricing().Set("summarize", NewAmountFromInt64(250000, 6)))
+		return service
+	}
+	service := newService()
+	metadata := map[string]interface{}{"input": "func main() {}", "model": "CodeT5", "maxTokens": 100}
+	metadataHash, err := SkillMetadataHash(metadata)
+	require.NoError(t, err)
+
+	t.Run("Burn", func(t *testing.T) {
+		result, err := service.BurnNRNForSkill(agent, "code-review", "2000000", metadata)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, sponsor, result.Sponsor)
+
+		// One burn on the NRN contract, with the skill and metadata in the memo
+		msgs, memo, err := decodeTxBody(chain.broadcasts[len(chain.broadcasts)-1])
+		require.NoError(t, err)
+		assert.Equal(t, "knirv:skill:code-review:"+metadataHash, memo)
+		require.Len(t, msgs, 1)
+		contract, execute := executeJSON(t, msgs[0])
+		assert.Equal(t, token, contract)
+		assert.JSONEq(t, `{"burn":{"amount":"2000000"}}`, execute)
+
+		receipt, err := service.GetSkillReceipt(result.TxHash)
+		require.NoError(t, err)
+		assert.Equal(t, "code-review", receipt.SkillID)
+		assert.Equal(t, agent, receipt.Caller)
+		assert.Equal(t, "2", receipt.Cost.String())
+		assert.Equal(t, metadataHash, receipt.MetadataHash)
+		assert.Equal(t, result.BlockHeight, receipt.BlockHeight)
+	})
+
+	t.Run("Overpaid", func(t *testing.T) {
+		result, err := service.BurnNRNForSkill(agent, "summarize", "300000", nil)
+		require.NoError(t, err)
+		receipt, err := service.GetSkillReceipt(result.TxHash)
+		require.NoError(t, err)
+		assert.Equal(t, "0.3", receipt.Cost.String(), "the receipt records what was burned")
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		broadcasts := len(chain.broadcasts)
+
+		_, err := service.BurnNRNForSkill(agent, "code-review", "1999999", metadata)
+		assert.ErrorIs(t, err, ErrUnderpaid)
+		_, err = service.BurnNRNForSkill(agent, "translate", "2000000", metadata)
+		assert.ErrorIs(t, err, ErrUnknownSkill)
+		_, err = service.BurnNRNForSkill(agent, "code-review", "2.5", metadata)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+		assert.Len(t, chain.broadcasts, broadcasts)
+	})
+
+	t.Run("FailedBurn", func(t *testing.T) {
+		chain.deliver = func([]byte) *ABCIError {
+			return &ABCIError{Codespace: "wasm", Code: 5, Log: "Cannot Sub with 0 and 2000000"}
+		}
+		defer func() { chain.deliver = nil }()
+		before := len(service.ListSkillReceipts(agent, ""))
+
+		result, err := service.BurnNRNForSkill(agent, "code-review", "2000000", metadata)
+		assert.Error(t, err)
+		assert.False(t, result.Success)
+		assert.Len(t, service.ListSkillReceipts(agent, ""), before, "failed burns pay for nothing")
+
+		_, err = service.VerifySkillReceipt(result.TxHash)
+		assert.ErrorIs(t, err, ErrReceiptMismatch)
+	})
+
+	t.Run("ListReceipts", func(t *testing.T) {
+		_, err := service.BurnNRNForSkill(remote, "summarize", "250000", map[string]interface{}{"input": "long text"})
+		require.NoError(t, err)
+
+		assert.Len(t, service.ListSkillReceipts("", ""), 3)
+		assert.Len(t, service.ListSkillReceipts(agent, ""), 2)
+		assert.Len(t, service.ListSkillReceipts("", "summarize"), 2)
+		mine := service.ListSkillReceipts(remote, "summarize")
+		require.Len(t, mine, 1)
+		assert.Equal(t, "0.25", mine[0].Cost.String())
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		for _, local := range service.ListSkillReceipts("", "") {
+			verified, err := service.VerifySkillReceipt(local.TxHash)
+			require.NoError(t, err)
+			assert.Equal(t, local, verified)
+		}
+
+		// A verifier without the local records, such as the skill's provider,
+		// rebuilds the receipt from the chain alone, including burns the
+		// sponsor executed for a meta account through authz
+		verifier := newService()
+		for _, local := range service.ListSkillReceipts("", "") {
+			verified, err := verifier.VerifySkillReceipt(local.TxHash)
+			require.NoError(t, err)
+			assert.Equal(t, local.Caller, verified.Caller)
+			assert.Equal(t, local.SkillID, verified.SkillID)
+			assert.Equal(t, 0, local.Cost.Cmp(verified.Cost))
+			assert.Equal(t, local.MetadataHash, verified.MetadataHash)
+			assert.Equal(t, local.BlockHeight, verified.BlockHeight)
+		}
+
+		_, err := verifier.GetSkillReceipt(service.ListSkillReceipts("", "")[0].TxHash)
+		assert.ErrorIs(t, err, ErrReceiptNotFound)
+	})
+
+	t.Run("VerifyOtherTransaction", func(t *testing.T) {
+		result, err := service.TransferNRN(agent, remote, "1000")
+		require.NoError(t, err)
+		_, err = service.VerifySkillReceipt(result.TxHash)
+		assert.ErrorIs(t, err, ErrReceiptMismatch)
+
+		_, err = service.VerifySkillReceipt("00" + result.TxHash[2:])
+		assert.ErrorIs(t, err, ErrTxNotFound)
+	})
+
+	t.Run("VerifyUnderpaid", func(t *testing.T) {
+		// Burns that bypass BurnNRNForSkill, with a well-formed memo
+		burn := func(t *testing.T, skillID string, units int64) string {
+			msg, err := service.NRNToken().Burn(agent, NewAmountFromInt64(units, 6))
+			require.NoError(t, err)
+			result, err := service.Execute(&XionTransaction{From: agent, Memo: skillMemo(skillID, metadataHash)}, msg)
+			require.NoError(t, err)
+			return result.TxHash
+		}
+
+		_, err := service.VerifySkillReceipt(burn(t, "code-review", 1))
+		assert.ErrorIs(t, err, ErrReceiptMismatch, "1 unit does not pay for code-review")
+		_, err = service.VerifySkillReceipt(burn(t, "code-review", 1999999))
+		assert.ErrorIs(t, err, ErrReceiptMismatch)
+		_, err = service.VerifySkillReceipt(burn(t, "translate", 2000000))
+		assert.ErrorIs(t, err, ErrReceiptMismatch)
+		assert.ErrorIs(t, err, ErrUnknownSkill)
+
+		verified, err := service.VerifySkillReceipt(burn(t, "summarize", 250000))
+		require.NoError(t, err)
+		assert.Equal(t, "0.25", verified.Cost.String())
+	})
+
+	t.Run("ReceiptJSON", func(t *testing.T) {
+		receipt := service.ListSkillReceipts(agent, "code-review")[0]
+		encoded, err := json.Marshal(receipt)
+		require.NoError(t, err)
+		assert.Contains(t, string(encoded), `"cost":{"units":"2000000","decimals":6}`)
+		assert.Contains(t, string(encoded), `"metadata_hash":"`+metadataHash+`"`)
+	})
+}
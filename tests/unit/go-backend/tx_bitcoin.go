@@ -0,0 +1,519 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const (
+	bitcoinTxVersion   = 2
+	bitcoinSequenceRBF = 0xfffffffd // BIP-125 opt-in replace-by-fee
+	bitcoinDustLimit   = 546
+	sigHashAll         = 0x01
+
+	p2pkhInputVSize  = 148
+	p2wpkhInputVSize = 68
+)
+
+var ErrMalformedBitcoinTx = errors.New("malformed bitcoin transaction")
+
+// UTXO is a spendable output, in the shape Esplora's /address/:a/utxo
+// returns. TxID is in the usual display (byte-reversed) order.
+type UTXO struct {
+	TxID  string `json:"txid"`
+	Vout  uint32 `json:"vout"`
+	Value int64  `json:"value"`
+
+	// ScriptPubKey defaults to the sender's output script.
+	ScriptPubKey []byte `json:"-"`
+	// PrevTx is the raw funding transaction. BIP-174 requires it for
+	// non-segwit inputs, where the signature does not commit to the amount.
+	PrevTx []byte `json:"-"`
+}
+
+// BitcoinTxParams select the coins and fee of a Bitcoin-family transfer.
+type BitcoinTxParams struct {
+	UTXOs         []UTXO
+	FeeRate       int64  // satoshis per virtual byte
+	ChangeAddress string // defaults to the sender
+}
+
+// BitcoinTxOut is a transaction output.
+type BitcoinTxOut struct {
+	Value  int64
+	Script []byte
+}
+
+// PSBTInput is an outpoint with the BIP-174 data needed to sign it.
+type PSBTInput struct {
+	PrevTxID       [32]byte // internal byte order
+	Vout           uint32
+	Sequence       uint32
+	WitnessUTXO    *BitcoinTxOut
+	NonWitnessUTXO []byte
+}
+
+// BitcoinPSBT is an unsigned transaction together with the UTXO data of its
+// inputs, the content of a BIP-174 partially signed transaction.
+type BitcoinPSBT struct {
+	Version  uint32
+	LockTime uint32
+	Inputs   []PSBTInput
+	Outputs  []BitcoinTxOut
+}
+
+func buildBitcoinTransfer(codec *BitcoinCodec, req *TransferRequest, units *big.Int) (*BitcoinPSBT, error) {
+	params := req.Bitcoin
+	if !units.IsInt64() {
+		return nil, fmt.Errorf("%w: %s satoshis is out of range", ErrInvalidAmount, units)
+	}
+	amount := units.Int64()
+	if amount < bitcoinDustLimit {
+		return nil, fmt.Errorf("%w: %d satoshis is below the dust limit", ErrInvalidAmount, amount)
+	}
+	if params.FeeRate <= 0 {
+		return nil, errors.New("fee rate must be positive")
+	}
+
+	fromScript, err := codec.ScriptPubKey(req.From)
+	if err != nil {
+		return nil, err
+	}
+	toScript, err := codec.ScriptPubKey(req.To)
+	if err != nil {
+		return nil, err
+	}
+	changeAddress := params.ChangeAddress
+	if changeAddress == "" {
+		changeAddress = req.From
+	}
+	changeScript, err := codec.ScriptPubKey(changeAddress)
+	if err != nil {
+		return nil, fmt.Errorf("change: %w", err)
+	}
+
+	selected, fee, change, err := selectUTXOs(params.UTXOs, fromScript, amount, params.FeeRate,
+		[]BitcoinTxOut{{Value: amount, Script: toScript}}, changeScript)
+	if err != nil {
+		return nil, err
+	}
+
+	psbt := &BitcoinPSBT{Version: bitcoinTxVersion}
+	for _, utxo := range selected {
+		input, err := newPSBTInput(utxo, fromScript)
+		if err != nil {
+			return nil, err
+		}
+		psbt.Inputs = append(psbt.Inputs, *input)
+	}
+	psbt.Outputs = append(psbt.Outputs, BitcoinTxOut{Value: amount, Script: toScript})
+	if change > 0 {
+		psbt.Outputs = append(psbt.Outputs, BitcoinTxOut{Value: change, Script: changeScript})
+	}
+
+	if psbt.Fee() != fee {
+		return nil, fmt.Errorf("fee mismatch: selected %d, built %d", fee, psbt.Fee())
+	}
+	return psbt, nil
+}
+
+// selectUTXOs spends the largest coins first until they cover the outputs
+// and the fee at feeRate. Change below the dust limit is left to the miner.
+func selectUTXOs(utxos []UTXO, defaultScript []byte, amount, feeRate int64, outputs []BitcoinTxOut, changeScript []byte) ([]UTXO, int64, int64, error) {
+	candidates := append([]UTXO(nil), utxos...)
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Value > candidates[j].Value })
+
+	var (
+		selected  []UTXO
+		total     int64
+		inputSize int64
+		segwit    bool
+	)
+	for _, utxo := range candidates {
+		script := utxo.ScriptPubKey
+		if script == nil {
+			script = defaultScript
+		}
+		switch {
+		case isP2WPKH(script):
+			inputSize += p2wpkhInputVSize
+			segwit = true
+		case isP2PKH(script):
+			inputSize += p2pkhInputVSize
+		default:
+			return nil, 0, 0, fmt.Errorf("UTXO %s:%d: unsupported output script %x", utxo.TxID, utxo.Vout, script)
+		}
+		selected = append(selected, utxo)
+		total += utxo.Value
+
+		withChange := feeRate * estimateVSize(inputSize, segwit, append(outputs, BitcoinTxOut{Script: changeScript}))
+		if change := total - amount - withChange; change >= bitcoinDustLimit {
+			return selected, withChange, change, nil
+		}
+		if withoutChange := feeRate * estimateVSize(inputSize, segwit, outputs); total-amount >= withoutChange {
+			return selected, total - amount, 0, nil
+		}
+	}
+	return nil, 0, 0, fmt.Errorf("%w: have %d satoshis, need %d plus fees", ErrInsufficientFunds, total, amount)
+}
+
+// estimateVSize returns the virtual size of a transaction whose inputs
+// weigh inputSize vbytes once signed.
+func estimateVSize(inputSize int64, segwit bool, outputs []BitcoinTxOut) int64 {
+	size := 10 + inputSize // version, counts, lock time
+	if segwit {
+		size++ // marker and flag, rounded up
+	}
+	for _, out := range outputs {
+		size += 9 + int64(len(out.Script))
+	}
+	return size
+}
+
+func newPSBTInput(utxo UTXO, defaultScript []byte) (*PSBTInput, error) {
+	txid, err := hex.DecodeString(utxo.TxID)
+	if err != nil || len(txid) != 32 {
+		return nil, fmt.Errorf("invalid UTXO txid %q", utxo.TxID)
+	}
+	script := utxo.ScriptPubKey
+	if script == nil {
+		script = defaultScript
+	}
+
+	input := &PSBTInput{Vout: utxo.Vout, Sequence: bitcoinSequenceRBF}
+	copy(input.PrevTxID[:], reverseBytes(txid))
+
+	if isP2WPKH(script) {
+		input.WitnessUTXO = &BitcoinTxOut{Value: utxo.Value, Script: script}
+	} else if utxo.PrevTx == nil {
+		return nil, fmt.Errorf("UTXO %s:%d: non-segwit inputs need the funding transaction", utxo.TxID, utxo.Vout)
+	}
+
+	if utxo.PrevTx != nil {
+		prevTxID, outputs, err := parseBitcoinTx(utxo.PrevTx)
+		if err != nil {
+			return nil, err
+		}
+		if prevTxID != input.PrevTxID {
+			return nil, fmt.Errorf("UTXO %s:%d: funding transaction has a different txid", utxo.TxID, utxo.Vout)
+		}
+		if int(utxo.Vout) >= len(outputs) || outputs[utxo.Vout].Value != utxo.Value || !bytes.Equal(outputs[utxo.Vout].Script, script) {
+			return nil, fmt.Errorf("UTXO %s:%d: does not match the funding transaction", utxo.TxID, utxo.Vout)
+		}
+		input.NonWitnessUTXO = utxo.PrevTx
+	}
+	return input, nil
+}
+
+// spentOutput returns the output input i spends.
+func (p *BitcoinPSBT) spentOutput(i int) (*BitcoinTxOut, error) {
+	input := p.Inputs[i]
+	if input.WitnessUTXO != nil {
+		return input.WitnessUTXO, nil
+	}
+	_, outputs, err := parseBitcoinTx(input.NonWitnessUTXO)
+	if err != nil {
+		return nil, err
+	}
+	if int(input.Vout) >= len(outputs) {
+		return nil, fmt.Errorf("%w: input %d spends a missing output", ErrMalformedBitcoinTx, i)
+	}
+	return &outputs[input.Vout], nil
+}
+
+// Fee returns the inputs' value not claimed by the outputs.
+func (p *BitcoinPSBT) Fee() int64 {
+	var fee int64
+	for i := range p.Inputs {
+		if out, err := p.spentOutput(i); err == nil {
+			fee += out.Value
+		}
+	}
+	for _, out := range p.Outputs {
+		fee -= out.Value
+	}
+	return fee
+}
+
+// Serialize encodes p as a BIP-174 PSBT (version 0) with no signatures.
+func (p *BitcoinPSBT) Serialize() []byte {
+	out := []byte("psbt\xff")
+	out = appendPSBTPair(out, []byte{0x00}, p.serializeTx(nil, nil)) // PSBT_GLOBAL_UNSIGNED_TX
+	out = append(out, 0x00)
+
+	for _, input := range p.Inputs {
+		if input.NonWitnessUTXO != nil {
+			out = appendPSBTPair(out, []byte{0x00}, input.NonWitnessUTXO) // PSBT_IN_NON_WITNESS_UTXO
+		}
+		if input.WitnessUTXO != nil {
+			out = appendPSBTPair(out, []byte{0x01}, appendTxOut(nil, *input.WitnessUTXO)) // PSBT_IN_WITNESS_UTXO
+		}
+		out = append(out, 0x00)
+	}
+	for range p.Outputs {
+		out = append(out, 0x00)
+	}
+	return out
+}
+
+func appendPSBTPair(b []byte, key []byte, value []byte) []byte {
+	b = appendCompactSize(b, uint64(len(key)))
+	b = append(b, key...)
+	b = appendCompactSize(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// Sign signs every input with SIGHASH_ALL and returns the finalized network
+// transaction. Each input must pay to the key's P2PKH or P2WPKH script.
+func (p *BitcoinPSBT) Sign(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != 32 || !validSecp256k1Scalar(privateKey) {
+		return nil, ErrInvalidPrivateKey
+	}
+	key := secp256k1.PrivKeyFromBytes(privateKey)
+	defer key.Zero()
+	publicKey := key.PubKey().SerializeCompressed()
+	keyHash := hash160(publicKey)
+
+	scriptSigs := make([][]byte, len(p.Inputs))
+	witnesses := make([][][]byte, len(p.Inputs))
+	for i := range p.Inputs {
+		spent, err := p.spentOutput(i)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case isP2WPKH(spent.Script):
+			if !bytes.Equal(spent.Script[2:], keyHash) {
+				return nil, fmt.Errorf("%w: input %d", ErrSignerMismatch, i)
+			}
+			sig := ecdsa.Sign(key, p.witnessSigHash(i, spent))
+			witnesses[i] = [][]byte{append(sig.Serialize(), sigHashAll), publicKey}
+		case isP2PKH(spent.Script):
+			if !bytes.Equal(spent.Script[3:23], keyHash) {
+				return nil, fmt.Errorf("%w: input %d", ErrSignerMismatch, i)
+			}
+			sig := ecdsa.Sign(key, p.legacySigHash(i, spent.Script))
+			scriptSigs[i] = appendScriptPush(appendScriptPush(nil, append(sig.Serialize(), sigHashAll)), publicKey)
+		default:
+			return nil, fmt.Errorf("input %d: unsupported output script %x", i, spent.Script)
+		}
+	}
+	return p.serializeTx(scriptSigs, witnesses), nil
+}
+
+// legacySigHash is the original SIGHASH_ALL digest: the transaction with the
+// signed input's script replaced by the spent script and the others empty.
+func (p *BitcoinPSBT) legacySigHash(i int, script []byte) []byte {
+	scriptSigs := make([][]byte, len(p.Inputs))
+	scriptSigs[i] = script
+	preimage := p.serializeTx(scriptSigs, nil)
+	return sha256d(binary.LittleEndian.AppendUint32(preimage, sigHashAll))
+}
+
+// witnessSigHash is the BIP-143 digest for a P2WPKH input, which commits to
+// the spent amount.
+func (p *BitcoinPSBT) witnessSigHash(i int, spent *BitcoinTxOut) []byte {
+	var prevouts, sequences, outputs []byte
+	for _, input := range p.Inputs {
+		prevouts = appendOutpoint(prevouts, input)
+		sequences = binary.LittleEndian.AppendUint32(sequences, input.Sequence)
+	}
+	for _, out := range p.Outputs {
+		outputs = appendTxOut(outputs, out)
+	}
+
+	scriptCode := append(append([]byte{0x76, 0xa9, 0x14}, spent.Script[2:]...), 0x88, 0xac)
+
+	preimage := binary.LittleEndian.AppendUint32(nil, p.Version)
+	preimage = append(preimage, sha256d(prevouts)...)
+	preimage = append(preimage, sha256d(sequences)...)
+	preimage = appendOutpoint(preimage, p.Inputs[i])
+	preimage = appendCompactSize(preimage, uint64(len(scriptCode)))
+	preimage = append(preimage, scriptCode...)
+	preimage = binary.LittleEndian.AppendUint64(preimage, uint64(spent.Value))
+	preimage = binary.LittleEndian.AppendUint32(preimage, p.Inputs[i].Sequence)
+	preimage = append(preimage, sha256d(outputs)...)
+	preimage = binary.LittleEndian.AppendUint32(preimage, p.LockTime)
+	preimage = binary.LittleEndian.AppendUint32(preimage, sigHashAll)
+	return sha256d(preimage)
+}
+
+// serializeTx encodes the transaction with the given input scripts, using
+// the BIP-144 witness format when any input has a witness.
+func (p *BitcoinPSBT) serializeTx(scriptSigs [][]byte, witnesses [][][]byte) []byte {
+	hasWitness := false
+	for _, witness := range witnesses {
+		hasWitness = hasWitness || len(witness) > 0
+	}
+
+	out := binary.LittleEndian.AppendUint32(nil, p.Version)
+	if hasWitness {
+		out = append(out, 0x00, 0x01)
+	}
+	out = appendCompactSize(out, uint64(len(p.Inputs)))
+	for i, input := range p.Inputs {
+		var scriptSig []byte
+		if scriptSigs != nil {
+			scriptSig = scriptSigs[i]
+		}
+		out = appendOutpoint(out, input)
+		out = appendCompactSize(out, uint64(len(scriptSig)))
+		out = append(out, scriptSig...)
+		out = binary.LittleEndian.AppendUint32(out, input.Sequence)
+	}
+	out = appendCompactSize(out, uint64(len(p.Outputs)))
+	for _, output := range p.Outputs {
+		out = appendTxOut(out, output)
+	}
+	if hasWitness {
+		for _, witness := range witnesses {
+			out = appendCompactSize(out, uint64(len(witness)))
+			for _, item := range witness {
+				out = appendCompactSize(out, uint64(len(item)))
+				out = append(out, item...)
+			}
+		}
+	}
+	return binary.LittleEndian.AppendUint32(out, p.LockTime)
+}
+
+// parseBitcoinTx returns the txid (internal byte order) and outputs of a
+// serialized transaction, with or without witness data.
+func parseBitcoinTx(raw []byte) ([32]byte, []BitcoinTxOut, error) {
+	var txid [32]byte
+	r := &bitcoinTxReader{b: raw}
+
+	r.read(4) // version
+	segwit := len(r.b) >= 2 && r.b[0] == 0x00 && r.b[1] == 0x01
+	if segwit {
+		r.read(2)
+	}
+	inputsStart := len(raw) - len(r.b)
+
+	inputCount := r.compactSize()
+	for i := uint64(0); i < inputCount && r.err == nil; i++ {
+		r.read(36) // outpoint
+		r.read(int(r.compactSize()))
+		r.read(4) // sequence
+	}
+	var outputs []BitcoinTxOut
+	outputCount := r.compactSize()
+	for i := uint64(0); i < outputCount && r.err == nil; i++ {
+		value := r.read(8)
+		script := r.read(int(r.compactSize()))
+		if r.err == nil {
+			outputs = append(outputs, BitcoinTxOut{Value: int64(binary.LittleEndian.Uint64(value)), Script: script})
+		}
+	}
+	outputsEnd := len(raw) - len(r.b)
+
+	if segwit {
+		for i := uint64(0); i < inputCount && r.err == nil; i++ {
+			items := r.compactSize()
+			for j := uint64(0); j < items && r.err == nil; j++ {
+				r.read(int(r.compactSize()))
+			}
+		}
+	}
+	lockTime := r.read(4)
+	if r.err != nil || len(r.b) != 0 {
+		return txid, nil, ErrMalformedBitcoinTx
+	}
+
+	// The txid excludes the marker, flag and witnesses
+	stripped := append(append(append([]byte(nil), raw[:4]...), raw[inputsStart:outputsEnd]...), lockTime...)
+	copy(txid[:], sha256d(stripped))
+	return txid, outputs, nil
+}
+
+type bitcoinTxReader struct {
+	b   []byte
+	err error
+}
+
+func (r *bitcoinTxReader) read(n int) []byte {
+	if r.err != nil || n < 0 || n > len(r.b) {
+		r.err = ErrMalformedBitcoinTx
+		return nil
+	}
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *bitcoinTxReader) compactSize() uint64 {
+	prefix := r.read(1)
+	if prefix == nil {
+		return 0
+	}
+	switch prefix[0] {
+	case 0xfd:
+		if b := r.read(2); b != nil {
+			return uint64(binary.LittleEndian.Uint16(b))
+		}
+	case 0xfe:
+		if b := r.read(4); b != nil {
+			return uint64(binary.LittleEndian.Uint32(b))
+		}
+	case 0xff:
+		if b := r.read(8); b != nil {
+			return binary.LittleEndian.Uint64(b)
+		}
+	default:
+		return uint64(prefix[0])
+	}
+	return 0
+}
+
+func appendCompactSize(b []byte, n uint64) []byte {
+	switch {
+	case n < 0xfd:
+		return append(b, byte(n))
+	case n <= 0xffff:
+		return binary.LittleEndian.AppendUint16(append(b, 0xfd), uint16(n))
+	case n <= 0xffffffff:
+		return binary.LittleEndian.AppendUint32(append(b, 0xfe), uint32(n))
+	default:
+		return binary.LittleEndian.AppendUint64(append(b, 0xff), n)
+	}
+}
+
+func appendOutpoint(b []byte, input PSBTInput) []byte {
+	return binary.LittleEndian.AppendUint32(append(b, input.PrevTxID[:]...), input.Vout)
+}
+
+func appendTxOut(b []byte, out BitcoinTxOut) []byte {
+	b = binary.LittleEndian.AppendUint64(b, uint64(out.Value))
+	b = appendCompactSize(b, uint64(len(out.Script)))
+	return append(b, out.Script...)
+}
+
+// appendScriptPush appends a direct push of data shorter than 76 bytes.
+func appendScriptPush(script []byte, data []byte) []byte {
+	return append(append(script, byte(len(data))), data...)
+}
+
+func isP2PKH(script []byte) bool {
+	return len(script) == 25 && script[0] == 0x76 && script[1] == 0xa9 && script[2] == 0x14 && script[23] == 0x88 && script[24] == 0xac
+}
+
+func isP2WPKH(script []byte) bool {
+	return len(script) == 22 && script[0] == 0x00 && script[1] == 0x14
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[len(b)-1-i] = b[i]
+	}
+	return out
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/uuid"
+)
+
+// Offline transaction building and signing
+//
+// BuildTransaction turns a TransferRequest into an UnsignedTx without any
+// network access: nonces, fees, UTXOs and blockhashes come from the caller,
+// typically read from the chain's backend. SignTransaction opens the wallet
+// key, signs and wipes the key again; the result is the raw transaction in
+// the chain's wire format, ready for ChainBackend.BroadcastTx.
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrSignerMismatch    = errors.New("private key does not belong to the transaction sender")
+)
+
+// TransferRequest describes a native-token transfer of Amount from From to
+// To. The parameter block matching the chain's family must be set.
+type TransferRequest struct {
+	Chain  string
+	From   string
+	To     string
+	Amount Amount
+	Memo   string
+
+	EVM     *EVMTxParams
+	Bitcoin *BitcoinTxParams
+	Solana  *SolanaTxParams
+	Cosmos  *CosmosTxParams
+}
+
+// UnsignedTx is a transaction that only lacks the sender's signature.
+type UnsignedTx interface {
+	// Sign returns the signed transaction serialized for broadcast.
+	Sign(privateKey []byte) ([]byte, error)
+}
+
+// BuildTransaction validates req against the chain's address format and
+// assembles the unsigned transaction for the chain's family.
+func (s *MultichainWalletService) BuildTransaction(req *TransferRequest) (UnsignedTx, error) {
+	config, err := s.chains.Get(req.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := config.Codec()
+	if err := codec.ValidateAddress(req.From); err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+	if err := codec.ValidateAddress(req.To); err != nil {
+		return nil, fmt.Errorf("recipient: %w", err)
+	}
+	if req.Amount.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+	units, err := req.Amount.UnitsAt(config.Decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Memo != "" {
+		if _, isCosmos := codec.(*Bech32Codec); !isCosmos {
+			return nil, fmt.Errorf("memos are not supported on %s", req.Chain)
+		}
+	}
+
+	switch codec := codec.(type) {
+	case *EVMCodec:
+		if req.EVM == nil {
+			return nil, fmt.Errorf("%s transfers need EVM parameters", req.Chain)
+		}
+		return buildEthereumTransfer(req, units)
+	case *BitcoinCodec:
+		if req.Bitcoin == nil {
+			return nil, fmt.Errorf("%s transfers need Bitcoin parameters", req.Chain)
+		}
+		return buildBitcoinTransfer(codec, req, units)
+	case *SolanaCodec:
+		if req.Solana == nil {
+			return nil, fmt.Errorf("%s transfers need Solana parameters", req.Chain)
+		}
+		return buildSolanaTransfer(req, units)
+	case *Bech32Codec:
+		if req.Cosmos == nil {
+			return nil, fmt.Errorf("%s transfers need Cosmos parameters", req.Chain)
+		}
+		return buildCosmosTransfer(config, req, units)
+	default:
+		return nil, fmt.Errorf("%w: cannot build transactions for %s", ErrUnsupportedChain, req.Chain)
+	}
+}
+
+// SignTransaction signs tx with the key of walletID. The key is decrypted
+// only for the duration of the call and wiped before it returns.
+func (s *MultichainWalletService) SignTransaction(walletID uuid.UUID, passphrase string, tx UnsignedTx) ([]byte, error) {
+	wallet, err := s.wallets.Get(walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	var signed []byte
+	err = s.withPrivateKey(wallet, passphrase, func(privateKey []byte) error {
+		signed, err = tx.Sign(privateKey)
+		return err
+	})
+	return signed, err
+}
+
+// withPrivateKey opens wallet's key, hands the raw bytes to use and zeroes
+// every plaintext copy afterwards.
+func (s *MultichainWalletService) withPrivateKey(wallet *Wallet, passphrase string, use func(privateKey []byte) error) error {
+	if wallet.IsWatchOnly {
+		return ErrWatchOnly
+	}
+	if wallet.EncryptedPrivateKey == "" {
+		return fmt.Errorf("wallet %s has no private key", wallet.ID)
+	}
+
+	plaintext, err := openPrivateKey(wallet.EncryptedPrivateKey, passphrase)
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(plaintext)
+
+	keyHex := bytes.TrimPrefix(bytes.TrimSpace(plaintext), []byte("0x"))
+	privateKey := make([]byte, hex.DecodedLen(len(keyHex)))
+	defer wipeBytes(privateKey)
+	if _, err := hex.Decode(privateKey, keyHex); err != nil || len(privateKey) == 0 {
+		return ErrInvalidPrivateKey
+	}
+	return use(privateKey)
+}
+
+// uint64Units narrows a base-unit count for chains with 64-bit amounts.
+func uint64Units(units *big.Int) (uint64, error) {
+	if units.Sign() < 0 || !units.IsUint64() {
+		return 0, fmt.Errorf("%w: %s base units do not fit in 64 bits", ErrInvalidAmount, units)
+	}
+	return units.Uint64(), nil
+}
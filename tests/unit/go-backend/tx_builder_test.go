@@ -0,0 +1,408 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionBuilder(t *testing.T) {
+	service := NewMultichainWalletService(NewMemoryWalletRepository())
+	testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return b
+	}
+	derive := func(chain string) (*WalletResult, []byte) {
+		result, err := service.GenerateWalletForChain(testMnemonic, chain)
+		require.NoError(t, err)
+		return result, mustHex(result.PrivateKey)
+	}
+
+	t.Run("EthereumLegacyEIP155", func(t *testing.T) {
+		// The example transaction from the EIP-155 specification
+		key := mustHex(strings.Repeat("46", 32))
+		to := "0x" + strings.Repeat("35", 20)
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "ETH",
+			From:   "0x9d8A62f656a8d1615C1294fd71e9CFb3E4855A4F",
+			To:     to,
+			Amount: mustParseAmount(t, "1", 18),
+			EVM:    &EVMTxParams{ChainID: 1, Nonce: 9, GasPrice: big.NewInt(20_000_000_000)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "daf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53", hex.EncodeToString(tx.(*EthereumTx).SigningHash()))
+
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, "f86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83", hex.EncodeToString(raw))
+	})
+
+	t.Run("EthereumEIP1559", func(t *testing.T) {
+		wallet, key := derive("ETH")
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "ETH",
+			From:   wallet.Address,
+			To:     "0x" + strings.Repeat("35", 20),
+			Amount: mustParseAmount(t, "0.5", 18),
+			EVM: &EVMTxParams{
+				ChainID:              1,
+				Nonce:                3,
+				MaxFeePerGas:         big.NewInt(100_000_000_000),
+				MaxPriorityFeePerGas: big.NewInt(2_000_000_000),
+			},
+		})
+		require.NoError(t, err)
+
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, "02f8730103847735940085174876e8008252089435353535353535353535353535353535353535358806f05b59d3b2000080c080a05e532e2775fb48da73f865072027795140f38b19813ac81a249091c205bef17ba05e7e54f21d11a8fa4e594216126ece413a8fb9c58a40d1e548c78b848def0b43", hex.EncodeToString(raw))
+
+		// The signature recovers to the sender
+		ethTx := tx.(*EthereumTx)
+		fields := raw[len(raw)-67:] // y-parity 0 (the empty string), then R and S
+		require.Equal(t, []byte{0x80, 0xa0}, fields[:2])
+		require.Equal(t, byte(0xa0), fields[34])
+		compact := append([]byte{27}, fields[2:34]...)
+		compact = append(compact, fields[35:]...)
+		publicKey, _, err := ecdsa.RecoverCompact(compact, ethTx.SigningHash())
+		require.NoError(t, err)
+		sender, err := (&EVMCodec{}).EncodeAddress(publicKey.SerializeCompressed())
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Address, sender)
+	})
+
+	t.Run("EthereumParams", func(t *testing.T) {
+		req := &TransferRequest{
+			Chain:  "ETH",
+			From:   "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+			To:     "0x" + strings.Repeat("35", 20),
+			Amount: mustParseAmount(t, "1", 18),
+			EVM:    &EVMTxParams{ChainID: 1, GasPrice: big.NewInt(1), MaxFeePerGas: big.NewInt(1)},
+		}
+		_, err := service.BuildTransaction(req)
+		assert.Error(t, err, "legacy and dynamic fees are exclusive")
+
+		req.EVM = &EVMTxParams{ChainID: 1, GasPrice: big.NewInt(1), Data: []byte{0xa9, 0x05, 0x9c, 0xbb}}
+		_, err = service.BuildTransaction(req)
+		assert.Error(t, err, "contract calls need a gas limit")
+
+		req.EVM = nil
+		_, err = service.BuildTransaction(req)
+		assert.Error(t, err)
+	})
+
+	t.Run("BitcoinP2PKH", func(t *testing.T) {
+		wallet, key := derive("BTC")
+		assert.Equal(t, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", wallet.Address)
+
+		// A funding transaction paying 100000 satoshis to the wallet
+		prevTx := mustHex("020000000111111111111111111111111111111111111111111111111111111111111111110000000000ffffffff01a0860100000000001976a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac00000000")
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "BTC",
+			From:   wallet.Address,
+			To:     "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			Amount: NewAmountFromInt64(50000, 8),
+			Bitcoin: &BitcoinTxParams{
+				FeeRate: 10,
+				UTXOs: []UTXO{{
+					TxID:   "fa5f0cae798e1100d37ca68b6c6cefefe513a9f25cc03848a763472231e4b8e6",
+					Value:  100000,
+					PrevTx: prevTx,
+				}},
+			},
+		})
+		require.NoError(t, err)
+
+		psbt := tx.(*BitcoinPSBT)
+		assert.Equal(t, int64(2230), psbt.Fee(), "223 vbytes at 10 sat/vB")
+		assert.Equal(t, "70736274ff0100740200000001e6b8e431224763a74838c05cf2a913e5efef6c6c8ba67cd300118e79ae0c5ffa0000000000fdffffff0250c3000000000000160014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e29aba0000000000001976a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac0000000000010055020000000111111111111111111111111111111111111111111111111111111111111111110000000000ffffffff01a0860100000000001976a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac00000000000000", hex.EncodeToString(psbt.Serialize()))
+
+		// Verified with btcd's script engine
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, "0200000001e6b8e431224763a74838c05cf2a913e5efef6c6c8ba67cd300118e79ae0c5ffa000000006a47304402207a958d053a79fc4018d699dc88a01f6ed42063b0defd5378e661b8d70f84a1a602203a7fe5a818db6184ae7a099f0036cf9c3a75426932c707cd160adab70b15a3c4012103aaeb52dd7494c361049de67cc680e83ebcbbbdbeb13637d92cd845f70308af5efdffffff0250c3000000000000160014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e29aba0000000000001976a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac00000000", hex.EncodeToString(raw))
+
+		txid, _, err := parseBitcoinTx(raw)
+		require.NoError(t, err)
+		assert.Equal(t, "33a357f904a645990b19a0ac1410caabc1e81fa712237ec8a27449c41c3fb967", hex.EncodeToString(reverseBytes(txid[:])))
+	})
+
+	t.Run("BitcoinP2WPKH", func(t *testing.T) {
+		wallet, key := derive("BTC")
+		from := "bc1qmxrw6qdh5g3ztfcwm0et5l8mvws4eva24kmp8m" // P2WPKH of the same key
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "BTC",
+			From:   from,
+			To:     wallet.Address,
+			Amount: NewAmountFromInt64(70000, 8),
+			Bitcoin: &BitcoinTxParams{
+				FeeRate: 5,
+				UTXOs: []UTXO{
+					{TxID: strings.Repeat("22", 32), Vout: 1, Value: 40000},
+					{TxID: strings.Repeat("33", 32), Vout: 0, Value: 60000},
+					{TxID: strings.Repeat("44", 32), Vout: 2, Value: 1000},
+				},
+			},
+		})
+		require.NoError(t, err)
+
+		// Largest coins first; the 1000 satoshi coin is not needed
+		psbt := tx.(*BitcoinPSBT)
+		require.Len(t, psbt.Inputs, 2)
+		assert.Equal(t, int64(60000), psbt.Inputs[0].WitnessUTXO.Value)
+		assert.Equal(t, int64(1060), psbt.Fee(), "212 vbytes at 5 sat/vB")
+		assert.Equal(t, int64(28940), psbt.Outputs[1].Value)
+
+		// Verified with btcd's script engine
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, "0200000000010233333333333333333333333333333333333333333333333333333333333333330000000000fdffffff22222222222222222222222222222222222222222222222222222222222222220100000000fdffffff0270110100000000001976a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac0c71000000000000160014d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa0247304402205ad57eb9b8f301a5cdd9173ff8d3d02a117574453842542bbe05d00559b0dba9022003a735ba3753a293bada4f42c385678ad28ed56108dd5d9c3454028e8c93a77c012103aaeb52dd7494c361049de67cc680e83ebcbbbdbeb13637d92cd845f70308af5e02483045022100a98750a354162587f2382301af3afdfbb7a0bc61899888281cb9e4f6df4c92ee02201caa2acf8eb950971a1301149a3fa7c46e7bbdac42ac45f49c0f6136a11d1496012103aaeb52dd7494c361049de67cc680e83ebcbbbdbeb13637d92cd845f70308af5e00000000", hex.EncodeToString(raw))
+
+		txid, _, err := parseBitcoinTx(raw)
+		require.NoError(t, err)
+		assert.Equal(t, "eeb263e8f86530983ce8674ea55529cf27ddf5a5a14fd5e81bb518055beb8f9f", hex.EncodeToString(reverseBytes(txid[:])))
+	})
+
+	t.Run("BitcoinCoinSelection", func(t *testing.T) {
+		from := "bc1qmxrw6qdh5g3ztfcwm0et5l8mvws4eva24kmp8m"
+		build := func(amount int64, utxos ...UTXO) (*BitcoinPSBT, error) {
+			tx, err := service.BuildTransaction(&TransferRequest{
+				Chain:   "BTC",
+				From:    from,
+				To:      "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",
+				Amount:  NewAmountFromInt64(amount, 8),
+				Bitcoin: &BitcoinTxParams{FeeRate: 1, UTXOs: utxos},
+			})
+			if err != nil {
+				return nil, err
+			}
+			return tx.(*BitcoinPSBT), nil
+		}
+
+		// Change below the dust limit goes to the fee
+		psbt, err := build(10000, UTXO{TxID: strings.Repeat("22", 32), Value: 10500})
+		require.NoError(t, err)
+		assert.Len(t, psbt.Outputs, 1)
+		assert.Equal(t, int64(500), psbt.Fee())
+
+		_, err = build(10000, UTXO{TxID: strings.Repeat("22", 32), Value: 10050})
+		assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+		_, err = build(10000, UTXO{TxID: strings.Repeat("22", 32), Value: 20000, ScriptPubKey: mustHex("a914" + strings.Repeat("00", 20) + "87")})
+		assert.Error(t, err, "P2SH coins cannot be signed")
+
+		// Legacy coins must come with their funding transaction
+		_, err = build(10000, UTXO{TxID: strings.Repeat("22", 32), Value: 20000, ScriptPubKey: mustHex("76a914d986ed01b7a22225a70edbf2ba7cfb63a15cb3aa88ac")})
+		assert.Error(t, err)
+
+		_, err = build(100, UTXO{TxID: strings.Repeat("22", 32), Value: 20000})
+		assert.ErrorIs(t, err, ErrInvalidAmount, "dust output")
+	})
+
+	t.Run("SolanaTransfer", func(t *testing.T) {
+		wallet, key := derive("SOL")
+		to := "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM"
+		blockhash := "EETubP5AKHgjPAhzPAFcb8BAY1hMH639CWCFTqi3hq1k"
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "SOL",
+			From:   wallet.Address,
+			To:     to,
+			Amount: mustParseAmount(t, "0.001", 9),
+			Solana: &SolanaTxParams{RecentBlockhash: blockhash},
+		})
+		require.NoError(t, err)
+
+		from, _ := base58Decode(wallet.Address)
+		recipient, _ := base58Decode(to)
+		recent, _ := base58Decode(blockhash)
+
+		// Legacy message layout: header, accounts, blockhash, one instruction
+		expected := mustHex("010001" + "03")
+		expected = append(expected, from...)
+		expected = append(expected, recipient...)
+		expected = append(expected, make([]byte, 32)...) // System Program
+		expected = append(expected, recent...)
+		expected = append(expected, mustHex("01"+"02"+"020001"+"0c"+"02000000"+"40420f0000000000")...)
+
+		message := tx.(*SolanaTransfer).Message()
+		assert.Equal(t, hex.EncodeToString(expected), hex.EncodeToString(message))
+
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		require.Len(t, raw, 1+64+len(message))
+		assert.Equal(t, byte(1), raw[0])
+		assert.True(t, ed25519.Verify(from, message, raw[1:65]))
+		assert.Equal(t, "0d55a16f7a2378f8efd83123a29082f24b0a6dd23d1272051efca6fbbde2bff1508a5f6ad18e1318dec48bf6c266428b9a2e56695b7d9f4b6312b23657667b0a", hex.EncodeToString(raw[1:65]))
+	})
+
+	t.Run("CosmosMsgSend", func(t *testing.T) {
+		wallet, key := derive("XION")
+		to := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush" // bytes 01..14
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "XION",
+			From:   wallet.Address,
+			To:     to,
+			Amount: mustParseAmount(t, "1.5", 6),
+			Memo:   "thanks",
+			Cosmos: &CosmosTxParams{
+				ChainID:       "xion-testnet-1",
+				AccountNumber: 42,
+				Sequence:      7,
+				GasLimit:      200000,
+				Fee:           mustParseAmount(t, "0.005", 6),
+			},
+		})
+		require.NoError(t, err)
+
+		cosmosTx := tx.(*CosmosTx)
+		require.Len(t, cosmosTx.Messages, 1)
+		assert.Equal(t, "/cosmos.bank.v1beta1.MsgSend", cosmosTx.Messages[0].TypeURL)
+		assert.Equal(t, []CosmosCoin{{Denom: "uxion", Amount: "5000"}}, cosmosTx.Fee)
+
+		raw, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, "0a97010a8c010a1c2f636f736d6f732e62616e6b2e763162657461312e4d736753656e64126c0a2b78696f6e3139726c34636d32686d7238616679346b6c6470787a33666b61346a67757130613766686c6637122b78696f6e31717970717870713971637273737a673270767871367273307a7167337979633561746b7573681a100a057578696f6e12073135303030303012067468616e6b7312670a500a460a1f2f636f736d6f732e63727970746f2e736563703235366b312e5075624b657912230a21024f4e2ad99c34d60b9ba6283c9431a8418af8673212961f97a77b6377fcd05b6212040a020801180712130a0d0a057578696f6e12043530303010c09a0c1a409099c994ac4d9f3a77179ac8fc689f0083130cf125f075a257ea5e6d451c6ea714e6a8ea4a2b09e516b92feeb6d2e5a4c8803ac5c851bf26b74e93e11e651216", hex.EncodeToString(raw))
+
+		// TxRaw{body_bytes, auth_info_bytes, signatures}
+		fields, err := protoFields(raw)
+		require.NoError(t, err)
+		require.Len(t, fields, 3)
+		assert.Equal(t, cosmosTx.BodyBytes(), fields[0].Bytes)
+
+		publicKey, err := secp256k1PublicKey(key)
+		require.NoError(t, err)
+		pub, err := secp256k1.ParsePubKey(publicKey)
+		require.NoError(t, err)
+
+		var r, s secp256k1.ModNScalar
+		r.SetByteSlice(fields[2].Bytes[:32])
+		s.SetByteSlice(fields[2].Bytes[32:])
+		digest := sha256.Sum256(cosmosTx.SignDoc(publicKey))
+		assert.True(t, ecdsa.NewSignature(&r, &s).Verify(digest[:], pub))
+	})
+
+	t.Run("CosmosGasPrices", func(t *testing.T) {
+		prices, err := ParseDecCoins("0.025uxion,0.001ibc/B3504E092456BA618CC28AC671A71FB08C6CA0FD0BE7C8A5B5A3E2DD933CC9E4")
+		require.NoError(t, err)
+		require.Len(t, prices, 2)
+		assert.Equal(t, "0.025uxion", prices[0].String())
+		assert.Equal(t, "ibc/B3504E092456BA618CC28AC671A71FB08C6CA0FD0BE7C8A5B5A3E2DD933CC9E4", prices[1].Denom)
+
+		// Fees round up to the next base unit
+		assert.Equal(t, CosmosCoin{Denom: "uxion", Amount: "5000"}, prices[0].FeeFor(200000))
+		assert.Equal(t, CosmosCoin{Denom: "uxion", Amount: "2"}, prices[0].FeeFor(41))
+		assert.Equal(t, CosmosCoin{Denom: "uxion", Amount: "0"}, prices[0].FeeFor(0))
+
+		whole, err := ParseDecCoin("3uatom")
+		require.NoError(t, err)
+		assert.Equal(t, "3uatom", whole.String())
+
+		for _, invalid := range []string{"", "uxion", "0.025", "0.025 uxion", "-1uxion", ".5uxion", "1.uxion", "0.025u", "0.025uxion,"} {
+			_, err := ParseDecCoins(invalid)
+			assert.ErrorIs(t, err, ErrInvalidAmount, invalid)
+		}
+	})
+
+	t.Run("SignerMismatch", func(t *testing.T) {
+		_, key := derive("ETH")
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "ETH",
+			From:   "0x" + strings.Repeat("35", 20),
+			To:     "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+			Amount: mustParseAmount(t, "1", 18),
+			EVM:    &EVMTxParams{ChainID: 1, GasPrice: big.NewInt(1)},
+		})
+		require.NoError(t, err)
+
+		_, err = tx.Sign(key)
+		assert.ErrorIs(t, err, ErrSignerMismatch)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		_, err := service.BuildTransaction(&TransferRequest{Chain: "DOGE"})
+		assert.ErrorIs(t, err, ErrUnsupportedChain)
+
+		req := &TransferRequest{
+			Chain:  "ETH",
+			From:   "0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+			To:     "0x1234",
+			Amount: mustParseAmount(t, "1", 18),
+			EVM:    &EVMTxParams{ChainID: 1, GasPrice: big.NewInt(1)},
+		}
+		_, err = service.BuildTransaction(req)
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+
+		req.To = "0x" + strings.Repeat("35", 20)
+		req.Amount = mustParseAmount(t, "0.0000000000000000001", 19)
+		_, err = service.BuildTransaction(req)
+		assert.ErrorIs(t, err, ErrInvalidAmount, "finer than wei")
+
+		req.Amount = NewAmountFromInt64(0, 18)
+		_, err = service.BuildTransaction(req)
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+
+		req.Amount = mustParseAmount(t, "1", 18)
+		req.Memo = "hello"
+		_, err = service.BuildTransaction(req)
+		assert.Error(t, err, "memos are Cosmos-only")
+	})
+
+	t.Run("SignTransaction", func(t *testing.T) {
+		testPassphrase := "correct horse battery staple"
+		wallets, err := service.CreateMultichainWallet(uuid.New(), "Spending", testMnemonic, testPassphrase, []string{"SOL"})
+		require.NoError(t, err)
+		require.Len(t, wallets, 1)
+
+		tx, err := service.BuildTransaction(&TransferRequest{
+			Chain:  "SOL",
+			From:   wallets[0].Address,
+			To:     "9WzDXwBbmkg8ZTbNMqUxvQRAyrZzDsGYdLVL9zYtAWWM",
+			Amount: mustParseAmount(t, "0.001", 9),
+			Solana: &SolanaTxParams{RecentBlockhash: "EETubP5AKHgjPAhzPAFcb8BAY1hMH639CWCFTqi3hq1k"},
+		})
+		require.NoError(t, err)
+
+		raw, err := service.SignTransaction(wallets[0].ID, testPassphrase, tx)
+		require.NoError(t, err)
+		_, key := derive("SOL")
+		direct, err := tx.Sign(key)
+		require.NoError(t, err)
+		assert.Equal(t, direct, raw)
+
+		_, err = service.SignTransaction(wallets[0].ID, "wrong passphrase", tx)
+		assert.ErrorIs(t, err, ErrPrivateKeyDecryption)
+
+		_, err = service.SignTransaction(uuid.New(), testPassphrase, tx)
+		assert.ErrorIs(t, err, ErrWalletNotFound)
+
+		watchOnly, err := service.ImportWatchOnly(uuid.New(), "Cold", "SOL", wallets[0].Address)
+		require.NoError(t, err)
+		_, err = service.SignTransaction(watchOnly.ID, testPassphrase, tx)
+		assert.ErrorIs(t, err, ErrWatchOnly)
+	})
+}
+
+func mustParseAmount(t *testing.T, s string, decimals int) Amount {
+	t.Helper()
+	amount, err := ParseAmount(s, decimals)
+	require.NoError(t, err)
+	return amount
+}
@@ -0,0 +1,343 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const (
+	msgSendTypeURL            = "/cosmos.bank.v1beta1.MsgSend"
+	msgExecuteContractTypeURL = "/cosmwasm.wasm.v1.MsgExecuteContract"
+	secp256k1PubKeyTypeURL    = "/cosmos.crypto.secp256k1.PubKey"
+
+	signModeDirect = 1
+)
+
+// CosmosTxParams are the sign-doc and fee fields of a Cosmos SDK
+// transaction. AccountNumber and Sequence come from CosmosBackend.GetAccount.
+type CosmosTxParams struct {
+	ChainID       string
+	AccountNumber uint64
+	Sequence      uint64
+	GasLimit      uint64
+	Fee           Amount // paid in Denom
+	Denom         string // defaults to the chain's denom
+}
+
+// CosmosCoin is an sdk.Coin: an integer amount of base units of denom.
+type CosmosCoin struct {
+	Denom  string
+	Amount string
+}
+
+func (c CosmosCoin) marshal() []byte {
+	b := protoAppendString(nil, 1, c.Denom)
+	return protoAppendString(b, 2, c.Amount)
+}
+
+// DecCoin is an sdk.DecCoin, a possibly fractional amount of a denom, as
+// used for gas prices ("0.025uxion").
+type DecCoin struct {
+	Denom  string
+	Amount *big.Rat
+}
+
+var decCoinPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([a-zA-Z][a-zA-Z0-9/:._-]{2,127})$`)
+
+// ParseDecCoin parses a single amount-denom pair.
+func ParseDecCoin(s string) (DecCoin, error) {
+	match := decCoinPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return DecCoin{}, fmt.Errorf("%w: %q is not a decimal coin", ErrInvalidAmount, s)
+	}
+	amount, _ := new(big.Rat).SetString(match[1])
+	return DecCoin{Denom: match[2], Amount: amount}, nil
+}
+
+// ParseDecCoins parses a comma-separated list such as node minimum gas
+// prices ("0.025uxion,0.001ibc/...").
+func ParseDecCoins(s string) ([]DecCoin, error) {
+	var coins []DecCoin
+	for _, part := range strings.Split(s, ",") {
+		coin, err := ParseDecCoin(part)
+		if err != nil {
+			return nil, err
+		}
+		coins = append(coins, coin)
+	}
+	return coins, nil
+}
+
+func (d DecCoin) String() string {
+	return strings.TrimRight(strings.TrimRight(d.Amount.FloatString(18), "0"), ".") + d.Denom
+}
+
+// FeeFor charges gas at this price, rounding up to a whole base unit as the
+// SDK's minimum-fee check does.
+func (d DecCoin) FeeFor(gas uint64) CosmosCoin {
+	total := new(big.Rat).Mul(d.Amount, new(big.Rat).SetInt(new(big.Int).SetUint64(gas)))
+	fee, remainder := new(big.Int).QuoRem(total.Num(), total.Denom(), new(big.Int))
+	if remainder.Sign() > 0 {
+		fee.Add(fee, big.NewInt(1))
+	}
+	return CosmosCoin{Denom: d.Denom, Amount: fee.String()}
+}
+
+// CosmosMsg is a transaction message packed in a google.protobuf.Any.
+type CosmosMsg struct {
+	TypeURL string
+	Value   []byte
+}
+
+func (m CosmosMsg) marshal() []byte {
+	b := protoAppendString(nil, 1, m.TypeURL)
+	return protoAppendBytes(b, 2, m.Value)
+}
+
+// NewMsgSend builds a bank MsgSend of amount from one account to another.
+func NewMsgSend(from, to string, amount ...CosmosCoin) CosmosMsg {
+	value := protoAppendString(nil, 1, from)
+	value = protoAppendString(value, 2, to)
+	for _, coin := range amount {
+		value = protoAppendBytes(value, 3, coin.marshal())
+	}
+	return CosmosMsg{TypeURL: msgSendTypeURL, Value: value}
+}
+
+// NewMsgExecuteContract calls a CosmWasm contract with the JSON execute
+// message msg, attaching funds.
+func NewMsgExecuteContract(sender, contract string, msg []byte, funds ...CosmosCoin) CosmosMsg {
+	value := protoAppendString(nil, 1, sender)
+	value = protoAppendString(value, 2, contract)
+	value = protoAppendBytes(value, 3, msg)
+	for _, coin := range funds {
+		value = protoAppendBytes(value, 5, coin.marshal())
+	}
+	return CosmosMsg{TypeURL: msgExecuteContractTypeURL, Value: value}
+}
+
+func decodeMsgSend(msg CosmosMsg) (from, to string, amount []CosmosCoin, err error) {
+	fields, err := protoFields(msg.Value)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			from = string(field.Bytes)
+		case 2:
+			to = string(field.Bytes)
+		case 3:
+			coin, err := decodeCoin(field.Bytes)
+			if err != nil {
+				return "", "", nil, err
+			}
+			amount = append(amount, coin)
+		}
+	}
+	return from, to, amount, nil
+}
+
+func decodeMsgExecuteContract(msg CosmosMsg) (sender, contract string, execute []byte, err error) {
+	fields, err := protoFields(msg.Value)
+	if err != nil {
+		return "", "", nil, err
+	}
+	for _, field := range fields {
+		switch field.Num {
+		case 1:
+			sender = string(field.Bytes)
+		case 2:
+			contract = string(field.Bytes)
+		case 3:
+			execute = field.Bytes
+		}
+	}
+	return sender, contract, execute, nil
+}
+
+// CosmosTx is an unsigned Cosmos SDK transaction with a single secp256k1
+// signer, signed in SIGN_MODE_DIRECT.
+type CosmosTx struct {
+	Signer        string // bech32 address of the signer, checked against the key
+	Messages      []CosmosMsg
+	Memo          string
+	Fee           []CosmosCoin
+	FeeGranter    string // pays Fee out of its x/feegrant allowance to Signer
+	GasLimit      uint64
+	ChainID       string
+	AccountNumber uint64
+	Sequence      uint64
+}
+
+func buildCosmosTransfer(config *ChainConfig, req *TransferRequest, units *big.Int) (*CosmosTx, error) {
+	params := req.Cosmos
+	if params.ChainID == "" {
+		return nil, errors.New("Cosmos transactions need a chain ID")
+	}
+	if params.GasLimit == 0 {
+		return nil, errors.New("Cosmos transactions need a gas limit")
+	}
+	denom := params.Denom
+	if denom == "" {
+		denom = config.Denom
+	}
+	if denom == "" {
+		return nil, fmt.Errorf("%s has no denom configured", req.Chain)
+	}
+
+	tx := &CosmosTx{
+		Signer:        req.From,
+		Messages:      []CosmosMsg{NewMsgSend(req.From, req.To, CosmosCoin{Denom: denom, Amount: units.String()})},
+		Memo:          req.Memo,
+		GasLimit:      params.GasLimit,
+		ChainID:       params.ChainID,
+		AccountNumber: params.AccountNumber,
+		Sequence:      params.Sequence,
+	}
+	if params.Fee.Sign() < 0 {
+		return nil, fmt.Errorf("%w: negative fee", ErrInvalidAmount)
+	}
+	if params.Fee.Sign() > 0 {
+		fee, err := params.Fee.UnitsAt(config.Decimals)
+		if err != nil {
+			return nil, err
+		}
+		tx.Fee = []CosmosCoin{{Denom: denom, Amount: fee.String()}}
+	}
+	return tx, nil
+}
+
+// BodyBytes serializes the TxBody.
+func (tx *CosmosTx) BodyBytes() []byte {
+	var body []byte
+	for _, msg := range tx.Messages {
+		body = protoAppendBytes(body, 1, msg.marshal())
+	}
+	return protoAppendString(body, 2, tx.Memo)
+}
+
+// AuthInfoBytes serializes the AuthInfo for a signer with the given
+// compressed public key.
+func (tx *CosmosTx) AuthInfoBytes(publicKey []byte) []byte {
+	pubKeyAny := CosmosMsg{TypeURL: secp256k1PubKeyTypeURL, Value: protoAppendBytes(nil, 1, publicKey)}
+
+	// ModeInfo{single: Single{mode}}; the mode is written even though
+	// SIGN_MODE_DIRECT is its only non-zero value, as the SDK does
+	single := protoAppendTag(nil, 1, protoWireVarint)
+	single = protoAppendVarint(single, signModeDirect)
+	modeInfo := protoAppendBytes(nil, 1, single)
+
+	signerInfo := protoAppendBytes(nil, 1, pubKeyAny.marshal())
+	signerInfo = protoAppendBytes(signerInfo, 2, modeInfo)
+	signerInfo = protoAppendUint64(signerInfo, 3, tx.Sequence)
+
+	var fee []byte
+	for _, coin := range tx.Fee {
+		fee = protoAppendBytes(fee, 1, coin.marshal())
+	}
+	fee = protoAppendUint64(fee, 2, tx.GasLimit)
+	fee = protoAppendString(fee, 4, tx.FeeGranter)
+
+	authInfo := protoAppendBytes(nil, 1, signerInfo)
+	return protoAppendBytes(authInfo, 2, fee)
+}
+
+// SignDoc serializes the SIGN_MODE_DIRECT document the signer commits to.
+func (tx *CosmosTx) SignDoc(publicKey []byte) []byte {
+	doc := protoAppendBytes(nil, 1, tx.BodyBytes())
+	doc = protoAppendBytes(doc, 2, tx.AuthInfoBytes(publicKey))
+	doc = protoAppendString(doc, 3, tx.ChainID)
+	return protoAppendUint64(doc, 4, tx.AccountNumber)
+}
+
+// SimulationBytes serializes the transaction with an empty signature, which
+// the Simulate endpoint accepts in place of a real one.
+func (tx *CosmosTx) SimulationBytes(publicKey []byte) []byte {
+	raw := protoAppendBytes(nil, 1, tx.BodyBytes())
+	raw = protoAppendBytes(raw, 2, tx.AuthInfoBytes(publicKey))
+	raw = protoAppendTag(raw, 3, protoWireBytes)
+	return protoAppendVarint(raw, 0)
+}
+
+// Sign returns the TxRaw bytes that broadcast_tx_sync accepts.
+func (tx *CosmosTx) Sign(privateKey []byte) ([]byte, error) {
+	publicKey, err := secp256k1PublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBech32Signer(tx.Signer, publicKey); err != nil {
+		return nil, err
+	}
+
+	key := secp256k1.PrivKeyFromBytes(privateKey)
+	defer key.Zero()
+
+	// Cosmos signatures are the 64-byte R || S over SHA-256 of the sign doc
+	digest := sha256.Sum256(tx.SignDoc(publicKey))
+	signature := ecdsa.SignCompact(key, digest[:], true)[1:]
+
+	raw := protoAppendBytes(nil, 1, tx.BodyBytes())
+	raw = protoAppendBytes(raw, 2, tx.AuthInfoBytes(publicKey))
+	return protoAppendBytes(raw, 3, signature), nil
+}
+
+// decodeTxBody returns the messages and memo of a TxRaw.
+func decodeTxBody(rawTx []byte) ([]CosmosMsg, string, error) {
+	raw, err := protoFields(rawTx)
+	if err != nil {
+		return nil, "", err
+	}
+	var msgs []CosmosMsg
+	var memo string
+	for _, field := range raw {
+		if field.Num != 1 {
+			continue
+		}
+		body, err := protoFields(field.Bytes)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, bodyField := range body {
+			switch bodyField.Num {
+			case 1:
+				msg, err := decodeAny(bodyField.Bytes)
+				if err != nil {
+					return nil, "", err
+				}
+				msgs = append(msgs, msg)
+			case 2:
+				memo = string(bodyField.Bytes)
+			}
+		}
+	}
+	if len(msgs) == 0 {
+		return nil, "", fmt.Errorf("%w: transaction without messages", ErrMalformedProto)
+	}
+	return msgs, memo, nil
+}
+
+// checkBech32Signer verifies that address is the account of publicKey,
+// whatever its prefix.
+func checkBech32Signer(address string, publicKey []byte) error {
+	_, data, err := bech32Decode(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	payload, err := convertBits(data, 5, 8, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if !bytes.Equal(payload, hash160(publicKey)) {
+		return fmt.Errorf("%w: %s", ErrSignerMismatch, address)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+const (
+	ethereumTransferGas = 21000
+	eip1559TxType       = 0x02
+)
+
+// EVMTxParams are the nonce and fee fields of an EVM transaction. Set
+// GasPrice for a legacy (EIP-155) transaction, or MaxFeePerGas and
+// MaxPriorityFeePerGas for an EIP-1559 one.
+type EVMTxParams struct {
+	ChainID              uint64
+	Nonce                uint64
+	GasLimit             uint64 // defaults to 21000 for plain transfers
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	Data                 []byte
+}
+
+// EthereumTx is an unsigned legacy or EIP-1559 transaction.
+type EthereumTx struct {
+	From                 string // optional; checked against the signing key
+	ChainID              uint64
+	Nonce                uint64
+	GasLimit             uint64
+	GasPrice             *big.Int // legacy only
+	MaxFeePerGas         *big.Int // EIP-1559 only
+	MaxPriorityFeePerGas *big.Int // EIP-1559 only
+	To                   [20]byte
+	Value                *big.Int
+	Data                 []byte
+}
+
+func buildEthereumTransfer(req *TransferRequest, value *big.Int) (*EthereumTx, error) {
+	params := req.EVM
+	if params.ChainID == 0 {
+		return nil, errors.New("EVM transactions need a chain ID")
+	}
+	if (params.GasPrice == nil) == (params.MaxFeePerGas == nil) {
+		return nil, errors.New("set either GasPrice (legacy) or MaxFeePerGas (EIP-1559)")
+	}
+
+	tx := &EthereumTx{
+		From:                 req.From,
+		ChainID:              params.ChainID,
+		Nonce:                params.Nonce,
+		GasLimit:             params.GasLimit,
+		GasPrice:             params.GasPrice,
+		MaxFeePerGas:         params.MaxFeePerGas,
+		MaxPriorityFeePerGas: params.MaxPriorityFeePerGas,
+		Value:                value,
+		Data:                 params.Data,
+	}
+	if tx.MaxFeePerGas != nil && tx.MaxPriorityFeePerGas == nil {
+		tx.MaxPriorityFeePerGas = new(big.Int)
+	}
+	if tx.MaxFeePerGas != nil && tx.MaxPriorityFeePerGas.Cmp(tx.MaxFeePerGas) > 0 {
+		return nil, errors.New("max priority fee exceeds max fee per gas")
+	}
+	if tx.GasLimit == 0 {
+		if len(tx.Data) > 0 {
+			return nil, errors.New("contract calls need an explicit gas limit")
+		}
+		tx.GasLimit = ethereumTransferGas
+	}
+
+	to, _ := hex.DecodeString(strings.TrimPrefix(req.To, "0x"))
+	copy(tx.To[:], to)
+	return tx, nil
+}
+
+// IsDynamicFee reports whether tx is an EIP-1559 (type 2) transaction.
+func (tx *EthereumTx) IsDynamicFee() bool {
+	return tx.MaxFeePerGas != nil
+}
+
+// fields returns the RLP items shared by the signing payload and the signed
+// transaction, in the order of the transaction type.
+func (tx *EthereumTx) fields() [][]byte {
+	common := [][]byte{
+		rlpEncodeUint(tx.GasLimit),
+		rlpEncodeBytes(tx.To[:]),
+		rlpEncodeBigInt(tx.Value),
+		rlpEncodeBytes(tx.Data),
+	}
+	if tx.IsDynamicFee() {
+		return append([][]byte{
+			rlpEncodeUint(tx.ChainID),
+			rlpEncodeUint(tx.Nonce),
+			rlpEncodeBigInt(tx.MaxPriorityFeePerGas),
+			rlpEncodeBigInt(tx.MaxFeePerGas),
+		}, append(common, rlpEncodeList())...) // empty access list
+	}
+	return append([][]byte{rlpEncodeUint(tx.Nonce), rlpEncodeBigInt(tx.GasPrice)}, common...)
+}
+
+// SigningHash is the Keccak-256 digest the sender signs: the EIP-2718
+// envelope for type 2, the EIP-155 replay-protected form for legacy.
+func (tx *EthereumTx) SigningHash() []byte {
+	if tx.IsDynamicFee() {
+		return keccak256([]byte{eip1559TxType}, rlpEncodeList(tx.fields()...))
+	}
+	fields := append(tx.fields(), rlpEncodeUint(tx.ChainID), rlpEncodeUint(0), rlpEncodeUint(0))
+	return keccak256(rlpEncodeList(fields...))
+}
+
+func (tx *EthereumTx) Sign(privateKey []byte) ([]byte, error) {
+	if len(privateKey) != 32 || !validSecp256k1Scalar(privateKey) {
+		return nil, ErrInvalidPrivateKey
+	}
+	key := secp256k1.PrivKeyFromBytes(privateKey)
+	defer key.Zero()
+
+	if tx.From != "" {
+		from, err := (&EVMCodec{}).EncodeAddress(key.PubKey().SerializeCompressed())
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(from, tx.From) {
+			return nil, fmt.Errorf("%w: key address is %s", ErrSignerMismatch, from)
+		}
+	}
+
+	// SignCompact yields [27+recovery id][R][S] with a low S
+	compact := ecdsa.SignCompact(key, tx.SigningHash(), false)
+	recoveryID := uint64(compact[0] - 27)
+	r, s := compact[1:33], compact[33:]
+
+	if tx.IsDynamicFee() {
+		fields := append(tx.fields(), rlpEncodeUint(recoveryID), rlpEncodeBigInt(new(big.Int).SetBytes(r)), rlpEncodeBigInt(new(big.Int).SetBytes(s)))
+		return append([]byte{eip1559TxType}, rlpEncodeList(fields...)...), nil
+	}
+
+	v := new(big.Int).SetUint64(tx.ChainID)
+	v.Mul(v, big.NewInt(2)).Add(v, big.NewInt(int64(35+recoveryID)))
+	fields := append(tx.fields(), rlpEncodeBigInt(v), rlpEncodeBigInt(new(big.Int).SetBytes(r)), rlpEncodeBigInt(new(big.Int).SetBytes(s)))
+	return rlpEncodeList(fields...), nil
+}
+
+// Recursive-length prefix encoding, just enough for transactions
+
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(rlpHeader(len(b), 0x80), b...)
+}
+
+// rlpEncodeList wraps already-encoded items in a list header.
+func rlpEncodeList(items ...[]byte) []byte {
+	var payload []byte
+	for _, item := range items {
+		payload = append(payload, item...)
+	}
+	return append(rlpHeader(len(payload), 0xc0), payload...)
+}
+
+// rlpEncodeUint encodes v as a minimal big-endian string; zero is empty.
+func rlpEncodeUint(v uint64) []byte {
+	return rlpEncodeBigInt(new(big.Int).SetUint64(v))
+}
+
+func rlpEncodeBigInt(v *big.Int) []byte {
+	if v == nil {
+		return rlpEncodeBytes(nil)
+	}
+	return rlpEncodeBytes(v.Bytes())
+}
+
+func rlpHeader(length int, offset byte) []byte {
+	if length < 56 {
+		return []byte{offset + byte(length)}
+	}
+	lengthBytes := big.NewInt(int64(length)).Bytes()
+	return append([]byte{offset + 55 + byte(len(lengthBytes))}, lengthBytes...)
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// systemTransferInstruction is the System Program's Transfer discriminant.
+const systemTransferInstruction = 2
+
+// solanaSystemProgram is the System Program id, 11111111111111111111111111111111.
+var solanaSystemProgram [32]byte
+
+// SolanaTxParams carry the recent blockhash a Solana transaction commits to;
+// it expires after roughly 150 blocks.
+type SolanaTxParams struct {
+	RecentBlockhash string
+}
+
+// SolanaTransfer is an unsigned System Program transfer in the legacy
+// message format.
+type SolanaTransfer struct {
+	From            [32]byte
+	To              [32]byte
+	Lamports        uint64
+	RecentBlockhash [32]byte
+}
+
+func buildSolanaTransfer(req *TransferRequest, units *big.Int) (*SolanaTransfer, error) {
+	lamports, err := uint64Units(units)
+	if err != nil {
+		return nil, err
+	}
+	blockhash, err := base58Decode(req.Solana.RecentBlockhash)
+	if err != nil || len(blockhash) != 32 {
+		return nil, fmt.Errorf("invalid recent blockhash %q", req.Solana.RecentBlockhash)
+	}
+
+	tx := &SolanaTransfer{Lamports: lamports}
+	from, _ := base58Decode(req.From)
+	to, _ := base58Decode(req.To)
+	copy(tx.From[:], from)
+	copy(tx.To[:], to)
+	copy(tx.RecentBlockhash[:], blockhash)
+	if tx.From == tx.To {
+		return nil, fmt.Errorf("%w: sender and recipient are the same account", ErrInvalidAddress)
+	}
+	return tx, nil
+}
+
+// Message serializes the transfer message, the bytes the sender signs.
+func (tx *SolanaTransfer) Message() []byte {
+	// One signer (the payer, writable); one read-only unsigned account
+	msg := []byte{1, 0, 1}
+
+	msg = appendShortVec(msg, 3)
+	msg = append(msg, tx.From[:]...)
+	msg = append(msg, tx.To[:]...)
+	msg = append(msg, solanaSystemProgram[:]...)
+	msg = append(msg, tx.RecentBlockhash[:]...)
+
+	data := binary.LittleEndian.AppendUint32(nil, systemTransferInstruction)
+	data = binary.LittleEndian.AppendUint64(data, tx.Lamports)
+
+	msg = appendShortVec(msg, 1) // instructions
+	msg = append(msg, 2)         // program id index
+	msg = appendShortVec(msg, 2)
+	msg = append(msg, 0, 1) // from, to
+	msg = appendShortVec(msg, len(data))
+	return append(msg, data...)
+}
+
+// Sign returns the wire transaction: the signature list followed by the
+// message. privateKey is a 32-byte seed or a 64-byte keypair.
+func (tx *SolanaTransfer) Sign(privateKey []byte) ([]byte, error) {
+	publicKey, err := (&SolanaCodec{}).PublicKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	if string(publicKey) != string(tx.From[:]) {
+		return nil, fmt.Errorf("%w: key address is %s", ErrSignerMismatch, base58Encode(publicKey))
+	}
+
+	key := ed25519.NewKeyFromSeed(privateKey[:ed25519.SeedSize])
+	defer wipeBytes(key)
+
+	message := tx.Message()
+	out := appendShortVec(nil, 1)
+	out = append(out, ed25519.Sign(key, message)...)
+	return append(out, message...), nil
+}
+
+// appendShortVec appends Solana's compact-u16 length prefix.
+func appendShortVec(b []byte, n int) []byte {
+	for {
+		elem := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(b, elem)
+		}
+		b = append(b, elem|0x80)
+	}
+}
@@ -0,0 +1,185 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TxStatus is where a broadcast transaction is on its way to finality.
+type TxStatus string
+
+const (
+	TxPending  TxStatus = "pending"   // broadcast, not yet in a block
+	TxIncluded TxStatus = "included"  // in a block that is not yet buried deep enough
+	TxFinal    TxStatus = "final"     // buried under FinalityDepth blocks
+	TxFailed   TxStatus = "failed"    // in a block, but rejected by DeliverTx
+	TxTimedOut TxStatus = "timed_out" // the tracker stopped waiting; see Height
+)
+
+// Terminal reports whether a transaction can leave status.
+func (s TxStatus) Terminal() bool {
+	return s == TxFinal || s == TxFailed || s == TxTimedOut
+}
+
+// reaches reports whether status is target or a later stage.
+func (s TxStatus) reaches(target TxStatus) bool {
+	return s.Terminal() || s == target || (s == TxIncluded && target == TxPending)
+}
+
+// TxUpdate is one step of a transaction's progress.
+type TxUpdate struct {
+	TxHash        string   `json:"tx_hash"`
+	Status        TxStatus `json:"status"`
+	Height        int64    `json:"height,omitempty"`
+	Confirmations int64    `json:"confirmations"` // blocks on top of Height
+	Error         string   `json:"error,omitempty"`
+
+	// Result is the DeliverTx result once the transaction is in a block.
+	Result *CosmosTxResult `json:"-"`
+	// Err is an *ABCIError for failed transactions and wraps ErrTxPending
+	// for timed out ones.
+	Err error `json:"-"`
+}
+
+// TxTrackerConfig paces the tracker. Timeout bounds each wait from the
+// first lookup.
+type TxTrackerConfig struct {
+	PollInterval  time.Duration
+	Timeout       time.Duration
+	FinalityDepth int64
+}
+
+const defaultFinalityDepth = 1
+
+// TxTracker follows broadcast transactions into blocks and to finality by
+// polling the node. CometBFT blocks do not reorganize, but a block is only
+// final for light clients once the next block carries its commit, hence a
+// FinalityDepth of one.
+type TxTracker struct {
+	backend *CosmosBackend
+	config  TxTrackerConfig
+}
+
+func NewTxTracker(backend *CosmosBackend, config TxTrackerConfig) *TxTracker {
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultXionPollInterval
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultXionConfirmTimeout
+	}
+	if config.FinalityDepth == 0 {
+		config.FinalityDepth = defaultFinalityDepth
+	}
+	return &TxTracker{backend: backend, config: config}
+}
+
+// Track streams the progress of txHash until it is final, failed or timed
+// out, then closes the channel. Every status and confirmation change is
+// sent; the channel is buffered for all of them, so slow readers miss
+// nothing. Cancelling ctx stops tracking and closes the channel.
+func (t *TxTracker) Track(ctx context.Context, txHash string) <-chan TxUpdate {
+	updates := make(chan TxUpdate, t.config.FinalityDepth+3)
+	go func() {
+		defer close(updates)
+		t.follow(ctx, txHash, TxFinal, func(update TxUpdate) { updates <- update })
+	}()
+	return updates
+}
+
+// OnUpdate calls fn with each update Track would send, from another
+// goroutine, and returns at once.
+func (t *TxTracker) OnUpdate(ctx context.Context, txHash string, fn func(TxUpdate)) {
+	updates := t.Track(ctx, txHash)
+	go func() {
+		for update := range updates {
+			fn(update)
+		}
+	}()
+}
+
+// WaitFor blocks until txHash reaches status or a terminal one and returns
+// its progress. Failed and timed out transactions also return their Err.
+func (t *TxTracker) WaitFor(ctx context.Context, txHash string, status TxStatus) (TxUpdate, error) {
+	update, err := t.follow(ctx, txHash, status, nil)
+	if err != nil {
+		return update, err
+	}
+	return update, update.Err
+}
+
+// follow polls txHash until it reaches until, calling emit on each change.
+func (t *TxTracker) follow(ctx context.Context, txHash string, until TxStatus, emit func(TxUpdate)) (TxUpdate, error) {
+	deadline := time.Now().Add(t.config.Timeout)
+	current := TxUpdate{TxHash: txHash}
+	var lastErr error
+	for {
+		next, err := t.check(current, until == TxFinal)
+		if err != nil {
+			lastErr = err
+		} else if next.Status != current.Status || next.Confirmations != current.Confirmations {
+			current = next
+			if emit != nil {
+				emit(current)
+			}
+		}
+		if current.Status != "" && current.Status.reaches(until) {
+			return current, nil
+		}
+
+		if time.Now().Add(t.config.PollInterval).After(deadline) {
+			current.Status = TxTimedOut
+			current.Err = fmt.Errorf("%w: %s after %s", ErrTxPending, txHash, t.config.Timeout)
+			if lastErr != nil {
+				current.Err = fmt.Errorf("%w (last error: %v)", current.Err, lastErr)
+			}
+			current.Error = current.Err.Error()
+			if emit != nil {
+				emit(current)
+			}
+			return current, nil
+		}
+		select {
+		case <-ctx.Done():
+			return current, ctx.Err()
+		case <-time.After(t.config.PollInterval):
+		}
+	}
+}
+
+// check looks the transaction up once, and once it is in a block only
+// counts the blocks on top, if asked to.
+func (t *TxTracker) check(current TxUpdate, confirm bool) (TxUpdate, error) {
+	next := current
+	if next.Result == nil {
+		result, err := t.backend.GetTxResult(current.TxHash)
+		if errors.Is(err, ErrTxNotFound) {
+			next.Status = TxPending
+			return next, nil
+		}
+		if err != nil {
+			return current, err
+		}
+		next.Result, next.Height = result, result.Height
+		if err := result.Err(); err != nil {
+			next.Status, next.Err, next.Error = TxFailed, err, err.Error()
+			return next, nil
+		}
+	}
+	if !confirm {
+		next.Status = TxIncluded
+		return next, nil
+	}
+
+	latest, err := t.backend.LatestHeight()
+	if err != nil {
+		return current, err
+	}
+	// Confirmations never go back, even if the node answering lags
+	next.Status, next.Confirmations = TxIncluded, max(latest-next.Height, current.Confirmations)
+	if next.Confirmations >= t.config.FinalityDepth {
+		next.Status = TxFinal
+	}
+	return next, nil
+}
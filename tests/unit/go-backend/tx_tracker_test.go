@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxTracker(t *testing.T) {
+	keyring := NewXionKeyring()
+	senderKey := sha256.Sum256([]byte("sender"))
+	sender, err := keyring.AddKey(senderKey[:])
+	require.NoError(t, err)
+	recipient := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+
+	chain := newXionChainStandIn(t)
+	backend := NewCosmosBackend(chain.URL, "uxion", 6)
+	tracker := NewTxTracker(backend, TxTrackerConfig{PollInterval: time.Millisecond, Timeout: 5 * time.Second, FinalityDepth: 2})
+
+	// newTx is a signed transfer that no one has broadcast yet
+	sequence := uint64(0)
+	newTx := func() ([]byte, string) {
+		sequence++
+		rawTx, err := keyring.SignTx(sender, &CosmosTx{
+			Signer:   sender,
+			Messages: []CosmosMsg{NewMsgSend(sender, recipient, CosmosCoin{Denom: "uxion", Amount: "1000"})},
+			Fee:      []CosmosCoin{{Denom: "uxion", Amount: "5000"}},
+			GasLimit: 200000,
+			ChainID:  "xion-testnet-1",
+			Sequence: sequence,
+		})
+		require.NoError(t, err)
+		hash := sha256.Sum256(rawTx)
+		return rawTx, strings.ToUpper(hex.EncodeToString(hash[:]))
+	}
+	next := func(t *testing.T, updates <-chan TxUpdate) TxUpdate {
+		select {
+		case update, ok := <-updates:
+			require.True(t, ok, "updates closed early")
+			return update
+		case <-time.After(5 * time.Second):
+			t.Fatal("no update")
+			return TxUpdate{}
+		}
+	}
+	closed := func(t *testing.T, updates <-chan TxUpdate) {
+		select {
+		case update, ok := <-updates:
+			assert.False(t, ok, "unexpected update %+v", update)
+		case <-time.After(5 * time.Second):
+			t.Fatal("updates not closed")
+		}
+	}
+
+	t.Run("ToFinality", func(t *testing.T) {
+		rawTx, hash := newTx()
+		updates := tracker.Track(context.Background(), hash)
+		assert.Equal(t, TxPending, next(t, updates).Status)
+
+		chain.include(rawTx)
+		included := next(t, updates)
+		assert.Equal(t, TxIncluded, included.Status)
+		assert.Equal(t, hash, included.TxHash)
+		assert.Equal(t, int64(0), included.Confirmations)
+		require.NotNil(t, included.Result)
+		assert.Equal(t, included.Height, included.Result.Height)
+
+		chain.advance(1)
+		confirming := next(t, updates)
+		assert.Equal(t, TxIncluded, confirming.Status)
+		assert.Equal(t, int64(1), confirming.Confirmations)
+
+		chain.advance(3)
+		final := next(t, updates)
+		assert.Equal(t, TxFinal, final.Status)
+		assert.Equal(t, int64(4), final.Confirmations)
+		assert.Equal(t, included.Height, final.Height)
+		assert.NoError(t, final.Err)
+		closed(t, updates)
+	})
+
+	t.Run("AlreadyFinal", func(t *testing.T) {
+		rawTx, hash := newTx()
+		chain.include(rawTx)
+		chain.advance(2)
+		updates := tracker.Track(context.Background(), hash)
+		assert.Equal(t, TxFinal, next(t, updates).Status)
+		closed(t, updates)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		chain.mu.Lock()
+		chain.deliver = func([]byte) *ABCIError {
+			return &ABCIError{Codespace: "sdk", Code: 5, Log: "insufficient funds"}
+		}
+		chain.mu.Unlock()
+		defer func() {
+			chain.mu.Lock()
+			chain.deliver = nil
+			chain.mu.Unlock()
+		}()
+
+		rawTx, hash := newTx()
+		chain.include(rawTx)
+		update, err := tracker.WaitFor(context.Background(), hash, TxFinal)
+		assert.Equal(t, TxFailed, update.Status)
+		assert.Greater(t, update.Height, int64(0))
+		var abciErr *ABCIError
+		require.True(t, errors.As(err, &abciErr))
+		assert.Equal(t, "insufficient funds", abciErr.Reason())
+		assert.Equal(t, err.Error(), update.Error)
+	})
+
+	t.Run("TimedOut", func(t *testing.T) {
+		quick := NewTxTracker(backend, TxTrackerConfig{PollInterval: time.Millisecond, Timeout: 20 * time.Millisecond})
+		_, hash := newTx()
+		updates := quick.Track(context.Background(), hash)
+		assert.Equal(t, TxPending, next(t, updates).Status)
+		timedOut := next(t, updates)
+		assert.Equal(t, TxTimedOut, timedOut.Status)
+		assert.ErrorIs(t, timedOut.Err, ErrTxPending)
+		assert.Zero(t, timedOut.Height)
+		closed(t, updates)
+
+		_, err := quick.WaitFor(context.Background(), hash, TxIncluded)
+		assert.ErrorIs(t, err, ErrTxPending)
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		_, hash := newTx()
+		ctx, cancel := context.WithCancel(context.Background())
+		updates := tracker.Track(ctx, hash)
+		assert.Equal(t, TxPending, next(t, updates).Status)
+		cancel()
+		closed(t, updates)
+
+		_, err := tracker.WaitFor(ctx, hash, TxIncluded)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("OnUpdate", func(t *testing.T) {
+		rawTx, hash := newTx()
+		chain.include(rawTx)
+		statuses := make(chan TxStatus, 4)
+		tracker.OnUpdate(context.Background(), hash, func(update TxUpdate) { statuses <- update.Status })
+
+		assert.Equal(t, TxIncluded, <-statuses)
+		chain.advance(2)
+		assert.Equal(t, TxFinal, <-statuses)
+	})
+
+	t.Run("Service", func(t *testing.T) {
+		service := NewXionIntegrationService(XionConfig{
+			ChainID:        "xion-testnet-1",
+			RPCEndpoint:    chain.URL,
+			GasPrice:       "0.025uxion",
+			ConfirmTimeout: 5 * time.Second,
+			PollInterval:   time.Millisecond,
+			FinalityDepth:  3,
+		}, keyring)
+		result, err := service.SendTransaction(&XionTransaction{
+			From:   sender,
+			To:     recipient,
+			Amount: NewAmountFromInt64(1000, 6),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, TxIncluded, result.Status, "SendTransaction returns once the transaction is in a block")
+
+		updates := service.Tracker().Track(context.Background(), result.TxHash)
+		assert.Equal(t, TxIncluded, next(t, updates).Status)
+		chain.advance(3)
+		final := next(t, updates)
+		assert.Equal(t, TxFinal, final.Status)
+		assert.Equal(t, result.BlockHeight, final.Height)
+	})
+
+	t.Run("UpdateJSON", func(t *testing.T) {
+		update := TxUpdate{TxHash: "AB", Status: TxIncluded, Height: 7, Confirmations: 1}
+		encoded, err := json.Marshal(update)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"tx_hash":"AB","status":"included","height":7,"confirmations":1}`, string(encoded))
+	})
+}
@@ -0,0 +1,177 @@
+package tests
+
+import (
+	"errors"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrWalletNotFound  = errors.New("wallet not found")
+	ErrDuplicateWallet = errors.New("wallet already exists for this user, network and address")
+)
+
+// WalletRepository persists Wallet records.
+type WalletRepository interface {
+	Create(wallet *Wallet) error
+	Get(id uuid.UUID) (*Wallet, error)
+	ListByUser(userID uuid.UUID) ([]*Wallet, error)
+	Update(wallet *Wallet) error
+	// UpdateAll updates every one of wallets or, if any fails, none.
+	UpdateAll(wallets []*Wallet) error
+	Deactivate(id uuid.UUID) error
+	Delete(id uuid.UUID) error
+}
+
+// MemoryWalletRepository is an in-memory WalletRepository for unit tests. It
+// enforces the same (UserID, Network, Address) uniqueness as the SQLite store
+// and hands out copies so callers cannot mutate stored records.
+type MemoryWalletRepository struct {
+	mu      sync.RWMutex
+	wallets map[uuid.UUID]*Wallet
+}
+
+func NewMemoryWalletRepository() *MemoryWalletRepository {
+	return &MemoryWalletRepository{
+		wallets: make(map[uuid.UUID]*Wallet),
+	}
+}
+
+func (r *MemoryWalletRepository) Create(wallet *Wallet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.wallets[wallet.ID]; exists {
+		return ErrDuplicateWallet
+	}
+	if r.conflicts(wallet) {
+		return ErrDuplicateWallet
+	}
+
+	stored := *wallet
+	r.wallets[wallet.ID] = &stored
+	return nil
+}
+
+func (r *MemoryWalletRepository) Get(id uuid.UUID) (*Wallet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wallet, exists := r.wallets[id]
+	if !exists {
+		return nil, ErrWalletNotFound
+	}
+
+	result := *wallet
+	return &result, nil
+}
+
+func (r *MemoryWalletRepository) ListByUser(userID uuid.UUID) ([]*Wallet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var wallets []*Wallet
+	for _, wallet := range r.wallets {
+		if wallet.UserID == userID {
+			result := *wallet
+			wallets = append(wallets, &result)
+		}
+	}
+
+	// Oldest first, by ID within a clock tick, as SQLiteWalletRepository
+	// orders them
+	sort.SliceStable(wallets, func(i, j int) bool {
+		if !wallets[i].CreatedAt.Equal(wallets[j].CreatedAt) {
+			return wallets[i].CreatedAt.Before(wallets[j].CreatedAt)
+		}
+		return wallets[i].ID.String() < wallets[j].ID.String()
+	})
+	return wallets, nil
+}
+
+func (r *MemoryWalletRepository) Update(wallet *Wallet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.wallets[wallet.ID]; !exists {
+		return ErrWalletNotFound
+	}
+	if r.conflicts(wallet) {
+		return ErrDuplicateWallet
+	}
+
+	stored := *wallet
+	r.wallets[wallet.ID] = &stored
+	return nil
+}
+
+func (r *MemoryWalletRepository) UpdateAll(wallets []*Wallet) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Apply the batch to a copy, which replaces the records only if every
+	// wallet in it passes
+	staged := maps.Clone(r.wallets)
+	for _, wallet := range wallets {
+		if _, exists := staged[wallet.ID]; !exists {
+			return ErrWalletNotFound
+		}
+		stored := *wallet
+		staged[wallet.ID] = &stored
+	}
+	for _, wallet := range wallets {
+		if walletConflicts(staged, wallet) {
+			return ErrDuplicateWallet
+		}
+	}
+	r.wallets = staged
+	return nil
+}
+
+func (r *MemoryWalletRepository) Deactivate(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wallet, exists := r.wallets[id]
+	if !exists {
+		return ErrWalletNotFound
+	}
+
+	wallet.IsActive = false
+	wallet.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryWalletRepository) Delete(id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.wallets[id]; !exists {
+		return ErrWalletNotFound
+	}
+
+	delete(r.wallets, id)
+	return nil
+}
+
+// conflicts reports whether another record shares wallet's user, network and
+// address. Callers must hold the lock.
+func (r *MemoryWalletRepository) conflicts(wallet *Wallet) bool {
+	return walletConflicts(r.wallets, wallet)
+}
+
+func walletConflicts(wallets map[uuid.UUID]*Wallet, wallet *Wallet) bool {
+	for id, existing := range wallets {
+		if id != wallet.ID &&
+			existing.UserID == wallet.UserID &&
+			existing.Network == wallet.Network &&
+			existing.Address == wallet.Address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// walletMigrations are applied in order; the index of each entry plus one is
+// its schema version. Append new migrations, never edit applied ones.
+var walletMigrations = []string{
+	`CREATE TABLE wallets (
+		id                    TEXT PRIMARY KEY,
+		user_id               TEXT NOT NULL,
+		name                  TEXT NOT NULL,
+		network               TEXT NOT NULL,
+		address               TEXT NOT NULL,
+		encrypted_private_key TEXT NOT NULL DEFAULT '',
+		is_hardware           INTEGER NOT NULL DEFAULT 0,
+		is_active             INTEGER NOT NULL DEFAULT 1,
+		created_at            INTEGER NOT NULL,
+		updated_at            INTEGER NOT NULL,
+		UNIQUE (user_id, network, address)
+	)`,
+	`CREATE INDEX idx_wallets_user_id ON wallets (user_id, created_at)`,
+	`ALTER TABLE wallets ADD COLUMN is_watch_only INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE wallets ADD COLUMN extended_public_key TEXT NOT NULL DEFAULT ''`,
+}
+
+const walletColumns = `id, user_id, name, network, address, encrypted_private_key,
+	is_hardware, is_watch_only, extended_public_key, is_active, created_at, updated_at`
+
+// SQLiteWalletRepository stores wallets in an embedded, pure-Go SQLite
+// database.
+type SQLiteWalletRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteWalletRepository opens (or creates) the database at path and
+// brings its schema up to date. Use ":memory:" for a throwaway store.
+func NewSQLiteWalletRepository(path string) (*SQLiteWalletRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wallet database: %w", err)
+	}
+
+	// SQLite serializes writers anyway, and a single connection keeps
+	// ":memory:" databases from splitting across the pool.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`PRAGMA busy_timeout = 5000`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to configure wallet database: %w", err)
+	}
+
+	repo := &SQLiteWalletRepository{db: db}
+	if err := repo.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (r *SQLiteWalletRepository) Close() error {
+	return r.db.Close()
+}
+
+// SchemaVersion returns the number of applied migrations.
+func (r *SQLiteWalletRepository) SchemaVersion() (int, error) {
+	return sqliteSchemaVersion(r.db, "schema_migrations")
+}
+
+func (r *SQLiteWalletRepository) migrate() error {
+	return migrateSQLite(r.db, "schema_migrations", walletMigrations)
+}
+
+func sqliteSchemaVersion(db *sql.DB, table string) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM ` + table).Scan(&version)
+	return version, err
+}
+
+// migrateSQLite applies the migrations not yet recorded in table, each in
+// its own transaction. Stores sharing a database file use separate tables.
+func migrateSQLite(db *sql.DB, table string, migrations []string) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	current, err := sqliteSchemaVersion(db, table)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO `+table+` (version, applied_at) VALUES (?, ?)`, version, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d failed: %w", version, err)
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteWalletRepository) Create(wallet *Wallet) error {
+	_, err := r.db.Exec(`INSERT INTO wallets (`+walletColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		wallet.ID.String(), wallet.UserID.String(), wallet.Name, wallet.Network, wallet.Address,
+		wallet.EncryptedPrivateKey, wallet.IsHardware, wallet.IsWatchOnly, wallet.ExtendedPublicKey, wallet.IsActive,
+		wallet.CreatedAt.UnixNano(), wallet.UpdatedAt.UnixNano())
+	return mapSQLiteError(err)
+}
+
+func (r *SQLiteWalletRepository) Get(id uuid.UUID) (*Wallet, error) {
+	row := r.db.QueryRow(`SELECT `+walletColumns+` FROM wallets WHERE id = ?`, id.String())
+
+	wallet, err := scanWallet(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWalletNotFound
+	}
+	return wallet, err
+}
+
+func (r *SQLiteWalletRepository) ListByUser(userID uuid.UUID) ([]*Wallet, error) {
+	rows, err := r.db.Query(`SELECT `+walletColumns+` FROM wallets
+		WHERE user_id = ? ORDER BY created_at, id`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallets []*Wallet
+	for rows.Next() {
+		wallet, err := scanWallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, rows.Err()
+}
+
+func (r *SQLiteWalletRepository) Update(wallet *Wallet) error {
+	return updateWallet(r.db, wallet)
+}
+
+func (r *SQLiteWalletRepository) UpdateAll(wallets []*Wallet) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		if err := updateWallet(tx, wallet); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqlExecer is a *sql.DB or a *sql.Tx.
+type sqlExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func updateWallet(db sqlExecer, wallet *Wallet) error {
+	result, err := db.Exec(`UPDATE wallets SET
+		user_id = ?, name = ?, network = ?, address = ?, encrypted_private_key = ?,
+		is_hardware = ?, is_watch_only = ?, extended_public_key = ?, is_active = ?, updated_at = ?
+		WHERE id = ?`,
+		wallet.UserID.String(), wallet.Name, wallet.Network, wallet.Address, wallet.EncryptedPrivateKey,
+		wallet.IsHardware, wallet.IsWatchOnly, wallet.ExtendedPublicKey, wallet.IsActive,
+		wallet.UpdatedAt.UnixNano(), wallet.ID.String())
+	if err != nil {
+		return mapSQLiteError(err)
+	}
+	return requireAffected(result)
+}
+
+func (r *SQLiteWalletRepository) Deactivate(id uuid.UUID) error {
+	result, err := r.db.Exec(`UPDATE wallets SET is_active = 0, updated_at = ? WHERE id = ?`,
+		time.Now().UnixNano(), id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+func (r *SQLiteWalletRepository) Delete(id uuid.UUID) error {
+	result, err := r.db.Exec(`DELETE FROM wallets WHERE id = ?`, id.String())
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWallet(row rowScanner) (*Wallet, error) {
+	var (
+		wallet               Wallet
+		id, userID           string
+		createdAt, updatedAt int64
+	)
+
+	err := row.Scan(&id, &userID, &wallet.Name, &wallet.Network, &wallet.Address,
+		&wallet.EncryptedPrivateKey, &wallet.IsHardware, &wallet.IsWatchOnly, &wallet.ExtendedPublicKey,
+		&wallet.IsActive, &createdAt, &updatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if wallet.ID, err = uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("corrupt wallet id %q: %w", id, err)
+	}
+	if wallet.UserID, err = uuid.Parse(userID); err != nil {
+		return nil, fmt.Errorf("corrupt user id %q: %w", userID, err)
+	}
+	wallet.CreatedAt = time.Unix(0, createdAt)
+	wallet.UpdatedAt = time.Unix(0, updatedAt)
+	return &wallet, nil
+}
+
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWalletNotFound
+	}
+	return nil
+}
+
+// mapSQLiteError translates constraint violations into repository errors.
+func mapSQLiteError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return ErrDuplicateWallet
+		}
+	}
+	return err
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletRepository(t *testing.T) {
+	repositories := map[string]func(t *testing.T) WalletRepository{
+		"Memory": func(t *testing.T) WalletRepository {
+			return NewMemoryWalletRepository()
+		},
+		"SQLite": func(t *testing.T) WalletRepository {
+			repo, err := NewSQLiteWalletRepository(filepath.Join(t.TempDir(), "wallets.db"))
+			require.NoError(t, err)
+			t.Cleanup(func() { repo.Close() })
+			return repo
+		},
+	}
+
+	newWallet := func(userID uuid.UUID, network, address string) *Wallet {
+		now := time.Now()
+		return &Wallet{
+			ID:                  uuid.New(),
+			UserID:              userID,
+			Name:                "Test Wallet",
+			Network:             network,
+			Address:             address,
+			EncryptedPrivateKey: "sealed",
+			IsActive:            true,
+			CreatedAt:           now,
+			UpdatedAt:           now,
+		}
+	}
+
+	for name, newRepo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			t.Run("CreateAndGet", func(t *testing.T) {
+				repo := newRepo(t)
+				wallet := newWallet(uuid.New(), "ethereum", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+
+				require.NoError(t, repo.Create(wallet))
+
+				stored, err := repo.Get(wallet.ID)
+				require.NoError(t, err)
+				assert.Equal(t, wallet.ID, stored.ID)
+				assert.Equal(t, wallet.UserID, stored.UserID)
+				assert.Equal(t, wallet.Address, stored.Address)
+				assert.Equal(t, wallet.EncryptedPrivateKey, stored.EncryptedPrivateKey)
+				assert.True(t, stored.IsActive)
+				assert.True(t, wallet.CreatedAt.Equal(stored.CreatedAt))
+
+				_, err = repo.Get(uuid.New())
+				assert.ErrorIs(t, err, ErrWalletNotFound)
+			})
+
+			t.Run("UniqueUserNetworkAddress", func(t *testing.T) {
+				repo := newRepo(t)
+				userID := uuid.New()
+
+				require.NoError(t, repo.Create(newWallet(userID, "bitcoin", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")))
+				err := repo.Create(newWallet(userID, "bitcoin", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"))
+				assert.ErrorIs(t, err, ErrDuplicateWallet)
+
+				// Same address for another user or network is allowed
+				assert.NoError(t, repo.Create(newWallet(uuid.New(), "bitcoin", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")))
+				assert.NoError(t, repo.Create(newWallet(userID, "litecoin", "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA")))
+			})
+
+			t.Run("ListByUser", func(t *testing.T) {
+				repo := newRepo(t)
+				userID := uuid.New()
+
+				first := newWallet(userID, "bitcoin", "addr-1")
+				second := newWallet(userID, "ethereum", "addr-2")
+				second.CreatedAt = first.CreatedAt.Add(time.Second)
+				require.NoError(t, repo.Create(second))
+				require.NoError(t, repo.Create(first))
+				require.NoError(t, repo.Create(newWallet(uuid.New(), "solana", "addr-3")))
+
+				wallets, err := repo.ListByUser(userID)
+				require.NoError(t, err)
+				require.Len(t, wallets, 2)
+				assert.Equal(t, first.ID, wallets[0].ID)
+				assert.Equal(t, second.ID, wallets[1].ID)
+
+				// Wallets created in the same tick come back by ID
+				var tied []uuid.UUID
+				for i := 0; i < 8; i++ {
+					wallet := newWallet(userID, "solana", fmt.Sprintf("tied-%d", i))
+					wallet.CreatedAt = second.CreatedAt.Add(time.Second)
+					require.NoError(t, repo.Create(wallet))
+					tied = append(tied, wallet.ID)
+				}
+				sort.Slice(tied, func(i, j int) bool { return tied[i].String() < tied[j].String() })
+				wallets, err = repo.ListByUser(userID)
+				require.NoError(t, err)
+				require.Len(t, wallets, 10)
+				for i, id := range tied {
+					assert.Equal(t, id, wallets[2+i].ID)
+				}
+			})
+
+			t.Run("UpdateAll", func(t *testing.T) {
+				repo := newRepo(t)
+				userID := uuid.New()
+				first := newWallet(userID, "bitcoin", "addr-1")
+				second := newWallet(userID, "ethereum", "addr-2")
+				require.NoError(t, repo.Create(first))
+				require.NoError(t, repo.Create(second))
+
+				first.Name, second.Name = "First", "Second"
+				require.NoError(t, repo.UpdateAll([]*Wallet{first, second}))
+				stored, err := repo.Get(second.ID)
+				require.NoError(t, err)
+				assert.Equal(t, "Second", stored.Name)
+
+				// One failure and none of the batch is written
+				first.Name = "Renamed"
+				assert.ErrorIs(t, repo.UpdateAll([]*Wallet{first, newWallet(userID, "solana", "addr-3")}), ErrWalletNotFound)
+				clash := *second
+				clash.Address = first.Address
+				clash.Network = first.Network
+				assert.ErrorIs(t, repo.UpdateAll([]*Wallet{first, &clash}), ErrDuplicateWallet)
+				stored, err = repo.Get(first.ID)
+				require.NoError(t, err)
+				assert.Equal(t, "First", stored.Name)
+			})
+
+			t.Run("UpdateDeactivateDelete", func(t *testing.T) {
+				repo := newRepo(t)
+				wallet := newWallet(uuid.New(), "solana", "HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk")
+				require.NoError(t, repo.Create(wallet))
+
+				wallet.Name = "Renamed"
+				wallet.EncryptedPrivateKey = "resealed"
+				require.NoError(t, repo.Update(wallet))
+
+				stored, err := repo.Get(wallet.ID)
+				require.NoError(t, err)
+				assert.Equal(t, "Renamed", stored.Name)
+				assert.Equal(t, "resealed", stored.EncryptedPrivateKey)
+
+				require.NoError(t, repo.Deactivate(wallet.ID))
+				stored, err = repo.Get(wallet.ID)
+				require.NoError(t, err)
+				assert.False(t, stored.IsActive)
+
+				require.NoError(t, repo.Delete(wallet.ID))
+				_, err = repo.Get(wallet.ID)
+				assert.ErrorIs(t, err, ErrWalletNotFound)
+
+				assert.ErrorIs(t, repo.Update(wallet), ErrWalletNotFound)
+				assert.ErrorIs(t, repo.Deactivate(wallet.ID), ErrWalletNotFound)
+				assert.ErrorIs(t, repo.Delete(wallet.ID), ErrWalletNotFound)
+			})
+		})
+	}
+
+	t.Run("SQLiteMigrationsAreIdempotent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wallets.db")
+
+		repo, err := NewSQLiteWalletRepository(path)
+		require.NoError(t, err)
+		wallet := newWallet(uuid.New(), "ethereum", "0xabc")
+		require.NoError(t, repo.Create(wallet))
+		require.NoError(t, repo.Close())
+
+		reopened, err := NewSQLiteWalletRepository(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+
+		version, err := reopened.SchemaVersion()
+		require.NoError(t, err)
+		assert.Equal(t, len(walletMigrations), version)
+
+		_, err = reopened.Get(wallet.ID)
+		assert.NoError(t, err)
+	})
+}
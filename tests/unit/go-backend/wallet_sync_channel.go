@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Device side of wallet sync
+//
+// Each device makes an ephemeral X25519 key pair and a random nonce per
+// session. It first posts a commitment to both, SHA-256 over the public key
+// and the nonce, and reveals them only once the session carries the peer's
+// commitment too. Once both are revealed, each checks the peer's against
+// its commitment and derives the same two AES-256-GCM keys from the shared
+// secret with HKDF-SHA256, one per direction, salted with the session ID
+// and bound to both public keys. Nonces are the sender's message sequence
+// number, which never repeats under a key, and the envelope around the
+// ciphertext is additional data, so the relay can neither read nor rewrite
+// a message.
+//
+// The same secret and both handshake nonces yield a six-digit SAS for the
+// users to compare. A relay that put its own key between the devices ends
+// up with a different secret on each side. It has to commit to that key
+// before either device reveals its nonce, so it cannot try keys until the
+// two codes match; it gets one guess in a million.
+
+type SyncRole string
+
+const (
+	SyncMobile  SyncRole = "mobile"
+	SyncBrowser SyncRole = "browser"
+)
+
+const (
+	syncChannelInfo    = "knirv wallet sync v1 "
+	syncHandshakeNonce = 32
+)
+
+var (
+	ErrSyncDecryption = errors.New("failed to open sync message: wrong key or tampered message")
+	ErrSyncReplay     = errors.New("sync message replayed or out of order")
+)
+
+// SyncHandshake is one device's half of the key agreement.
+type SyncHandshake struct {
+	role           SyncRole
+	deviceID       string
+	private        *ecdh.PrivateKey
+	nonce          []byte
+	peer           []byte // the peer key to expect, when known out of band
+	peerCommitment []byte // the peer commitment to expect, once known
+}
+
+func NewSyncHandshake(role SyncRole, deviceID string) (*SyncHandshake, error) {
+	if role != SyncMobile && role != SyncBrowser {
+		return nil, fmt.Errorf("unknown sync role %q", role)
+	}
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate handshake key: %w", err)
+	}
+	nonce := make([]byte, syncHandshakeNonce)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate handshake nonce: %w", err)
+	}
+	return &SyncHandshake{role: role, deviceID: deviceID, private: private, nonce: nonce}, nil
+}
+
+// PublicKey is what the device reveals to the session.
+func (h *SyncHandshake) PublicKey() []byte {
+	return h.private.PublicKey().Bytes()
+}
+
+// Commitment is what the device posts before revealing its key and nonce.
+func (h *SyncHandshake) Commitment() []byte {
+	return syncCommitment(h.PublicKey(), h.nonce)
+}
+
+func syncCommitment(publicKey, nonce []byte) []byte {
+	digest := sha256.Sum256(append(append([]byte(syncChannelInfo+"commit"), publicKey...), nonce...))
+	return digest[:]
+}
+
+// sides returns the session's keys, commitments and nonces as this device's
+// own and its peer's.
+func (h *SyncHandshake) sides(session *SyncSession) (own, peer syncHandshakeSide, peerID string) {
+	mobile := syncHandshakeSide{session.MobilePublicKey, session.MobileCommitment, session.MobileNonce}
+	browser := syncHandshakeSide{session.BrowserPublicKey, session.BrowserCommitment, session.BrowserNonce}
+	if h.role == SyncBrowser {
+		return browser, mobile, session.MobileDeviceID
+	}
+	return mobile, browser, session.BrowserInstanceID
+}
+
+type syncHandshakeSide struct {
+	publicKey, commitment, nonce []byte
+}
+
+// VerifyQRCode checks that a pairing code the service issued carries this
+// browser's key and commitment. The browser shows no code that fails it, as
+// the mobile would pin whatever key the code carries.
+func (h *SyncHandshake) VerifyQRCode(qr *QRCodeData) error {
+	if h.role != SyncBrowser {
+		return fmt.Errorf("%w: only the browser shows pairing codes", ErrInvalidPairing)
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(qr.URL, pairingURLPrefix))
+	if err != nil || !strings.HasPrefix(qr.URL, pairingURLPrefix) {
+		return fmt.Errorf("%w: not a knirv sync URL", ErrInvalidPairing)
+	}
+	publicKey := base64.RawURLEncoding.EncodeToString(h.PublicKey())
+	commitment := base64.RawURLEncoding.EncodeToString(h.Commitment())
+	if qr.PublicKey != publicKey || values.Get("pk") != publicKey || values.Get("commit") != commitment {
+		return fmt.Errorf("%w: the pairing code does not carry this browser's key", ErrInvalidSyncKey)
+	}
+	return nil
+}
+
+// Reveal returns the nonce to post along with the public key, once the
+// session carries this device's commitment and its peer's. From then on
+// the handshake only completes with the peer commitment it saw here.
+func (h *SyncHandshake) Reveal(session *SyncSession) ([]byte, error) {
+	own, peer, _ := h.sides(session)
+	if !bytes.Equal(own.commitment, h.Commitment()) {
+		return nil, fmt.Errorf("%w: the session does not carry this device's commitment", ErrInvalidSyncKey)
+	}
+	if len(peer.commitment) == 0 {
+		return nil, fmt.Errorf("%w: the peer has not committed to its key", ErrSyncHandshakeIncomplete)
+	}
+	if h.peerCommitment != nil && !bytes.Equal(peer.commitment, h.peerCommitment) {
+		return nil, fmt.Errorf("%w: the session does not carry the peer's commitment", ErrInvalidSyncKey)
+	}
+	h.peerCommitment = bytes.Clone(peer.commitment)
+	return bytes.Clone(h.nonce), nil
+}
+
+// Complete derives the channel from a session both devices have revealed
+// their keys to, after this device's Reveal. The session must carry this
+// handshake's own key and nonce, and a peer key and nonce that match the
+// commitment Reveal saw, and the key from the pairing code if there was
+// one. A relay that swapped the peer's key before that is caught by
+// comparing SAS codes.
+func (h *SyncHandshake) Complete(session *SyncSession) (*SyncChannel, error) {
+	if !session.HandshakeComplete() {
+		return nil, fmt.Errorf("%w: %s", ErrSyncHandshakeIncomplete, session.ID)
+	}
+	own, peer, peerID := h.sides(session)
+	if !bytes.Equal(own.publicKey, h.PublicKey()) || !bytes.Equal(own.nonce, h.nonce) {
+		return nil, fmt.Errorf("%w: the session does not carry this device's key", ErrInvalidSyncKey)
+	}
+	if h.peerCommitment == nil {
+		return nil, fmt.Errorf("%w: this device has not revealed its key", ErrSyncHandshakeIncomplete)
+	}
+	if !bytes.Equal(peer.commitment, h.peerCommitment) || !bytes.Equal(syncCommitment(peer.publicKey, peer.nonce), h.peerCommitment) {
+		return nil, fmt.Errorf("%w: the peer's key does not match its commitment", ErrInvalidSyncKey)
+	}
+	if h.peer != nil && !bytes.Equal(peer.publicKey, h.peer) {
+		return nil, fmt.Errorf("%w: the session does not carry the key from the pairing code", ErrInvalidSyncKey)
+	}
+
+	peerKey, err := ecdh.X25519().NewPublicKey(peer.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSyncKey, err)
+	}
+	secret, err := h.private.ECDH(peerKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSyncKey, err)
+	}
+	defer wipeBytes(secret)
+
+	toBrowser, err := syncDirectionAEAD(secret, session, SyncMobile)
+	if err != nil {
+		return nil, err
+	}
+	toMobile, err := syncDirectionAEAD(secret, session, SyncBrowser)
+	if err != nil {
+		return nil, err
+	}
+	channel := &SyncChannel{sessionID: session.ID, deviceID: h.deviceID, peerID: peerID, send: toBrowser, receive: toMobile}
+	if h.role == SyncBrowser {
+		channel.send, channel.receive = toMobile, toBrowser
+	}
+	channel.fingerprint = sha256.Sum256(append(bytes.Clone(session.MobilePublicKey), session.BrowserPublicKey...))
+	if channel.sas, err = syncSAS(secret, session); err != nil {
+		return nil, err
+	}
+	return channel, nil
+}
+
+// syncSAS derives the short authentication string of a handshake.
+func syncSAS(secret []byte, session *SyncSession) (string, error) {
+	info := syncChannelInfo + "sas" + string(session.MobilePublicKey) + string(session.BrowserPublicKey) +
+		string(session.MobileNonce) + string(session.BrowserNonce)
+	code, err := hkdf.Key(sha256.New, secret, []byte(session.ID), info, 8)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint64(code)%1_000_000), nil
+}
+
+// syncDirectionAEAD keys the messages from's side sends.
+func syncDirectionAEAD(secret []byte, session *SyncSession, from SyncRole) (cipher.AEAD, error) {
+	info := syncChannelInfo + string(from) + string(session.MobilePublicKey) + string(session.BrowserPublicKey)
+	key, err := hkdf.Key(sha256.New, secret, []byte(session.ID), info, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SyncChannel seals messages for the peer device and opens the peer's.
+// It is safe for concurrent use.
+type SyncChannel struct {
+	sessionID   string
+	deviceID    string
+	peerID      string
+	send        cipher.AEAD
+	receive     cipher.AEAD
+	fingerprint [sha256.Size]byte
+	sas         string
+
+	mu       sync.Mutex
+	sent     uint64 // sequence of the last message sealed
+	received uint64 // highest sequence opened
+}
+
+// Fingerprint identifies the pair of handshake keys. Both devices see the
+// same one unless the relay substituted a key.
+func (c *SyncChannel) Fingerprint() []byte {
+	return c.fingerprint[:]
+}
+
+// SAS is the six-digit code the device shows its user, who confirms the
+// pairing only if the other device shows the same.
+func (c *SyncChannel) SAS() string {
+	return c.sas
+}
+
+// Seal encrypts data for the peer as the next message of this device. The
+// message carries a fresh MessageID, so sending it again is harmless. Its
+// sequence number is used up even if it is never sent; the service then
+// delivers later messages once it gives up on the gap (see syncGapTimeout).
+func (c *SyncChannel) Seal(msgType string, data map[string]interface{}) (*SyncMessage, error) {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sync message: %w", err)
+	}
+	defer wipeBytes(plaintext)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent++
+	msg := &SyncMessage{Type: msgType, SessionID: c.sessionID, Sender: c.deviceID, Sequence: c.sent, MessageID: uuid.New().String()}
+	msg.Ciphertext = c.send.Seal(nil, syncNonce(msg.Sequence), plaintext, syncMessageAAD(msg))
+	return msg, nil
+}
+
+// SealWalletData seals a WALLET_SYNC message carrying walletData.
+func (c *SyncChannel) SealWalletData(walletData *WalletSyncData) (*SyncMessage, error) {
+	return c.Seal("WALLET_SYNC", map[string]interface{}{
+		"accounts":        walletData.Accounts,
+		"current_account": walletData.CurrentAccount,
+		"networks":        walletData.Networks,
+		"preferences":     walletData.Preferences,
+		"last_sync_time":  walletData.LastSyncTime,
+		"sync_version":    walletData.SyncVersion,
+	})
+}
+
+// Open decrypts a message from the peer. Sequences must rise, so a message
+// opened before, or older than one opened before, is refused with
+// ErrSyncReplay.
+func (c *SyncChannel) Open(msg *SyncMessage) (map[string]interface{}, error) {
+	if msg.SessionID != c.sessionID || msg.Sender != c.peerID {
+		return nil, fmt.Errorf("%w: not from the peer on this session", ErrInvalidSyncMessage)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if msg.Sequence <= c.received {
+		return nil, fmt.Errorf("%w: sequence %d after %d", ErrSyncReplay, msg.Sequence, c.received)
+	}
+	plaintext, err := c.receive.Open(nil, syncNonce(msg.Sequence), msg.Ciphertext, syncMessageAAD(msg))
+	if err != nil {
+		return nil, ErrSyncDecryption
+	}
+	defer wipeBytes(plaintext)
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSyncMessage, err)
+	}
+	c.received = msg.Sequence
+	return data, nil
+}
+
+func syncNonce(sequence uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], sequence)
+	return nonce
+}
+
+// syncMessageAAD authenticates the envelope fields the relay sees.
+func syncMessageAAD(msg *SyncMessage) []byte {
+	var aad []byte
+	for _, field := range []string{msg.SessionID, msg.Sender, msg.Type} {
+		aad = binary.AppendUvarint(aad, uint64(len(field)))
+		aad = append(aad, field...)
+	}
+	return binary.BigEndian.AppendUint64(aad, msg.Sequence)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncChannel(t *testing.T) {
+	service := NewWalletSyncService()
+
+	t.Run("SameKeysBothSides", func(t *testing.T) {
+		_, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		assert.Equal(t, mobile.Fingerprint(), browser.Fingerprint())
+		assert.Len(t, mobile.SAS(), 6)
+		assert.Equal(t, mobile.SAS(), browser.SAS())
+
+		first, err := mobile.Seal("PING", map[string]interface{}{"n": 1})
+		require.NoError(t, err)
+		second, err := mobile.Seal("PING", map[string]interface{}{"n": 1})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), first.Sequence)
+		assert.Equal(t, uint64(2), second.Sequence)
+		assert.NotEqual(t, first.Ciphertext, second.Ciphertext, "each sequence number is a fresh nonce")
+
+		reply, err := browser.Seal("PING", map[string]interface{}{"n": 1})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), reply.Sequence)
+		assert.NotEqual(t, first.Ciphertext, reply.Ciphertext, "each direction has its own key")
+	})
+
+	t.Run("Tampering", func(t *testing.T) {
+		_, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		seal := func() *SyncMessage {
+			msg, err := mobile.Seal("WALLET_UPDATE", map[string]interface{}{"balance": "1000000"})
+			require.NoError(t, err)
+			return msg
+		}
+
+		flipped := seal()
+		flipped.Ciphertext[0] ^= 1
+		_, err := browser.Open(flipped)
+		assert.ErrorIs(t, err, ErrSyncDecryption)
+
+		retyped := seal()
+		retyped.Type = "WALLET_SYNC"
+		_, err = browser.Open(retyped)
+		assert.ErrorIs(t, err, ErrSyncDecryption, "the envelope is authenticated")
+
+		resequenced := seal()
+		resequenced.Sequence += 10
+		_, err = browser.Open(resequenced)
+		assert.ErrorIs(t, err, ErrSyncDecryption)
+
+		_, other, _ := pairSyncDevices(t, service, "mobile", "browser")
+		stranger, err := other.Seal("WALLET_UPDATE", map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = browser.Open(stranger)
+		assert.ErrorIs(t, err, ErrInvalidSyncMessage, "another session's message")
+	})
+
+	t.Run("Replay", func(t *testing.T) {
+		_, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		first, err := mobile.Seal("PING", map[string]interface{}{})
+		require.NoError(t, err)
+		second, err := mobile.Seal("PING", map[string]interface{}{})
+		require.NoError(t, err)
+
+		_, err = browser.Open(second)
+		require.NoError(t, err)
+		_, err = browser.Open(second)
+		assert.ErrorIs(t, err, ErrSyncReplay)
+		_, err = browser.Open(first)
+		assert.ErrorIs(t, err, ErrSyncReplay, "older than one already opened")
+	})
+
+	t.Run("SubstitutedKey", func(t *testing.T) {
+		// A relay that shows the browser a key of its own instead of the
+		// mobile's. It has to commit to that key before the browser reveals
+		// its nonce, so it cannot search for one that makes the codes match.
+		session, _, err := service.CreateSyncSession("mobile", "browser")
+		require.NoError(t, err)
+		mobile, err := NewSyncHandshake(SyncMobile, "mobile")
+		require.NoError(t, err)
+		browser, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+		attacker, err := NewSyncHandshake(SyncMobile, "mobile")
+		require.NoError(t, err)
+
+		genuine := *session
+		genuine.BrowserPublicKey, genuine.BrowserCommitment = browser.PublicKey(), browser.Commitment()
+		genuine.MobileCommitment = mobile.Commitment()
+		forged := genuine
+		forged.MobileCommitment = attacker.Commitment()
+
+		_, err = mobile.Complete(&genuine)
+		assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete, "nothing revealed yet")
+		mobileNonce, err := mobile.Reveal(&genuine)
+		require.NoError(t, err)
+		browserNonce, err := browser.Reveal(&forged)
+		require.NoError(t, err)
+		attackerNonce, err := attacker.Reveal(&forged)
+		require.NoError(t, err)
+		genuine.MobilePublicKey, genuine.MobileNonce, genuine.BrowserNonce = mobile.PublicKey(), mobileNonce, browserNonce
+		forged.MobilePublicKey, forged.MobileNonce, forged.BrowserNonce = attacker.PublicKey(), attackerNonce, browserNonce
+
+		_, err = mobile.Complete(&forged)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey, "the mobile's own key is missing")
+
+		mobileChannel, err := mobile.Complete(&genuine)
+		require.NoError(t, err)
+		browserChannel, err := browser.Complete(&forged)
+		require.NoError(t, err)
+		assert.NotEqual(t, mobileChannel.SAS(), browserChannel.SAS(), "the users see different codes and refuse to confirm")
+		assert.NotEqual(t, mobileChannel.Fingerprint(), browserChannel.Fingerprint())
+
+		msg, err := mobileChannel.Seal("PING", map[string]interface{}{})
+		require.NoError(t, err)
+		_, err = browserChannel.Open(msg)
+		assert.ErrorIs(t, err, ErrSyncDecryption)
+
+		// Nor can the relay pick its key once it has seen the browser's
+		// nonce: the browser holds it to the commitment it revealed against
+		late, err := NewSyncHandshake(SyncMobile, "mobile")
+		require.NoError(t, err)
+		lateNonce, err := late.Reveal(&SyncSession{MobileCommitment: late.Commitment(), BrowserCommitment: browser.Commitment()})
+		require.NoError(t, err)
+		swapped := forged
+		swapped.MobilePublicKey, swapped.MobileNonce = late.PublicKey(), lateNonce
+		_, err = browser.Complete(&swapped)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey)
+		swapped.MobileCommitment = late.Commitment()
+		_, err = browser.Complete(&swapped)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey)
+		_, err = service.RevealHandshake(session.ID, "mobile", late.PublicKey(), mobileNonce)
+		assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete, "the service takes no reveal before both commit")
+	})
+}
@@ -0,0 +1,200 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message log
+//
+// The service numbers a session's messages with a cursor as it delivers
+// them, so readers page through the log and acknowledge what they have
+// handled by cursor rather than by time. Each sender's messages are
+// delivered in Sequence order: one that arrives ahead of an earlier one,
+// as concurrent sends from a device can, is held back until the gap fills.
+// A message sent again, after a lost response say, is recognised by its
+// MessageID or by its sender and sequence and answered with the stored copy
+// instead of being delivered twice.
+//
+// A device uses up a sequence number when it seals a message, since the
+// number is also the message's nonce, and a sealed message may never be
+// sent. So a gap is not waited on forever: once a sender's earliest missing
+// message has been awaited for syncGapTimeout, the next message from that
+// sender gives up on it and delivers what is held from the oldest held
+// message on. The missing message is refused with ErrSyncMessageSkipped if
+// it turns up later, as its peer could no longer open it in order.
+//
+// The log is changed under its session's lock. Delivered messages are never
+// changed again, and the log only appends to them, so it publishes them as
+// a slice readers can use without the lock.
+
+const (
+	// maxSyncHeldMessages bounds how far ahead of the message it waits
+	// for a sender may get.
+	maxSyncHeldMessages = 64
+	syncGapTimeout      = 30 * time.Second
+)
+
+var (
+	ErrSyncSequenceGap    = errors.New("sync message too far ahead of the sender's earlier messages")
+	ErrSyncMessageSkipped = errors.New("sync message arrived after its sequence number was skipped")
+)
+
+type syncLog struct {
+	messages []*SyncMessage // delivered, messages[i].Cursor == i+1
+	byID     map[string]*SyncMessage
+	senders  map[string]*syncSender
+	acked    map[string]uint64 // the highest cursor each device acknowledged
+	streamed map[string]uint64 // the highest cursor streamed to each device
+
+	published atomic.Pointer[[]*SyncMessage] // messages as of the last delivery
+}
+
+type syncSender struct {
+	delivered map[uint64]*SyncMessage // by Sequence; skipped ones are missing
+	last      uint64                  // the highest sequence delivered or skipped
+	held      map[uint64]*SyncMessage
+	gapSince  time.Time // since when the message after last is awaited
+}
+
+// waitingFor returns the sequence the sender's next delivery starts at: the
+// one after last, or the oldest held once the gap before it has timed out.
+func (s *syncSender) waitingFor(now time.Time) uint64 {
+	next := s.last + 1
+	if len(s.held) == 0 || s.held[next] != nil || now.Sub(s.gapSince) < syncGapTimeout {
+		return next
+	}
+	oldest := uint64(0)
+	for sequence := range s.held {
+		if oldest == 0 || sequence < oldest {
+			oldest = sequence
+		}
+	}
+	return oldest
+}
+
+func newSyncLog() *syncLog {
+	return &syncLog{
+		byID:     make(map[string]*SyncMessage),
+		senders:  make(map[string]*syncSender),
+		acked:    make(map[string]uint64),
+		streamed: make(map[string]uint64),
+	}
+}
+
+// add stores msg, returning the stored copy and the messages it let
+// through, in order: none while msg is held back, msg and any held behind
+// it otherwise. A resent message comes back as stored, delivering nothing.
+func (l *syncLog) add(msg *SyncMessage, now time.Time) (*SyncMessage, []*SyncMessage, error) {
+	if stored, ok := l.byID[msg.MessageID]; ok && msg.MessageID != "" {
+		return l.resent(stored, msg)
+	}
+	sender, ok := l.senders[msg.Sender]
+	if !ok {
+		sender = &syncSender{delivered: make(map[uint64]*SyncMessage), held: make(map[uint64]*SyncMessage)}
+		l.senders[msg.Sender] = sender
+	}
+	next := sender.waitingFor(now)
+	switch {
+	case msg.Sequence <= sender.last && sender.delivered[msg.Sequence] != nil:
+		return l.resent(sender.delivered[msg.Sequence], msg)
+	case msg.Sequence <= sender.last:
+		return nil, nil, fmt.Errorf("%w: sequence %d from %s", ErrSyncMessageSkipped, msg.Sequence, msg.Sender)
+	case sender.held[msg.Sequence] != nil:
+		return l.resent(sender.held[msg.Sequence], msg)
+	case msg.Sequence >= next && msg.Sequence-next >= maxSyncHeldMessages:
+		return nil, nil, fmt.Errorf("%w: sequence %d while waiting for %d", ErrSyncSequenceGap, msg.Sequence, next)
+	}
+
+	stored := *msg
+	stored.Ciphertext = bytes.Clone(msg.Ciphertext)
+	stored.Timestamp = now
+	stored.Cursor = 0
+	if stored.MessageID == "" {
+		stored.MessageID = uuid.New().String()
+	}
+	l.byID[stored.MessageID] = &stored
+	if len(sender.held) == 0 {
+		sender.gapSince = now
+	}
+	sender.held[stored.Sequence] = &stored
+
+	// A message filling part of a timed-out gap goes out first
+	next = min(next, stored.Sequence)
+	var delivered []*SyncMessage
+	for held := sender.held[next]; held != nil; held = sender.held[next] {
+		delete(sender.held, next)
+		held.Cursor = uint64(len(l.messages)) + 1
+		l.messages = append(l.messages, held)
+		sender.delivered[next] = held
+		sender.last = next
+		delivered = append(delivered, held)
+		next++
+	}
+	if len(delivered) > 0 {
+		sender.gapSince = now
+	}
+	if len(delivered) > 0 {
+		messages := l.messages
+		l.published.Store(&messages)
+	}
+	return &stored, delivered, nil
+}
+
+// resent answers a message the log already has, which must be the same
+// message: a different one under the same ID or sequence number is refused.
+func (l *syncLog) resent(stored, msg *SyncMessage) (*SyncMessage, []*SyncMessage, error) {
+	if stored.Sender != msg.Sender || stored.Sequence != msg.Sequence || stored.Type != msg.Type || !bytes.Equal(stored.Ciphertext, msg.Ciphertext) {
+		return nil, nil, fmt.Errorf("%w: sequence %d from %s already used for another message", ErrInvalidSyncMessage, msg.Sequence, msg.Sender)
+	}
+	return stored, nil, nil
+}
+
+// after returns the delivered messages past cursor. The caller holds the
+// session's lock.
+func (l *syncLog) after(cursor uint64) []*SyncMessage {
+	return messagesAfter(l.messages, cursor)
+}
+
+// delivered is after for callers without the lock, as of the last delivery.
+func (l *syncLog) delivered(cursor uint64) []*SyncMessage {
+	published := l.published.Load()
+	if published == nil {
+		return nil
+	}
+	return messagesAfter(*published, cursor)
+}
+
+func messagesAfter(messages []*SyncMessage, cursor uint64) []*SyncMessage {
+	if cursor >= uint64(len(messages)) {
+		return nil
+	}
+	return messages[cursor:]
+}
+
+// cursorOf returns the cursor of a delivered message.
+func (l *syncLog) cursorOf(messageID string) (uint64, error) {
+	msg, ok := l.byID[messageID]
+	if !ok || msg.Cursor == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownSyncMessage, messageID)
+	}
+	return msg.Cursor, nil
+}
+
+// ack records that deviceID has handled its peer's messages up to cursor,
+// which must not be past what was streamed to it. Acknowledgements only move
+// forward.
+func (l *syncLog) ack(deviceID string, cursor uint64) error {
+	if cursor > l.streamed[deviceID] {
+		return fmt.Errorf("%w: cursor %d was never streamed to %s", ErrUnknownSyncMessage, cursor, deviceID)
+	}
+	if cursor > l.acked[deviceID] {
+		l.acked[deviceID] = cursor
+	}
+	return nil
+}
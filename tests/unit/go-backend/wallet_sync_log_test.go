@@ -0,0 +1,247 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncDelivery(t *testing.T) {
+	service := NewWalletSyncService()
+
+	seal := func(t *testing.T, channel *SyncChannel, msgType string) *SyncMessage {
+		sealed, err := channel.Seal(msgType, map[string]interface{}{"type": msgType})
+		require.NoError(t, err)
+		return sealed
+	}
+	send := func(t *testing.T, sealed *SyncMessage) *SyncMessage {
+		sent, err := service.SendSyncMessage(sealed)
+		require.NoError(t, err)
+		return sent
+	}
+	cursors := func(messages []*SyncMessage) []uint64 {
+		var positions []uint64
+		for _, msg := range messages {
+			positions = append(positions, msg.Cursor)
+		}
+		return positions
+	}
+
+	t.Run("SameInstant", func(t *testing.T) {
+		frozen := NewWalletSyncService()
+		instant := time.Now()
+		frozen.now = func() time.Time { return instant }
+		session, mobile, _ := pairSyncDevices(t, frozen, "mobile", "browser")
+
+		for _, msgType := range []string{"FIRST", "SECOND"} {
+			_, err := frozen.SendSyncMessage(seal(t, mobile, msgType))
+			require.NoError(t, err)
+		}
+		messages, err := frozen.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, messages[0].Timestamp, messages[1].Timestamp)
+		assert.Equal(t, []uint64{1, 2}, cursors(messages))
+
+		messages, err = frozen.GetSyncMessages(session.ID, 1)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "SECOND", messages[0].Type)
+	})
+
+	t.Run("Resend", func(t *testing.T) {
+		session, mobile, _ := pairSyncDevices(t, service, "mobile", "browser")
+		sealed := seal(t, mobile, "WALLET_SYNC")
+		first := send(t, sealed)
+		assert.Equal(t, sealed.MessageID, first.MessageID, "the sealed message's ID is kept")
+
+		again := send(t, sealed)
+		assert.Equal(t, first, again)
+		anonymous := *sealed
+		anonymous.MessageID = ""
+		assert.Equal(t, first, send(t, &anonymous), "recognised by sender and sequence")
+
+		messages, err := service.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		assert.Len(t, messages, 1)
+
+		forged := *sealed
+		forged.Ciphertext = append([]byte{0}, sealed.Ciphertext...)
+		_, err = service.SendSyncMessage(&forged)
+		assert.ErrorIs(t, err, ErrInvalidSyncMessage, "another message under the same ID")
+		forged.MessageID = ""
+		_, err = service.SendSyncMessage(&forged)
+		assert.ErrorIs(t, err, ErrInvalidSyncMessage, "another message under the same sequence")
+	})
+
+	t.Run("SenderOrder", func(t *testing.T) {
+		session, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		sub, err := service.Subscribe(session.ID, "browser", "")
+		require.NoError(t, err)
+		defer sub.Close()
+		first, second, third := seal(t, mobile, "FIRST"), seal(t, mobile, "SECOND"), seal(t, mobile, "THIRD")
+
+		// Held back until the first arrives
+		assert.Zero(t, send(t, third).Cursor)
+		assert.Zero(t, send(t, second).Cursor)
+		assert.Zero(t, send(t, second).Cursor, "resending a held message")
+		messages, err := service.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+
+		assert.Equal(t, uint64(1), send(t, first).Cursor)
+		messages, err = service.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 3}, cursors(messages))
+		for _, want := range []string{"FIRST", "SECOND", "THIRD"} {
+			msg := <-sub.Messages()
+			data, err := browser.Open(msg)
+			require.NoError(t, err)
+			assert.Equal(t, want, data["type"])
+		}
+
+		_, err = service.SendSyncMessage(&SyncMessage{Type: "FAR", SessionID: session.ID, Sender: "mobile", Sequence: 4 + maxSyncHeldMessages, Ciphertext: []byte{1}})
+		assert.ErrorIs(t, err, ErrSyncSequenceGap)
+	})
+
+	t.Run("AbandonedSeal", func(t *testing.T) {
+		clocked := NewWalletSyncService()
+		now := time.Now()
+		clocked.now = func() time.Time { return now }
+		session, mobile, browser := pairSyncDevices(t, clocked, "mobile", "browser")
+		sendTo := func(t *testing.T, sealed *SyncMessage) *SyncMessage {
+			sent, err := clocked.SendSyncMessage(sealed)
+			require.NoError(t, err)
+			return sent
+		}
+
+		// The first is sealed but never sent
+		abandoned := seal(t, mobile, "LOST")
+		assert.Zero(t, sendTo(t, seal(t, mobile, "SECOND")).Cursor)
+		now = now.Add(syncGapTimeout / 2)
+		assert.Zero(t, sendTo(t, seal(t, mobile, "THIRD")).Cursor, "held while the gap is young")
+
+		now = now.Add(syncGapTimeout / 2)
+		fourth := sendTo(t, seal(t, mobile, "FOURTH"))
+		messages, err := clocked.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 3}, cursors(messages))
+		assert.Equal(t, uint64(3), fourth.Cursor)
+		for _, want := range []string{"SECOND", "THIRD", "FOURTH"} {
+			data, err := browser.Open(messages[0])
+			require.NoError(t, err)
+			assert.Equal(t, want, data["type"])
+			messages = messages[1:]
+		}
+
+		_, err = clocked.SendSyncMessage(abandoned)
+		assert.ErrorIs(t, err, ErrSyncMessageSkipped)
+		assert.Equal(t, uint64(4), sendTo(t, seal(t, mobile, "FIFTH")).Cursor)
+	})
+
+	t.Run("TimedOutGapFilledLate", func(t *testing.T) {
+		clocked := NewWalletSyncService()
+		now := time.Now()
+		clocked.now = func() time.Time { return now }
+		session, mobile, _ := pairSyncDevices(t, clocked, "mobile", "browser")
+		first, second, third := seal(t, mobile, "FIRST"), seal(t, mobile, "SECOND"), seal(t, mobile, "THIRD")
+
+		// Once the gap times out, the second, arriving late, still goes
+		// ahead of the third; only the first is given up on
+		_, err := clocked.SendSyncMessage(third)
+		require.NoError(t, err)
+		now = now.Add(syncGapTimeout)
+		_, err = clocked.SendSyncMessage(second)
+		require.NoError(t, err)
+		messages, err := clocked.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, []string{"SECOND", "THIRD"}, []string{messages[0].Type, messages[1].Type})
+		_, err = clocked.SendSyncMessage(first)
+		assert.ErrorIs(t, err, ErrSyncMessageSkipped)
+	})
+
+	t.Run("Acknowledgements", func(t *testing.T) {
+		paired := pairSync(t, service, "mobile", "browser")
+		session, mobile, browser := paired.session, paired.mobile, paired.browser
+		var sent []*SyncMessage
+		for _, msgType := range []string{"FIRST", "SECOND", "THIRD"} {
+			sent = append(sent, send(t, seal(t, mobile, msgType)))
+		}
+		reply := send(t, seal(t, browser, "ACK"))
+
+		// Nothing has been streamed to the browser yet
+		err := service.AckSyncMessages(session.ID, "browser", paired.browserToken, sent[0].Cursor)
+		assert.ErrorIs(t, err, ErrUnknownSyncMessage)
+
+		sub, err := service.Subscribe(session.ID, "browser", "")
+		require.NoError(t, err)
+		for range sent {
+			<-sub.Messages()
+		}
+		sub.Close()
+		require.NoError(t, service.AckSyncMessages(session.ID, "browser", paired.browserToken, sent[1].Cursor))
+		require.NoError(t, service.AckSyncMessages(session.ID, "browser", paired.browserToken, sent[0].Cursor), "acknowledgements never move back")
+		sub, err = service.Subscribe(session.ID, "browser", "")
+		require.NoError(t, err)
+		defer sub.Close()
+		assert.Equal(t, sent[2].MessageID, (<-sub.Messages()).MessageID)
+		select {
+		case msg := <-sub.Messages():
+			t.Fatalf("unexpected %s", msg.Type)
+		default:
+		}
+
+		// The mobile has acknowledged nothing
+		mobileSub, err := service.Subscribe(session.ID, "mobile", "")
+		require.NoError(t, err)
+		defer mobileSub.Close()
+		assert.Equal(t, reply.MessageID, (<-mobileSub.Messages()).MessageID)
+
+		// The browser's own reply was never streamed to it
+		err = service.AckSyncMessages(session.ID, "browser", paired.browserToken, reply.Cursor)
+		assert.ErrorIs(t, err, ErrUnknownSyncMessage)
+		err = service.AckSyncMessages(session.ID, "eavesdropper", paired.browserToken, 1)
+		assert.ErrorIs(t, err, ErrNotSyncParty)
+
+		// A device acknowledges with its own token only
+		for _, token := range []string{"", "guess", paired.browserToken} {
+			err = service.AckSyncMessages(session.ID, "mobile", token, reply.Cursor)
+			assert.ErrorIs(t, err, ErrSyncDeviceUnauthorized)
+		}
+		assert.NoError(t, service.AckSyncMessages(session.ID, "mobile", paired.mobileToken, reply.Cursor))
+	})
+
+	t.Run("ConcurrentSenders", func(t *testing.T) {
+		session, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		const perSender = 50
+		var wg sync.WaitGroup
+		for _, channel := range []*SyncChannel{mobile, browser} {
+			for i := 0; i < perSender; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sealed, err := channel.Seal("CONCURRENT", map[string]interface{}{})
+					if assert.NoError(t, err) {
+						_, err = service.SendSyncMessage(sealed)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+		}
+		wg.Wait()
+
+		messages, err := service.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2*perSender)
+		last := map[string]uint64{}
+		for i, msg := range messages {
+			assert.Equal(t, uint64(i+1), msg.Cursor)
+			assert.Equal(t, last[msg.Sender]+1, msg.Sequence, "in order per sender")
+			last[msg.Sender] = msg.Sequence
+		}
+	})
+}
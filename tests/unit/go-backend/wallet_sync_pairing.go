@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pairing
+//
+// The browser's QR code carries its handshake public key and commitment and
+// a one-time token, never a secret: whoever photographs it can at most race
+// the mobile to claim it, which the mobile notices when the claim fails and
+// both users notice when their SAS codes differ. The service signs the code
+// so the mobile knows the key came from the session it is joining, and
+// forgets the token once claimed. The browser checks the code carries its
+// own key before showing it, since the mobile pins that key.
+
+const (
+	pairingURLPrefix     = "knirv://sync?"
+	pairingSigningPrefix = "knirv wallet sync pairing v2"
+	pairingTokenSize     = 16
+	defaultPairingTTL    = 5 * time.Minute
+)
+
+var (
+	ErrInvalidPairing     = errors.New("invalid pairing code")
+	ErrPairingExpired     = errors.New("pairing code expired")
+	ErrPairingUsed        = errors.New("pairing code already used")
+	ErrPairingUnconfirmed = errors.New("sync pairing not confirmed on both devices")
+)
+
+// QRCodeData is what the browser shows for the mobile to scan. URL holds
+// the same fields, signed; the others are there for display and debugging.
+type QRCodeData struct {
+	SessionID  string `json:"session_id"`
+	PublicKey  string `json:"public_key"` // the browser's handshake key, base64url
+	Commitment string `json:"commitment"` // the browser's handshake commitment, base64url
+	Token      string `json:"token"`
+	ExpiresAt  int64  `json:"expires_at"`
+	URL        string `json:"url"`
+}
+
+// syncPairing is the service's record of the code it issued for a session.
+type syncPairing struct {
+	token     [sha256.Size]byte // hashed; the service has no use for it after issuing
+	expiresAt time.Time
+	used      bool
+}
+
+// PairingPublicKey verifies the pairing codes this service signs.
+func (s *WalletSyncService) PairingPublicKey() ed25519.PublicKey {
+	return s.pairingKey.Public().(ed25519.PublicKey)
+}
+
+// GenerateQRCode issues a pairing code for a session the browser has posted
+// its key to, replacing any unclaimed code issued before. Codes expire after
+// five minutes, or with the session if that is sooner.
+func (s *WalletSyncService) GenerateQRCode(sessionID string) (*QRCodeData, error) {
+	token := make([]byte, pairingTokenSize)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("failed to generate pairing token: %w", err)
+	}
+
+	var qr *QRCodeData
+	_, err := s.update(sessionID, func(e *syncEntry) error {
+		session := e.session
+		if len(session.BrowserPublicKey) == 0 {
+			return fmt.Errorf("%w: the browser has not posted its key", ErrSyncHandshakeIncomplete)
+		}
+		if len(session.MobileCommitment) > 0 {
+			return fmt.Errorf("%w: the session is already claimed", ErrPairingUsed)
+		}
+
+		expiresAt := s.now().Add(defaultPairingTTL)
+		if session.ExpiresAt.Before(expiresAt) {
+			expiresAt = session.ExpiresAt
+		}
+		qr = &QRCodeData{
+			SessionID:  session.ID,
+			PublicKey:  base64.RawURLEncoding.EncodeToString(session.BrowserPublicKey),
+			Commitment: base64.RawURLEncoding.EncodeToString(session.BrowserCommitment),
+			Token:      base64.RawURLEncoding.EncodeToString(token),
+			ExpiresAt:  expiresAt.Unix(),
+		}
+		signature := ed25519.Sign(s.pairingKey, pairingSigningInput(qr.SessionID, qr.PublicKey, qr.Commitment, qr.Token, qr.ExpiresAt))
+		qr.URL = pairingURLPrefix + url.Values{
+			"session": {qr.SessionID},
+			"pk":      {qr.PublicKey},
+			"commit":  {qr.Commitment},
+			"token":   {qr.Token},
+			"exp":     {strconv.FormatInt(qr.ExpiresAt, 10)},
+			"sig":     {base64.RawURLEncoding.EncodeToString(signature)},
+		}.Encode()
+
+		e.pairing = &syncPairing{token: sha256.Sum256([]byte(qr.Token)), expiresAt: expiresAt}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return qr, nil
+}
+
+// ClaimPairing redeems the token of a pairing code for the mobile device,
+// posting its handshake commitment, and returns the session along with the
+// mobile's device token. A code can be claimed once.
+func (s *WalletSyncService) ClaimPairing(sessionID, token, deviceID string, commitment []byte) (*SyncSession, string, error) {
+	deviceToken, deviceTokenHash, err := newSyncDeviceToken()
+	if err != nil {
+		return nil, "", err
+	}
+	session, err := s.update(sessionID, func(e *syncEntry) error {
+		session, pairing := e.session, e.pairing
+		if pairing == nil {
+			return fmt.Errorf("%w: none issued for session %s", ErrInvalidPairing, sessionID)
+		}
+		tokenHash := sha256.Sum256([]byte(token))
+		switch {
+		case subtle.ConstantTimeCompare(tokenHash[:], pairing.token[:]) != 1:
+			return fmt.Errorf("%w: wrong token", ErrInvalidPairing)
+		case pairing.used:
+			return ErrPairingUsed
+		case s.now().After(pairing.expiresAt):
+			return ErrPairingExpired
+		case deviceID != session.MobileDeviceID:
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		if err := postSyncCommitment(&session.MobileCommitment, deviceID, commitment); err != nil {
+			return err
+		}
+		pairing.used = true
+		e.tokens[deviceID] = deviceTokenHash
+		session.LastActivity = s.now()
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return session, deviceToken, nil
+}
+
+// ConfirmPairing records that deviceID's user saw the same SAS on both
+// devices. The service cannot check the codes itself; it only holds
+// messages back until both users have.
+func (s *WalletSyncService) ConfirmPairing(sessionID, deviceID string) (*SyncSession, error) {
+	return s.update(sessionID, func(e *syncEntry) error {
+		session := e.session
+		if !session.HandshakeComplete() {
+			return fmt.Errorf("%w: %s", ErrSyncHandshakeIncomplete, sessionID)
+		}
+		switch deviceID {
+		case session.MobileDeviceID:
+			session.MobileConfirmed = true
+		case session.BrowserInstanceID:
+			session.BrowserConfirmed = true
+		default:
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		session.LastActivity = s.now()
+		return nil
+	})
+}
+
+func pairingSigningInput(sessionID, publicKey, commitment, token string, expiresAt int64) []byte {
+	return []byte(strings.Join([]string{pairingSigningPrefix, sessionID, publicKey, commitment, token, strconv.FormatInt(expiresAt, 10)}, "\n"))
+}
+
+// PairingOffer is a pairing code as the mobile reads it.
+type PairingOffer struct {
+	SessionID  string
+	PublicKey  []byte
+	Commitment []byte
+	Token      string
+	ExpiresAt  time.Time
+}
+
+// ParsePairingURL reads a scanned pairing URL, checking it was signed by
+// serverKey and has not expired.
+func ParsePairingURL(rawURL string, serverKey ed25519.PublicKey) (*PairingOffer, error) {
+	if !strings.HasPrefix(rawURL, pairingURLPrefix) {
+		return nil, fmt.Errorf("%w: not a knirv sync URL", ErrInvalidPairing)
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(rawURL, pairingURLPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPairing, err)
+	}
+	sessionID, encodedKey, encodedCommitment, token := values.Get("session"), values.Get("pk"), values.Get("commit"), values.Get("token")
+	expiresAt, err := strconv.ParseInt(values.Get("exp"), 10, 64)
+	if err != nil || sessionID == "" || token == "" {
+		return nil, fmt.Errorf("%w: missing fields", ErrInvalidPairing)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(values.Get("sig"))
+	if err != nil || !ed25519.Verify(serverKey, pairingSigningInput(sessionID, encodedKey, encodedCommitment, token, expiresAt), signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidPairing)
+	}
+	publicKey, err := base64.RawURLEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSyncKey, err)
+	}
+	commitment, err := base64.RawURLEncoding.DecodeString(encodedCommitment)
+	if err != nil || len(commitment) != sha256.Size {
+		return nil, fmt.Errorf("%w: malformed commitment", ErrInvalidSyncKey)
+	}
+
+	offer := &PairingOffer{SessionID: sessionID, PublicKey: publicKey, Commitment: commitment, Token: token, ExpiresAt: time.Unix(expiresAt, 0)}
+	if time.Now().After(offer.ExpiresAt) {
+		return nil, ErrPairingExpired
+	}
+	return offer, nil
+}
+
+// Accept starts the mobile's handshake, pinned to the browser key and
+// commitment in the offer so the relay cannot substitute others.
+func (o *PairingOffer) Accept(deviceID string) (*SyncHandshake, error) {
+	handshake, err := NewSyncHandshake(SyncMobile, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	handshake.peer = o.PublicKey
+	handshake.peerCommitment = o.Commitment
+	return handshake, nil
+}
@@ -0,0 +1,255 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncPairing(t *testing.T) {
+	service := NewWalletSyncService()
+
+	// offer has the browser post its key and commitment and show a pairing
+	// code
+	offer := func(t *testing.T) (*SyncSession, *SyncHandshake, *QRCodeData) {
+		session, _, err := service.CreateSyncSession("mobile", "browser")
+		require.NoError(t, err)
+		browser, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+		_, err = service.PostHandshakeKey(session.ID, "browser", browser.PublicKey(), browser.Commitment())
+		require.NoError(t, err)
+		qr, err := service.GenerateQRCode(session.ID)
+		require.NoError(t, err)
+		require.NoError(t, browser.VerifyQRCode(qr))
+		return session, browser, qr
+	}
+
+	t.Run("CodeCarriesNoSecret", func(t *testing.T) {
+		session, browser, qr := offer(t)
+		parsed, err := ParsePairingURL(qr.URL, service.PairingPublicKey())
+		require.NoError(t, err)
+		assert.Equal(t, session.ID, parsed.SessionID)
+		assert.Equal(t, browser.PublicKey(), parsed.PublicKey)
+		assert.Equal(t, browser.Commitment(), parsed.Commitment)
+		assert.Equal(t, qr.Token, parsed.Token)
+		assert.Equal(t, qr.ExpiresAt, parsed.ExpiresAt.Unix())
+		assert.LessOrEqual(t, qr.ExpiresAt, time.Now().Add(defaultPairingTTL).Unix())
+
+		query, err := url.ParseQuery(strings.TrimPrefix(qr.URL, "knirv://sync?"))
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"session", "pk", "commit", "token", "exp", "sig"}, queryKeys(query))
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		_, _, qr := offer(t)
+		other, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+
+		tampered := strings.Replace(qr.URL, url.QueryEscape(qr.PublicKey), url.QueryEscape(base64.RawURLEncoding.EncodeToString(other.PublicKey())), 1)
+		require.NotEqual(t, qr.URL, tampered)
+		_, err = ParsePairingURL(tampered, service.PairingPublicKey())
+		assert.ErrorIs(t, err, ErrInvalidPairing)
+
+		otherServer, _, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		_, err = ParsePairingURL(qr.URL, otherServer)
+		assert.ErrorIs(t, err, ErrInvalidPairing)
+
+		_, err = ParsePairingURL("https://example.com/sync?"+strings.SplitN(qr.URL, "?", 2)[1], service.PairingPublicKey())
+		assert.ErrorIs(t, err, ErrInvalidPairing)
+	})
+
+	t.Run("SingleUse", func(t *testing.T) {
+		session, _, qr := offer(t)
+		parsed, err := ParsePairingURL(qr.URL, service.PairingPublicKey())
+		require.NoError(t, err)
+		mobile, err := parsed.Accept("mobile")
+		require.NoError(t, err)
+
+		_, _, err = service.ClaimPairing(session.ID, "guess", "mobile", mobile.Commitment())
+		assert.ErrorIs(t, err, ErrInvalidPairing)
+		_, _, err = service.ClaimPairing(session.ID, parsed.Token, "browser", mobile.Commitment())
+		assert.ErrorIs(t, err, ErrNotSyncParty)
+
+		claimed, _, err := service.ClaimPairing(session.ID, parsed.Token, "mobile", mobile.Commitment())
+		require.NoError(t, err)
+		assert.Equal(t, mobile.Commitment(), claimed.MobileCommitment)
+		assert.Empty(t, claimed.MobilePublicKey, "the key waits for the reveal")
+
+		// Someone else who photographed the screen
+		thief, err := parsed.Accept("mobile")
+		require.NoError(t, err)
+		_, _, err = service.ClaimPairing(session.ID, parsed.Token, "mobile", thief.Commitment())
+		assert.ErrorIs(t, err, ErrPairingUsed)
+		_, err = service.GenerateQRCode(session.ID)
+		assert.ErrorIs(t, err, ErrPairingUsed, "no new code once claimed")
+
+		// The mobile reveals what it committed to, and only that
+		nonce, err := mobile.Reveal(claimed)
+		require.NoError(t, err)
+		_, err = service.RevealHandshake(session.ID, "mobile", thief.PublicKey(), nonce)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey)
+		_, err = service.RevealHandshake(session.ID, "eavesdropper", mobile.PublicKey(), nonce)
+		assert.ErrorIs(t, err, ErrNotSyncParty)
+		revealed, err := service.RevealHandshake(session.ID, "mobile", mobile.PublicKey(), nonce)
+		require.NoError(t, err)
+		assert.Equal(t, mobile.PublicKey(), revealed.MobilePublicKey)
+	})
+
+	t.Run("Reissued", func(t *testing.T) {
+		session, _, first := offer(t)
+		second, err := service.GenerateQRCode(session.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, first.Token, second.Token)
+
+		mobile, err := NewSyncHandshake(SyncMobile, "mobile")
+		require.NoError(t, err)
+		_, _, err = service.ClaimPairing(session.ID, first.Token, "mobile", mobile.Commitment())
+		assert.ErrorIs(t, err, ErrInvalidPairing, "a new code replaces the old one")
+		_, _, err = service.ClaimPairing(session.ID, second.Token, "mobile", mobile.Commitment())
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		expiring := NewWalletSyncService()
+		session, _, err := expiring.CreateSyncSession("mobile", "browser")
+		require.NoError(t, err)
+		browser, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+		_, err = expiring.PostHandshakeKey(session.ID, "browser", browser.PublicKey(), browser.Commitment())
+		require.NoError(t, err)
+		qr, err := expiring.GenerateQRCode(session.ID)
+		require.NoError(t, err)
+
+		expiring.now = func() time.Time { return time.Now().Add(defaultPairingTTL + time.Minute) }
+		mobile, err := NewSyncHandshake(SyncMobile, "mobile")
+		require.NoError(t, err)
+		_, _, err = expiring.ClaimPairing(session.ID, qr.Token, "mobile", mobile.Commitment())
+		assert.ErrorIs(t, err, ErrPairingExpired)
+
+		// The code is signed with its expiry, which the mobile checks too
+		expiring.now = func() time.Time { return time.Now().Add(-time.Hour) }
+		stale, err := expiring.GenerateQRCode(session.ID)
+		require.NoError(t, err)
+		_, err = ParsePairingURL(stale.URL, expiring.PairingPublicKey())
+		assert.ErrorIs(t, err, ErrPairingExpired)
+	})
+
+	t.Run("PinnedBrowserKey", func(t *testing.T) {
+		session, browser, qr := offer(t)
+		parsed, err := ParsePairingURL(qr.URL, service.PairingPublicKey())
+		require.NoError(t, err)
+		mobile, err := parsed.Accept("mobile")
+		require.NoError(t, err)
+		claimed, _, err := service.ClaimPairing(session.ID, parsed.Token, "mobile", mobile.Commitment())
+		require.NoError(t, err)
+		revealed := revealSync(t, service, claimed, mobile, browser)
+
+		// A relay that swaps the browser key after the code was shown
+		attacker, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+		attackerNonce, err := attacker.Reveal(&SyncSession{BrowserCommitment: attacker.Commitment(), MobileCommitment: mobile.Commitment()})
+		require.NoError(t, err)
+		forged := *revealed
+		forged.BrowserPublicKey, forged.BrowserNonce = attacker.PublicKey(), attackerNonce
+		_, err = mobile.Complete(&forged)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey)
+		forged.BrowserCommitment = attacker.Commitment()
+		_, err = mobile.Complete(&forged)
+		assert.ErrorIs(t, err, ErrInvalidSyncKey, "the commitment is pinned too")
+	})
+
+	t.Run("BrowserChecksCode", func(t *testing.T) {
+		_, browser, qr := offer(t)
+		other, err := NewSyncHandshake(SyncBrowser, "browser")
+		require.NoError(t, err)
+		otherKey := base64.RawURLEncoding.EncodeToString(other.PublicKey())
+		otherCommitment := base64.RawURLEncoding.EncodeToString(other.Commitment())
+
+		// A relay that signs a code for a key of its own
+		forged := *qr
+		forged.PublicKey = otherKey
+		assert.ErrorIs(t, browser.VerifyQRCode(&forged), ErrInvalidSyncKey)
+		forged = *qr
+		forged.URL = strings.Replace(qr.URL, url.QueryEscape(qr.PublicKey), url.QueryEscape(otherKey), 1)
+		assert.ErrorIs(t, browser.VerifyQRCode(&forged), ErrInvalidSyncKey, "the mobile reads the URL, not the field")
+		forged.URL = strings.Replace(qr.URL, url.QueryEscape(qr.Commitment), url.QueryEscape(otherCommitment), 1)
+		assert.ErrorIs(t, browser.VerifyQRCode(&forged), ErrInvalidSyncKey)
+		assert.ErrorIs(t, other.VerifyQRCode(qr), ErrInvalidSyncKey)
+	})
+
+	t.Run("ConfirmBeforeMessages", func(t *testing.T) {
+		session, browser, qr := offer(t)
+		parsed, err := ParsePairingURL(qr.URL, service.PairingPublicKey())
+		require.NoError(t, err)
+		mobile, err := parsed.Accept("mobile")
+		require.NoError(t, err)
+
+		_, err = service.ConfirmPairing(session.ID, "browser")
+		assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete, "nothing to confirm before the mobile joins")
+
+		claimed, _, err := service.ClaimPairing(session.ID, parsed.Token, "mobile", mobile.Commitment())
+		require.NoError(t, err)
+		_, err = service.ConfirmPairing(session.ID, "browser")
+		assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete, "nor before both reveal")
+		revealed := revealSync(t, service, claimed, mobile, browser)
+		mobileChannel, err := mobile.Complete(revealed)
+		require.NoError(t, err)
+		browserChannel, err := browser.Complete(revealed)
+		require.NoError(t, err)
+		assert.Equal(t, mobileChannel.SAS(), browserChannel.SAS())
+
+		send := func() error {
+			sealed, err := mobileChannel.Seal("PING", map[string]interface{}{})
+			require.NoError(t, err)
+			_, err = service.SendSyncMessage(sealed)
+			return err
+		}
+		assert.ErrorIs(t, send(), ErrPairingUnconfirmed)
+		confirmed, err := service.ConfirmPairing(session.ID, "mobile")
+		require.NoError(t, err)
+		assert.False(t, confirmed.Paired())
+		assert.ErrorIs(t, send(), ErrPairingUnconfirmed)
+
+		_, err = service.ConfirmPairing(session.ID, "eavesdropper")
+		assert.ErrorIs(t, err, ErrNotSyncParty)
+		confirmed, err = service.ConfirmPairing(session.ID, "browser")
+		require.NoError(t, err)
+		assert.True(t, confirmed.Paired())
+		assert.NoError(t, send())
+	})
+
+	t.Run("Render", func(t *testing.T) {
+		_, _, qr := offer(t)
+
+		encoded, err := qr.PNG(256)
+		require.NoError(t, err)
+		img, err := png.Decode(bytes.NewReader(encoded))
+		require.NoError(t, err)
+		assert.Equal(t, 256, img.Bounds().Dx())
+		assert.Equal(t, 256, img.Bounds().Dy())
+
+		svg, err := qr.SVG(256)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(svg), `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`))
+		assert.Contains(t, string(svg), `<path fill="#000" d="M`)
+		assert.True(t, strings.HasSuffix(string(svg), "</svg>"))
+	})
+}
+
+func queryKeys(values url.Values) []string {
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	return names
+}
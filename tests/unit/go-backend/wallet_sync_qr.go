@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// PNG renders the pairing URL as a QR code size pixels square.
+func (q *QRCodeData) PNG(size int) ([]byte, error) {
+	code, err := qrcode.New(q.URL, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	return code.PNG(size)
+}
+
+// SVG renders the pairing URL as a QR code size pixels square. Modules are
+// one unit in the view box, so the code scales without blurring.
+func (q *QRCodeData) SVG(size int) ([]byte, error) {
+	code, err := qrcode.New(q.URL, qrcode.Medium)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	bitmap := code.Bitmap() // includes the quiet zone
+
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		size, size, len(bitmap), len(bitmap))
+	svg.WriteString(`<rect width="100%" height="100%" fill="#fff"/>`)
+	fmt.Fprintf(&svg, `<path fill="#000" d="%s"/>`, path.String())
+	svg.WriteString(`</svg>`)
+	return []byte(svg.String()), nil
+}
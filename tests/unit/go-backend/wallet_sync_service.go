@@ -0,0 +1,420 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Wallet sync pairs a mobile wallet with a browser extension. The service
+// only relays: the two devices agree on keys between themselves through an
+// X25519 handshake whose public halves it passes along, and every message
+// it stores is ciphertext it has no key for. The browser posts its key and
+// its handshake commitment and shows a pairing QR code; the mobile posts
+// its commitment by claiming the code. Once both have committed, each
+// reveals its handshake nonce, and the mobile its key, and messages flow
+// once both users have confirmed the devices show the same short code. See
+// SyncChannel for the device side.
+//
+// Each device also gets a token of its own, the browser when it creates the
+// session and the mobile when it claims the pairing code, which it presents
+// to acknowledge messages. The service keeps only their hashes.
+
+const (
+	SyncSessionActive  = "active"
+	SyncSessionClosed  = "closed"
+	SyncSessionExpired = "expired"
+
+	defaultSyncSessionTTL = 24 * time.Hour
+	syncDeviceTokenSize   = 32
+)
+
+var (
+	ErrSyncSessionNotFound     = errors.New("sync session not found")
+	ErrSyncSessionExpired      = errors.New("sync session expired")
+	ErrSyncSessionClosed       = errors.New("sync session closed")
+	ErrSyncDevicesRequired     = errors.New("mobile device and browser instance IDs are required")
+	ErrNotSyncParty            = errors.New("device is not a party to the sync session")
+	ErrInvalidSyncKey          = errors.New("invalid sync handshake key")
+	ErrSyncHandshakeIncomplete = errors.New("sync handshake incomplete")
+	ErrInvalidSyncMessage      = errors.New("invalid sync message")
+	ErrSyncDeviceUnauthorized  = errors.New("sync device token missing or wrong")
+)
+
+type SyncSession struct {
+	ID                string `json:"id"`
+	MobileDeviceID    string `json:"mobile_device_id"`
+	BrowserInstanceID string `json:"browser_instance_id"`
+
+	// The X25519 public keys of each side's handshake, as they posted
+	// them. The channel keys never leave the devices.
+	MobilePublicKey  []byte `json:"mobile_public_key,omitempty"`
+	BrowserPublicKey []byte `json:"browser_public_key,omitempty"`
+
+	// Each side commits to its key and nonce before either reveals its
+	// nonce; the nonces go into the SAS.
+	MobileCommitment  []byte `json:"mobile_commitment,omitempty"`
+	BrowserCommitment []byte `json:"browser_commitment,omitempty"`
+	MobileNonce       []byte `json:"mobile_nonce,omitempty"`
+	BrowserNonce      []byte `json:"browser_nonce,omitempty"`
+
+	// Each side confirms once its user has seen the same SAS on both
+	// devices.
+	MobileConfirmed  bool `json:"mobile_confirmed"`
+	BrowserConfirmed bool `json:"browser_confirmed"`
+
+	Status       string    `json:"status"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// Committed reports whether both sides have posted their commitments.
+func (s *SyncSession) Committed() bool {
+	return len(s.MobileCommitment) > 0 && len(s.BrowserCommitment) > 0
+}
+
+// HandshakeComplete reports whether both sides have revealed their keys.
+func (s *SyncSession) HandshakeComplete() bool {
+	return len(s.MobilePublicKey) > 0 && len(s.BrowserPublicKey) > 0 && len(s.MobileNonce) > 0 && len(s.BrowserNonce) > 0
+}
+
+// Paired reports whether both users have confirmed the handshake.
+func (s *SyncSession) Paired() bool {
+	return s.HandshakeComplete() && s.MobileConfirmed && s.BrowserConfirmed
+}
+
+func (s *SyncSession) clone() *SyncSession {
+	copied := *s
+	copied.MobilePublicKey = bytes.Clone(s.MobilePublicKey)
+	copied.BrowserPublicKey = bytes.Clone(s.BrowserPublicKey)
+	copied.MobileCommitment = bytes.Clone(s.MobileCommitment)
+	copied.BrowserCommitment = bytes.Clone(s.BrowserCommitment)
+	copied.MobileNonce = bytes.Clone(s.MobileNonce)
+	copied.BrowserNonce = bytes.Clone(s.BrowserNonce)
+	return &copied
+}
+
+// SyncMessage is a sealed payload on its way from one device to the other.
+// Type, SessionID, Sender and Sequence travel in the clear and are
+// authenticated with the ciphertext; Sequence counts the sender's messages
+// from 1. Cursor is the message's place in the session's log, in both
+// directions, which the service numbers from 1 as it delivers messages.
+type SyncMessage struct {
+	Type       string    `json:"type"`
+	SessionID  string    `json:"session_id"`
+	Sender     string    `json:"sender"`
+	Sequence   uint64    `json:"sequence"`
+	Ciphertext []byte    `json:"ciphertext"`
+	Timestamp  time.Time `json:"timestamp"`
+	MessageID  string    `json:"message_id"`
+	Cursor     uint64    `json:"cursor"`
+}
+
+type WalletSyncData struct {
+	Accounts       []map[string]interface{} `json:"accounts"`
+	CurrentAccount string                   `json:"current_account"`
+	Networks       []string                 `json:"networks"`
+	Preferences    map[string]interface{}   `json:"preferences"`
+	LastSyncTime   time.Time                `json:"last_sync_time"`
+	SyncVersion    string                   `json:"sync_version"`
+}
+
+// WalletSyncService keeps sync sessions and relays their messages. It
+// signs the pairing codes it issues with a key of its own, which devices
+// pin through PairingPublicKey. It is safe for concurrent use; see the
+// session store for how.
+type WalletSyncService struct {
+	shards     [syncShardCount]syncShard
+	pairingKey ed25519.PrivateKey
+	ttl        time.Duration
+	now        func() time.Time
+
+	// streamBuffer is how many messages a subscriber may fall behind by
+	// before it is dropped.
+	streamBuffer int
+}
+
+func NewWalletSyncService() *WalletSyncService {
+	_, pairingKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate pairing key: %v", err))
+	}
+	s := &WalletSyncService{
+		pairingKey:   pairingKey,
+		ttl:          defaultSyncSessionTTL,
+		now:          time.Now,
+		streamBuffer: defaultSyncStreamBuffer,
+	}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]*syncEntry)
+	}
+	return s
+}
+
+// CreateSyncSession starts a session for the browser, returning it along
+// with the browser's device token.
+func (s *WalletSyncService) CreateSyncSession(mobileDeviceID, browserInstanceID string) (*SyncSession, string, error) {
+	if mobileDeviceID == "" || browserInstanceID == "" {
+		return nil, "", ErrSyncDevicesRequired
+	}
+	token, tokenHash, err := newSyncDeviceToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := s.now()
+	session := &SyncSession{
+		ID:                uuid.New().String(),
+		MobileDeviceID:    mobileDeviceID,
+		BrowserInstanceID: browserInstanceID,
+		Status:            SyncSessionActive,
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(s.ttl),
+		LastActivity:      now,
+	}
+
+	shard := s.shard(session.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	e := newSyncEntry(session)
+	e.tokens[browserInstanceID] = tokenHash
+	shard.entries[session.ID] = e
+	return session.clone(), token, nil
+}
+
+// newSyncDeviceToken returns a fresh device token and the hash the service
+// keeps of it.
+func newSyncDeviceToken() (string, [sha256.Size]byte, error) {
+	raw := make([]byte, syncDeviceTokenSize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", [sha256.Size]byte{}, fmt.Errorf("failed to generate device token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	return token, sha256.Sum256([]byte(token)), nil
+}
+
+// GetSyncSession returns a copy of the session. An expired session comes
+// back marked expired, along with ErrSyncSessionExpired.
+func (s *WalletSyncService) GetSyncSession(sessionID string) (*SyncSession, error) {
+	_, session, err := s.view(sessionID)
+	if session == nil {
+		return nil, err
+	}
+	copied := session.clone()
+	if errors.Is(err, ErrSyncSessionExpired) {
+		copied.Status = SyncSessionExpired
+	}
+	return copied, err
+}
+
+// PostHandshakeKey records the browser's X25519 public key and its
+// commitment, which the pairing QR code then carries to the mobile. The
+// mobile posts its commitment by claiming the code. A device cannot change
+// its key once posted; it starts a new session instead.
+func (s *WalletSyncService) PostHandshakeKey(sessionID, deviceID string, publicKey, commitment []byte) (*SyncSession, error) {
+	return s.update(sessionID, func(e *syncEntry) error {
+		session := e.session
+		switch deviceID {
+		case session.BrowserInstanceID:
+			if err := postSyncKey(&session.BrowserPublicKey, deviceID, publicKey); err != nil {
+				return err
+			}
+			if err := postSyncCommitment(&session.BrowserCommitment, deviceID, commitment); err != nil {
+				return err
+			}
+		case session.MobileDeviceID:
+			return fmt.Errorf("%w: the mobile device commits by claiming the pairing code", ErrInvalidPairing)
+		default:
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		session.LastActivity = s.now()
+		return nil
+	})
+}
+
+// RevealHandshake records the key and nonce deviceID committed to. Neither
+// side can reveal before both have committed.
+func (s *WalletSyncService) RevealHandshake(sessionID, deviceID string, publicKey, nonce []byte) (*SyncSession, error) {
+	return s.update(sessionID, func(e *syncEntry) error {
+		session := e.session
+		if !session.Committed() {
+			return fmt.Errorf("%w: both devices must commit before either reveals", ErrSyncHandshakeIncomplete)
+		}
+		keySlot, commitment, nonceSlot := &session.MobilePublicKey, session.MobileCommitment, &session.MobileNonce
+		switch deviceID {
+		case session.MobileDeviceID:
+		case session.BrowserInstanceID:
+			keySlot, commitment, nonceSlot = &session.BrowserPublicKey, session.BrowserCommitment, &session.BrowserNonce
+		default:
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		if !bytes.Equal(syncCommitment(publicKey, nonce), commitment) {
+			return fmt.Errorf("%w: %s revealed a key it did not commit to", ErrInvalidSyncKey, deviceID)
+		}
+		if len(*nonceSlot) > 0 && !bytes.Equal(*nonceSlot, nonce) {
+			return fmt.Errorf("%w: %s already revealed a different nonce", ErrInvalidSyncKey, deviceID)
+		}
+		if err := postSyncKey(keySlot, deviceID, publicKey); err != nil {
+			return err
+		}
+		*nonceSlot = bytes.Clone(nonce)
+		session.LastActivity = s.now()
+		return nil
+	})
+}
+
+// postSyncKey sets one side's handshake key.
+func postSyncKey(slot *[]byte, deviceID string, publicKey []byte) error {
+	if _, err := ecdh.X25519().NewPublicKey(publicKey); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSyncKey, err)
+	}
+	if len(*slot) > 0 && !bytes.Equal(*slot, publicKey) {
+		return fmt.Errorf("%w: %s already posted a different key", ErrInvalidSyncKey, deviceID)
+	}
+	*slot = bytes.Clone(publicKey)
+	return nil
+}
+
+// postSyncCommitment sets one side's handshake commitment.
+func postSyncCommitment(slot *[]byte, deviceID string, commitment []byte) error {
+	if len(commitment) != sha256.Size {
+		return fmt.Errorf("%w: a commitment is %d bytes", ErrInvalidSyncKey, sha256.Size)
+	}
+	if len(*slot) > 0 && !bytes.Equal(*slot, commitment) {
+		return fmt.Errorf("%w: %s already posted a different commitment", ErrInvalidSyncKey, deviceID)
+	}
+	*slot = bytes.Clone(commitment)
+	return nil
+}
+
+// SendSyncMessage stores a message sealed by a SyncChannel for the other
+// device, pushes it to the other device's subscriptions and returns it with
+// its ID, timestamp and cursor. A message that arrives before one the sender
+// sealed earlier comes back without a cursor and is delivered once the
+// earlier one is; sending a message again returns it as first stored.
+// Messages can only flow once both devices have confirmed the pairing.
+func (s *WalletSyncService) SendSyncMessage(msg *SyncMessage) (*SyncMessage, error) {
+	if msg.Type == "" || msg.Sequence == 0 || len(msg.Ciphertext) == 0 {
+		return nil, fmt.Errorf("%w: type, sequence and ciphertext are required", ErrInvalidSyncMessage)
+	}
+
+	var returned SyncMessage
+	_, err := s.update(msg.SessionID, func(e *syncEntry) error {
+		session := e.session
+		if msg.Sender != session.MobileDeviceID && msg.Sender != session.BrowserInstanceID {
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, msg.Sender)
+		}
+		if !session.HandshakeComplete() {
+			return fmt.Errorf("%w: %s", ErrSyncHandshakeIncomplete, msg.SessionID)
+		}
+		if !session.Paired() {
+			return fmt.Errorf("%w: %s", ErrPairingUnconfirmed, msg.SessionID)
+		}
+
+		stored, delivered, err := e.log.add(msg, s.now())
+		if err != nil {
+			return err
+		}
+		session.LastActivity = s.now()
+		for _, msg := range delivered {
+			e.publish(msg)
+		}
+		returned = *stored
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &returned, nil
+}
+
+// GetSyncMessages returns the session's messages, in both directions, past
+// cursor after, oldest first. Pass the Cursor of the last message read to
+// get the next ones, or 0 for all. It reads the log as last published,
+// without waiting on senders.
+func (s *WalletSyncService) GetSyncMessages(sessionID string, after uint64) ([]*SyncMessage, error) {
+	e, _, err := s.view(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []*SyncMessage
+	for _, msg := range e.log.delivered(after) {
+		copied := *msg
+		messages = append(messages, &copied)
+	}
+	return messages, nil
+}
+
+// AckSyncMessages records that deviceID, presenting its device token, has
+// handled its peer's messages up to cursor. A subscription that names no
+// message to resume after starts after the device's acknowledgement, so
+// with both a device gets each message once however often it reconnects.
+// Only what a subscription has streamed to the device can be acknowledged.
+func (s *WalletSyncService) AckSyncMessages(sessionID, deviceID, token string, cursor uint64) error {
+	_, err := s.update(sessionID, func(e *syncEntry) error {
+		if deviceID != e.session.MobileDeviceID && deviceID != e.session.BrowserInstanceID {
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		tokenHash := sha256.Sum256([]byte(token))
+		want, issued := e.tokens[deviceID]
+		if !issued || subtle.ConstantTimeCompare(tokenHash[:], want[:]) != 1 {
+			return fmt.Errorf("%w: %s", ErrSyncDeviceUnauthorized, deviceID)
+		}
+		return e.log.ack(deviceID, cursor)
+	})
+	return err
+}
+
+// CloseSyncSession ends a session, expired or not, and the streams
+// following it.
+func (s *WalletSyncService) CloseSyncSession(sessionID string) error {
+	e, err := s.lookup(sessionID)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.removed {
+		return fmt.Errorf("%w: %s", ErrSyncSessionNotFound, sessionID)
+	}
+	e.session.Status = SyncSessionClosed
+	e.session.LastActivity = s.now()
+	e.publishSession()
+	e.unsubscribeAll(ErrSyncSessionClosed)
+	return nil
+}
+
+// CleanupExpiredSessions forgets expired sessions and their messages and
+// returns how many it removed. It holds one shard at a time, so the rest
+// of the service carries on meanwhile.
+func (s *WalletSyncService) CleanupExpiredSessions() int {
+	count := 0
+	now := s.now()
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mu.Lock()
+		for sessionID, e := range shard.entries {
+			e.mu.Lock()
+			if now.After(e.session.ExpiresAt) {
+				delete(shard.entries, sessionID)
+				e.removed = true
+				e.unsubscribeAll(ErrSyncSessionExpired)
+				count++
+			}
+			e.mu.Unlock()
+		}
+		shard.mu.Unlock()
+	}
+	return count
+}
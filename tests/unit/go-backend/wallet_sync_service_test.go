@@ -1,220 +1,91 @@
 package tests
 
 import (
-	"encoding/json"
+	"bytes"
 	"testing"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-// Mock structures for wallet synchronization testing
-type SyncSession struct {
-	ID                string    `json:"id"`
-	MobileDeviceID    string    `json:"mobile_device_id"`
-	BrowserInstanceID string    `json:"browser_instance_id"`
-	EncryptionKey     string    `json:"encryption_key"`
-	Status            string    `json:"status"`
-	CreatedAt         time.Time `json:"created_at"`
-	ExpiresAt         time.Time `json:"expires_at"`
-	LastActivity      time.Time `json:"last_activity"`
+// pairSyncDevices pairs a mobile and a browser device the way their users
+// would, through the QR code and matching SAS codes, and returns their
+// session and channels.
+// pairedSync is a paired session as its two test devices hold it.
+type pairedSync struct {
+	session                   *SyncSession
+	mobile, browser           *SyncChannel
+	mobileToken, browserToken string // the device tokens
 }
 
-type SyncMessage struct {
-	Type      string                 `json:"type"`
-	SessionID string                 `json:"session_id"`
-	Data      map[string]interface{} `json:"data"`
-	Timestamp time.Time              `json:"timestamp"`
-	MessageID string                 `json:"message_id"`
+func pairSync(t testing.TB, service *WalletSyncService, mobileDeviceID, browserInstanceID string) *pairedSync {
+	session, browserToken, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
+	require.NoError(t, err)
+
+	browser, err := NewSyncHandshake(SyncBrowser, browserInstanceID)
+	require.NoError(t, err)
+	_, err = service.PostHandshakeKey(session.ID, browserInstanceID, browser.PublicKey(), browser.Commitment())
+	require.NoError(t, err)
+	qr, err := service.GenerateQRCode(session.ID)
+	require.NoError(t, err)
+	require.NoError(t, browser.VerifyQRCode(qr))
+
+	offer, err := ParsePairingURL(qr.URL, service.PairingPublicKey())
+	require.NoError(t, err)
+	mobile, err := offer.Accept(mobileDeviceID)
+	require.NoError(t, err)
+	session, mobileToken, err := service.ClaimPairing(offer.SessionID, offer.Token, mobileDeviceID, mobile.Commitment())
+	require.NoError(t, err)
+	session = revealSync(t, service, session, mobile, browser)
+
+	mobileChannel, err := mobile.Complete(session)
+	require.NoError(t, err)
+	browserChannel, err := browser.Complete(session)
+	require.NoError(t, err)
+	require.Equal(t, mobileChannel.SAS(), browserChannel.SAS())
+
+	_, err = service.ConfirmPairing(session.ID, mobileDeviceID)
+	require.NoError(t, err)
+	session, err = service.ConfirmPairing(session.ID, browserInstanceID)
+	require.NoError(t, err)
+	return &pairedSync{session: session, mobile: mobileChannel, browser: browserChannel, mobileToken: mobileToken, browserToken: browserToken}
 }
 
-type QRCodeData struct {
-	SessionID     string `json:"session_id"`
-	EncryptionKey string `json:"encryption_key"`
-	ExpiresAt     int64  `json:"expires_at"`
-	URL           string `json:"url"`
-}
-
-type WalletSyncData struct {
-	Accounts        []map[string]interface{} `json:"accounts"`
-	CurrentAccount  string                   `json:"current_account"`
-	Networks        []string                 `json:"networks"`
-	Preferences     map[string]interface{}   `json:"preferences"`
-	LastSyncTime    time.Time                `json:"last_sync_time"`
-	SyncVersion     string                   `json:"sync_version"`
-}
-
-// Mock Wallet Sync Service
-type MockWalletSyncService struct {
-	sessions map[string]*SyncSession
-	messages map[string][]*SyncMessage
-}
-
-func NewMockWalletSyncService() *MockWalletSyncService {
-	return &MockWalletSyncService{
-		sessions: make(map[string]*SyncSession),
-		messages: make(map[string][]*SyncMessage),
-	}
-}
-
-func (s *MockWalletSyncService) CreateSyncSession(mobileDeviceID, browserInstanceID string) (*SyncSession, error) {
-	if mobileDeviceID == "" || browserInstanceID == "" {
-		return nil, assert.AnError
-	}
-
-	sessionID := uuid.New().String()
-	encryptionKey := uuid.New().String()
-
-	session := &SyncSession{
-		ID:                sessionID,
-		MobileDeviceID:    mobileDeviceID,
-		BrowserInstanceID: browserInstanceID,
-		EncryptionKey:     encryptionKey,
-		Status:            "active",
-		CreatedAt:         time.Now(),
-		ExpiresAt:         time.Now().Add(24 * time.Hour),
-		LastActivity:      time.Now(),
-	}
-
-	s.sessions[sessionID] = session
-	s.messages[sessionID] = make([]*SyncMessage, 0)
-
-	return session, nil
-}
-
-func (s *MockWalletSyncService) GetSyncSession(sessionID string) (*SyncSession, error) {
-	session, exists := s.sessions[sessionID]
-	if !exists {
-		return nil, assert.AnError
-	}
-
-	if time.Now().After(session.ExpiresAt) {
-		session.Status = "expired"
-		return session, assert.AnError
-	}
-
-	return session, nil
-}
-
-func (s *MockWalletSyncService) GenerateQRCode(sessionID string) (*QRCodeData, error) {
-	session, err := s.GetSyncSession(sessionID)
-	if err != nil {
-		return nil, err
-	}
-
-	qrData := &QRCodeData{
-		SessionID:     session.ID,
-		EncryptionKey: session.EncryptionKey,
-		ExpiresAt:     session.ExpiresAt.Unix(),
-		URL:           "knirv://sync?session=" + session.ID + "&key=" + session.EncryptionKey,
-	}
-
-	return qrData, nil
-}
-
-func (s *MockWalletSyncService) SendSyncMessage(sessionID string, messageType string, data map[string]interface{}) (*SyncMessage, error) {
-	session, err := s.GetSyncSession(sessionID)
-	if err != nil {
-		return nil, err
-	}
-
-	message := &SyncMessage{
-		Type:      messageType,
-		SessionID: sessionID,
-		Data:      data,
-		Timestamp: time.Now(),
-		MessageID: uuid.New().String(),
-	}
-
-	s.messages[sessionID] = append(s.messages[sessionID], message)
-	session.LastActivity = time.Now()
-
-	return message, nil
-}
-
-func (s *MockWalletSyncService) GetSyncMessages(sessionID string, since time.Time) ([]*SyncMessage, error) {
-	_, err := s.GetSyncSession(sessionID)
-	if err != nil {
-		return nil, err
-	}
-
-	messages := s.messages[sessionID]
-	var filteredMessages []*SyncMessage
-
-	for _, msg := range messages {
-		if msg.Timestamp.After(since) {
-			filteredMessages = append(filteredMessages, msg)
-		}
-	}
-
-	return filteredMessages, nil
-}
-
-func (s *MockWalletSyncService) SyncWalletData(sessionID string, walletData *WalletSyncData) error {
-	session, err := s.GetSyncSession(sessionID)
-	if err != nil {
-		return err
-	}
-
-	// Convert wallet data to map for message
-	dataMap := map[string]interface{}{
-		"accounts":       walletData.Accounts,
-		"current_account": walletData.CurrentAccount,
-		"networks":       walletData.Networks,
-		"preferences":    walletData.Preferences,
-		"last_sync_time": walletData.LastSyncTime,
-		"sync_version":   walletData.SyncVersion,
-	}
-
-	_, err = s.SendSyncMessage(sessionID, "WALLET_SYNC", dataMap)
-	return err
-}
-
-func (s *MockWalletSyncService) CloseSyncSession(sessionID string) error {
-	session, exists := s.sessions[sessionID]
-	if !exists {
-		return assert.AnError
+// revealSync has both devices of a committed session reveal their keys.
+func revealSync(t testing.TB, service *WalletSyncService, session *SyncSession, mobile, browser *SyncHandshake) *SyncSession {
+	for deviceID, handshake := range map[string]*SyncHandshake{session.MobileDeviceID: mobile, session.BrowserInstanceID: browser} {
+		nonce, err := handshake.Reveal(session)
+		require.NoError(t, err)
+		_, err = service.RevealHandshake(session.ID, deviceID, handshake.PublicKey(), nonce)
+		require.NoError(t, err)
 	}
-
-	session.Status = "closed"
-	session.LastActivity = time.Now()
-
-	return nil
+	session, err := service.GetSyncSession(session.ID)
+	require.NoError(t, err)
+	return session
 }
 
-func (s *MockWalletSyncService) CleanupExpiredSessions() int {
-	count := 0
-	now := time.Now()
-
-	for sessionID, session := range s.sessions {
-		if now.After(session.ExpiresAt) {
-			session.Status = "expired"
-			delete(s.sessions, sessionID)
-			delete(s.messages, sessionID)
-			count++
-		}
-	}
-
-	return count
+func pairSyncDevices(t testing.TB, service *WalletSyncService, mobileDeviceID, browserInstanceID string) (*SyncSession, *SyncChannel, *SyncChannel) {
+	paired := pairSync(t, service, mobileDeviceID, browserInstanceID)
+	return paired.session, paired.mobile, paired.browser
 }
 
 func TestWalletSyncService(t *testing.T) {
-	service := NewMockWalletSyncService()
+	service := NewWalletSyncService()
 
 	t.Run("SyncSessionManagement", func(t *testing.T) {
 		mobileDeviceID := "mobile-device-123"
 		browserInstanceID := "browser-instance-456"
 
 		t.Run("CreateSyncSession", func(t *testing.T) {
-			session, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
+			session, _, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
 
 			require.NoError(t, err)
 			assert.NotEmpty(t, session.ID)
 			assert.Equal(t, mobileDeviceID, session.MobileDeviceID)
 			assert.Equal(t, browserInstanceID, session.BrowserInstanceID)
-			assert.NotEmpty(t, session.EncryptionKey)
+			assert.Empty(t, session.MobilePublicKey, "no handshake yet")
+			assert.False(t, session.HandshakeComplete())
 			assert.Equal(t, "active", session.Status)
 			assert.False(t, session.CreatedAt.IsZero())
 			assert.True(t, session.ExpiresAt.After(time.Now()))
@@ -222,7 +93,7 @@ func TestWalletSyncService(t *testing.T) {
 
 		t.Run("GetSyncSession", func(t *testing.T) {
 			// Create a session first
-			createdSession, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
+			createdSession, _, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
 			require.NoError(t, err)
 
 			// Retrieve the session
@@ -230,39 +101,88 @@ func TestWalletSyncService(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, createdSession.ID, retrievedSession.ID)
-			assert.Equal(t, createdSession.EncryptionKey, retrievedSession.EncryptionKey)
+			assert.Equal(t, createdSession.MobileDeviceID, retrievedSession.MobileDeviceID)
 			assert.Equal(t, "active", retrievedSession.Status)
 		})
 
 		t.Run("InvalidSessionCreation", func(t *testing.T) {
-			_, err := service.CreateSyncSession("", browserInstanceID)
-			assert.Error(t, err)
+			_, _, err := service.CreateSyncSession("", browserInstanceID)
+			assert.ErrorIs(t, err, ErrSyncDevicesRequired)
 
-			_, err = service.CreateSyncSession(mobileDeviceID, "")
-			assert.Error(t, err)
+			_, _, err = service.CreateSyncSession(mobileDeviceID, "")
+			assert.ErrorIs(t, err, ErrSyncDevicesRequired)
 		})
 
 		t.Run("NonExistentSession", func(t *testing.T) {
 			_, err := service.GetSyncSession("non-existent-session-id")
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrSyncSessionNotFound)
+		})
+
+		t.Run("Handshake", func(t *testing.T) {
+			session, _, err := service.CreateSyncSession(mobileDeviceID, browserInstanceID)
+			require.NoError(t, err)
+			browser, err := NewSyncHandshake(SyncBrowser, browserInstanceID)
+			require.NoError(t, err)
+
+			_, err = service.PostHandshakeKey(session.ID, browserInstanceID, []byte("short"), browser.Commitment())
+			assert.ErrorIs(t, err, ErrInvalidSyncKey)
+			_, err = service.PostHandshakeKey(session.ID, browserInstanceID, browser.PublicKey(), []byte("short"))
+			assert.ErrorIs(t, err, ErrInvalidSyncKey)
+			_, err = service.PostHandshakeKey(session.ID, "eavesdropper", browser.PublicKey(), browser.Commitment())
+			assert.ErrorIs(t, err, ErrNotSyncParty)
+			_, err = service.PostHandshakeKey(session.ID, mobileDeviceID, browser.PublicKey(), browser.Commitment())
+			assert.ErrorIs(t, err, ErrInvalidPairing, "the mobile joins through the QR code")
+
+			posted, err := service.PostHandshakeKey(session.ID, browserInstanceID, browser.PublicKey(), browser.Commitment())
+			require.NoError(t, err)
+			assert.Equal(t, browser.PublicKey(), posted.BrowserPublicKey)
+			assert.Equal(t, browser.Commitment(), posted.BrowserCommitment)
+			_, err = browser.Complete(posted)
+			assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete)
+
+			// Nothing is revealed before the mobile commits
+			_, err = browser.Reveal(posted)
+			assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete)
+			_, err = service.RevealHandshake(session.ID, browserInstanceID, browser.PublicKey(), make([]byte, syncHandshakeNonce))
+			assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete)
+
+			_, err = service.PostHandshakeKey(session.ID, browserInstanceID, browser.PublicKey(), browser.Commitment())
+			assert.NoError(t, err, "posting the same key again is harmless")
+			other, err := NewSyncHandshake(SyncBrowser, browserInstanceID)
+			require.NoError(t, err)
+			_, err = service.PostHandshakeKey(session.ID, browserInstanceID, browser.PublicKey(), other.Commitment())
+			assert.ErrorIs(t, err, ErrInvalidSyncKey, "a posted commitment cannot be replaced")
+			_, err = service.PostHandshakeKey(session.ID, browserInstanceID, other.PublicKey(), other.Commitment())
+			assert.ErrorIs(t, err, ErrInvalidSyncKey, "a posted key cannot be replaced")
 		})
 	})
 
 	t.Run("QRCodeGeneration", func(t *testing.T) {
-		// Create a session first
-		session, err := service.CreateSyncSession("mobile-123", "browser-456")
+		// Create a session the browser has posted its key to first
+		session, _, err := service.CreateSyncSession("mobile-123", "browser-456")
+		require.NoError(t, err)
+		browser, err := NewSyncHandshake(SyncBrowser, "browser-456")
 		require.NoError(t, err)
 
+		t.Run("BrowserKeyRequired", func(t *testing.T) {
+			_, err := service.GenerateQRCode(session.ID)
+			assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete)
+		})
+
 		t.Run("GenerateValidQRCode", func(t *testing.T) {
+			_, err := service.PostHandshakeKey(session.ID, "browser-456", browser.PublicKey(), browser.Commitment())
+			require.NoError(t, err)
+
 			qrData, err := service.GenerateQRCode(session.ID)
 
 			require.NoError(t, err)
 			assert.Equal(t, session.ID, qrData.SessionID)
-			assert.Equal(t, session.EncryptionKey, qrData.EncryptionKey)
+			assert.NotEmpty(t, qrData.Token)
 			assert.Greater(t, qrData.ExpiresAt, time.Now().Unix())
 			assert.Contains(t, qrData.URL, "knirv://sync")
 			assert.Contains(t, qrData.URL, session.ID)
-			assert.Contains(t, qrData.URL, session.EncryptionKey)
+			assert.Contains(t, qrData.URL, qrData.PublicKey)
+			assert.NoError(t, browser.VerifyQRCode(qrData))
 		})
 
 		t.Run("GenerateQRCodeForInvalidSession", func(t *testing.T) {
@@ -272,9 +192,15 @@ func TestWalletSyncService(t *testing.T) {
 	})
 
 	t.Run("MessageSynchronization", func(t *testing.T) {
-		// Create a session first
-		session, err := service.CreateSyncSession("mobile-789", "browser-012")
-		require.NoError(t, err)
+		session, mobile, browser := pairSyncDevices(t, service, "mobile-789", "browser-012")
+
+		send := func(t *testing.T, channel *SyncChannel, messageType string, data map[string]interface{}) *SyncMessage {
+			sealed, err := channel.Seal(messageType, data)
+			require.NoError(t, err)
+			message, err := service.SendSyncMessage(sealed)
+			require.NoError(t, err)
+			return message
+		}
 
 		t.Run("SendSyncMessage", func(t *testing.T) {
 			messageData := map[string]interface{}{
@@ -282,14 +208,46 @@ func TestWalletSyncService(t *testing.T) {
 				"data":   "test wallet data",
 			}
 
-			message, err := service.SendSyncMessage(session.ID, "WALLET_UPDATE", messageData)
+			message := send(t, mobile, "WALLET_UPDATE", messageData)
 
-			require.NoError(t, err)
 			assert.Equal(t, "WALLET_UPDATE", message.Type)
 			assert.Equal(t, session.ID, message.SessionID)
-			assert.Equal(t, messageData, message.Data)
+			assert.Equal(t, "mobile-789", message.Sender)
 			assert.NotEmpty(t, message.MessageID)
 			assert.False(t, message.Timestamp.IsZero())
+			assert.False(t, bytes.Contains(message.Ciphertext, []byte("test wallet data")), "the service only sees ciphertext")
+
+			opened, err := browser.Open(message)
+			require.NoError(t, err)
+			assert.Equal(t, messageData, opened)
+		})
+
+		t.Run("BothDirections", func(t *testing.T) {
+			reply := send(t, browser, "ACK", map[string]interface{}{"ok": true})
+			opened, err := mobile.Open(reply)
+			require.NoError(t, err)
+			assert.Equal(t, true, opened["ok"])
+
+			_, err = browser.Open(reply)
+			assert.ErrorIs(t, err, ErrInvalidSyncMessage, "a device does not open its own messages")
+		})
+
+		t.Run("Unpaired", func(t *testing.T) {
+			unpaired, _, err := service.CreateSyncSession("mobile-unpaired", "browser-unpaired")
+			require.NoError(t, err)
+			_, err = service.SendSyncMessage(&SyncMessage{Type: "TEST", SessionID: unpaired.ID, Sender: "mobile-unpaired", Sequence: 1, Ciphertext: []byte{1}})
+			assert.ErrorIs(t, err, ErrSyncHandshakeIncomplete)
+
+			sealed, err := mobile.Seal("TEST", map[string]interface{}{})
+			require.NoError(t, err)
+			sealed.Sender = "eavesdropper"
+			_, err = service.SendSyncMessage(sealed)
+			assert.ErrorIs(t, err, ErrNotSyncParty)
+
+			// Later messages wait on this one until it is sent
+			sealed.Sender = "mobile-789"
+			_, err = service.SendSyncMessage(sealed)
+			assert.NoError(t, err)
 		})
 
 		t.Run("GetSyncMessages", func(t *testing.T) {
@@ -297,70 +255,55 @@ func TestWalletSyncService(t *testing.T) {
 			messageData1 := map[string]interface{}{"test": "data1"}
 			messageData2 := map[string]interface{}{"test": "data2"}
 
-			_, err := service.SendSyncMessage(session.ID, "TEST_MESSAGE_1", messageData1)
-			require.NoError(t, err)
-
-			time.Sleep(10 * time.Millisecond) // Small delay to ensure different timestamps
-
-			_, err = service.SendSyncMessage(session.ID, "TEST_MESSAGE_2", messageData2)
-			require.NoError(t, err)
+			first := send(t, mobile, "TEST_MESSAGE_1", messageData1)
+			second := send(t, mobile, "TEST_MESSAGE_2", messageData2)
+			assert.Equal(t, first.Cursor+1, second.Cursor)
 
 			// Get all messages
-			messages, err := service.GetSyncMessages(session.ID, time.Time{})
+			messages, err := service.GetSyncMessages(session.ID, 0)
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, len(messages), 2)
+			require.GreaterOrEqual(t, len(messages), 2)
 
 			// Verify message order and content
-			found1, found2 := false, false
-			for _, msg := range messages {
-				if msg.Type == "TEST_MESSAGE_1" {
-					found1 = true
-				}
-				if msg.Type == "TEST_MESSAGE_2" {
-					found2 = true
-				}
+			for i, msg := range messages {
+				assert.Equal(t, uint64(i+1), msg.Cursor)
 			}
-			assert.True(t, found1)
-			assert.True(t, found2)
+			assert.Equal(t, first.MessageID, messages[len(messages)-2].MessageID)
+			assert.Equal(t, second.MessageID, messages[len(messages)-1].MessageID)
 		})
 
-		t.Run("GetSyncMessagesWithTimeFilter", func(t *testing.T) {
-			beforeTime := time.Now()
-			time.Sleep(10 * time.Millisecond)
+		t.Run("GetSyncMessagesAfterCursor", func(t *testing.T) {
+			messages, err := service.GetSyncMessages(session.ID, 0)
+			require.NoError(t, err)
+			last := messages[len(messages)-1].Cursor
 
 			messageData := map[string]interface{}{"filtered": "message"}
-			_, err := service.SendSyncMessage(session.ID, "FILTERED_MESSAGE", messageData)
-			require.NoError(t, err)
+			filtered := send(t, mobile, "FILTERED_MESSAGE", messageData)
 
-			// Get messages since beforeTime
-			messages, err := service.GetSyncMessages(session.ID, beforeTime)
+			// Get messages after the last one read
+			messages, err = service.GetSyncMessages(session.ID, last)
 
 			require.NoError(t, err)
-			assert.GreaterOrEqual(t, len(messages), 1)
+			require.Len(t, messages, 1)
+			assert.Equal(t, filtered.MessageID, messages[0].MessageID)
 
-			// Verify the filtered message is included
-			found := false
-			for _, msg := range messages {
-				if msg.Type == "FILTERED_MESSAGE" {
-					found = true
-					break
-				}
-			}
-			assert.True(t, found)
+			messages, err = service.GetSyncMessages(session.ID, filtered.Cursor)
+			require.NoError(t, err)
+			assert.Empty(t, messages)
 		})
 
 		t.Run("SendMessageToInvalidSession", func(t *testing.T) {
-			messageData := map[string]interface{}{"test": "data"}
-			_, err := service.SendSyncMessage("invalid-session", "TEST", messageData)
-			assert.Error(t, err)
+			sealed, err := mobile.Seal("TEST", map[string]interface{}{"test": "data"})
+			require.NoError(t, err)
+			sealed.SessionID = "invalid-session"
+			_, err = service.SendSyncMessage(sealed)
+			assert.ErrorIs(t, err, ErrSyncSessionNotFound)
 		})
 	})
 
 	t.Run("WalletDataSynchronization", func(t *testing.T) {
-		// Create a session first
-		session, err := service.CreateSyncSession("mobile-sync", "browser-sync")
-		require.NoError(t, err)
+		session, mobile, browser := pairSyncDevices(t, service, "mobile-sync", "browser-sync")
 
 		t.Run("SyncWalletData", func(t *testing.T) {
 			walletData := &WalletSyncData{
@@ -389,12 +332,13 @@ func TestWalletSyncService(t *testing.T) {
 				SyncVersion:  "1.0.0",
 			}
 
-			err := service.SyncWalletData(session.ID, walletData)
-
+			sealed, err := mobile.SealWalletData(walletData)
+			require.NoError(t, err)
+			_, err = service.SendSyncMessage(sealed)
 			require.NoError(t, err)
 
 			// Verify that a sync message was created
-			messages, err := service.GetSyncMessages(session.ID, time.Time{})
+			messages, err := service.GetSyncMessages(session.ID, 0)
 			require.NoError(t, err)
 
 			// Find the wallet sync message
@@ -409,8 +353,10 @@ func TestWalletSyncService(t *testing.T) {
 			require.NotNil(t, syncMessage)
 			assert.Equal(t, "WALLET_SYNC", syncMessage.Type)
 			assert.Equal(t, session.ID, syncMessage.SessionID)
-			assert.NotNil(t, syncMessage.Data["accounts"])
-			assert.Equal(t, "account-1", syncMessage.Data["current_account"])
+			data, err := browser.Open(syncMessage)
+			require.NoError(t, err)
+			assert.NotNil(t, data["accounts"])
+			assert.Equal(t, "account-1", data["current_account"])
 		})
 
 		t.Run("SyncWalletDataToInvalidSession", func(t *testing.T) {
@@ -423,14 +369,17 @@ func TestWalletSyncService(t *testing.T) {
 				SyncVersion:    "1.0.0",
 			}
 
-			err := service.SyncWalletData("invalid-session", walletData)
-			assert.Error(t, err)
+			sealed, err := mobile.SealWalletData(walletData)
+			require.NoError(t, err)
+			sealed.SessionID = "invalid-session"
+			_, err = service.SendSyncMessage(sealed)
+			assert.ErrorIs(t, err, ErrSyncSessionNotFound)
 		})
 	})
 
 	t.Run("SessionLifecycleManagement", func(t *testing.T) {
 		t.Run("CloseSyncSession", func(t *testing.T) {
-			session, err := service.CreateSyncSession("mobile-close", "browser-close")
+			session, _, err := service.CreateSyncSession("mobile-close", "browser-close")
 			require.NoError(t, err)
 
 			err = service.CloseSyncSession(session.ID)
@@ -441,35 +390,40 @@ func TestWalletSyncService(t *testing.T) {
 			closedSession, err := service.GetSyncSession(session.ID)
 			require.NoError(t, err)
 			assert.Equal(t, "closed", closedSession.Status)
+
+			_, err = service.PostHandshakeKey(session.ID, "mobile-close", bytes.Repeat([]byte{9}, 32), bytes.Repeat([]byte{9}, 32))
+			assert.ErrorIs(t, err, ErrSyncSessionClosed)
 		})
 
 		t.Run("CloseInvalidSession", func(t *testing.T) {
 			err := service.CloseSyncSession("invalid-session-id")
-			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrSyncSessionNotFound)
 		})
 
 		t.Run("CleanupExpiredSessions", func(t *testing.T) {
-			// Create a session and manually expire it
-			session, err := service.CreateSyncSession("mobile-expire", "browser-expire")
+			// A service of its own, whose clock can move a day on
+			expiring := NewWalletSyncService()
+			session, _, err := expiring.CreateSyncSession("mobile-expire", "browser-expire")
 			require.NoError(t, err)
+			expiring.now = func() time.Time { return time.Now().Add(25 * time.Hour) }
 
-			// Manually set expiration to past
-			session.ExpiresAt = time.Now().Add(-1 * time.Hour)
+			expired, err := expiring.GetSyncSession(session.ID)
+			assert.ErrorIs(t, err, ErrSyncSessionExpired)
+			assert.Equal(t, "expired", expired.Status)
 
 			// Run cleanup
-			cleanedCount := service.CleanupExpiredSessions()
+			cleanedCount := expiring.CleanupExpiredSessions()
 
-			assert.GreaterOrEqual(t, cleanedCount, 1)
+			assert.Equal(t, 1, cleanedCount)
 
 			// Verify session is no longer accessible
-			_, err = service.GetSyncSession(session.ID)
-			assert.Error(t, err)
+			_, err = expiring.GetSyncSession(session.ID)
+			assert.ErrorIs(t, err, ErrSyncSessionNotFound)
 		})
 	})
 
 	t.Run("ConcurrentOperations", func(t *testing.T) {
-		session, err := service.CreateSyncSession("mobile-concurrent", "browser-concurrent")
-		require.NoError(t, err)
+		session, mobile, _ := pairSyncDevices(t, service, "mobile-concurrent", "browser-concurrent")
 
 		t.Run("ConcurrentMessageSending", func(t *testing.T) {
 			// Send multiple messages concurrently
@@ -481,7 +435,9 @@ func TestWalletSyncService(t *testing.T) {
 						"index": index,
 						"data":  "concurrent message",
 					}
-					_, err := service.SendSyncMessage(session.ID, "CONCURRENT_MESSAGE", messageData)
+					sealed, err := mobile.Seal("CONCURRENT_MESSAGE", messageData)
+					assert.NoError(t, err)
+					_, err = service.SendSyncMessage(sealed)
 					assert.NoError(t, err)
 					done <- true
 				}(i)
@@ -493,7 +449,7 @@ func TestWalletSyncService(t *testing.T) {
 			}
 
 			// Verify all messages were received
-			messages, err := service.GetSyncMessages(session.ID, time.Time{})
+			messages, err := service.GetSyncMessages(session.ID, 0)
 			require.NoError(t, err)
 
 			concurrentMessages := 0
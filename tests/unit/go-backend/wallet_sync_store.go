@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+)
+
+// Session store
+//
+// Sessions are spread over shards by ID, and a shard's lock only guards
+// its map, so finding a session never waits on work in another. Each
+// session has a lock of its own for changes, and after every change
+// publishes a copy of itself, as its log publishes its delivered messages,
+// through an atomic pointer. Reads take the shard's read lock for the
+// lookup and none after it, so they neither wait on senders nor hold them
+// up. Locks are taken shard before session, never the other way round.
+
+const syncShardCount = 64
+
+type syncShard struct {
+	mu      sync.RWMutex
+	entries map[string]*syncEntry
+}
+
+// syncEntry holds one session and everything that hangs off it.
+type syncEntry struct {
+	mu          sync.Mutex
+	session     *SyncSession // the working copy, guarded by mu
+	log         *syncLog
+	pairing     *syncPairing
+	tokens      map[string][sha256.Size]byte // hashed device tokens, by device ID
+	subscribers map[*SyncSubscription]struct{}
+	removed     bool // cleaned up; the entry is gone from its shard
+
+	snapshot atomic.Pointer[SyncSession] // session as of the last change
+}
+
+func newSyncEntry(session *SyncSession) *syncEntry {
+	e := &syncEntry{
+		session:     session,
+		log:         newSyncLog(),
+		tokens:      make(map[string][sha256.Size]byte),
+		subscribers: make(map[*SyncSubscription]struct{}),
+	}
+	e.snapshot.Store(session.clone())
+	return e
+}
+
+var syncShardSeed = maphash.MakeSeed()
+
+func (s *WalletSyncService) shard(sessionID string) *syncShard {
+	return &s.shards[maphash.String(syncShardSeed, sessionID)%syncShardCount]
+}
+
+func (s *WalletSyncService) lookup(sessionID string) (*syncEntry, error) {
+	shard := s.shard(sessionID)
+	shard.mu.RLock()
+	e, ok := shard.entries[sessionID]
+	shard.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSyncSessionNotFound, sessionID)
+	}
+	return e, nil
+}
+
+// view returns the session as last published, with ErrSyncSessionExpired
+// past its expiry. It takes no session lock.
+func (s *WalletSyncService) view(sessionID string) (*syncEntry, *SyncSession, error) {
+	e, err := s.lookup(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	session := e.snapshot.Load()
+	if s.now().After(session.ExpiresAt) {
+		return e, session, fmt.Errorf("%w: %s", ErrSyncSessionExpired, sessionID)
+	}
+	return e, session, nil
+}
+
+// update runs fn on the session with its lock held, provided it is open
+// for changes, then publishes the session and returns a copy of it.
+func (s *WalletSyncService) update(sessionID string, fn func(e *syncEntry) error) (*SyncSession, error) {
+	e, err := s.lookup(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case e.removed:
+		return nil, fmt.Errorf("%w: %s", ErrSyncSessionNotFound, sessionID)
+	case s.now().After(e.session.ExpiresAt):
+		return nil, fmt.Errorf("%w: %s", ErrSyncSessionExpired, sessionID)
+	case e.session.Status == SyncSessionClosed:
+		return nil, fmt.Errorf("%w: %s", ErrSyncSessionClosed, sessionID)
+	}
+	if err := fn(e); err != nil {
+		return nil, err
+	}
+	return e.publishSession(), nil
+}
+
+// publishSession makes the working copy of the session visible to readers
+// and returns a copy of it. The caller holds e.mu.
+func (e *syncEntry) publishSession() *SyncSession {
+	snapshot := e.session.clone()
+	e.snapshot.Store(snapshot)
+	return snapshot.clone()
+}
@@ -0,0 +1,280 @@
+package tests
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWalletSyncServiceStress runs many sessions at once, each with both
+// devices sending from several goroutines while a subscriber, a poller and
+// a session reader follow along. Run it with -race.
+func TestWalletSyncServiceStress(t *testing.T) {
+	const (
+		sessions  = 32
+		perDevice = 40
+		senders   = 4 // goroutines per device, so messages arrive out of order
+	)
+	service := NewWalletSyncService()
+
+	var wg sync.WaitGroup
+	var ids []string
+	for i := 0; i < sessions; i++ {
+		paired := pairSync(t, service, fmt.Sprintf("mobile-%d", i), fmt.Sprintf("browser-%d", i))
+		session, mobile, browser := paired.session, paired.mobile, paired.browser
+		ids = append(ids, session.ID)
+		sub, err := service.Subscribe(session.ID, session.BrowserInstanceID, "")
+		require.NoError(t, err)
+
+		for _, channel := range []*SyncChannel{mobile, browser} {
+			for g := 0; g < senders; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for n := 0; n < perDevice/senders; n++ {
+						sealed, err := channel.Seal("STRESS", map[string]interface{}{"n": n})
+						if !assert.NoError(t, err) {
+							return
+						}
+						_, err = service.SendSyncMessage(sealed)
+						assert.NoError(t, err)
+					}
+				}()
+			}
+		}
+
+		// The browser opens the mobile's messages as pushed; Open refuses
+		// any out of order
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sub.Close()
+			for got := 0; got < perDevice; got++ {
+				select {
+				case msg, ok := <-sub.Messages():
+					if !assert.True(t, ok, "subscription ended: %v", sub.Err()) {
+						return
+					}
+					_, err := browser.Open(msg)
+					assert.NoError(t, err)
+					assert.NoError(t, service.AckSyncMessages(session.ID, session.BrowserInstanceID, paired.browserToken, msg.Cursor))
+				case <-time.After(10 * time.Second):
+					t.Errorf("session %s: %d of %d messages pushed", session.ID, got, perDevice)
+					return
+				}
+			}
+		}()
+
+		// A poller pages through the log by cursor
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var cursor uint64
+			for deadline := time.Now().Add(10 * time.Second); cursor < 2*perDevice; {
+				messages, err := service.GetSyncMessages(session.ID, cursor)
+				if !assert.NoError(t, err) {
+					return
+				}
+				for _, msg := range messages {
+					assert.Equal(t, cursor+1, msg.Cursor)
+					cursor = msg.Cursor
+				}
+				if len(messages) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				if time.Now().After(deadline) {
+					t.Errorf("session %s: read %d of %d messages", session.ID, cursor, 2*perDevice)
+					return
+				}
+			}
+		}()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				read, err := service.GetSyncSession(session.ID)
+				if assert.NoError(t, err) {
+					assert.True(t, read.Paired())
+				}
+			}
+		}()
+	}
+
+	// Sessions come and go in the same shards meanwhile
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 50; n++ {
+			session, _, err := service.CreateSyncSession("mobile-churn", "browser-churn")
+			if assert.NoError(t, err) {
+				assert.NoError(t, service.CloseSyncSession(session.ID))
+			}
+			service.CleanupExpiredSessions()
+		}
+	}()
+	wg.Wait()
+
+	for _, id := range ids {
+		messages, err := service.GetSyncMessages(id, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2*perDevice)
+		last := map[string]uint64{}
+		for i, msg := range messages {
+			assert.Equal(t, uint64(i+1), msg.Cursor)
+			assert.Equal(t, last[msg.Sender]+1, msg.Sequence)
+			last[msg.Sender] = msg.Sequence
+		}
+	}
+}
+
+// TestWalletSyncServiceCloseWhileSending closes sessions under senders and
+// subscribers: every send either lands or is refused as closed, and every
+// subscription ends.
+func TestWalletSyncServiceCloseWhileSending(t *testing.T) {
+	service := NewWalletSyncService()
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		session, mobile, _ := pairSyncDevices(t, service, "mobile", "browser")
+		sub, err := service.Subscribe(session.ID, "browser", "")
+		require.NoError(t, err)
+
+		var sent atomic.Int64
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 20; n++ {
+				sealed, err := mobile.Seal("RACE", map[string]interface{}{})
+				if !assert.NoError(t, err) {
+					return
+				}
+				if _, err := service.SendSyncMessage(sealed); err != nil {
+					assert.ErrorIs(t, err, ErrSyncSessionClosed)
+					return
+				}
+				sent.Add(1)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, service.CloseSyncSession(session.ID))
+		}()
+		go func() {
+			defer wg.Done()
+			for range sub.Messages() {
+			}
+			assert.ErrorIs(t, sub.Err(), ErrSyncSessionClosed)
+		}()
+		wg.Wait()
+
+		messages, err := service.GetSyncMessages(session.ID, 0)
+		require.NoError(t, err)
+		assert.Len(t, messages, int(sent.Load()))
+	}
+}
+
+func BenchmarkWalletSyncService(b *testing.B) {
+	// pairedSessions pairs n sessions up front; the benchmarks share them
+	// out among their goroutines.
+	pairedSessions := func(b *testing.B, service *WalletSyncService, n int) ([]*SyncSession, []*SyncChannel) {
+		var sessions []*SyncSession
+		var channels []*SyncChannel
+		for i := 0; i < n; i++ {
+			session, mobile, _ := pairSyncDevices(b, service, fmt.Sprintf("mobile-%d", i), fmt.Sprintf("browser-%d", i))
+			sessions = append(sessions, session)
+			channels = append(channels, mobile)
+		}
+		return sessions, channels
+	}
+
+	send := func(service *WalletSyncService, channel *SyncChannel) error {
+		sealed, err := channel.Seal("BENCH", map[string]interface{}{"balance": "1000000"})
+		if err != nil {
+			return err
+		}
+		_, err = service.SendSyncMessage(sealed)
+		return err
+	}
+
+	b.Run("Send", func(b *testing.B) {
+		service := NewWalletSyncService()
+		_, channels := pairedSessions(b, service, 1)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := send(service, channels[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// A channel is one device, so each goroutine has a session of its own
+	b.Run("SendParallelSessions", func(b *testing.B) {
+		service := NewWalletSyncService()
+		_, channels := pairedSessions(b, service, runtime.GOMAXPROCS(0))
+		var next atomic.Int64
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			channel := channels[next.Add(1)-1]
+			for pb.Next() {
+				if err := send(service, channel); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("ReadWhileSending", func(b *testing.B) {
+		service := NewWalletSyncService()
+		sessions, channels := pairedSessions(b, service, 1)
+		for i := 0; i < 100; i++ {
+			sealed, err := channels[0].Seal("BENCH", map[string]interface{}{})
+			require.NoError(b, err)
+			_, err = service.SendSyncMessage(sealed)
+			require.NoError(b, err)
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				sealed, _ := channels[0].Seal("BENCH", map[string]interface{}{})
+				service.SendSyncMessage(sealed)
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			// Each reader polls for what is new since its last read
+			var cursor uint64
+			for pb.Next() {
+				messages, err := service.GetSyncMessages(sessions[0].ID, cursor)
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				if len(messages) > 0 {
+					cursor = messages[len(messages)-1].Cursor
+				}
+				if _, err := service.GetSyncSession(sessions[0].ID); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
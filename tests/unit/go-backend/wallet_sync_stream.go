@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+)
+
+const defaultSyncStreamBuffer = 64
+
+var (
+	ErrUnknownSyncMessage = errors.New("unknown sync message ID")
+	ErrSyncStreamLagging  = errors.New("sync stream fell too far behind")
+)
+
+// SyncSubscription pushes a device the messages its peer sends, in the
+// order the service stored them. Messages is closed when the session ends
+// or the subscriber falls more than the stream buffer behind; Err then says
+// which. A dropped subscriber resumes from the last MessageID it got.
+type SyncSubscription struct {
+	entry    *syncEntry
+	deviceID string
+	messages chan *SyncMessage
+	err      error // set before messages is closed
+}
+
+func (sub *SyncSubscription) Messages() <-chan *SyncMessage {
+	return sub.messages
+}
+
+// Err is why Messages was closed: ErrSyncSessionClosed or
+// ErrSyncSessionExpired when the session ended, ErrSyncStreamLagging when
+// the subscriber did not keep up, and nil after Close.
+func (sub *SyncSubscription) Err() error {
+	return sub.err
+}
+
+// Close stops the subscription.
+func (sub *SyncSubscription) Close() {
+	sub.entry.mu.Lock()
+	defer sub.entry.mu.Unlock()
+	sub.entry.unsubscribe(sub, nil)
+}
+
+// Subscribe streams deviceID the messages its peer sends from now on,
+// preceded by those delivered after the message with ID after or, if none
+// is given, after the last one the device acknowledged.
+func (s *WalletSyncService) Subscribe(sessionID, deviceID, after string) (*SyncSubscription, error) {
+	var sub *SyncSubscription
+	_, err := s.update(sessionID, func(e *syncEntry) error {
+		if deviceID != e.session.MobileDeviceID && deviceID != e.session.BrowserInstanceID {
+			return fmt.Errorf("%w: %s", ErrNotSyncParty, deviceID)
+		}
+		cursor := e.log.acked[deviceID]
+		if after != "" {
+			var err error
+			if cursor, err = e.log.cursorOf(after); err != nil {
+				return err
+			}
+		}
+
+		var backlog []*SyncMessage
+		for _, msg := range e.log.after(cursor) {
+			if msg.Sender != deviceID {
+				backlog = append(backlog, msg)
+			}
+		}
+		sub = &SyncSubscription{
+			entry:    e,
+			deviceID: deviceID,
+			messages: make(chan *SyncMessage, len(backlog)+s.streamBuffer),
+		}
+		for _, msg := range backlog {
+			copied := *msg
+			sub.messages <- &copied
+			e.log.streamed[deviceID] = max(e.log.streamed[deviceID], msg.Cursor)
+		}
+		e.subscribers[sub] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// publish pushes msg to the subscriptions of the sender's peer, dropping
+// those with no room left. The caller holds e.mu.
+func (e *syncEntry) publish(msg *SyncMessage) {
+	for sub := range e.subscribers {
+		if sub.deviceID == msg.Sender {
+			continue
+		}
+		copied := *msg
+		select {
+		case sub.messages <- &copied:
+			e.log.streamed[sub.deviceID] = max(e.log.streamed[sub.deviceID], msg.Cursor)
+		default:
+			e.unsubscribe(sub, ErrSyncStreamLagging)
+		}
+	}
+}
+
+// unsubscribe closes sub with err, once. The caller holds e.mu.
+func (e *syncEntry) unsubscribe(sub *SyncSubscription, err error) {
+	if _, ok := e.subscribers[sub]; !ok {
+		return
+	}
+	delete(e.subscribers, sub)
+	sub.err = err
+	close(sub.messages)
+}
+
+// unsubscribeAll closes every subscription with err. The caller holds e.mu.
+func (e *syncEntry) unsubscribeAll(err error) {
+	for sub := range e.subscribers {
+		e.unsubscribe(sub, err)
+	}
+}
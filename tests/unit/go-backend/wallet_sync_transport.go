@@ -0,0 +1,349 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Push delivery of sync messages
+//
+// Each device holds a WebSocket, or an SSE stream where WebSockets are
+// blocked, open on its session and gets its peer's messages as the service
+// stores them. Both transports send a heartbeat every Heartbeat so proxies
+// keep the connection open and clients notice a dead one, and both resume
+// after a given MessageID: the WebSocket from the after query parameter,
+// SSE from the Last-Event-ID header browsers send when they reconnect, and
+// both from the device's last acknowledgement when given neither. Devices
+// acknowledge messages by cursor with {"ack": cursor} frames on the
+// WebSocket, or by posting to /sync/{session}/ack, and present their device
+// token to do so: as a bearer token in the Authorization header, or in the
+// token query parameter of a WebSocket, which browsers open without custom
+// headers. The messages are ciphertext, so the device ID in the URL only
+// decides which direction a stream carries; following one needs no token.
+
+const (
+	defaultSyncHeartbeat    = 30 * time.Second
+	defaultSyncWriteTimeout = 10 * time.Second
+)
+
+var ErrSyncStreamRefused = errors.New("sync stream refused")
+
+// syncAck is the frame a device sends over its WebSocket to acknowledge
+// messages.
+type syncAck struct {
+	Ack uint64 `json:"ack"`
+}
+
+type SyncStreamConfig struct {
+	Heartbeat    time.Duration
+	WriteTimeout time.Duration
+}
+
+// SyncStreamServer serves
+//
+//	GET /sync/{session}/ws?device=ID&after=MessageID&token=T
+//	GET /sync/{session}/events?device=ID&after=MessageID
+//	POST /sync/{session}/ack?device=ID&cursor=N
+type SyncStreamServer struct {
+	service  *WalletSyncService
+	config   SyncStreamConfig
+	upgrader websocket.Upgrader
+	mux      *http.ServeMux
+}
+
+func NewSyncStreamServer(service *WalletSyncService, config SyncStreamConfig) *SyncStreamServer {
+	if config.Heartbeat == 0 {
+		config.Heartbeat = defaultSyncHeartbeat
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = defaultSyncWriteTimeout
+	}
+	srv := &SyncStreamServer{service: service, config: config, mux: http.NewServeMux()}
+	srv.mux.HandleFunc("GET /sync/{session}/ws", srv.serveWebSocket)
+	srv.mux.HandleFunc("GET /sync/{session}/events", srv.serveEvents)
+	srv.mux.HandleFunc("POST /sync/{session}/ack", srv.serveAck)
+	return srv
+}
+
+func (srv *SyncStreamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.mux.ServeHTTP(w, r)
+}
+
+func (srv *SyncStreamServer) subscribe(w http.ResponseWriter, r *http.Request, after string) (*SyncSubscription, bool) {
+	sub, err := srv.service.Subscribe(r.PathValue("session"), r.URL.Query().Get("device"), after)
+	if err != nil {
+		http.Error(w, err.Error(), syncHTTPStatus(err))
+		return nil, false
+	}
+	return sub, true
+}
+
+func syncHTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrSyncSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrSyncSessionClosed), errors.Is(err, ErrSyncSessionExpired):
+		return http.StatusGone
+	case errors.Is(err, ErrSyncDeviceUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrNotSyncParty):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnknownSyncMessage), errors.Is(err, ErrInvalidSyncMessage):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// syncDeviceToken returns the device token a request presents.
+func syncDeviceToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+// syncCloseCode tells a WebSocket client whether to reconnect: a normal
+// closure means the session is over, a policy violation that the client's
+// acknowledgements were refused, anything else that it should resume.
+func syncCloseCode(err error) int {
+	switch {
+	case errors.Is(err, ErrSyncStreamLagging):
+		return websocket.CloseTryAgainLater
+	case errors.Is(err, ErrSyncDeviceUnauthorized), errors.Is(err, ErrUnknownSyncMessage):
+		return websocket.ClosePolicyViolation
+	default:
+		return websocket.CloseNormalClosure
+	}
+}
+
+func (srv *SyncStreamServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	sub, ok := srv.subscribe(w, r, r.URL.Query().Get("after"))
+	if !ok {
+		return
+	}
+	defer sub.Close()
+	conn, err := srv.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has replied
+	}
+	defer conn.Close()
+
+	// The client sends acknowledgements, pongs and close frames; reading
+	// them also notices when it has gone.
+	sessionID, deviceID, token := r.PathValue("session"), r.URL.Query().Get("device"), syncDeviceToken(r)
+	gone := make(chan struct{})
+	var ackErr error // set before gone closes
+	conn.SetReadDeadline(time.Now().Add(2 * srv.config.Heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * srv.config.Heartbeat))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			var ack syncAck
+			if err := conn.ReadJSON(&ack); err != nil {
+				return
+			}
+			if ackErr = srv.service.AckSyncMessages(sessionID, deviceID, token, ack.Ack); ackErr != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(srv.config.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				reason := websocket.FormatCloseMessage(syncCloseCode(sub.Err()), fmt.Sprint(sub.Err()))
+				conn.WriteControl(websocket.CloseMessage, reason, time.Now().Add(srv.config.WriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(srv.config.WriteTimeout))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(srv.config.WriteTimeout)); err != nil {
+				return
+			}
+		case <-gone:
+			if ackErr != nil {
+				reason := websocket.FormatCloseMessage(syncCloseCode(ackErr), ackErr.Error())
+				conn.WriteControl(websocket.CloseMessage, reason, time.Now().Add(srv.config.WriteTimeout))
+			}
+			return
+		}
+	}
+}
+
+func (srv *SyncStreamServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	after := r.Header.Get("Last-Event-ID")
+	if after == "" {
+		after = r.URL.Query().Get("after")
+	}
+	sub, ok := srv.subscribe(w, r, after)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	// Browsers reconnect after retry milliseconds on their own
+	rc.SetWriteDeadline(time.Now().Add(srv.config.WriteTimeout))
+	fmt.Fprintf(w, "retry: %d\n\n", srv.config.Heartbeat.Milliseconds())
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(srv.config.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		var frame string
+		closing := false
+		select {
+		case msg, ok := <-sub.Messages():
+			if !ok {
+				frame, closing = fmt.Sprintf("event: close\ndata: %v\n\n", sub.Err()), true
+				break
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return
+			}
+			frame = fmt.Sprintf("id: %s\nevent: message\ndata: %s\n\n", msg.MessageID, data)
+		case <-heartbeat.C:
+			frame = ": heartbeat\n\n"
+		case <-r.Context().Done():
+			return
+		}
+		// The deadline covers the write, not the wait for something to write
+		rc.SetWriteDeadline(time.Now().Add(srv.config.WriteTimeout))
+		fmt.Fprint(w, frame)
+		if rc.Flush() != nil || closing {
+			return
+		}
+	}
+}
+
+func (srv *SyncStreamServer) serveAck(w http.ResponseWriter, r *http.Request) {
+	cursor, err := strconv.ParseUint(r.URL.Query().Get("cursor"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err := srv.service.AckSyncMessages(r.PathValue("session"), r.URL.Query().Get("device"), syncDeviceToken(r), cursor); err != nil {
+		http.Error(w, err.Error(), syncHTTPStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SyncStreamClient follows a session's WebSocket stream for one device,
+// reconnecting after dropped connections and resuming after the last
+// message it got, so fn sees every message once and in order. It
+// acknowledges each message once fn returns, so a client started afresh
+// carries on after the last message an earlier one handled.
+type SyncStreamClient struct {
+	URL       string // the stream server, http:// or https://
+	SessionID string
+	DeviceID  string
+	Token     string // the device token, for acknowledging messages
+
+	// LastMessageID is where the next connection resumes. Run keeps it
+	// current; when empty, the stream resumes after the last acknowledged
+	// message.
+	LastMessageID string
+
+	// Backoff is the pause before reconnecting, and Timeout how long a
+	// connection may go without a message or heartbeat.
+	Backoff time.Duration
+	Timeout time.Duration
+}
+
+// Run calls fn with each message until the session ends, returning
+// ErrSyncSessionClosed, or ctx is done, returning its error. Refused
+// subscriptions, such as to unknown sessions, and refused acknowledgements
+// are returned at once.
+func (c *SyncStreamClient) Run(ctx context.Context, fn func(*SyncMessage)) error {
+	backoff, timeout := c.Backoff, c.Timeout
+	if backoff == 0 {
+		backoff = time.Second
+	}
+	if timeout == 0 {
+		timeout = 3 * defaultSyncHeartbeat
+	}
+	for {
+		err := c.follow(ctx, timeout, fn)
+		var closeErr *websocket.CloseError
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure:
+			return fmt.Errorf("%w: %s", ErrSyncSessionClosed, closeErr.Text)
+		case errors.As(err, &closeErr) && closeErr.Code == websocket.ClosePolicyViolation:
+			return fmt.Errorf("%w: %s", ErrSyncStreamRefused, closeErr.Text)
+		case errors.Is(err, ErrSyncStreamRefused):
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// follow holds one connection until it fails.
+func (c *SyncStreamClient) follow(ctx context.Context, timeout time.Duration, fn func(*SyncMessage)) error {
+	query := url.Values{"device": {c.DeviceID}}
+	if c.LastMessageID != "" {
+		query.Set("after", c.LastMessageID)
+	}
+	endpoint := "ws" + strings.TrimPrefix(c.URL, "http") + "/sync/" + url.PathEscape(c.SessionID) + "/ws?" + query.Encode()
+
+	header := http.Header{"Authorization": {"Bearer " + c.Token}}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return fmt.Errorf("%w: %s", ErrSyncStreamRefused, resp.Status)
+		}
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(defaultSyncWriteTimeout))
+	})
+	for {
+		var msg SyncMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		c.LastMessageID = msg.MessageID
+		fn(&msg)
+		conn.SetWriteDeadline(time.Now().Add(defaultSyncWriteTimeout))
+		if err := conn.WriteJSON(syncAck{Ack: msg.Cursor}); err != nil {
+			return err
+		}
+	}
+}
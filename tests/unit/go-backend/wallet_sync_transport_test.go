@@ -0,0 +1,402 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncStreams(t *testing.T) {
+	service := NewWalletSyncService()
+	server := httptest.NewServer(NewSyncStreamServer(service, SyncStreamConfig{Heartbeat: 50 * time.Millisecond}))
+	defer server.Close()
+
+	dial := func(t *testing.T, sessionID, deviceID, after string) *websocket.Conn {
+		endpoint := "ws" + strings.TrimPrefix(server.URL, "http") + "/sync/" + sessionID + "/ws?device=" + deviceID
+		if after != "" {
+			endpoint += "&after=" + after
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	receive := func(t *testing.T, conn *websocket.Conn) *SyncMessage {
+		var msg SyncMessage
+		require.NoError(t, conn.ReadJSON(&msg))
+		return &msg
+	}
+	send := func(t *testing.T, channel *SyncChannel, msgType string) *SyncMessage {
+		sealed, err := channel.Seal(msgType, map[string]interface{}{"type": msgType})
+		require.NoError(t, err)
+		sent, err := service.SendSyncMessage(sealed)
+		require.NoError(t, err)
+		return sent
+	}
+
+	t.Run("FanOutToPeer", func(t *testing.T) {
+		session, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		mobileConn := dial(t, session.ID, "mobile", "")
+		browserConn := dial(t, session.ID, "browser", "")
+
+		sent := send(t, mobile, "WALLET_SYNC")
+		got := receive(t, browserConn)
+		assert.Equal(t, sent.MessageID, got.MessageID)
+		data, err := browser.Open(got)
+		require.NoError(t, err)
+		assert.Equal(t, "WALLET_SYNC", data["type"])
+
+		// The mobile's stream carries only what the browser sends
+		reply := send(t, browser, "ACK")
+		got = receive(t, mobileConn)
+		assert.Equal(t, reply.MessageID, got.MessageID)
+		_, err = mobile.Open(got)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		session, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		first := send(t, mobile, "FIRST")
+		send(t, browser, "ACK")
+		second := send(t, mobile, "SECOND")
+		third := send(t, mobile, "THIRD")
+
+		conn := dial(t, session.ID, "browser", first.MessageID)
+		assert.Equal(t, second.MessageID, receive(t, conn).MessageID)
+		assert.Equal(t, third.MessageID, receive(t, conn).MessageID)
+		fourth := send(t, mobile, "FOURTH")
+		assert.Equal(t, fourth.MessageID, receive(t, conn).MessageID)
+		for _, msg := range []*SyncMessage{first, second, third, fourth} {
+			_, err := browser.Open(msg)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("Heartbeat", func(t *testing.T) {
+		session, _, _ := pairSyncDevices(t, service, "mobile", "browser")
+		conn := dial(t, session.ID, "browser", "")
+		pinged := make(chan struct{}, 1)
+		conn.SetPingHandler(func(string) error {
+			select {
+			case pinged <- struct{}{}:
+			default:
+			}
+			return nil
+		})
+		go conn.ReadMessage()
+		select {
+		case <-pinged:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no heartbeat")
+		}
+	})
+
+	t.Run("SessionClosed", func(t *testing.T) {
+		session, _, _ := pairSyncDevices(t, service, "mobile", "browser")
+		conn := dial(t, session.ID, "browser", "")
+		require.NoError(t, service.CloseSyncSession(session.ID))
+
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "got %v", err)
+
+		resp, err := http.Get(server.URL + "/sync/" + session.ID + "/events?device=browser")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusGone, resp.StatusCode)
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		session, _, _ := pairSyncDevices(t, service, "mobile", "browser")
+		for path, status := range map[string]int{
+			"/sync/missing/events?device=browser":                     http.StatusNotFound,
+			"/sync/" + session.ID + "/events?device=someone":          http.StatusForbidden,
+			"/sync/" + session.ID + "/events?device=browser&after=no": http.StatusBadRequest,
+			"/sync/" + session.ID + "/ws?device=someone":              http.StatusForbidden,
+		} {
+			resp, err := http.Get(server.URL + path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, path)
+		}
+	})
+
+	t.Run("ServerSentEvents", func(t *testing.T) {
+		session, mobile, browser := pairSyncDevices(t, service, "mobile", "browser")
+		first := send(t, mobile, "FIRST")
+		second := send(t, mobile, "SECOND")
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/sync/"+session.ID+"/events?device=browser", nil)
+		require.NoError(t, err)
+		req.Header.Set("Last-Event-ID", first.MessageID)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		// event reads up to the next blank line
+		lines := bufio.NewScanner(resp.Body)
+		event := func() []string {
+			var fields []string
+			for lines.Scan() && lines.Text() != "" {
+				fields = append(fields, lines.Text())
+			}
+			return fields
+		}
+		assert.Equal(t, []string{"retry: 50"}, event())
+
+		decode := func(fields []string) *SyncMessage {
+			require.Len(t, fields, 3)
+			assert.Equal(t, "event: message", fields[1])
+			var msg SyncMessage
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(fields[2], "data: ")), &msg))
+			assert.Equal(t, "id: "+msg.MessageID, fields[0])
+			return &msg
+		}
+		got := decode(event())
+		assert.Equal(t, second.MessageID, got.MessageID)
+		data, err := browser.Open(got)
+		require.NoError(t, err)
+		assert.Equal(t, "SECOND", data["type"])
+
+		assert.Equal(t, []string{": heartbeat"}, event())
+		third := send(t, mobile, "THIRD")
+		for {
+			fields := event()
+			if len(fields) == 1 && fields[0] == ": heartbeat" {
+				continue
+			}
+			assert.Equal(t, third.MessageID, decode(fields).MessageID)
+			break
+		}
+
+		require.NoError(t, service.CloseSyncSession(session.ID))
+		for {
+			fields := event()
+			if len(fields) == 1 && fields[0] == ": heartbeat" {
+				continue
+			}
+			assert.Equal(t, []string{"event: close", "data: " + ErrSyncSessionClosed.Error()}, fields)
+			break
+		}
+	})
+
+	t.Run("Lagging", func(t *testing.T) {
+		lagging := NewWalletSyncService()
+		lagging.streamBuffer = 2
+		session, mobile, _ := pairSyncDevices(t, lagging, "mobile", "browser")
+		sub, err := lagging.Subscribe(session.ID, "browser", "")
+		require.NoError(t, err)
+
+		var sent []*SyncMessage
+		for i := 0; i < 3; i++ {
+			sealed, err := mobile.Seal("WALLET_SYNC", map[string]interface{}{"n": i})
+			require.NoError(t, err)
+			msg, err := lagging.SendSyncMessage(sealed)
+			require.NoError(t, err)
+			sent = append(sent, msg)
+		}
+		var got []string
+		for msg := range sub.Messages() {
+			got = append(got, msg.MessageID)
+		}
+		assert.Equal(t, []string{sent[0].MessageID, sent[1].MessageID}, got)
+		assert.ErrorIs(t, sub.Err(), ErrSyncStreamLagging)
+		assert.Equal(t, websocket.CloseTryAgainLater, syncCloseCode(sub.Err()))
+
+		// Resuming picks up where the dropped subscription stopped
+		resumed, err := lagging.Subscribe(session.ID, "browser", got[len(got)-1])
+		require.NoError(t, err)
+		defer resumed.Close()
+		assert.Equal(t, sent[2].MessageID, (<-resumed.Messages()).MessageID)
+	})
+
+	t.Run("ClientReconnects", func(t *testing.T) {
+		paired := pairSync(t, service, "mobile", "browser")
+		session, mobile, browser := paired.session, paired.mobile, paired.browser
+		before := send(t, mobile, "BEFORE")
+		_, err := browser.Open(before)
+		require.NoError(t, err)
+		client := &SyncStreamClient{
+			URL: server.URL, SessionID: session.ID, DeviceID: "browser", Token: paired.browserToken,
+			LastMessageID: before.MessageID, Backoff: 10 * time.Millisecond,
+		}
+		received := make(chan *SyncMessage, 16)
+		done := make(chan error, 1)
+		go func() {
+			done <- client.Run(context.Background(), func(msg *SyncMessage) { received <- msg })
+		}()
+
+		next := func(t *testing.T) *SyncMessage {
+			select {
+			case msg := <-received:
+				return msg
+			case <-time.After(5 * time.Second):
+				t.Fatal("no message")
+				return nil
+			}
+		}
+		first := send(t, mobile, "FIRST")
+		assert.Equal(t, first.MessageID, next(t).MessageID)
+
+		// Drop the connection; what is sent meanwhile arrives once the
+		// client is back, once each and in order
+		server.CloseClientConnections()
+		var sent []*SyncMessage
+		for i := 0; i < 5; i++ {
+			sent = append(sent, send(t, mobile, fmt.Sprintf("MESSAGE_%d", i)))
+		}
+		for _, want := range sent {
+			got := next(t)
+			require.Equal(t, want.MessageID, got.MessageID)
+			_, err := browser.Open(got)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, sent[len(sent)-1].MessageID, client.LastMessageID)
+
+		require.NoError(t, service.CloseSyncSession(session.ID))
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, ErrSyncSessionClosed)
+		case <-time.After(5 * time.Second):
+			t.Fatal("client did not stop with the session")
+		}
+		assert.Empty(t, received)
+	})
+
+	t.Run("Acknowledged", func(t *testing.T) {
+		paired := pairSync(t, service, "mobile", "browser")
+		session, mobile, browser := paired.session, paired.mobile, paired.browser
+		for _, msgType := range []string{"FIRST", "SECOND"} {
+			send(t, mobile, msgType)
+		}
+
+		// A client resumes after what an earlier one acknowledged
+		run := func(ctx context.Context) <-chan *SyncMessage {
+			received := make(chan *SyncMessage, 16)
+			client := &SyncStreamClient{URL: server.URL, SessionID: session.ID, DeviceID: "browser", Token: paired.browserToken}
+			go client.Run(ctx, func(msg *SyncMessage) { received <- msg })
+			return received
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		received := run(ctx)
+		for _, want := range []string{"FIRST", "SECOND"} {
+			select {
+			case msg := <-received:
+				data, err := browser.Open(msg)
+				require.NoError(t, err)
+				assert.Equal(t, want, data["type"])
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s never arrived", want)
+			}
+		}
+		require.Eventually(t, func() bool {
+			sub, err := service.Subscribe(session.ID, "browser", "")
+			require.NoError(t, err)
+			defer sub.Close()
+			return len(sub.Messages()) == 0
+		}, 5*time.Second, 10*time.Millisecond, "both messages acknowledged")
+		cancel()
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		received = run(ctx)
+		third := send(t, mobile, "THIRD")
+		select {
+		case msg := <-received:
+			assert.Equal(t, third.MessageID, msg.MessageID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("THIRD never arrived")
+		}
+
+		// Acknowledging over HTTP, for SSE clients
+		ack := func(token, query string) int {
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/sync/"+session.ID+"/ack?"+query, nil)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+		assert.Equal(t, http.StatusNoContent, ack(paired.browserToken, fmt.Sprintf("device=browser&cursor=%d", third.Cursor)))
+		assert.Equal(t, http.StatusBadRequest, ack(paired.browserToken, "device=browser&cursor=last"))
+		assert.Equal(t, http.StatusBadRequest, ack(paired.browserToken, fmt.Sprintf("device=browser&cursor=%d", third.Cursor+1)))
+		assert.Equal(t, http.StatusForbidden, ack(paired.browserToken, "device=someone&cursor=1"))
+		assert.Equal(t, http.StatusUnauthorized, ack("", fmt.Sprintf("device=browser&cursor=%d", third.Cursor)))
+		assert.Equal(t, http.StatusUnauthorized, ack(paired.mobileToken, fmt.Sprintf("device=browser&cursor=%d", third.Cursor)))
+
+		// A stream that acknowledges without the device's token is refused
+		// rather than reconnected
+		send(t, mobile, "FOURTH")
+		client := &SyncStreamClient{URL: server.URL, SessionID: session.ID, DeviceID: "browser", Token: "guess", Backoff: 10 * time.Millisecond}
+		err := client.Run(context.Background(), func(*SyncMessage) {})
+		assert.ErrorIs(t, err, ErrSyncStreamRefused)
+		assert.Contains(t, err.Error(), ErrSyncDeviceUnauthorized.Error())
+	})
+
+	t.Run("IdleLongerThanWriteTimeout", func(t *testing.T) {
+		slow := httptest.NewServer(NewSyncStreamServer(service, SyncStreamConfig{Heartbeat: 300 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}))
+		defer slow.Close()
+		session, mobile, _ := pairSyncDevices(t, service, "mobile", "browser")
+
+		resp, err := http.Get(slow.URL + "/sync/" + session.ID + "/events?device=browser")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		lines := bufio.NewScanner(resp.Body)
+		event := func() []string {
+			var fields []string
+			for lines.Scan() && lines.Text() != "" {
+				fields = append(fields, lines.Text())
+			}
+			return fields
+		}
+		assert.Equal(t, []string{"retry: 300"}, event())
+
+		// Each wait between frames outlasts the write timeout
+		assert.Equal(t, []string{": heartbeat"}, event())
+		assert.Equal(t, []string{": heartbeat"}, event())
+		time.Sleep(200 * time.Millisecond)
+		sent := send(t, mobile, "LATE")
+		fields := event()
+		require.Len(t, fields, 3)
+		assert.Equal(t, "id: "+sent.MessageID, fields[0])
+	})
+
+	t.Run("ClientRefused", func(t *testing.T) {
+		client := &SyncStreamClient{URL: server.URL, SessionID: "missing", DeviceID: "browser"}
+		err := client.Run(context.Background(), func(*SyncMessage) {})
+		assert.ErrorIs(t, err, ErrSyncStreamRefused)
+		assert.Contains(t, err.Error(), fmt.Sprint(http.StatusNotFound))
+	})
+
+	t.Run("ClientCancelled", func(t *testing.T) {
+		session, _, _ := pairSyncDevices(t, service, "mobile", "browser")
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			client := &SyncStreamClient{URL: server.URL, SessionID: session.ID, DeviceID: "mobile"}
+			done <- client.Run(ctx, func(*SyncMessage) {})
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-done:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("client did not stop when cancelled")
+		}
+	})
+}
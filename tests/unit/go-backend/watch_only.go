@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWatchOnly is returned by any operation that needs the private key of a
+// wallet that was imported from an address or extended public key.
+var ErrWatchOnly = errors.New("wallet is watch-only and cannot sign")
+
+// DefaultGapLimit is the BIP-44 number of consecutive unused addresses after
+// which a wallet stops scanning a branch.
+const DefaultGapLimit = 20
+
+// SLIP-0132 versions select the script type of the derived addresses.
+var extendedPublicKeyVersions = map[string]func(codec BitcoinCodec) BitcoinCodec{
+	"0488b21e": func(codec BitcoinCodec) BitcoinCodec { return codec }, // xpub: P2PKH
+	"049d7cb2": func(codec BitcoinCodec) BitcoinCodec { // ypub: P2SH-P2WPKH
+		codec.NestedSegwit = true
+		return codec
+	},
+	"04b24746": func(codec BitcoinCodec) BitcoinCodec { // zpub: P2WPKH
+		codec.Segwit = true
+		return codec
+	},
+}
+
+// WatchOnlyAddresses holds the external (receive) and internal (change)
+// addresses derived from an account-level extended public key.
+type WatchOnlyAddresses struct {
+	Receive []string `json:"receive"`
+	Change  []string `json:"change"`
+}
+
+// isExtendedPublicKey reports whether s looks like an xpub, ypub or zpub.
+func isExtendedPublicKey(s string) bool {
+	return strings.HasPrefix(s, "xpub") || strings.HasPrefix(s, "ypub") || strings.HasPrefix(s, "zpub")
+}
+
+// parseWatchOnlyXpub decodes an account extended public key and returns a
+// variant of the chain's codec for the address type its version implies.
+func parseWatchOnlyXpub(codec AddressCodec, xpub string) (*ExtendedKey, AddressCodec, error) {
+	bitcoinCodec, ok := codec.(*BitcoinCodec)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: extended public keys need a Bitcoin-family chain", ErrInvalidExtendedKey)
+	}
+
+	account, version, err := ParseExtendedPublicKey(xpub)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	withScriptType, ok := extendedPublicKeyVersions[fmt.Sprintf("%x", version)]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown version %x", ErrInvalidExtendedKey, version)
+	}
+
+	variant := withScriptType(*bitcoinCodec)
+	if variant.Segwit && variant.SegwitHRP == "" {
+		return nil, nil, fmt.Errorf("%w: chain has no native segwit addresses", ErrInvalidExtendedKey)
+	}
+	return account, &variant, nil
+}
+
+// ScanExtendedPublicKey derives receive (m/.../0/i) and change (m/.../1/i)
+// addresses from an account node. Each branch stops once gapLimit
+// consecutive addresses are unused; a nil used reports every address as
+// unused, which yields exactly gapLimit addresses per branch.
+func ScanExtendedPublicKey(account *ExtendedKey, codec AddressCodec, gapLimit int, used func(address string) bool) (*WatchOnlyAddresses, error) {
+	if gapLimit <= 0 {
+		return nil, fmt.Errorf("gap limit must be positive, got %d", gapLimit)
+	}
+
+	scanBranch := func(branch uint32) ([]string, error) {
+		node, err := account.Neuter().Child(branch)
+		if err != nil {
+			return nil, err
+		}
+
+		var addresses []string
+		for i, gap := uint32(0), 0; gap < gapLimit; i++ {
+			child, err := node.Child(i)
+			if errors.Is(err, ErrInvalidChildKey) {
+				// BIP-32: skip to the next index
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			address, err := codec.EncodeAddress(child.PublicKey())
+			if err != nil {
+				return nil, err
+			}
+			addresses = append(addresses, address)
+
+			if used != nil && used(address) {
+				gap = 0
+			} else {
+				gap++
+			}
+		}
+		return addresses, nil
+	}
+
+	receive, err := scanBranch(0)
+	if err != nil {
+		return nil, err
+	}
+	change, err := scanBranch(1)
+	if err != nil {
+		return nil, err
+	}
+	return &WatchOnlyAddresses{Receive: receive, Change: change}, nil
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Account keys for "abandon ... about" from BIP-44, BIP-49 and BIP-84
+const (
+	bip44AccountXpub = "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj"
+	bip49AccountYpub = "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP"
+	bip84AccountZpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+)
+
+func TestWatchOnlyWallets(t *testing.T) {
+	testMnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	testPassphrase := "correct horse battery staple"
+
+	t.Run("AccountKeyMatchesMnemonic", func(t *testing.T) {
+		master, err := NewMasterKey(MnemonicToSeed(testMnemonic, ""), CurveSecp256k1)
+		require.NoError(t, err)
+		account, err := master.Derive("m/44'/0'/0'")
+		require.NoError(t, err)
+
+		assert.Equal(t, bip44AccountXpub, account.Neuter().String())
+
+		parsed, version, err := ParseExtendedPublicKey(bip44AccountXpub)
+		require.NoError(t, err)
+		assert.Equal(t, xpubVersion, version)
+		assert.Equal(t, account.PublicKey(), parsed.PublicKey())
+		assert.False(t, parsed.IsPrivate())
+
+		// Public derivation must agree with private derivation
+		fromPrivate, err := account.Derive("m/0/7")
+		require.NoError(t, err)
+		fromPublic, err := parsed.Derive("m/0/7")
+		require.NoError(t, err)
+		assert.Equal(t, fromPrivate.PublicKey(), fromPublic.PublicKey())
+
+		_, err = parsed.Child(hardenedOffset)
+		assert.ErrorIs(t, err, ErrHardenedFromPublic)
+	})
+
+	t.Run("ScriptTypesFromVersion", func(t *testing.T) {
+		tests := []struct {
+			xpub    string
+			receive string
+			change  string
+		}{
+			{bip44AccountXpub, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA", "1J3J6EvPrv8q6AC3VCjWV45Uf3nssNMRtH"},
+			{bip49AccountYpub, "37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf", "34K56kSjgUCUSD8GTtuF7c9Zzwokbs6uZ7"},
+			{bip84AccountZpub, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		}
+
+		for _, tt := range tests {
+			account, codec, err := parseWatchOnlyXpub(mustAddressCodec(t, "BTC"), tt.xpub)
+			require.NoError(t, err)
+
+			addresses, err := ScanExtendedPublicKey(account, codec, 3, nil)
+			require.NoError(t, err)
+			assert.Len(t, addresses.Receive, 3)
+			assert.Len(t, addresses.Change, 3)
+			assert.Equal(t, tt.receive, addresses.Receive[0])
+			assert.Equal(t, tt.change, addresses.Change[0])
+		}
+	})
+
+	t.Run("GapLimit", func(t *testing.T) {
+		account, codec, err := parseWatchOnlyXpub(mustAddressCodec(t, "BTC"), bip84AccountZpub)
+		require.NoError(t, err)
+		all, err := ScanExtendedPublicKey(account, codec, 10, nil)
+		require.NoError(t, err)
+
+		// A used address at index 4 extends the receive branch to 4+5 addresses
+		usedAddress := all.Receive[4]
+		addresses, err := ScanExtendedPublicKey(account, codec, 5, func(address string) bool {
+			return address == usedAddress
+		})
+		require.NoError(t, err)
+		assert.Equal(t, all.Receive[:10], addresses.Receive)
+		assert.Equal(t, all.Change[:5], addresses.Change)
+
+		_, err = ScanExtendedPublicKey(account, codec, 0, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("ImportXpub", func(t *testing.T) {
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+		userID := uuid.New()
+
+		wallet, err := service.ImportWatchOnly(userID, "Cold Storage", "BTC", bip84AccountZpub)
+		require.NoError(t, err)
+		assert.True(t, wallet.IsWatchOnly)
+		assert.Empty(t, wallet.EncryptedPrivateKey)
+		assert.Equal(t, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", wallet.Address)
+		assert.Equal(t, bip84AccountZpub, wallet.ExtendedPublicKey)
+
+		addresses, err := service.ScanWatchOnlyAddresses(wallet.ID, DefaultGapLimit, nil)
+		require.NoError(t, err)
+		assert.Len(t, addresses.Receive, DefaultGapLimit)
+		assert.Equal(t, wallet.Address, addresses.Receive[0])
+
+		// The chain comes from the wallet, so a stored network the registry
+		// does not know is refused
+		stray := *wallet
+		stray.ID, stray.Network, stray.Address = uuid.New(), "retired-net", "stray"
+		require.NoError(t, service.wallets.Create(&stray))
+		_, err = service.ScanWatchOnlyAddresses(stray.ID, DefaultGapLimit, nil)
+		assert.ErrorIs(t, err, ErrUnsupportedChain)
+
+		_, err = service.ImportWatchOnly(userID, "Cold Storage", "ETH", bip84AccountZpub)
+		assert.ErrorIs(t, err, ErrInvalidExtendedKey)
+	})
+
+	t.Run("ImportAddress", func(t *testing.T) {
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+		userID := uuid.New()
+
+		wallet, err := service.ImportWatchOnly(userID, "Treasury", "ETH", "0x9858EfFD232B4033E47d90003D41EC34EcaEda94")
+		require.NoError(t, err)
+		assert.True(t, wallet.IsWatchOnly)
+		assert.Empty(t, wallet.ExtendedPublicKey)
+
+		_, err = service.ImportWatchOnly(userID, "Treasury", "ETH", "0x9858efFD232B4033E47d90003D41EC34EcaEda94")
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+	})
+
+	t.Run("SigningFails", func(t *testing.T) {
+		service := NewMultichainWalletService(NewMemoryWalletRepository())
+		userID := uuid.New()
+
+		wallet, err := service.ImportWatchOnly(userID, "Treasury", "SOL", "HAgk14JpMQLgt6rVgv7cBQFJWFto5Dqxi472uT3DKpqk")
+		require.NoError(t, err)
+
+		_, err = service.DecryptPrivateKey(wallet, testPassphrase)
+		assert.ErrorIs(t, err, ErrWatchOnly)
+
+		_, err = service.ExportKeystore(wallet.ID, testPassphrase, "export password")
+		assert.ErrorIs(t, err, ErrWatchOnly)
+
+		// Watch-only wallets carry no key, so rotation skips them
+		assert.NoError(t, service.RotatePassphrase(userID, testPassphrase, "new passphrase"))
+	})
+}
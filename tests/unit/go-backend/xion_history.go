@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transaction types in the history.
+const (
+	XionTxTransfer  = "transfer"
+	XionTxSkillBurn = "skill_burn"
+	XionTxFaucet    = "faucet"
+	XionTxBurn      = "burn" // an NRN burn that pays for no skill
+)
+
+var ErrInvalidCursor = errors.New("invalid history cursor")
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+)
+
+// XionHistoryQuery selects a page of transaction history, newest first.
+// Empty fields match everything; Since is inclusive and Until exclusive.
+// Cursor continues from the NextCursor of the previous page.
+type XionHistoryQuery struct {
+	Address string    `json:"address"`
+	Types   []string  `json:"types,omitempty"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+	Cursor  string    `json:"cursor,omitempty"`
+	Limit   int       `json:"limit,omitempty"`
+}
+
+type XionHistoryPage struct {
+	Transactions []*XionTransactionResult `json:"transactions"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// xionHistory holds the transactions the service made or indexed, by hash.
+type xionHistory struct {
+	mu     sync.RWMutex
+	byHash map[string]*XionTransactionResult
+}
+
+func newXionHistory() *xionHistory {
+	return &xionHistory{byHash: make(map[string]*XionTransactionResult)}
+}
+
+// put records a copy of tx, keeping what an earlier record of the same
+// transaction knew and tx does not, such as who sponsored it.
+func (h *xionHistory) put(tx *XionTransactionResult) {
+	record := *tx
+	record.TxHash = strings.ToUpper(record.TxHash)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if known, ok := h.byHash[record.TxHash]; ok {
+		if record.Sponsor == "" {
+			record.Sponsor = known.Sponsor
+		}
+		if record.Timestamp.IsZero() {
+			record.Timestamp = known.Timestamp
+		}
+	}
+	h.byHash[record.TxHash] = &record
+}
+
+// query returns up to limit matches of q, or all of them for a limit of 0.
+func (h *xionHistory) query(q XionHistoryQuery, limit int) (*XionHistoryPage, error) {
+	var after *historyPosition
+	if q.Cursor != "" {
+		position, err := decodeHistoryCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &position
+	}
+
+	h.mu.RLock()
+	var matches []*XionTransactionResult
+	for _, tx := range h.byHash {
+		if q.matches(tx) && (after == nil || after.before(positionOf(tx))) {
+			copied := *tx
+			matches = append(matches, &copied)
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		return positionOf(matches[i]).before(positionOf(matches[j]))
+	})
+	page := &XionHistoryPage{Transactions: matches}
+	if limit > 0 && len(matches) > limit {
+		page.Transactions = matches[:limit]
+		page.NextCursor = positionOf(matches[limit-1]).cursor()
+	}
+	return page, nil
+}
+
+func (q XionHistoryQuery) matches(tx *XionTransactionResult) bool {
+	if q.Address != "" && tx.From != q.Address && tx.To != q.Address {
+		return false
+	}
+	if len(q.Types) > 0 {
+		found := false
+		for _, typ := range q.Types {
+			found = found || typ == tx.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	return !tx.Timestamp.Before(q.Since) && (q.Until.IsZero() || tx.Timestamp.Before(q.Until))
+}
+
+// historyPosition orders the history newest block first, then by hash.
+type historyPosition struct {
+	height int64
+	hash   string
+}
+
+func positionOf(tx *XionTransactionResult) historyPosition {
+	return historyPosition{height: tx.BlockHeight, hash: tx.TxHash}
+}
+
+func (p historyPosition) before(other historyPosition) bool {
+	if p.height != other.height {
+		return p.height > other.height
+	}
+	return p.hash < other.hash
+}
+
+// Cursors are opaque to clients; they name the last transaction served.
+func (p historyPosition) cursor() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.height, 10) + ":" + p.hash))
+}
+
+func decodeHistoryCursor(cursor string) (historyPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return historyPosition{}, ErrInvalidCursor
+	}
+	height, hash, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return historyPosition{}, ErrInvalidCursor
+	}
+	position := historyPosition{hash: hash}
+	if position.height, err = strconv.ParseInt(height, 10, 64); err != nil || position.height <= 0 {
+		return historyPosition{}, ErrInvalidCursor
+	}
+	return position, nil
+}
+
+// GetTransactionHistory returns every transaction sent from or to address,
+// newest first.
+func (s *XionIntegrationService) GetTransactionHistory(address string) ([]*XionTransactionResult, error) {
+	if err := s.ValidateAddress(address); err != nil {
+		return nil, err
+	}
+	page, err := s.history.query(XionHistoryQuery{Address: address}, 0)
+	if err != nil {
+		return nil, err
+	}
+	return page.Transactions, nil
+}
+
+// QueryTransactionHistory returns one page of history. It covers the
+// transactions this service made and, for addresses the Indexer watches,
+// everything the chain has on them as of the last sync.
+func (s *XionIntegrationService) QueryTransactionHistory(q XionHistoryQuery) (*XionHistoryPage, error) {
+	if q.Address != "" {
+		if err := s.ValidateAddress(q.Address); err != nil {
+			return nil, err
+		}
+	}
+	limit := q.Limit
+	switch {
+	case limit == 0:
+		limit = defaultHistoryPageSize
+	case limit < 0 || limit > maxHistoryPageSize:
+		return nil, fmt.Errorf("history page size must be between 1 and %d", maxHistoryPageSize)
+	}
+	return s.history.query(q, limit)
+}
@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXionHistoryQuery(t *testing.T) {
+	service := newTestnetXionService()
+	alice := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+	bob := "xion1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnpltc8j"
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Seven transactions of alice's, one a block, and one between others
+	types := []string{XionTxFaucet, XionTxTransfer, XionTxSkillBurn, XionTxTransfer, XionTxSkillBurn, XionTxTransfer, XionTxTransfer}
+	for i, typ := range types {
+		service.history.put(&XionTransactionResult{
+			TxHash:      fmt.Sprintf("%064X", i+1),
+			BlockHeight: int64(100 + i),
+			Success:     true,
+			From:        alice,
+			To:          bob,
+			Amount:      NewAmountFromInt64(int64(i+1)*1000, 6),
+			Denom:       "nrn",
+			Type:        typ,
+			Timestamp:   start.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	service.history.put(&XionTransactionResult{TxHash: fmt.Sprintf("%064X", 99), BlockHeight: 200, From: bob, To: "xion1other", Type: XionTxTransfer})
+
+	t.Run("ByAddress", func(t *testing.T) {
+		history, err := service.GetTransactionHistory(alice)
+		require.NoError(t, err)
+		require.Len(t, history, 7)
+		assert.Equal(t, int64(106), history[0].BlockHeight, "newest first")
+		assert.Equal(t, int64(100), history[6].BlockHeight)
+
+		history, err = service.GetTransactionHistory(bob)
+		require.NoError(t, err)
+		assert.Len(t, history, 8, "bob received alice's and sent one")
+
+		history, err = service.GetTransactionHistory(newTestXionAddress(t, 9))
+		require.NoError(t, err)
+		assert.Empty(t, history)
+
+		_, err = service.GetTransactionHistory("xion1nobody")
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+		_, err = service.QueryTransactionHistory(XionHistoryQuery{Address: "xion1nobody"})
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+	})
+
+	t.Run("Pages", func(t *testing.T) {
+		var heights []int64
+		query := XionHistoryQuery{Address: alice, Limit: 3}
+		for pages := 1; ; pages++ {
+			page, err := service.QueryTransactionHistory(query)
+			require.NoError(t, err)
+			for _, tx := range page.Transactions {
+				heights = append(heights, tx.BlockHeight)
+			}
+			if page.NextCursor == "" {
+				assert.Equal(t, 3, pages)
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		assert.Equal(t, []int64{106, 105, 104, 103, 102, 101, 100}, heights)
+	})
+
+	t.Run("NewTransactionsDoNotShiftPages", func(t *testing.T) {
+		first, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: 2})
+		require.NoError(t, err)
+
+		service.history.put(&XionTransactionResult{TxHash: fmt.Sprintf("%064X", 50), BlockHeight: 150, From: alice, Type: XionTxTransfer, Timestamp: start.Add(24 * time.Hour)})
+		defer delete(service.history.byHash, fmt.Sprintf("%064X", 50))
+
+		second, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: 2, Cursor: first.NextCursor})
+		require.NoError(t, err)
+		require.Len(t, second.Transactions, 2)
+		assert.Equal(t, int64(104), second.Transactions[0].BlockHeight)
+	})
+
+	t.Run("ByType", func(t *testing.T) {
+		page, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Types: []string{XionTxSkillBurn}})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, 2)
+		for _, tx := range page.Transactions {
+			assert.Equal(t, XionTxSkillBurn, tx.Type)
+		}
+
+		page, err = service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Types: []string{XionTxFaucet, XionTxSkillBurn}})
+		require.NoError(t, err)
+		assert.Len(t, page.Transactions, 3)
+	})
+
+	t.Run("ByTime", func(t *testing.T) {
+		page, err := service.QueryTransactionHistory(XionHistoryQuery{
+			Address: alice,
+			Since:   start.Add(2 * time.Hour),
+			Until:   start.Add(5 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, 3)
+		assert.Equal(t, int64(104), page.Transactions[0].BlockHeight)
+		assert.Equal(t, int64(102), page.Transactions[2].BlockHeight)
+	})
+
+	t.Run("Copies", func(t *testing.T) {
+		page, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: 1})
+		require.NoError(t, err)
+		page.Transactions[0].Type = "tampered"
+		again, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, XionTxTransfer, again.Transactions[0].Type)
+	})
+
+	t.Run("InvalidQueries", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", "MTAw", "eDpBQkM"} {
+			_, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Cursor: cursor})
+			assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+		}
+		_, err := service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: maxHistoryPageSize + 1})
+		assert.Error(t, err)
+		_, err = service.QueryTransactionHistory(XionHistoryQuery{Address: alice, Limit: -1})
+		assert.Error(t, err)
+	})
+}
+
+func TestXionIndexer(t *testing.T) {
+	const token = "xion1nrntoken"
+	keyring := NewXionKeyring()
+	addKey := func(seed string) string {
+		key := sha256.Sum256([]byte(seed))
+		address, err := keyring.AddKey(key[:])
+		require.NoError(t, err)
+		return address
+	}
+	sponsor, agent, faucet, other := addKey("sponsor"), addKey("agent"), addKey("faucet"), addKey("other wallet")
+	remote := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+
+	chain := newXionChainStandIn(t)
+	newService := func() *XionIntegrationService {
+		service := NewXionIntegrationService(XionConfig{
+			ChainID:         "xion-testnet-1",
+			RPCEndpoint:     chain.URL,
+			GasPrice:        "0.025uxion",
+			NRNTokenAddress: token,
+			FaucetAddress:   faucet,
+			GaslessEnabled:  true,
+			FeeGranter:      sponsor,
+			ConfirmTimeout:  time.Second,
+			PollInterval:    time.Millisecond,
+		}, keyring)
+		require.NoError(t, service.SkillPricing().Set("summarize", NewAmountFromInt64(250000, 6)))
+		return service
+	}
+	// send is a bank transfer from the other wallet, which is not this
+	// service's
+	send := func(to string, units int64, memo string) []byte {
+		rawTx, err := keyring.SignTx(other, &CosmosTx{
+			Signer:   other,
+			Messages: []CosmosMsg{NewMsgSend(other, to, CosmosCoin{Denom: "uxion", Amount: fmt.Sprint(units)})},
+			Memo:     memo,
+			Fee:      []CosmosCoin{{Denom: "uxion", Amount: "5000"}},
+			GasLimit: 200000,
+			ChainID:  "xion-testnet-1",
+		})
+		require.NoError(t, err)
+		return rawTx
+	}
+
+	service := newService()
+	sent, err := service.TransferNRN(agent, remote, "1000")
+	require.NoError(t, err)
+	burned, err := service.BurnNRNForSkill(remote, "summarize", "250000", nil)
+	require.NoError(t, err)
+	dripped, err := service.RequestFromFaucet(agent, "500000")
+	require.NoError(t, err)
+	received := chain.include(send(agent, 2500000, "rent"))
+	failedTx := send(agent, 1, "")
+	failed := chain.include(failedTx)
+	chain.deliver = func(rawTx []byte) *ABCIError {
+		if bytes.Equal(rawTx, failedTx) {
+			return &ABCIError{Codespace: "sdk", Code: 5, Log: "insufficient funds"}
+		}
+		return nil
+	}
+	defer func() { chain.deliver = nil }()
+	chain.include(send(sponsor, 1, ""))
+
+	// A service that did not make these transactions, as after a restart,
+	// learns of them from the chain
+	restarted := newService()
+	indexer := restarted.Indexer()
+	require.NoError(t, indexer.Watch(agent))
+	require.NoError(t, indexer.Watch(remote))
+	assert.ErrorIs(t, indexer.Watch("xion1notanaddress"), ErrInvalidAddress)
+
+	t.Run("Sync", func(t *testing.T) {
+		indexed, err := indexer.Sync()
+		require.NoError(t, err)
+		assert.Equal(t, 6, indexed, "four transactions of agent's and two of remote's, one shared")
+		assert.Equal(t, chain.height, indexer.Height(agent))
+
+		history, err := restarted.GetTransactionHistory(agent)
+		require.NoError(t, err)
+		require.Len(t, history, 4)
+		hashes := []string{failed, received, dripped.TxHash, sent.TxHash}
+		for i, tx := range history {
+			assert.Equal(t, hashes[i], tx.TxHash)
+			assert.Equal(t, chain.blockTime(tx.BlockHeight), tx.Timestamp)
+		}
+
+		assert.False(t, history[0].Success)
+		assert.Contains(t, history[0].Error, "insufficient funds")
+
+		incoming := history[1]
+		assert.True(t, incoming.Success)
+		assert.Equal(t, XionTxTransfer, incoming.Type)
+		assert.Equal(t, other, incoming.From)
+		assert.Equal(t, agent, incoming.To)
+		assert.Equal(t, "2.5", incoming.Amount.String())
+		assert.Equal(t, "uxion", incoming.Denom)
+		assert.Equal(t, "rent", incoming.Memo)
+		assert.Equal(t, "118250", incoming.GasUsed)
+
+		drip := history[2]
+		assert.Equal(t, XionTxFaucet, drip.Type)
+		assert.Equal(t, faucet, drip.From)
+		assert.Equal(t, "0.5", drip.Amount.String())
+		assert.Equal(t, "nrn", drip.Denom)
+
+		transfer := history[3]
+		assert.Equal(t, XionTxTransfer, transfer.Type)
+		assert.Equal(t, agent, transfer.From)
+		assert.Equal(t, remote, transfer.To)
+
+		// The burn was sponsored through authz: the sponsor signed it
+		history, err = restarted.GetTransactionHistory(remote)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, burned.TxHash, history[0].TxHash)
+		assert.Equal(t, XionTxSkillBurn, history[0].Type)
+		assert.Equal(t, remote, history[0].From)
+		assert.Equal(t, "0.25", history[0].Amount.String())
+	})
+
+	t.Run("Incremental", func(t *testing.T) {
+		chain.searches = nil
+		indexed, err := indexer.Sync()
+		require.NoError(t, err)
+		assert.Zero(t, indexed)
+		assert.Empty(t, chain.searches, "nothing new to search")
+
+		height := chain.height
+		chain.include(send(agent, 7, ""))
+		indexed, err = indexer.Sync()
+		require.NoError(t, err)
+		assert.Equal(t, 1, indexed)
+		require.NotEmpty(t, chain.searches)
+		for _, search := range chain.searches {
+			assert.Contains(t, search, fmt.Sprintf("tx.height>%d AND tx.height<=%d", height, height+1))
+		}
+	})
+
+	t.Run("ManyPages", func(t *testing.T) {
+		carol := newTestXionAddress(t, 0x43)
+		for i := 0; i < xionIndexerPageSize+5; i++ {
+			chain.include(send(carol, int64(i+1), ""))
+		}
+		require.NoError(t, indexer.Watch(carol))
+		_, err := indexer.Sync()
+		require.NoError(t, err)
+
+		page, err := restarted.QueryTransactionHistory(XionHistoryQuery{Address: carol, Limit: maxHistoryPageSize})
+		require.NoError(t, err)
+		assert.Len(t, page.Transactions, xionIndexerPageSize+5)
+	})
+
+	t.Run("MergesWithOwnRecords", func(t *testing.T) {
+		require.NoError(t, service.Indexer().Watch(agent))
+		_, err := service.Indexer().Sync()
+		require.NoError(t, err)
+
+		page, err := service.QueryTransactionHistory(XionHistoryQuery{Address: agent, Types: []string{XionTxTransfer}, Until: chain.blockTime(sent.BlockHeight + 1)})
+		require.NoError(t, err)
+		require.Len(t, page.Transactions, 1)
+		assert.Equal(t, sponsor, page.Transactions[0].Sponsor, "only this service knew who sponsored it")
+		assert.Equal(t, chain.blockTime(sent.BlockHeight), page.Transactions[0].Timestamp)
+	})
+
+	t.Run("Unwatch", func(t *testing.T) {
+		indexer.Unwatch(remote)
+		assert.Zero(t, indexer.Height(remote))
+		history, err := restarted.GetTransactionHistory(remote)
+		require.NoError(t, err)
+		assert.Len(t, history, 2, "history is kept")
+	})
+}
@@ -0,0 +1,250 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const xionIndexerPageSize = 100
+
+// xionIndexedEvents are the tx_search events that name an address as a
+// party to a wallet transaction: bank transfers, and CW20 transfers, sends
+// and burns on the NRN contract.
+var xionIndexedEvents = []string{"transfer.sender", "transfer.recipient", "wasm.from", "wasm.to"}
+
+// XionIndexer keeps the service's history of watched addresses current
+// from the chain, catching what other wallets sent them and what this
+// service sent but lost track of. Each Sync indexes the blocks since the
+// last one.
+type XionIndexer struct {
+	service *XionIntegrationService
+
+	mu      sync.Mutex
+	watched map[string]int64 // last indexed height by address
+}
+
+func newXionIndexer(service *XionIntegrationService) *XionIndexer {
+	return &XionIndexer{service: service, watched: make(map[string]int64)}
+}
+
+// Indexer returns the service's history indexer.
+func (s *XionIntegrationService) Indexer() *XionIndexer {
+	return s.indexer
+}
+
+// Watch adds address to the indexer, from genesis on its next Sync.
+func (ix *XionIndexer) Watch(address string) error {
+	if err := ix.service.ValidateAddress(address); err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if _, ok := ix.watched[address]; !ok {
+		ix.watched[address] = 0
+	}
+	return nil
+}
+
+// Unwatch stops indexing address. Its history so far is kept.
+func (ix *XionIndexer) Unwatch(address string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	delete(ix.watched, address)
+}
+
+// Height returns the height address is indexed up to.
+func (ix *XionIndexer) Height(address string) int64 {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.watched[address]
+}
+
+// Sync indexes every watched address up to the latest block and returns
+// how many transactions it recorded. An address whose indexing fails is
+// retried from where it was on the next Sync.
+func (ix *XionIndexer) Sync() (int, error) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	latest, err := ix.service.backend.LatestHeight()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the latest height: %w", err)
+	}
+	addresses := make([]string, 0, len(ix.watched))
+	for address := range ix.watched {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	blockTimes := make(map[int64]time.Time)
+	indexed := 0
+	for _, address := range addresses {
+		from := ix.watched[address]
+		if from >= latest {
+			continue
+		}
+		n, err := ix.index(address, from, latest, blockTimes)
+		indexed += n
+		if err != nil {
+			return indexed, fmt.Errorf("failed to index %s: %w", address, err)
+		}
+		ix.watched[address] = latest
+	}
+	return indexed, nil
+}
+
+// Run syncs every interval until ctx is done, returning ctx's error.
+// Failed syncs are retried on the next tick.
+func (ix *XionIndexer) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ix.Sync()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// index records the transactions of address in blocks (from, to].
+func (ix *XionIndexer) index(address string, from, to int64, blockTimes map[int64]time.Time) (int, error) {
+	seen := make(map[string]bool)
+	indexed := 0
+	for _, event := range xionIndexedEvents {
+		query := fmt.Sprintf("%s='%s' AND tx.height>%d AND tx.height<=%d", event, address, from, to)
+		for page, fetched := 1, 0; ; page++ {
+			txs, total, err := ix.service.backend.TxSearch(query, page, xionIndexerPageSize)
+			if err != nil {
+				return indexed, err
+			}
+			for _, tx := range txs {
+				if seen[tx.Hash] {
+					continue
+				}
+				seen[tx.Hash] = true
+				record, ok := ix.service.describeTx(tx)
+				if !ok {
+					continue
+				}
+				if record.Timestamp, ok = blockTimes[tx.Height]; !ok {
+					if record.Timestamp, err = ix.service.backend.BlockTime(tx.Height); err != nil {
+						return indexed, err
+					}
+					blockTimes[tx.Height] = record.Timestamp
+				}
+				ix.service.history.put(record)
+				indexed++
+			}
+			fetched += len(txs)
+			if len(txs) == 0 || fetched >= total {
+				break
+			}
+		}
+	}
+	return indexed, nil
+}
+
+// describeTx reads the history record of an included transaction from its
+// first bank send or NRN transfer, send or burn, looking inside authz
+// MsgExec for sponsored ones. ok is false for transactions of any other
+// kind.
+func (s *XionIntegrationService) describeTx(tx *CosmosTxResult) (record *XionTransactionResult, ok bool) {
+	msgs, memo, err := decodeTxBody(tx.Tx)
+	if err != nil {
+		return nil, false
+	}
+	record = &XionTransactionResult{
+		TxHash:      tx.Hash,
+		BlockHeight: tx.Height,
+		GasUsed:     strconv.FormatInt(tx.GasUsed, 10),
+		Success:     tx.Code == 0,
+		Status:      TxIncluded,
+		Memo:        memo,
+	}
+	if err := tx.Err(); err != nil {
+		record.Error, record.Status = err.Error(), TxFailed
+	}
+
+	for i := 0; i < len(msgs); i++ {
+		switch msgs[i].TypeURL {
+		case msgExecTypeURL:
+			inner, err := decodeMsgExec(msgs[i])
+			if err != nil {
+				return nil, false
+			}
+			msgs = append(msgs, inner...)
+		case msgSendTypeURL:
+			from, to, coins, err := decodeMsgSend(msgs[i])
+			if err != nil || len(coins) == 0 {
+				continue
+			}
+			decimals := xionDenomDecimals[coins[0].Denom]
+			amount, err := ParseBaseUnits(coins[0].Amount, decimals)
+			if err != nil {
+				continue
+			}
+			record.From, record.To, record.Amount, record.Denom, record.Type = from, to, amount, coins[0].Denom, XionTxTransfer
+			return record, true
+		case msgExecuteContractTypeURL:
+			if s.nrn != nil && s.describeNRN(record, msgs[i]) {
+				return record, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// describeNRN fills in record from msg if it moves or burns NRN.
+func (s *XionIntegrationService) describeNRN(record *XionTransactionResult, msg CosmosMsg) bool {
+	sender, contract, execute, err := decodeMsgExecuteContract(msg)
+	if err != nil || contract != s.nrn.Contract() {
+		return false
+	}
+	var call struct {
+		Transfer *struct {
+			Recipient string `json:"recipient"`
+			Amount    string `json:"amount"`
+		} `json:"transfer"`
+		Send *struct {
+			Contract string `json:"contract"`
+			Amount   string `json:"amount"`
+		} `json:"send"`
+		Burn *struct {
+			Amount string `json:"amount"`
+		} `json:"burn"`
+	}
+	if json.Unmarshal(execute, &call) != nil {
+		return false
+	}
+
+	var amount string
+	switch {
+	case call.Transfer != nil:
+		record.To, amount, record.Type = call.Transfer.Recipient, call.Transfer.Amount, XionTxTransfer
+		if sender == s.config.FaucetAddress {
+			record.Type = XionTxFaucet
+		}
+	case call.Send != nil:
+		record.To, amount, record.Type = call.Send.Contract, call.Send.Amount, XionTxTransfer
+	case call.Burn != nil:
+		amount, record.Type = call.Burn.Amount, XionTxBurn
+		if _, _, err := parseSkillMemo(record.Memo); err == nil {
+			record.Type = XionTxSkillBurn
+		}
+	default:
+		return false
+	}
+	value, err := ParseBaseUnits(amount, xionDenomDecimals["nrn"])
+	if err != nil {
+		return false
+	}
+	record.From, record.Amount, record.Denom = sender, value, "nrn"
+	return true
+}
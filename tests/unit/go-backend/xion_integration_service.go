@@ -0,0 +1,583 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMetaAccountNotFound = errors.New("meta account not found")
+	ErrNoSigner            = errors.New("no signing key for account")
+	ErrTxPending           = errors.New("transaction broadcast but not yet included in a block")
+	ErrNoNRNToken          = errors.New("no NRN token contract configured")
+)
+
+type XionConfig struct {
+	ChainID         string `json:"chain_id"`
+	RPCEndpoint     string `json:"rpc_endpoint"`
+	GasPrice        string `json:"gas_price"`
+	NRNTokenAddress string `json:"nrn_token_address"`
+	FaucetAddress   string `json:"faucet_address"`
+	GaslessEnabled  bool   `json:"gasless_enabled"`
+
+	// AddressPrefixes are the bech32 prefixes the service accepts addresses
+	// under. They default to xion's.
+	AddressPrefixes []string `json:"address_prefixes,omitempty"`
+
+	// FeeGranter pays for gasless transactions, either through x/feegrant
+	// allowances or by executing them under an authz grant. Sponsorship
+	// decides which messages qualify; it defaults to NRN transfers and skill
+	// burns.
+	FeeGranter  string            `json:"fee_granter,omitempty"`
+	Sponsorship SponsorshipPolicy `json:"sponsorship"`
+
+	// GasAdjustment scales simulated gas into the gas limit, leaving room
+	// for state to change between simulation and inclusion.
+	GasAdjustment float64 `json:"gas_adjustment,omitempty"`
+
+	// ConfirmTimeout bounds how long SendTransaction waits for a broadcast
+	// transaction to land in a block, and the Tracker for it to become
+	// final; PollInterval paces the lookups.
+	ConfirmTimeout time.Duration `json:"confirm_timeout,omitempty"`
+	PollInterval   time.Duration `json:"poll_interval,omitempty"`
+	FinalityDepth  int64         `json:"finality_depth,omitempty"`
+}
+
+const (
+	defaultXionGasAdjustment  = 1.3
+	defaultXionConfirmTimeout = 30 * time.Second
+	defaultXionPollInterval   = time.Second
+)
+
+type XionMetaAccount struct {
+	Address   string    `json:"address"`
+	ChainID   string    `json:"chain_id"`
+	Gasless   bool      `json:"gasless_enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type XionTransaction struct {
+	From            string                 `json:"from"`
+	To              string                 `json:"to"`
+	Amount          Amount                 `json:"amount"`
+	Denom           string                 `json:"denom"`
+	Memo            string                 `json:"memo"`
+	GasLimit        string                 `json:"gas_limit"`
+	GasPrice        string                 `json:"gas_price"`
+	Gasless         bool                   `json:"gasless"`
+	Type            string                 `json:"type"`
+	ContractAddress string                 `json:"contract_address,omitempty"`
+	SkillID         string                 `json:"skill_id,omitempty"`
+	Metadata        map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type XionTransactionResult struct {
+	TxHash      string `json:"tx_hash"`
+	BlockHeight int64  `json:"block_height"`
+	GasUsed     string `json:"gas_used"`
+	Success     bool   `json:"success"`
+	Error       string `json:"error,omitempty"`
+
+	// Status is TxIncluded or TxFailed once the transaction is in a block,
+	// and TxPending if it was broadcast but did not make it in time. Use
+	// the Tracker to follow it further.
+	Status TxStatus `json:"status,omitempty"`
+
+	// Sponsor is the account that paid the fee of a gasless transaction.
+	Sponsor string `json:"sponsor,omitempty"`
+
+	// What the transaction did, for the history. Type is one of the
+	// XionTx* types.
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to,omitempty"`
+	Amount    Amount    `json:"amount"`
+	Denom     string    `json:"denom,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Memo      string    `json:"memo,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// xionDenomDecimals maps bank denoms to the decimals of their display unit.
+var xionDenomDecimals = map[string]int{
+	"uxion": 6,
+	"nrn":   6,
+}
+
+// XionFeeEstimate breaks down the fee of a simulated transaction.
+type XionFeeEstimate struct {
+	GasUsed       uint64  `json:"gas_used"`
+	GasAdjustment float64 `json:"gas_adjustment"`
+	GasLimit      uint64  `json:"gas_limit"`
+	GasPrice      string  `json:"gas_price"`
+	Fee           Amount  `json:"fee"`
+	FeeDenom      string  `json:"fee_denom"`
+}
+
+// XionSigner signs transactions on behalf of the accounts it holds keys for.
+type XionSigner interface {
+	// PublicKey returns the compressed public key of address, which gas
+	// simulation needs before anything is signed.
+	PublicKey(address string) ([]byte, error)
+	SignTx(address string, tx UnsignedTx) ([]byte, error)
+}
+
+// XionKeyring is an in-memory XionSigner for service-held hot keys such as
+// the faucet's.
+type XionKeyring struct {
+	mu   sync.RWMutex
+	keys map[string][]byte
+}
+
+func NewXionKeyring() *XionKeyring {
+	return &XionKeyring{keys: make(map[string][]byte)}
+}
+
+// AddKey stores a secp256k1 private key and returns its xion address.
+func (k *XionKeyring) AddKey(privateKey []byte) (string, error) {
+	codec := &Bech32Codec{HRP: "xion"}
+	publicKey, err := codec.PublicKey(privateKey)
+	if err != nil {
+		return "", err
+	}
+	address, err := codec.EncodeAddress(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[address] = append([]byte(nil), privateKey...)
+	return address, nil
+}
+
+func (k *XionKeyring) PublicKey(address string) ([]byte, error) {
+	key, err := k.key(address)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1PublicKey(key)
+}
+
+func (k *XionKeyring) SignTx(address string, tx UnsignedTx) ([]byte, error) {
+	key, err := k.key(address)
+	if err != nil {
+		return nil, err
+	}
+	return tx.Sign(key)
+}
+
+func (k *XionKeyring) key(address string) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[address]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoSigner, address)
+	}
+	return key, nil
+}
+
+// XionIntegrationService manages XION meta accounts and submits their
+// transactions through the chain's CometBFT RPC endpoint.
+type XionIntegrationService struct {
+	config   XionConfig
+	backend  *CosmosBackend
+	nrn      *CW20Client
+	signer   XionSigner
+	skills   *SkillPricing
+	receipts *skillReceipts
+	faucet   faucetState
+	tracker  *TxTracker
+	history  *xionHistory
+	indexer  *XionIndexer
+
+	mu       sync.RWMutex // guards accounts
+	accounts map[string]*XionMetaAccount
+}
+
+// NewXionIntegrationService connects to config.RPCEndpoint. signer may be
+// nil for read-only use.
+func NewXionIntegrationService(config XionConfig, signer XionSigner) *XionIntegrationService {
+	if len(config.Sponsorship.Rules) == 0 && config.NRNTokenAddress != "" {
+		config.Sponsorship = DefaultSponsorshipPolicy(config.NRNTokenAddress)
+	}
+	if len(config.AddressPrefixes) == 0 {
+		config.AddressPrefixes = []string{"xion"}
+	}
+	if config.GasAdjustment == 0 {
+		config.GasAdjustment = defaultXionGasAdjustment
+	}
+	if config.ConfirmTimeout == 0 {
+		config.ConfirmTimeout = defaultXionConfirmTimeout
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultXionPollInterval
+	}
+	s := &XionIntegrationService{
+		config:   config,
+		backend:  NewCosmosBackend(config.RPCEndpoint, "uxion", xionDenomDecimals["uxion"]),
+		signer:   signer,
+		skills:   NewSkillPricing(),
+		receipts: newSkillReceipts(),
+		faucet:   faucetState{policy: DefaultFaucetPolicy(), ledger: NewMemoryFaucetLedger(), now: time.Now},
+		history:  newXionHistory(),
+		accounts: make(map[string]*XionMetaAccount),
+	}
+	s.tracker = NewTxTracker(s.backend, TxTrackerConfig{
+		PollInterval:  config.PollInterval,
+		Timeout:       config.ConfirmTimeout,
+		FinalityDepth: config.FinalityDepth,
+	})
+	s.indexer = newXionIndexer(s)
+	if config.NRNTokenAddress != "" {
+		s.nrn = NewCW20Client(s.backend, config.NRNTokenAddress, xionDenomDecimals["nrn"])
+	}
+	return s
+}
+
+// NRNToken returns the client for the NRN token contract, or nil if none is
+// configured.
+func (s *XionIntegrationService) NRNToken() *CW20Client {
+	return s.nrn
+}
+
+func (s *XionIntegrationService) GetConfig() XionConfig {
+	return s.config
+}
+
+// ParseAddress decodes address, which must carry one of the configured
+// prefixes and a bech32 checksum, and be a 20-byte account or a 32-byte
+// contract, such as a smart contract meta account.
+func (s *XionIntegrationService) ParseAddress(address string) (CosmosAddress, error) {
+	parsed, err := ParseCosmosAddress(address, s.config.AddressPrefixes...)
+	if err != nil {
+		return CosmosAddress{}, err
+	}
+	if parsed.Bech32m {
+		return CosmosAddress{}, fmt.Errorf("%w %q: Cosmos addresses take a bech32 checksum, not bech32m", ErrInvalidAddress, address)
+	}
+	return parsed, nil
+}
+
+// ValidateAddress reports whether ParseAddress accepts address.
+func (s *XionIntegrationService) ValidateAddress(address string) error {
+	_, err := s.ParseAddress(address)
+	return err
+}
+
+func (s *XionIntegrationService) CreateMetaAccount(address string) (*XionMetaAccount, error) {
+	if err := s.ValidateAddress(address); err != nil {
+		return nil, err
+	}
+
+	account := &XionMetaAccount{
+		Address:   address,
+		ChainID:   s.config.ChainID,
+		Gasless:   s.config.GaslessEnabled,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.accounts[address] = account
+	s.mu.Unlock()
+	copied := *account
+	return &copied, nil
+}
+
+func (s *XionIntegrationService) GetMetaAccount(address string) (*XionMetaAccount, error) {
+	if err := s.ValidateAddress(address); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	account, exists := s.accounts[address]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrMetaAccountNotFound, address)
+	}
+	copied := *account
+	return &copied, nil
+}
+
+// GetBalance reports NRN from the token contract and every other denom,
+// uxion and IBC denoms alike, from the bank module. Denoms the service does
+// not know the decimals of are reported in base units.
+func (s *XionIntegrationService) GetBalance(address string, denom string) (Amount, error) {
+	if err := s.ValidateAddress(address); err != nil {
+		return Amount{}, err
+	}
+	if denom == "nrn" {
+		if s.nrn == nil {
+			return Amount{}, ErrNoNRNToken
+		}
+		return s.nrn.Balance(address)
+	}
+	return s.backend.GetDenomBalance(address, denom, xionDenomDecimals[denom])
+}
+
+// TransferNRN moves amount base units of NRN through the token contract,
+// sponsored when gasless execution is enabled.
+func (s *XionIntegrationService) TransferNRN(from, to, amount string) (*XionTransactionResult, error) {
+	failed := func(err error) (*XionTransactionResult, error) {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	if s.nrn == nil {
+		return failed(ErrNoNRNToken)
+	}
+	if err := s.ValidateAddress(from); err != nil {
+		return failed(fmt.Errorf("sender: %w", err))
+	}
+	if err := s.ValidateAddress(to); err != nil {
+		return failed(fmt.Errorf("recipient: %w", err))
+	}
+	value, err := ParseBaseUnits(amount, xionDenomDecimals["nrn"])
+	if err != nil {
+		return failed(err)
+	}
+
+	msg, err := s.nrn.Transfer(from, to, value)
+	if err != nil {
+		return failed(err)
+	}
+	return s.Execute(&XionTransaction{
+		From:            from,
+		To:              to,
+		Amount:          value,
+		Denom:           "nrn",
+		Gasless:         s.config.GaslessEnabled,
+		Type:            XionTxTransfer,
+		ContractAddress: s.nrn.Contract(),
+	}, msg)
+}
+
+// SendTransaction builds a bank MsgSend from tx, signs it with the sender's
+// key, broadcasts it and waits for it to be included in a block. An empty
+// GasLimit is filled in from EstimateGas. Rejections are reported in the
+// result's Error and as an *ABCIError.
+func (s *XionIntegrationService) SendTransaction(tx *XionTransaction) (*XionTransactionResult, error) {
+	msg, err := s.buildSend(tx)
+	if err != nil {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	return s.Execute(tx, msg)
+}
+
+// EstimateGas simulates tx against the chain's current state and prices the
+// adjusted gas at the transaction's gas price, or the configured one.
+func (s *XionIntegrationService) EstimateGas(tx *XionTransaction) (*XionFeeEstimate, error) {
+	msg, err := s.buildSend(tx)
+	if err != nil {
+		return nil, err
+	}
+	cosmosTx, err := s.prepare(tx, msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.estimate(tx, cosmosTx)
+}
+
+// Execute signs msgs as tx.From, or has the fee granter sponsor them when tx
+// is gasless, and broadcasts them. Of tx, only From, Memo, the gas fields
+// and Gasless apply.
+func (s *XionIntegrationService) Execute(tx *XionTransaction, msgs ...CosmosMsg) (*XionTransactionResult, error) {
+	failed := func(err error) (*XionTransactionResult, error) {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+
+	cosmosTx, err := s.prepare(tx, msgs...)
+	if err != nil {
+		return failed(err)
+	}
+	// An estimated gas limit is for this call only; tx is left as given
+	var gasLimit uint64
+	if tx.GasLimit == "" {
+		estimate, err := s.estimate(tx, cosmosTx)
+		if err != nil {
+			return failed(err)
+		}
+		gasLimit = estimate.GasLimit
+	} else if gasLimit, err = strconv.ParseUint(tx.GasLimit, 10, 64); err != nil || gasLimit == 0 {
+		return failed(fmt.Errorf("invalid gas limit %q", tx.GasLimit))
+	}
+	gasPrice, err := s.gasPrice(tx)
+	if err != nil {
+		return failed(err)
+	}
+	cosmosTx.GasLimit = gasLimit
+	cosmosTx.Fee = []CosmosCoin{gasPrice.FeeFor(gasLimit)}
+
+	rawTx, err := s.signer.SignTx(cosmosTx.Signer, cosmosTx)
+	if err != nil {
+		return failed(err)
+	}
+	result, err := s.broadcast(rawTx)
+	if tx.Gasless {
+		result.Sponsor = s.config.FeeGranter
+	}
+	result.From, result.To, result.Amount, result.Denom = tx.From, tx.To, tx.Amount, tx.Denom
+	result.Type, result.Memo, result.Timestamp = tx.Type, tx.Memo, time.Now()
+	if result.Type == "" {
+		result.Type = XionTxTransfer
+	}
+	if result.Denom == "" {
+		result.Denom = "uxion"
+	}
+	// Transactions that made it on chain are history whether or not they
+	// succeeded
+	if result.BlockHeight > 0 {
+		s.history.put(result)
+	}
+	return result, err
+}
+
+// prepare wraps msgs in an unsigned transaction for the account that signs
+// it: tx.From, or for gasless transactions from meta accounts whose keys the
+// service does not hold, the fee granter executing msgs under the account's
+// authz grant.
+func (s *XionIntegrationService) prepare(tx *XionTransaction, msgs ...CosmosMsg) (*CosmosTx, error) {
+	if s.signer == nil {
+		return nil, fmt.Errorf("%w %s", ErrNoSigner, tx.From)
+	}
+	if err := s.ValidateAddress(tx.From); err != nil {
+		return nil, fmt.Errorf("sender: %w", err)
+	}
+
+	cosmosTx := &CosmosTx{
+		Signer:   tx.From,
+		Messages: msgs,
+		Memo:     tx.Memo,
+		ChainID:  s.config.ChainID,
+	}
+	if tx.Gasless {
+		if err := s.checkSponsored(msgs); err != nil {
+			return nil, err
+		}
+		_, err := s.signer.PublicKey(tx.From)
+		switch {
+		case err == nil:
+			cosmosTx.FeeGranter = s.config.FeeGranter
+		case errors.Is(err, ErrNoSigner):
+			cosmosTx.Signer = s.config.FeeGranter
+			cosmosTx.Messages = []CosmosMsg{NewMsgExec(s.config.FeeGranter, msgs...)}
+		default:
+			return nil, err
+		}
+	}
+
+	var err error
+	cosmosTx.AccountNumber, cosmosTx.Sequence, err = s.backend.GetAccount(cosmosTx.Signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load account %s: %w", cosmosTx.Signer, err)
+	}
+	return cosmosTx, nil
+}
+
+// estimate simulates cosmosTx and prices the adjusted gas.
+func (s *XionIntegrationService) estimate(tx *XionTransaction, cosmosTx *CosmosTx) (*XionFeeEstimate, error) {
+	gasPrice, err := s.gasPrice(tx)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := s.signer.PublicKey(cosmosTx.Signer)
+	if err != nil {
+		return nil, err
+	}
+
+	gasUsed, err := s.backend.Simulate(cosmosTx.SimulationBytes(publicKey))
+	if err != nil {
+		return nil, fmt.Errorf("simulation failed: %w", err)
+	}
+
+	gasLimit := uint64(math.Ceil(float64(gasUsed) * s.config.GasAdjustment))
+	fee := gasPrice.FeeFor(gasLimit)
+	feeAmount, err := ParseBaseUnits(fee.Amount, xionDenomDecimals[fee.Denom])
+	if err != nil {
+		return nil, err
+	}
+	return &XionFeeEstimate{
+		GasUsed:       gasUsed,
+		GasAdjustment: s.config.GasAdjustment,
+		GasLimit:      gasLimit,
+		GasPrice:      gasPrice.String(),
+		Fee:           feeAmount,
+		FeeDenom:      fee.Denom,
+	}, nil
+}
+
+// gasPrice returns the first price of tx.GasPrice, falling back to the
+// configured price. Nodes accept a fee in any denom they list.
+func (s *XionIntegrationService) gasPrice(tx *XionTransaction) (DecCoin, error) {
+	gasPrice := tx.GasPrice
+	if gasPrice == "" {
+		gasPrice = s.config.GasPrice
+	}
+	prices, err := ParseDecCoins(gasPrice)
+	if err != nil {
+		return DecCoin{}, fmt.Errorf("invalid gas price: %w", err)
+	}
+	return prices[0], nil
+}
+
+// buildSend validates tx and returns its bank MsgSend.
+func (s *XionIntegrationService) buildSend(tx *XionTransaction) (CosmosMsg, error) {
+	if err := s.ValidateAddress(tx.From); err != nil {
+		return CosmosMsg{}, fmt.Errorf("sender: %w", err)
+	}
+	if err := s.ValidateAddress(tx.To); err != nil {
+		return CosmosMsg{}, fmt.Errorf("recipient: %w", err)
+	}
+	if tx.Amount.Sign() <= 0 {
+		return CosmosMsg{}, fmt.Errorf("%w: transfer amount must be positive", ErrInvalidAmount)
+	}
+
+	denom := tx.Denom
+	if denom == "" {
+		denom = "uxion"
+	}
+	units := tx.Amount.BaseUnits()
+	if decimals, known := xionDenomDecimals[denom]; known {
+		var err error
+		if units, err = tx.Amount.UnitsAt(decimals); err != nil {
+			return CosmosMsg{}, err
+		}
+	}
+	return NewMsgSend(tx.From, tx.To, CosmosCoin{Denom: denom, Amount: units.String()}), nil
+}
+
+// broadcast submits rawTx and follows it into a block.
+func (s *XionIntegrationService) broadcast(rawTx []byte) (*XionTransactionResult, error) {
+	checked, err := s.backend.BroadcastTxSync(rawTx)
+	if err != nil {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	if err := checked.Err(); err != nil {
+		return &XionTransactionResult{TxHash: checked.Hash, Success: false, Error: err.Error()}, err
+	}
+
+	update, err := s.tracker.WaitFor(context.Background(), checked.Hash, TxIncluded)
+	if update.Result == nil {
+		return &XionTransactionResult{TxHash: checked.Hash, Success: false, Error: err.Error(), Status: TxPending}, err
+	}
+
+	included := update.Result
+	result := &XionTransactionResult{
+		TxHash:      included.Hash,
+		BlockHeight: included.Height,
+		GasUsed:     strconv.FormatInt(included.GasUsed, 10),
+		Success:     included.Code == 0,
+		Status:      TxIncluded,
+	}
+	if err := included.Err(); err != nil {
+		result.Error, result.Status = err.Error(), TxFailed
+		return result, err
+	}
+	return result, nil
+}
+
+// Tracker follows the service's transactions to finality.
+func (s *XionIntegrationService) Tracker() *TxTracker {
+	return s.tracker
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrGaslessUnavailable = errors.New("gasless execution is not configured")
+	ErrNotSponsored       = errors.New("message is not sponsored")
+)
+
+// SponsorshipRule admits one kind of message to gasless execution.
+type SponsorshipRule struct {
+	Name    string `json:"name"`
+	TypeURL string `json:"type_url"`
+
+	// Contract and Actions narrow MsgExecuteContract rules to one contract
+	// and to the top-level keys of its execute messages.
+	Contract string   `json:"contract,omitempty"`
+	Actions  []string `json:"actions,omitempty"`
+}
+
+// SponsorshipPolicy decides which messages the fee granter pays for. The
+// on-chain allowance can only restrict message types, so the contract and
+// action checks are enforced here.
+type SponsorshipPolicy struct {
+	Rules []SponsorshipRule `json:"rules"`
+}
+
+// DefaultSponsorshipPolicy sponsors NRN transfers and skill burns on the
+// NRN token contract.
+func DefaultSponsorshipPolicy(nrnToken string) SponsorshipPolicy {
+	return SponsorshipPolicy{Rules: []SponsorshipRule{
+		{Name: "nrn_transfer", TypeURL: msgExecuteContractTypeURL, Contract: nrnToken, Actions: []string{"transfer", "send"}},
+		{Name: "skill_burn", TypeURL: msgExecuteContractTypeURL, Contract: nrnToken, Actions: []string{"burn"}},
+	}}
+}
+
+// Sponsors returns the rule that admits msg, if any.
+func (p SponsorshipPolicy) Sponsors(msg CosmosMsg) (*SponsorshipRule, bool) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.TypeURL == msg.TypeURL && rule.admits(msg) {
+			return rule, true
+		}
+	}
+	return nil, false
+}
+
+func (r *SponsorshipRule) admits(msg CosmosMsg) bool {
+	if r.Contract == "" && len(r.Actions) == 0 {
+		return true
+	}
+	if msg.TypeURL != msgExecuteContractTypeURL {
+		return false
+	}
+
+	// MsgExecuteContract{sender, contract, msg}
+	fields, err := protoFields(msg.Value)
+	if err != nil {
+		return false
+	}
+	var contract string
+	var execute map[string]json.RawMessage
+	for _, field := range fields {
+		switch field.Num {
+		case 2:
+			contract = string(field.Bytes)
+		case 3:
+			if err := json.Unmarshal(field.Bytes, &execute); err != nil {
+				return false
+			}
+		}
+	}
+	if r.Contract != "" && contract != r.Contract {
+		return false
+	}
+	if len(r.Actions) == 0 {
+		return true
+	}
+	if len(execute) != 1 {
+		return false
+	}
+	for _, action := range r.Actions {
+		if _, ok := execute[action]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MessageTypes lists the distinct message types the policy admits, for the
+// AllowedMsgAllowance that backs it on chain.
+func (p SponsorshipPolicy) MessageTypes() []string {
+	var types []string
+	seen := make(map[string]bool)
+	for _, rule := range p.Rules {
+		if !seen[rule.TypeURL] {
+			seen[rule.TypeURL] = true
+			types = append(types, rule.TypeURL)
+		}
+	}
+	return types
+}
+
+func (s *XionIntegrationService) checkSponsored(msgs []CosmosMsg) error {
+	if !s.config.GaslessEnabled || s.config.FeeGranter == "" {
+		return ErrGaslessUnavailable
+	}
+	for _, msg := range msgs {
+		if _, ok := s.config.Sponsorship.Sponsors(msg); !ok {
+			return fmt.Errorf("%w: %s", ErrNotSponsored, msg.TypeURL)
+		}
+	}
+	return nil
+}
+
+// GrantFeeAllowance has the fee granter cover grantee's fees up to
+// allowance. Unless allowance is already an AllowedMsgAllowance it is
+// restricted to the message types of the sponsorship policy.
+func (s *XionIntegrationService) GrantFeeAllowance(grantee string, allowance FeeAllowance) (*XionTransactionResult, error) {
+	if err := s.checkGrantee(grantee); err != nil {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	if _, restricted := allowance.(AllowedMsgAllowance); !restricted {
+		allowance = AllowedMsgAllowance{Allowance: allowance, AllowedMessages: s.config.Sponsorship.MessageTypes()}
+	}
+	return s.Execute(&XionTransaction{From: s.config.FeeGranter, Type: "fee_grant"},
+		NewMsgGrantAllowance(s.config.FeeGranter, grantee, allowance))
+}
+
+// RevokeFeeAllowance withdraws grantee's allowance.
+func (s *XionIntegrationService) RevokeFeeAllowance(grantee string) (*XionTransactionResult, error) {
+	if err := s.checkGrantee(grantee); err != nil {
+		return &XionTransactionResult{Success: false, Error: err.Error()}, err
+	}
+	return s.Execute(&XionTransaction{From: s.config.FeeGranter, Type: "fee_revoke"},
+		NewMsgRevokeAllowance(s.config.FeeGranter, grantee))
+}
+
+// GetFeeAllowance returns what is left of grantee's allowance, or
+// ErrAllowanceNotFound.
+func (s *XionIntegrationService) GetFeeAllowance(grantee string) (*FeeGrant, error) {
+	if err := s.checkGrantee(grantee); err != nil {
+		return nil, err
+	}
+	return s.backend.GetFeeAllowance(s.config.FeeGranter, grantee)
+}
+
+func (s *XionIntegrationService) checkGrantee(grantee string) error {
+	if s.config.FeeGranter == "" {
+		return ErrGaslessUnavailable
+	}
+	if err := s.ValidateAddress(grantee); err != nil {
+		return fmt.Errorf("grantee: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeAllowanceEncoding(t *testing.T) {
+	t.Run("BasicAllowance", func(t *testing.T) {
+		allowance := BasicAllowance{
+			SpendLimit: []CosmosCoin{{Denom: "uxion", Amount: "1000000"}},
+			Expiration: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		assert.Equal(t, "0a100a057578696f6e12073130303030303012060880b1ef8607", hex.EncodeToString(allowance.marshal()))
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		allowance := AllowedMsgAllowance{
+			Allowance: PeriodicAllowance{
+				Basic:            BasicAllowance{SpendLimit: []CosmosCoin{{Denom: "uxion", Amount: "5000000"}}},
+				Period:           24 * time.Hour,
+				PeriodSpendLimit: []CosmosCoin{{Denom: "uxion", Amount: "250000"}},
+				PeriodCanSpend:   []CosmosCoin{{Denom: "uxion", Amount: "120000"}},
+				PeriodReset:      time.Date(2026, 10, 17, 9, 30, 0, 500, time.UTC),
+			},
+			AllowedMessages: []string{msgExecuteContractTypeURL, msgSendTypeURL},
+		}
+
+		grant := protoAppendString(nil, 1, "xion1granter")
+		grant = protoAppendString(grant, 2, "xion1grantee")
+		grant = protoAppendBytes(grant, 3, packAllowance(allowance).marshal())
+		decoded, err := decodeFeeGrant(grant)
+		require.NoError(t, err)
+		assert.Equal(t, "xion1granter", decoded.Granter)
+		assert.Equal(t, "xion1grantee", decoded.Grantee)
+		assert.Equal(t, allowance, decoded.Allowance)
+
+		// Unset times stay unset rather than becoming the epoch
+		decoded, err = decodeFeeGrant(protoAppendBytes(nil, 3, packAllowance(PeriodicAllowance{Period: time.Hour}).marshal()))
+		require.NoError(t, err)
+		assert.Equal(t, PeriodicAllowance{Period: time.Hour}, decoded.Allowance)
+	})
+
+	t.Run("UnsupportedType", func(t *testing.T) {
+		unknown := CosmosMsg{TypeURL: "/xion.v1.CustomAllowance", Value: []byte{0x08, 0x01}}
+		_, err := decodeFeeGrant(protoAppendBytes(nil, 3, unknown.marshal()))
+		assert.Error(t, err)
+
+		_, err = decodeFeeGrant(protoAppendString(nil, 1, "xion1granter"))
+		assert.ErrorIs(t, err, ErrMalformedProto)
+	})
+}
+
+func TestSponsorshipPolicy(t *testing.T) {
+	const token = "xion1nrntoken"
+	policy := DefaultSponsorshipPolicy(token)
+	execute := func(contract, msg string) CosmosMsg {
+		return NewMsgExecuteContract("xion1sender", contract, []byte(msg))
+	}
+
+	tests := []struct {
+		name string
+		msg  CosmosMsg
+		rule string
+	}{
+		{"Transfer", execute(token, `{"transfer":{"recipient":"xion1to","amount":"10"}}`), "nrn_transfer"},
+		{"Send", execute(token, `{"send":{"contract":"xion1c","amount":"10","msg":""}}`), "nrn_transfer"},
+		{"Burn", execute(token, `{"burn":{"amount":"10"}}`), "skill_burn"},
+		{"Mint", execute(token, `{"mint":{"recipient":"xion1to","amount":"10"}}`), ""},
+		{"OtherContract", execute("xion1other", `{"transfer":{"recipient":"xion1to","amount":"10"}}`), ""},
+		{"SeveralActions", execute(token, `{"burn":{"amount":"10"},"mint":{"amount":"10"}}`), ""},
+		{"NotJSON", execute(token, `burn`), ""},
+		{"BankSend", NewMsgSend("xion1sender", "xion1to", CosmosCoin{Denom: "uxion", Amount: "1"}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, ok := policy.Sponsors(tt.msg)
+			if tt.rule == "" {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, tt.rule, rule.Name)
+		})
+	}
+
+	assert.Equal(t, []string{msgExecuteContractTypeURL}, policy.MessageTypes())
+}
+
+func TestXionSponsorship(t *testing.T) {
+	keyring := NewXionKeyring()
+	sponsorKey := sha256.Sum256([]byte("sponsor"))
+	sponsor, err := keyring.AddKey(sponsorKey[:])
+	require.NoError(t, err)
+	userKey := sha256.Sum256([]byte("meta account"))
+	user, err := keyring.AddKey(userKey[:])
+	require.NoError(t, err)
+	// A meta account whose key stays on the user's device
+	remote := "xion1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5atkush"
+	to := "xion1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnpltc8j"
+
+	accounts := map[string][2]uint64{sponsor: {3, 90}, user: {42, 7}}
+	var (
+		broadcasts [][]byte
+		grants     = make(map[string][]byte)
+	)
+	server := newRPCStandIn(t, map[string]rpcHandler{
+		"abci_query": func(params json.RawMessage) (interface{}, *RPCError) {
+			var query struct {
+				Path string `json:"path"`
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(params, &query))
+			data, err := hex.DecodeString(query.Data)
+			require.NoError(t, err)
+			request, err := protoFields(data)
+			require.NoError(t, err)
+			respond := func(value []byte) (interface{}, *RPCError) {
+				return map[string]interface{}{"response": map[string]interface{}{"code": 0, "value": value}}, nil
+			}
+
+			switch query.Path {
+			case "/cosmos.auth.v1beta1.Query/Account":
+				address := string(request[0].Bytes)
+				numbers, ok := accounts[address]
+				require.True(t, ok, "unexpected account query for %s", address)
+				account := protoAppendString(nil, 1, address)
+				account = protoAppendUint64(account, 3, numbers[0])
+				account = protoAppendUint64(account, 4, numbers[1])
+				anyAccount := protoAppendString(nil, 1, baseAccountTypeURL)
+				anyAccount = protoAppendBytes(anyAccount, 2, account)
+				return respond(protoAppendBytes(nil, 1, anyAccount))
+			case "/cosmos.tx.v1beta1.Service/Simulate":
+				return respond(protoAppendBytes(nil, 1, protoAppendUint64(nil, 2, 100000)))
+			case "/cosmos.feegrant.v1beta1.Query/Allowance":
+				assert.Equal(t, sponsor, string(request[0].Bytes))
+				grant, ok := grants[string(request[1].Bytes)]
+				if !ok {
+					return map[string]interface{}{"response": map[string]interface{}{"code": 38, "codespace": "sdk", "log": "fee-grant not found: not found"}}, nil
+				}
+				return respond(protoAppendBytes(nil, 1, grant))
+			}
+			t.Errorf("unexpected abci query %s", query.Path)
+			return nil, &RPCError{Code: -32603, Message: "Internal error"}
+		},
+		"broadcast_tx_sync": func(params json.RawMessage) (interface{}, *RPCError) {
+			var req map[string]string
+			require.NoError(t, json.Unmarshal(params, &req))
+			rawTx, err := base64.StdEncoding.DecodeString(req["tx"])
+			require.NoError(t, err)
+			broadcasts = append(broadcasts, rawTx)
+			hash := sha256.Sum256(rawTx)
+			return map[string]interface{}{"code": 0, "hash": strings.ToUpper(hex.EncodeToString(hash[:]))}, nil
+		},
+		"tx": func(params json.RawMessage) (interface{}, *RPCError) {
+			return map[string]interface{}{"height": "77", "tx_result": map[string]interface{}{"code": 0, "gas_used": "91000"}}, nil
+		},
+	})
+
+	config := XionConfig{
+		ChainID:         "xion-testnet-1",
+		RPCEndpoint:     server.URL,
+		GasPrice:        "0.025uxion",
+		NRNTokenAddress: "xion1nrntoken",
+		GaslessEnabled:  true,
+		FeeGranter:      sponsor,
+		Sponsorship: SponsorshipPolicy{Rules: []SponsorshipRule{
+			{Name: "xion_send", TypeURL: msgSendTypeURL},
+		}},
+		ConfirmTimeout: time.Second,
+		PollInterval:   time.Millisecond,
+	}
+	service := NewXionIntegrationService(config, keyring)
+
+	newTx := func(from string) *XionTransaction {
+		return &XionTransaction{
+			From:    from,
+			To:      to,
+			Amount:  NewAmountFromInt64(250000, xionDenomDecimals["uxion"]),
+			Denom:   "uxion",
+			Gasless: true,
+		}
+	}
+	// lastBroadcast splits the last TxRaw into its body messages and the
+	// signer's public key and fee.
+	type broadcastTx struct {
+		messages   []CosmosMsg
+		publicKey  []byte
+		feeGranter string
+		gasLimit   uint64
+	}
+	lastBroadcast := func(t *testing.T) broadcastTx {
+		require.NotEmpty(t, broadcasts)
+		raw, err := protoFields(broadcasts[len(broadcasts)-1])
+		require.NoError(t, err)
+		var out broadcastTx
+
+		body, err := protoFields(raw[0].Bytes)
+		require.NoError(t, err)
+		for _, field := range body {
+			if field.Num == 1 {
+				msg, err := decodeAny(field.Bytes)
+				require.NoError(t, err)
+				out.messages = append(out.messages, msg)
+			}
+		}
+
+		authInfo, err := protoFields(raw[1].Bytes)
+		require.NoError(t, err)
+		signerInfo, err := protoFields(authInfo[0].Bytes)
+		require.NoError(t, err)
+		pubKeyAny, err := decodeAny(signerInfo[0].Bytes)
+		require.NoError(t, err)
+		pubKey, err := protoFields(pubKeyAny.Value)
+		require.NoError(t, err)
+		out.publicKey = pubKey[0].Bytes
+
+		fee, err := protoFields(authInfo[1].Bytes)
+		require.NoError(t, err)
+		for _, field := range fee {
+			switch field.Num {
+			case 2:
+				out.gasLimit = field.Varint
+			case 4:
+				out.feeGranter = string(field.Bytes)
+			}
+		}
+		return out
+	}
+	publicKeyOf := func(key [32]byte) []byte {
+		publicKey, err := secp256k1PublicKey(key[:])
+		require.NoError(t, err)
+		return publicKey
+	}
+
+	t.Run("FeeGrant", func(t *testing.T) {
+		broadcasts = nil
+		result, err := service.SendTransaction(newTx(user))
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, sponsor, result.Sponsor)
+
+		// The meta account signs its own transfer and the granter pays
+		sent := lastBroadcast(t)
+		assert.Equal(t, []CosmosMsg{NewMsgSend(user, to, CosmosCoin{Denom: "uxion", Amount: "250000"})}, sent.messages)
+		assert.Equal(t, publicKeyOf(userKey), sent.publicKey)
+		assert.Equal(t, sponsor, sent.feeGranter)
+		assert.Equal(t, uint64(130000), sent.gasLimit)
+	})
+
+	t.Run("AuthzExec", func(t *testing.T) {
+		broadcasts = nil
+		result, err := service.SendTransaction(newTx(remote))
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, sponsor, result.Sponsor)
+
+		// The granter executes the transfer under the meta account's grant
+		// and pays for it directly
+		sent := lastBroadcast(t)
+		transfer := NewMsgSend(remote, to, CosmosCoin{Denom: "uxion", Amount: "250000"})
+		assert.Equal(t, []CosmosMsg{NewMsgExec(sponsor, transfer)}, sent.messages)
+		assert.Equal(t, publicKeyOf(sponsorKey), sent.publicKey)
+		assert.Empty(t, sent.feeGranter)
+	})
+
+	t.Run("NotSponsored", func(t *testing.T) {
+		broadcasts = nil
+		strict := NewXionIntegrationService(XionConfig{
+			ChainID:         config.ChainID,
+			RPCEndpoint:     server.URL,
+			GasPrice:        config.GasPrice,
+			NRNTokenAddress: "xion1nrntoken",
+			GaslessEnabled:  true,
+			FeeGranter:      sponsor,
+		}, keyring)
+
+		result, err := strict.SendTransaction(newTx(user))
+		assert.ErrorIs(t, err, ErrNotSponsored)
+		assert.False(t, result.Success)
+		assert.Empty(t, broadcasts)
+
+		// Paying for it is still fine
+		tx := newTx(user)
+		tx.Gasless = false
+		result, err = strict.SendTransaction(tx)
+		require.NoError(t, err)
+		assert.Empty(t, result.Sponsor)
+		assert.Empty(t, lastBroadcast(t).feeGranter)
+	})
+
+	t.Run("GaslessDisabled", func(t *testing.T) {
+		broadcasts = nil
+		disabled := config
+		disabled.GaslessEnabled = false
+		result, err := NewXionIntegrationService(disabled, keyring).SendTransaction(newTx(user))
+		assert.ErrorIs(t, err, ErrGaslessUnavailable)
+		assert.False(t, result.Success)
+
+		noGranter := config
+		noGranter.FeeGranter = ""
+		_, err = NewXionIntegrationService(noGranter, keyring).SendTransaction(newTx(user))
+		assert.ErrorIs(t, err, ErrGaslessUnavailable)
+		_, err = NewXionIntegrationService(noGranter, keyring).GetFeeAllowance(user)
+		assert.ErrorIs(t, err, ErrGaslessUnavailable)
+		assert.Empty(t, broadcasts)
+	})
+
+	t.Run("GrantFeeAllowance", func(t *testing.T) {
+		broadcasts = nil
+		daily := PeriodicAllowance{
+			Basic:            BasicAllowance{Expiration: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+			Period:           24 * time.Hour,
+			PeriodSpendLimit: []CosmosCoin{{Denom: "uxion", Amount: "50000"}},
+			PeriodCanSpend:   []CosmosCoin{{Denom: "uxion", Amount: "50000"}},
+		}
+		result, err := service.GrantFeeAllowance(user, daily)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+
+		sent := lastBroadcast(t)
+		assert.Equal(t, publicKeyOf(sponsorKey), sent.publicKey)
+		restricted := AllowedMsgAllowance{Allowance: daily, AllowedMessages: []string{msgSendTypeURL}}
+		assert.Equal(t, []CosmosMsg{NewMsgGrantAllowance(sponsor, user, restricted)}, sent.messages)
+
+		// Allowances that already restrict messages are granted as they are
+		custom := AllowedMsgAllowance{Allowance: BasicAllowance{}, AllowedMessages: []string{msgExecTypeURL}}
+		_, err = service.GrantFeeAllowance(user, custom)
+		require.NoError(t, err)
+		assert.Equal(t, []CosmosMsg{NewMsgGrantAllowance(sponsor, user, custom)}, lastBroadcast(t).messages)
+
+		_, err = service.GrantFeeAllowance("cosmos1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnrk363e", daily)
+		assert.ErrorIs(t, err, ErrInvalidAddress)
+	})
+
+	t.Run("RevokeFeeAllowance", func(t *testing.T) {
+		broadcasts = nil
+		result, err := service.RevokeFeeAllowance(user)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, []CosmosMsg{NewMsgRevokeAllowance(sponsor, user)}, lastBroadcast(t).messages)
+	})
+
+	t.Run("GetFeeAllowance", func(t *testing.T) {
+		remaining := BasicAllowance{SpendLimit: []CosmosCoin{{Denom: "uxion", Amount: "48210"}}}
+		grant := protoAppendString(nil, 1, sponsor)
+		grant = protoAppendString(grant, 2, user)
+		grant = protoAppendBytes(grant, 3, packAllowance(remaining).marshal())
+		grants[user] = grant
+
+		found, err := service.GetFeeAllowance(user)
+		require.NoError(t, err)
+		assert.Equal(t, &FeeGrant{Granter: sponsor, Grantee: user, Allowance: remaining}, found)
+
+		_, err = service.GetFeeAllowance(remote)
+		assert.ErrorIs(t, err, ErrAllowanceNotFound)
+	})
+}